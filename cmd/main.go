@@ -3,44 +3,169 @@ package main
 import (
 	"context"
 	"github.com/crypto_app/middlewhare"
+	"github.com/crypto_app/pkg/config"
 	"github.com/crypto_app/pkg/crypto_app"
+	"github.com/crypto_app/pkg/emaildomain"
+	"github.com/crypto_app/pkg/keyring"
+	"github.com/crypto_app/pkg/limiter"
+	"github.com/crypto_app/pkg/mailer"
+	"github.com/crypto_app/pkg/rates"
+	"github.com/crypto_app/pkg/reconcile"
+	"github.com/crypto_app/pkg/revocation"
+	"github.com/crypto_app/pkg/storage"
 	"github.com/crypto_app/service"
 	"github.com/crypto_app/service/httpserver"
 	"github.com/crypto_app/tools/db"
 	"log"
-	"math/rand"
 	"net/http"
-	"time"
+	"os"
 )
 
-func init() {
-	rand.Seed(time.Now().UnixNano())
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		runReconcile(os.Args[2:])
+		return
+	}
+	runServer(os.Args[1:])
 }
 
-const (
-	serverPort = "8080"
-	login      = "postgres"
-	pass       = "somepass"
-	name       = "postgres"
-	host       = "127.0.0.1"
-	dbPort     = uint16(5432)
-)
+func runServer(args []string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-func main() {
-	ctx := context.Background()
+	cfg, err := config.Load(args)
+	if err != nil {
+		log.Fatalf("error while loading config: %v", err)
+	}
+	log.Printf("effective config:\n%s", cfg)
+
+	keys, err := keyring.New(cfg.JWT.Keys, cfg.JWT.CurrentKid)
+	if err != nil {
+		log.Fatalf("error while loading jwt keys: %v", err)
+	}
+
+	var (
+		store    storage.Storage
+		revoked  revocation.Store
+		attempts limiter.Store
+	)
+	switch cfg.Storage {
+	case config.StorageMemory:
+		log.Printf("the data is kept in memory and is lost on restart")
+		store = storage.NewMemoryStorage()
+		revoked = revocation.NewMemoryStore()
+		attempts = limiter.NewMemoryStore()
+	default:
+		if err = checkSchema(ctx, cfg); err != nil {
+			log.Fatalf("error while checking the database schema: %v", err)
+		}
+
+		dbConfig := newDbConfig(cfg)
+		// the package slices are copied, appending to them must not write into their spare capacity
+		dbConfig.CachedStatements = append(append([]string(nil), storage.CachedStatements...), revocation.CachedStatements...)
+		dbConfig.CachedStatements = append(dbConfig.CachedStatements, limiter.CachedStatements...)
+		dbAdp, err := db.NewDbConnector(ctx, dbConfig)
+		if err != nil {
+			log.Fatalf("error while connecting to db: %v", err)
+		}
+		defer dbAdp.Close()
+
+		store = storage.NewPostgresStorage(dbAdp)
+		revoked = revocation.NewPostgresStore(dbAdp)
+		attempts = limiter.NewPostgresStore(dbAdp)
+	}
+
+	if cfg.Rates.Source != "" {
+		provider, err := rates.NewProvider(cfg.Rates.Source, cfg.Rates.Timeout)
+		if err != nil {
+			log.Fatalf("error while creating the rate provider: %v", err)
+		}
+		go rates.NewRefresher(provider, store, cfg.Rates.RefreshPeriod).Run(ctx)
+	} else {
+		log.Printf("rates source is not configured, the transfers stop once the saved rates get stale")
+	}
+
+	if cfg.Ledger.ReconcilePeriod > 0 {
+		go reconcile.NewReconciler(store, cfg.Ledger.ReconcilePeriod).Run(ctx)
+	}
+
+	mail, err := mailer.New(mailer.Settings{
+		Transport: cfg.Mail.Transport,
+		From:      cfg.Mail.From,
+		File:      cfg.Mail.File,
+		SMTPHost:  cfg.Mail.SMTP.Host,
+		SMTPPort:  cfg.Mail.SMTP.Port,
+		SMTPUser:  cfg.Mail.SMTP.User,
+		SMTPPass:  cfg.Mail.SMTP.Pass,
+	})
+	if err != nil {
+		log.Fatalf("error while creating the mailer: %v", err)
+	}
 
-	dbAdp, err := db.NewDbConnector(ctx, login, pass, host, name, dbPort)
+	domains, err := emaildomain.New(emaildomain.Settings{
+		Kind:     cfg.Email.DomainCheck,
+		Timeout:  cfg.Email.DomainCheckTimeout,
+		CacheTTL: cfg.Email.DomainCacheTTL,
+	})
 	if err != nil {
-		log.Fatalf("error while connecting to db: %v", err)
+		log.Fatalf("error while creating the email domain checker: %v", err)
+	}
+
+	limiters := crypto_app.Limiters{
+		Accounts:      limiter.NewLimiter(attempts, "email:", newPolicy(cfg.Login.Account)),
+		Clients:       limiter.NewLimiter(attempts, "ip:", newPolicy(cfg.Login.Client)),
+		TransferCodes: limiter.NewLimiter(attempts, "otp:", crypto_app.TransferCodePolicy),
 	}
-	defer dbAdp.Close()
 
-	crypto := crypto_app.NewCrypto(dbAdp)
+	crypto := crypto_app.NewCrypto(store, revoked, keys, mail, domains, limiters, crypto_app.Settings{
+		Commission:           cfg.Crypto.Commission,
+		DefaultBalance:       cfg.Crypto.DefaultBalance,
+		BcryptCost:           cfg.Crypto.BcryptCost,
+		RateMaxAge:           cfg.Rates.MaxAge,
+		PasswordResetTTL:     cfg.Crypto.PasswordResetTTL,
+		PasswordResetURL:     cfg.Mail.ResetURL,
+		EmailVerificationTTL: cfg.Crypto.EmailVerificationTTL,
+		EmailVerificationURL: cfg.Mail.VerifyURL,
+		MFAIssuer:            cfg.Crypto.MFA.Issuer,
+		MFAChallengeTTL:      cfg.Crypto.MFA.ChallengeTTL,
+		MFATransferThreshold: cfg.Crypto.MFA.TransferThreshold,
+	})
 	svc := service.NewService(crypto)
 
 	router := httpserver.NewPreparedServer(svc)
 	http.Handle("/", router)
 
-	log.Printf("server starting on port: %s", serverPort)
-	log.Fatal(http.ListenAndServe(":"+serverPort, middlewhare.ExampleMiddleware(router)))
+	handler := middlewhare.AuthMiddleware(keys, revoked)(router)
+	handler = middlewhare.ClientIPMiddleware(cfg.Server.TrustProxy)(handler)
+	handler = middlewhare.CORSMiddleware(cfg.CORS.AllowedOrigins)(handler)
+
+	log.Printf("server starting on port: %s", cfg.Server.Port)
+	log.Fatal(http.ListenAndServe(":"+cfg.Server.Port, handler))
+}
+
+func newPolicy(cfg config.LimitConfig) limiter.Policy {
+	return limiter.Policy{
+		FreeAttempts:    cfg.FreeAttempts,
+		LockoutAttempts: cfg.LockoutAttempts,
+		BaseDelay:       cfg.BaseDelay,
+		LockoutDuration: cfg.LockoutDuration,
+		Window:          cfg.Window,
+	}
+}
+
+func newDbConfig(cfg config.Config) db.Config {
+	return db.Config{
+		Login:             cfg.DB.Login,
+		Pass:              cfg.DB.Pass,
+		Host:              cfg.DB.Host,
+		Name:              cfg.DB.Name,
+		Port:              uint16(cfg.DB.Port),
+		MaxConnections:    cfg.DB.MaxConnections,
+		AcquireTimeout:    cfg.DB.AcquireTimeout,
+		HealthCheckPeriod: cfg.DB.HealthCheckPeriod,
+	}
 }
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/crypto_app/migrations"
+	"github.com/crypto_app/pkg/config"
+	"github.com/crypto_app/tools/db"
+	"github.com/crypto_app/tools/migrate"
+	"log"
+	"strconv"
+	"strings"
+)
+
+const migrateUsage = "usage: crypto migrate up [N] | down [N] | status | force VERSION [flags]"
+
+// runMigrate handles the migrate subcommand, the config flags go after the action and its argument
+func runMigrate(args []string) {
+	var positional []string
+	for len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	if len(positional) == 0 || len(positional) > 2 {
+		log.Fatal(migrateUsage)
+	}
+
+	var (
+		number int64
+		err    error
+	)
+	if len(positional) == 2 {
+		if number, err = strconv.ParseInt(positional[1], 10, 64); err != nil || number < 0 {
+			log.Fatalf("bad number %q: %s", positional[1], migrateUsage)
+		}
+	}
+
+	cfg, err := config.Load(args)
+	if err != nil {
+		log.Fatalf("error while loading config: %v", err)
+	}
+
+	ctx := context.Background()
+	// the statements are not cached here, the tables they use may not exist yet
+	dbAdp, err := db.NewDbConnector(ctx, newDbConfig(cfg))
+	if err != nil {
+		log.Fatalf("error while connecting to db: %v", err)
+	}
+	defer dbAdp.Close()
+
+	migrator, err := migrate.NewMigrator(dbAdp, migrations.FS)
+	if err != nil {
+		log.Fatalf("error while loading migrations: %v", err)
+	}
+
+	switch positional[0] {
+	case "up":
+		var applied []migrate.Migration
+		applied, err = migrator.Up(ctx, int(number))
+		log.Printf("applied %d migrations", len(applied))
+	case "down":
+		if len(positional) == 1 {
+			number = 1
+		}
+		var rolledBack []migrate.Migration
+		rolledBack, err = migrator.Down(ctx, int(number))
+		log.Printf("rolled back %d migrations", len(rolledBack))
+	case "status":
+		var statuses []migrate.Status
+		statuses, err = migrator.Status(ctx)
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied at " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d %-40s %s\n", status.Version, status.Name, state)
+		}
+	case "force":
+		if len(positional) != 2 {
+			log.Fatal(migrateUsage)
+		}
+		if err = migrator.Force(ctx, number); err == nil {
+			log.Printf("forced version %d", number)
+		}
+	default:
+		log.Fatal(migrateUsage)
+	}
+
+	if err != nil {
+		log.Fatalf("migrate %s failed: %v", positional[0], err)
+	}
+}
+
+// checkSchema refuses to start the server on the database with the pending migrations. The pool is not the one
+// of the server, the statements it prepares on connect would fail on the missing tables first.
+func checkSchema(ctx context.Context, cfg config.Config) error {
+	dbAdp, err := db.NewDbConnector(ctx, newDbConfig(cfg))
+	if err != nil {
+		return err
+	}
+	defer dbAdp.Close()
+
+	migrator, err := migrate.NewMigrator(dbAdp, migrations.FS)
+	if err != nil {
+		return err
+	}
+	return migrator.Check(ctx)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/crypto_app/pkg/config"
+	"github.com/crypto_app/pkg/reconcile"
+	"github.com/crypto_app/pkg/storage"
+	"github.com/crypto_app/tools/db"
+	"log"
+	"os"
+)
+
+// exitDiscrepancies the exit code of the reconcile subcommand when the ledger has discrepancies,
+// the failed check exits with 1
+const exitDiscrepancies = 2
+
+// runReconcile handles the reconcile subcommand, it prints the JSON report to stdout
+func runReconcile(args []string) {
+	cfg, err := config.Load(args)
+	if err != nil {
+		log.Fatalf("error while loading config: %v", err)
+	}
+	if cfg.Storage != config.StoragePostgres {
+		log.Fatalf("reconcile needs the %s storage, the %s one is empty in the new process",
+			config.StoragePostgres, cfg.Storage)
+	}
+
+	ctx := context.Background()
+	dbAdp, err := db.NewDbConnector(ctx, newDbConfig(cfg))
+	if err != nil {
+		log.Fatalf("error while connecting to db: %v", err)
+	}
+	defer dbAdp.Close()
+
+	report, err := reconcile.NewReconciler(storage.NewPostgresStorage(dbAdp), 0).Reconcile(ctx)
+	if err != nil {
+		log.Fatalf("reconcile failed: %v", err)
+	}
+
+	out, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.Fatalf("error while encoding the report: %v", err)
+	}
+	os.Stdout.Write(append(out, '\n'))
+
+	if !report.OK {
+		log.Printf("the ledger has %d discrepancies", len(report.Discrepancies))
+		dbAdp.Close()
+		os.Exit(exitDiscrepancies)
+	}
+}
@@ -0,0 +1,32 @@
+package middlewhare
+
+import (
+	"context"
+	"github.com/crypto_app/pkg/models"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIPMiddleware puts the address of the client into the context as models.CtxKey("ip"). Behind the proxy
+// the address is the last one of X-Forwarded-For, the one the proxy appended, so trustProxy is set only when
+// the server is not reachable bypassing the proxy, otherwise the client picks any address it likes.
+func ClientIPMiddleware(trustProxy bool) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				ip = r.RemoteAddr
+			}
+
+			if forwarded := r.Header.Get("X-Forwarded-For"); trustProxy && forwarded != "" {
+				hops := strings.Split(forwarded, ",")
+				if last := strings.TrimSpace(hops[len(hops)-1]); net.ParseIP(last) != nil {
+					ip = last
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), models.CtxKey("ip"), ip)))
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package middlewhare
+
+import (
+	"github.com/crypto_app/pkg/models"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPMiddleware(t *testing.T) {
+	for _, c := range []struct {
+		name       string
+		trustProxy bool
+		remoteAddr string
+		forwarded  string
+		expected   string
+	}{
+		{"remote address", false, "192.0.2.1:1234", "", "192.0.2.1"},
+		{"remote address without port", false, "192.0.2.1", "", "192.0.2.1"},
+		{"untrusted proxy", false, "192.0.2.1:1234", "198.51.100.7", "192.0.2.1"},
+		{"trusted proxy", true, "192.0.2.1:1234", "198.51.100.7", "198.51.100.7"},
+		// the client sends any hops it likes, only the one the proxy appended counts
+		{"hop appended by the proxy", true, "192.0.2.1:1234", "203.0.113.9, 198.51.100.7", "198.51.100.7"},
+		{"garbage hop", true, "192.0.2.1:1234", "198.51.100.7, unknown", "192.0.2.1"},
+		{"no header behind the proxy", true, "192.0.2.1:1234", "", "192.0.2.1"},
+	} {
+		var ip interface{}
+		handler := ClientIPMiddleware(c.trustProxy)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip = r.Context().Value(models.CtxKey("ip"))
+		}))
+
+		r := httptest.NewRequest(http.MethodPost, "/login", nil)
+		r.RemoteAddr = c.remoteAddr
+		if c.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", c.forwarded)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		require.Equal(t, c.expected, ip, c.name)
+	}
+}
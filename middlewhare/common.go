@@ -4,48 +4,83 @@ import (
 	"context"
 	"errors"
 	"github.com/dgrijalva/jwt-go"
+	"github.com/crypto_app/pkg/keyring"
 	"github.com/crypto_app/pkg/models"
+	"github.com/crypto_app/pkg/revocation"
 	"github.com/crypto_app/tools"
 	"net/http"
 	"strings"
+	"time"
 )
 
 const (
 	auth = "Authorization"
+	// adminPrefix the routes under it are allowed only to the admin tokens
+	adminPrefix = "/crypto/admin/"
 )
 
 var (
 	publicAPI = [][]string{
 		{"POST", "/crypto/register"},
 		{"POST", "/crypto/log_in"},
+		{"POST", "/crypto/log_in/mfa"},
+		{"POST", "/crypto/token/refresh"},
+		{"POST", "/crypto/password/forgot"},
+		{"POST", "/crypto/password/reset"},
+		{"POST", "/crypto/email/verify"},
+		{"GET", "/crypto/.well-known/jwks.json"},
 	}
 )
 
-func ExampleMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Our middleware logic goes here...
-		if isRoutePublic(r.Method, r.URL.Path) {
-			next.ServeHTTP(w, r)
-			return
-		}
+// AuthMiddleware checks the access token of every non public route and rejects the revoked ones
+func AuthMiddleware(keys *keyring.Keyring, revoked revocation.Store) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isRoutePublic(r.Method, r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
 
-		p := strings.Split(r.Header.Get(auth), " ")
-		if len(p) != 2 || p[0] != "Bearer" {
-			err := tools.NewErrorMessage(errors.New("bad token format"), "Неправильный формат токена",
-				http.StatusUnauthorized)
-			tools.EncodeIntoResponseWriter(w, err)
-			return
-		}
+			p := strings.Split(r.Header.Get(auth), " ")
+			if len(p) != 2 || p[0] != "Bearer" {
+				err := tools.NewErrorMessage(errors.New("bad token format"), "Неправильный формат токена",
+					http.StatusUnauthorized)
+				tools.EncodeIntoResponseWriter(w, err)
+				return
+			}
 
-		userID, err := checkTheTokenValidness(p[1])
-		if err != nil {
-			tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
-			return
-		}
-		ctx := context.WithValue(r.Context(), models.CtxKey("id"), userID)
-		r = r.WithContext(ctx)
-		next.ServeHTTP(w, r)
-	})
+			claims, err := checkTheTokenValidness(keys, p[1])
+			if err != nil {
+				tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+				return
+			}
+
+			isRevoked, err := revoked.IsRevoked(r.Context(), claims.Id, claims.ID, time.Unix(claims.IssuedAt, 0))
+			if err != nil {
+				tools.EncodeIntoResponseWriter(w, tools.NewErrorMessage(err, "Ошибка при проверке токена",
+					http.StatusInternalServerError))
+				return
+			}
+			if isRevoked {
+				tools.EncodeIntoResponseWriter(w, tools.NewErrorMessage(errors.New("token is revoked"),
+					"Токен отозван", http.StatusUnauthorized))
+				return
+			}
+
+			if strings.HasPrefix(r.URL.Path, adminPrefix) && !claims.Admin {
+				tools.EncodeIntoResponseWriter(w, tools.NewErrorMessage(errors.New("not an admin"),
+					"Недостаточно прав", http.StatusForbidden))
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), models.CtxKey("id"), claims.ID)
+			ctx = context.WithValue(ctx, models.CtxKey("jti"), claims.Id)
+			ctx = context.WithValue(ctx, models.CtxKey("sid"), claims.SessionID)
+			ctx = context.WithValue(ctx, models.CtxKey("exp"), time.Unix(claims.ExpiresAt, 0))
+			r = r.WithContext(ctx)
+			next.ServeHTTP(w, r)
+		})
+	}
 }
 
 func isRoutePublic(method, url string) (response bool) {
@@ -62,22 +97,20 @@ func isRoutePublic(method, url string) (response bool) {
 	return false
 }
 
-func checkTheTokenValidness(tokenString string) (userID string, err error) {
+func checkTheTokenValidness(keys *keyring.Keyring, tokenString string) (claims *models.ClaimWithID, err error) {
 	const (
 		tokenInvalidErr = "token is invalid"
 	)
 
-	token, err := jwt.ParseWithClaims(tokenString, &models.ClaimWithID{}, func(token *jwt.Token) (interface{}, error) {
-		return models.JwtSigningKey, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &models.ClaimWithID{}, keys.Keyfunc)
 
 	if err != nil {
 		err = tools.NewErrorMessage(err, "Некорректный токен", http.StatusUnauthorized)
 		return
 	}
 
-	if claims, ok := token.Claims.(*models.ClaimWithID); ok && token.Valid {
-		userID = claims.ID
+	if c, ok := token.Claims.(*models.ClaimWithID); ok && token.Valid {
+		claims = c
 		return
 	} else {
 		err = tools.NewErrorMessage(errors.New(tokenInvalidErr), "Некорректный токен", http.StatusUnauthorized)
@@ -0,0 +1,95 @@
+package middlewhare
+
+import (
+	"context"
+	"github.com/crypto_app/pkg/keyring"
+	"github.com/crypto_app/pkg/models"
+	"github.com/crypto_app/pkg/revocation"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func signTestToken(t *testing.T, keys *keyring.Keyring, userID string, jti string, issuedAt time.Time) string {
+	t.Helper()
+	return signTestTokenAs(t, keys, userID, jti, issuedAt, false)
+}
+
+func signTestTokenAs(t *testing.T, keys *keyring.Keyring, userID string, jti string, issuedAt time.Time,
+	admin bool) string {
+	t.Helper()
+	token, err := keys.Sign(models.ClaimWithID{
+		ID:        userID,
+		SessionID: "session",
+		Admin:     admin,
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			IssuedAt:  issuedAt.Unix(),
+			ExpiresAt: issuedAt.Add(time.Hour).Unix(),
+		},
+	})
+	require.NoError(t, err)
+	return token
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	keys, err := keyring.New("current:HS256:secret", "")
+	require.NoError(t, err)
+	otherKeys, err := keyring.New("current:HS256:other-secret", "")
+	require.NoError(t, err)
+	revoked := revocation.NewMemoryStore()
+	require.NoError(t, revoked.Revoke(ctx, "revoked", now.Add(time.Hour)))
+	require.NoError(t, revoked.RevokeUser(ctx, "2", now, now.Add(time.Hour)))
+
+	var userID interface{}
+	handler := AuthMiddleware(keys, revoked)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID = r.Context().Value(models.CtxKey("id"))
+	}))
+
+	for _, c := range []struct {
+		name   string
+		method string
+		path   string
+		auth   string
+		code   int
+		userID interface{}
+	}{
+		{"public route", "POST", "/crypto/log_in", "", http.StatusOK, nil},
+		{"jwks", "GET", "/crypto/.well-known/jwks.json", "", http.StatusOK, nil},
+		{"no token", "GET", "/crypto/wallet", "", http.StatusUnauthorized, nil},
+		{"bad format", "GET", "/crypto/wallet", "Token abc", http.StatusUnauthorized, nil},
+		{"bad signature", "GET", "/crypto/wallet", "Bearer abc.def.ghi", http.StatusUnauthorized, nil},
+		{"valid token", "GET", "/crypto/wallet", "Bearer " + signTestToken(t, keys, "1", "jti", now),
+			http.StatusOK, "1"},
+		{"token of another key", "GET", "/crypto/wallet", "Bearer " + signTestToken(t, otherKeys, "1", "jti", now),
+			http.StatusUnauthorized, nil},
+		{"revoked token", "GET", "/crypto/wallet", "Bearer " + signTestToken(t, keys, "1", "revoked", now),
+			http.StatusUnauthorized, nil},
+		{"token issued before revoke all", "GET", "/crypto/wallet",
+			"Bearer " + signTestToken(t, keys, "2", "jti", now.Add(-time.Minute)), http.StatusUnauthorized, nil},
+		{"admin route", "PUT", "/crypto/admin/rates",
+			"Bearer " + signTestTokenAs(t, keys, "1", "jti", now, true), http.StatusOK, "1"},
+		{"admin route without admin", "PUT", "/crypto/admin/rates",
+			"Bearer " + signTestToken(t, keys, "1", "jti", now), http.StatusForbidden, nil},
+		// the state of the pool is not public
+		{"db stats without token", "GET", "/crypto/admin/db/stats", "", http.StatusUnauthorized, nil},
+		{"db stats without admin", "GET", "/crypto/admin/db/stats",
+			"Bearer " + signTestToken(t, keys, "1", "jti", now), http.StatusForbidden, nil},
+	} {
+		userID = nil
+		r := httptest.NewRequest(c.method, c.path, nil)
+		if c.auth != "" {
+			r.Header.Set(auth, c.auth)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		require.Equal(t, c.code, w.Code, c.name)
+		require.Equal(t, c.userID, userID, c.name)
+	}
+}
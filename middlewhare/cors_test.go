@@ -0,0 +1,53 @@
+package middlewhare
+
+import (
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	var reached bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	})
+
+	for _, c := range []struct {
+		name        string
+		allowed     []string
+		method      string
+		origin      string
+		preflight   bool
+		allowOrigin string
+		code        int
+		reached     bool
+	}{
+		{"no origin", []string{"https://app.example.com"}, "GET", "", false, "", http.StatusOK, true},
+		{"allowed origin", []string{"https://app.example.com"}, "GET", "https://app.example.com", false,
+			"https://app.example.com", http.StatusOK, true},
+		{"other origin", []string{"https://app.example.com"}, "GET", "https://evil.example.com", false,
+			"", http.StatusOK, true},
+		{"any origin", []string{"*"}, "GET", "https://evil.example.com", false,
+			"https://evil.example.com", http.StatusOK, true},
+		{"preflight", []string{"https://app.example.com"}, "OPTIONS", "https://app.example.com", true,
+			"https://app.example.com", http.StatusNoContent, false},
+		{"options without preflight header", []string{"https://app.example.com"}, "OPTIONS",
+			"https://app.example.com", false, "https://app.example.com", http.StatusOK, true},
+	} {
+		reached = false
+		r := httptest.NewRequest(c.method, "/crypto/wallet", nil)
+		if c.origin != "" {
+			r.Header.Set("Origin", c.origin)
+		}
+		if c.preflight {
+			r.Header.Set("Access-Control-Request-Method", "POST")
+		}
+		w := httptest.NewRecorder()
+		CORSMiddleware(c.allowed)(next).ServeHTTP(w, r)
+
+		require.Equal(t, c.code, w.Code, c.name)
+		require.Equal(t, c.allowOrigin, w.Header().Get("Access-Control-Allow-Origin"), c.name)
+		require.Equal(t, c.reached, reached, c.name)
+	}
+}
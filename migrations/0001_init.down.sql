@@ -0,0 +1,9 @@
+drop function make_transaction(integer, integer, float, float);
+
+drop table transactions;
+
+drop table addresses;
+
+drop table salary;
+
+drop table user_data;
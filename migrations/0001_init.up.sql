@@ -138,4 +138,4 @@ begin
         values(first_address_id,last_address_id,amount,commission, last_update is not null) returning successful
             into response;
     return query (select response as response);
-end; $$
\ No newline at end of file
+end; $$;
@@ -0,0 +1,22 @@
+-- create table to store refresh tokens, tokens issued one after another share the family
+create table refresh_tokens
+(
+	id serial not null
+		constraint refresh_tokens_pk
+			primary key,
+	user_id integer not null
+		constraint refresh_tokens_user_data_id_fk
+			references user_data,
+	family_id varchar(64) not null,
+	token_hash varchar(64) not null,
+	expires_at timestamp not null,
+	used_at timestamp,
+	revoked bool default false not null,
+	create_at timestamp default current_timestamp not null
+);
+
+create unique index refresh_tokens_token_hash_uindex
+	on refresh_tokens (token_hash);
+
+create index refresh_tokens_family_id_index
+	on refresh_tokens (family_id);
@@ -0,0 +1,3 @@
+drop table revoked_users;
+
+drop table revoked_tokens;
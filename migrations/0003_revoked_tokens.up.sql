@@ -0,0 +1,17 @@
+-- create tables to store revoked access tokens until they expire
+create table revoked_tokens
+(
+	jti varchar(64) not null
+		constraint revoked_tokens_pk
+			primary key,
+	expires_at timestamptz not null
+);
+
+create table revoked_users
+(
+	user_id varchar(64) not null
+		constraint revoked_users_pk
+			primary key,
+	issued_before timestamptz not null,
+	expires_at timestamptz not null
+);
@@ -0,0 +1,42 @@
+alter table transactions drop column sender_id;
+
+alter table transactions drop column recipient_id;
+
+-- restore the function which does not record the sender and the recipient
+create or replace function make_transaction (
+    first_address_id integer,
+    last_address_id integer ,
+    amount float ,
+    commission float
+)
+returns table (
+	response bool
+)
+language plpgsql
+as $$
+declare
+    first_update integer;
+    last_update integer;
+    firstCost float;
+    lastCost float;
+begin
+    select s.cost from addresses as a
+        left join salary s on a.salary_id = s.id
+    where a.id = first_address_id into firstCost;
+    select s.cost from addresses as a
+        left join salary s on a.salary_id = s.id
+    where a.id = last_address_id into lastCost;
+
+    PERFORM balance from addresses where id = first_address_id OR id = last_address_id for update;
+    UPDATE addresses SET balance = balance - (amount/firstCost)/(1 - commission) WHERE id = first_address_id
+            and balance >= (amount / firstCost)/(1 - commission)
+    RETURNING id into first_update;
+    UPDATE addresses SET balance = balance + (amount/lastCost)  WHERE id = last_address_id and
+            first_update is not null
+    returning id into last_update;
+
+    INSERT INTO transactions (from_address, to_address, amount_dollars, commission, successful)
+        values(first_address_id,last_address_id,amount,commission, last_update is not null) returning successful
+            into response;
+    return query (select response as response);
+end; $$;
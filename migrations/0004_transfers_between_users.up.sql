@@ -0,0 +1,60 @@
+-- store the sender and the recipient of the transaction, so both sides see the transfer between different users
+alter table transactions
+	add sender_id integer
+		constraint transactions_user_data_id_fk
+			references user_data;
+
+alter table transactions
+	add recipient_id integer
+		constraint transactions_user_data_id_fk_2
+			references user_data;
+
+update transactions as t set sender_id = a_from.user_id, recipient_id = a_to.user_id
+	from addresses as a_from, addresses as a_to
+where a_from.id = t.from_address and a_to.id = t.to_address;
+
+create index transactions_sender_id_index
+	on transactions (sender_id);
+
+create index transactions_recipient_id_index
+	on transactions (recipient_id);
+
+create or replace function make_transaction (
+    first_address_id integer,
+    last_address_id integer ,
+    amount float ,
+    commission float
+)
+returns table (
+	response bool
+)
+language plpgsql
+as $$
+declare
+    first_update integer;
+    last_update integer;
+    firstCost float;
+    lastCost float;
+    sender integer;
+    recipient integer;
+begin
+    select s.cost, a.user_id from addresses as a
+        left join salary s on a.salary_id = s.id
+    where a.id = first_address_id into firstCost, sender;
+    select s.cost, a.user_id from addresses as a
+        left join salary s on a.salary_id = s.id
+    where a.id = last_address_id into lastCost, recipient;
+
+    PERFORM balance from addresses where id = first_address_id OR id = last_address_id for update;
+    UPDATE addresses SET balance = balance - (amount/firstCost)/(1 - commission) WHERE id = first_address_id
+            and balance >= (amount / firstCost)/(1 - commission)
+    RETURNING id into first_update;
+    UPDATE addresses SET balance = balance + (amount/lastCost)  WHERE id = last_address_id and
+            first_update is not null
+    returning id into last_update;
+
+    INSERT INTO transactions (from_address, to_address, amount_dollars, commission, successful, sender_id, recipient_id)
+        values(first_address_id,last_address_id,amount,commission, last_update is not null, sender, recipient)
+        returning successful into response;
+    return query (select response as response);
+end; $$;
@@ -0,0 +1,13 @@
+-- create table to store idempotency keys of the transactions together with their outcome
+create table idempotency_keys
+(
+	user_id integer not null
+		constraint idempotency_keys_user_data_id_fk
+			references user_data,
+	key varchar(255) not null,
+	fingerprint varchar(64) not null,
+	success bool default false not null,
+	create_at timestamp default current_timestamp not null,
+	constraint idempotency_keys_pk
+		primary key (user_id, key)
+);
@@ -0,0 +1,54 @@
+drop function make_transaction(integer, integer, numeric, numeric);
+
+drop function ceil_scale(numeric, integer);
+
+alter table transactions alter column commission type float using commission::float;
+
+alter table transactions alter column amount_dollars type float using amount_dollars::float;
+
+alter table addresses alter column balance type float using balance::float;
+
+alter table salary alter column cost type float using cost::float;
+
+alter table salary drop column scale;
+
+-- restore the float version of the function
+create or replace function make_transaction (
+    first_address_id integer,
+    last_address_id integer ,
+    amount float ,
+    commission float
+)
+returns table (
+	response bool
+)
+language plpgsql
+as $$
+declare
+    first_update integer;
+    last_update integer;
+    firstCost float;
+    lastCost float;
+    sender integer;
+    recipient integer;
+begin
+    select s.cost, a.user_id from addresses as a
+        left join salary s on a.salary_id = s.id
+    where a.id = first_address_id into firstCost, sender;
+    select s.cost, a.user_id from addresses as a
+        left join salary s on a.salary_id = s.id
+    where a.id = last_address_id into lastCost, recipient;
+
+    PERFORM balance from addresses where id = first_address_id OR id = last_address_id for update;
+    UPDATE addresses SET balance = balance - (amount/firstCost)/(1 - commission) WHERE id = first_address_id
+            and balance >= (amount / firstCost)/(1 - commission)
+    RETURNING id into first_update;
+    UPDATE addresses SET balance = balance + (amount/lastCost)  WHERE id = last_address_id and
+            first_update is not null
+    returning id into last_update;
+
+    INSERT INTO transactions (from_address, to_address, amount_dollars, commission, successful, sender_id, recipient_id)
+        values(first_address_id,last_address_id,amount,commission, last_update is not null, sender, recipient)
+        returning successful into response;
+    return query (select response as response);
+end; $$;
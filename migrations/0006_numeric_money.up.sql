@@ -0,0 +1,79 @@
+-- keep money in exact numeric types, crypto amounts are stored with the scale of their currency,
+-- dollar amounts with 2 decimals
+alter table salary
+	add scale integer default 8 not null;
+
+update salary set scale = 8 where name = 'BTC';
+update salary set scale = 18 where name = 'ETH';
+
+alter table salary alter column cost type numeric(30, 8) using cost::numeric(30, 8);
+
+alter table addresses alter column balance type numeric(38, 18) using balance::numeric(38, 18);
+
+update addresses as a set balance = trunc(a.balance, s.scale)
+	from salary as s
+where s.id = a.salary_id;
+
+alter table transactions alter column amount_dollars type numeric(20, 2) using amount_dollars::numeric(20, 2);
+
+alter table transactions alter column commission type numeric(10, 8) using commission::numeric(10, 8);
+
+-- ceil_scale rounds the value up to the given number of decimals
+create or replace function ceil_scale (
+    x numeric,
+    s integer
+)
+returns numeric
+language sql
+immutable
+as $$
+    select case when trunc(x, s) < x then trunc(x, s) + power(10::numeric, -s) else trunc(x, s) end;
+$$;
+
+drop function make_transaction(integer, integer, float, float);
+
+create or replace function make_transaction (
+    first_address_id integer,
+    last_address_id integer,
+    amount numeric,
+    commission numeric
+)
+returns table (
+	response bool
+)
+language plpgsql
+as $$
+declare
+    first_update integer;
+    last_update integer;
+    firstCost numeric;
+    lastCost numeric;
+    firstScale integer;
+    lastScale integer;
+    debit numeric;
+    credit numeric;
+    sender integer;
+    recipient integer;
+begin
+    select s.cost, s.scale, a.user_id from addresses as a
+        left join salary s on a.salary_id = s.id
+    where a.id = first_address_id into firstCost, firstScale, sender;
+    select s.cost, s.scale, a.user_id from addresses as a
+        left join salary s on a.salary_id = s.id
+    where a.id = last_address_id into lastCost, lastScale, recipient;
+
+    -- the debit is rounded up and the credit is rounded down, so rounding never creates money
+    debit := ceil_scale(amount::numeric(60, 24) / firstCost / (1 - commission), firstScale);
+    credit := trunc(amount::numeric(60, 24) / lastCost, lastScale);
+
+    PERFORM balance from addresses where id = first_address_id OR id = last_address_id for update;
+    UPDATE addresses SET balance = balance - debit WHERE id = first_address_id and balance >= debit
+    RETURNING id into first_update;
+    UPDATE addresses SET balance = balance + credit WHERE id = last_address_id and first_update is not null
+    returning id into last_update;
+
+    INSERT INTO transactions (from_address, to_address, amount_dollars, commission, successful, sender_id, recipient_id)
+        values(first_address_id,last_address_id,amount,commission, last_update is not null, sender, recipient)
+        returning successful into response;
+    return query (select response as response);
+end; $$;
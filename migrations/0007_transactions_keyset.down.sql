@@ -0,0 +1,11 @@
+create index transactions_sender_id_index
+	on transactions (sender_id);
+
+create index transactions_recipient_id_index
+	on transactions (recipient_id);
+
+drop index transactions_sender_id_create_at_id_index;
+
+drop index transactions_recipient_id_create_at_id_index;
+
+alter table transactions drop column id;
@@ -0,0 +1,17 @@
+-- the transactions get the id, so the list is paginated by (create_at, id) instead of the offset
+alter table transactions
+	add id bigserial not null;
+
+alter table transactions
+	add constraint transactions_pk
+		primary key (id);
+
+create index transactions_sender_id_create_at_id_index
+	on transactions (sender_id, create_at desc, id desc);
+
+create index transactions_recipient_id_create_at_id_index
+	on transactions (recipient_id, create_at desc, id desc);
+
+drop index transactions_sender_id_index;
+
+drop index transactions_recipient_id_index;
@@ -0,0 +1,66 @@
+drop function make_transfer(uuid, integer, integer, numeric, numeric);
+
+alter table idempotency_keys drop column transaction_id;
+
+alter table transactions drop column failure_reason;
+
+alter table transactions drop column fee;
+
+alter table transactions drop column credited;
+
+alter table transactions drop column debited;
+
+alter table transactions drop column to_rate;
+
+alter table transactions drop column from_rate;
+
+drop index transactions_public_id_uindex;
+
+alter table transactions drop column public_id;
+
+-- restore the function which does not save the details
+create or replace function make_transaction (
+    first_address_id integer,
+    last_address_id integer,
+    amount numeric,
+    commission numeric
+)
+returns table (
+	response bool
+)
+language plpgsql
+as $$
+declare
+    first_update integer;
+    last_update integer;
+    firstCost numeric;
+    lastCost numeric;
+    firstScale integer;
+    lastScale integer;
+    debit numeric;
+    credit numeric;
+    sender integer;
+    recipient integer;
+begin
+    select s.cost, s.scale, a.user_id from addresses as a
+        left join salary s on a.salary_id = s.id
+    where a.id = first_address_id into firstCost, firstScale, sender;
+    select s.cost, s.scale, a.user_id from addresses as a
+        left join salary s on a.salary_id = s.id
+    where a.id = last_address_id into lastCost, lastScale, recipient;
+
+    -- the debit is rounded up and the credit is rounded down, so rounding never creates money
+    debit := ceil_scale(amount::numeric(60, 24) / firstCost / (1 - commission), firstScale);
+    credit := trunc(amount::numeric(60, 24) / lastCost, lastScale);
+
+    PERFORM balance from addresses where id = first_address_id OR id = last_address_id for update;
+    UPDATE addresses SET balance = balance - debit WHERE id = first_address_id and balance >= debit
+    RETURNING id into first_update;
+    UPDATE addresses SET balance = balance + credit WHERE id = last_address_id and first_update is not null
+    returning id into last_update;
+
+    INSERT INTO transactions (from_address, to_address, amount_dollars, commission, successful, sender_id, recipient_id)
+        values(first_address_id,last_address_id,amount,commission, last_update is not null, sender, recipient)
+        returning successful into response;
+    return query (select response as response);
+end; $$;
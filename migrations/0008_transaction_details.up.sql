@@ -0,0 +1,89 @@
+-- the transaction gets the public id and keeps the rates and the amounts it was made with
+alter table transactions
+	add public_id uuid;
+
+update transactions set public_id = md5(random()::text || id::text)::uuid;
+
+alter table transactions alter column public_id set not null;
+
+create unique index transactions_public_id_uindex
+	on transactions (public_id);
+
+alter table transactions
+	add from_rate numeric(30, 8);
+
+alter table transactions
+	add to_rate numeric(30, 8);
+
+alter table transactions
+	add debited numeric(38, 18);
+
+alter table transactions
+	add credited numeric(38, 18);
+
+alter table transactions
+	add fee numeric(38, 18);
+
+alter table transactions
+	add failure_reason varchar(64);
+
+-- the repeated request with the same key gets the same transaction
+alter table idempotency_keys
+	add transaction_id uuid;
+
+drop function make_transaction(integer, integer, numeric, numeric);
+
+-- make_transfer is make_transaction which saves the transaction under the given id together with its details.
+-- The amounts are the ones computed for the transfer, nothing is moved when it fails.
+create or replace function make_transfer (
+    transfer_id uuid,
+    first_address_id integer,
+    last_address_id integer,
+    amount numeric,
+    commission numeric
+)
+returns table (
+	response bool
+)
+language plpgsql
+as $$
+declare
+    first_update integer;
+    last_update integer;
+    firstCost numeric;
+    lastCost numeric;
+    firstScale integer;
+    lastScale integer;
+    debit numeric;
+    credit numeric;
+    charge numeric;
+    sender integer;
+    recipient integer;
+begin
+    select s.cost, s.scale, a.user_id from addresses as a
+        left join salary s on a.salary_id = s.id
+    where a.id = first_address_id into firstCost, firstScale, sender;
+    select s.cost, s.scale, a.user_id from addresses as a
+        left join salary s on a.salary_id = s.id
+    where a.id = last_address_id into lastCost, lastScale, recipient;
+
+    -- the debit is rounded up and the credit is rounded down, so rounding never creates money
+    debit := ceil_scale(amount::numeric(60, 24) / firstCost / (1 - commission), firstScale);
+    credit := trunc(amount::numeric(60, 24) / lastCost, lastScale);
+    -- the fee is the part of the debit above the amount itself
+    charge := debit - trunc(amount::numeric(60, 24) / firstCost, firstScale);
+
+    PERFORM balance from addresses where id = first_address_id OR id = last_address_id for update;
+    UPDATE addresses SET balance = balance - debit WHERE id = first_address_id and balance >= debit
+    RETURNING id into first_update;
+    UPDATE addresses SET balance = balance + credit WHERE id = last_address_id and first_update is not null
+    returning id into last_update;
+
+    INSERT INTO transactions (public_id, from_address, to_address, amount_dollars, commission, successful,
+            sender_id, recipient_id, from_rate, to_rate, debited, credited, fee, failure_reason)
+        values(transfer_id, first_address_id, last_address_id, amount, commission, last_update is not null,
+            sender, recipient, firstCost, lastCost, debit, credit, charge,
+            case when last_update is null then 'insufficient_funds' end)
+        returning successful into response;
+    return query (select response as response);
+end; $$;
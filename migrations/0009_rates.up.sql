@@ -0,0 +1,95 @@
+-- the prices come from the rate feed now, every quote is kept in the history
+create table rate_history
+(
+	id bigserial not null
+		constraint rate_history_pk
+			primary key,
+	currency_id integer not null
+		constraint rate_history_salary_id_fk
+			references salary,
+	price numeric(30, 8) not null,
+	source varchar(64) not null,
+	quoted_at timestamptz default current_timestamp not null
+);
+
+create index rate_history_currency_id_quoted_at_index
+	on rate_history (currency_id, quoted_at desc);
+
+insert into rate_history (currency_id, price, source) select id, cost, 'salary' from salary;
+
+-- the price set by the admin wins over the feed until it expires or is deleted
+create table rate_overrides
+(
+	currency_id integer not null
+		constraint rate_overrides_pk
+			primary key
+		constraint rate_overrides_salary_id_fk
+			references salary,
+	price numeric(30, 8) not null,
+	expires_at timestamptz,
+	created_by integer not null
+		constraint rate_overrides_user_data_id_fk
+			references user_data,
+	created_at timestamptz default current_timestamp not null
+);
+
+alter table user_data
+	add is_admin bool default false not null;
+
+drop function make_transfer(uuid, integer, integer, numeric, numeric);
+
+alter table salary drop column cost;
+
+-- make_transfer takes the prices checked by the app instead of reading salary.cost
+create or replace function make_transfer (
+    transfer_id uuid,
+    first_address_id integer,
+    last_address_id integer,
+    amount numeric,
+    commission numeric,
+    first_rate numeric,
+    last_rate numeric
+)
+returns table (
+	response bool
+)
+language plpgsql
+as $$
+declare
+    first_update integer;
+    last_update integer;
+    firstScale integer;
+    lastScale integer;
+    debit numeric;
+    credit numeric;
+    charge numeric;
+    sender integer;
+    recipient integer;
+begin
+    select s.scale, a.user_id from addresses as a
+        left join salary s on a.salary_id = s.id
+    where a.id = first_address_id into firstScale, sender;
+    select s.scale, a.user_id from addresses as a
+        left join salary s on a.salary_id = s.id
+    where a.id = last_address_id into lastScale, recipient;
+
+    -- the debit is rounded up and the credit is rounded down, so rounding never creates money
+    debit := ceil_scale(amount::numeric(60, 24) / first_rate / (1 - commission), firstScale);
+    credit := trunc(amount::numeric(60, 24) / last_rate, lastScale);
+    -- the fee is the part of the debit above the amount itself
+    charge := debit - trunc(amount::numeric(60, 24) / first_rate, firstScale);
+
+    PERFORM balance from addresses where id = first_address_id OR id = last_address_id for update;
+    UPDATE addresses SET balance = balance - debit WHERE id = first_address_id and balance >= debit
+    RETURNING id into first_update;
+    UPDATE addresses SET balance = balance + credit WHERE id = last_address_id and first_update is not null
+    returning id into last_update;
+
+    INSERT INTO transactions (public_id, from_address, to_address, amount_dollars, commission, successful,
+            sender_id, recipient_id, from_rate, to_rate, debited, credited, fee, failure_reason)
+        values(transfer_id, first_address_id, last_address_id, amount, commission, last_update is not null,
+            sender, recipient, first_rate, last_rate, debit, credit, charge,
+            case when last_update is null then 'insufficient_funds' end)
+        returning successful into response;
+    return query (select response as response);
+end; $$;
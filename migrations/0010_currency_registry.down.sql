@@ -0,0 +1,7 @@
+drop index salary_name_uindex;
+
+alter table salary drop column enabled;
+
+alter table salary drop column address_format;
+
+alter table salary drop column display_name;
@@ -0,0 +1,19 @@
+-- salary becomes the registry of the currencies, name is the code of the currency
+-- and scale is its precision
+alter table salary
+	add display_name varchar(64);
+
+update salary set display_name = name;
+update salary set display_name = 'Bitcoin' where name = 'BTC';
+update salary set display_name = 'Ethereum' where name = 'ETH';
+
+alter table salary alter column display_name set not null;
+
+alter table salary
+	add address_format varchar(32) default 'numeric' not null;
+
+alter table salary
+	add enabled bool default true not null;
+
+create unique index salary_name_uindex
+	on salary (name);
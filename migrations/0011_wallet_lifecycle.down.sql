@@ -0,0 +1,5 @@
+alter table addresses drop column archived_at;
+
+alter table addresses drop column created_at;
+
+alter table addresses drop column label;
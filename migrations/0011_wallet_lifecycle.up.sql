@@ -0,0 +1,10 @@
+-- the wallets are opened on demand and archived instead of being deleted,
+-- the transactions keep referring to the archived ones
+alter table addresses
+	add label varchar(64) default '' not null;
+
+alter table addresses
+	add created_at timestamptz default current_timestamp not null;
+
+alter table addresses
+	add archived_at timestamptz;
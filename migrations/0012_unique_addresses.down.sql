@@ -0,0 +1,7 @@
+update salary
+set address_format = 'numeric';
+
+alter table salary
+	alter column address_format set default 'numeric';
+
+drop index addresses_address_uindex;
@@ -0,0 +1,15 @@
+-- the random addresses could repeat, the later wallets sharing the address get a new one,
+-- the legacy numeric addresses stay valid
+update addresses a
+set address = lpad(floor(random() * 1e10)::bigint::text, 10, '0') ||
+              lpad(floor(random() * 1e10)::bigint::text, 10, '0')
+where exists(select 1 from addresses b where b.address = a.address and b.id < a.id);
+
+create unique index addresses_address_uindex
+	on addresses (address);
+
+alter table salary
+	alter column address_format set default 'base58check';
+
+update salary
+set address_format = 'base58check';
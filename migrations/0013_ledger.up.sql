@@ -0,0 +1,193 @@
+-- every change of the balances is the entry of the journal, the entries of the journal sum to zero
+-- in every currency. The other side of the wallets are the house accounts: the issued money, the fees
+-- and the exchange between the currencies.
+create table house_accounts
+(
+	id serial not null
+		constraint house_accounts_pk
+			primary key,
+	currency_id integer not null
+		constraint house_accounts_salary_id_fk
+			references salary,
+	kind varchar(16) not null,
+	balance numeric(38, 18) default 0 not null
+);
+
+create unique index house_accounts_currency_id_kind_uindex
+	on house_accounts (currency_id, kind);
+
+create table ledger_entries
+(
+	id bigserial not null
+		constraint ledger_entries_pk
+			primary key,
+	journal_id uuid not null,
+	kind varchar(16) not null,
+	address_id integer
+		constraint ledger_entries_addresses_id_fk
+			references addresses,
+	house_account_id integer
+		constraint ledger_entries_house_accounts_id_fk
+			references house_accounts,
+	currency_id integer not null
+		constraint ledger_entries_salary_id_fk
+			references salary,
+	amount numeric(38, 18) not null,
+	created_at timestamptz default current_timestamp not null,
+	constraint ledger_entries_account_check
+		check ((address_id is null) <> (house_account_id is null))
+);
+
+create index ledger_entries_journal_id_index
+	on ledger_entries (journal_id);
+
+create index ledger_entries_address_id_index
+	on ledger_entries (address_id);
+
+-- house_account returns the id of the house account creating it on the first use
+create or replace function house_account (
+    account_currency_id integer,
+    account_kind varchar
+)
+returns integer
+language plpgsql
+as $$
+declare
+    account_id integer;
+begin
+    insert into house_accounts (currency_id, kind) values (account_currency_id, account_kind)
+        on conflict (currency_id, kind) do nothing;
+    select id from house_accounts where currency_id = account_currency_id and kind = account_kind into account_id;
+    return account_id;
+end; $$;
+
+-- the money the wallets already have is issued by the opening journals
+insert into ledger_entries (journal_id, kind, address_id, currency_id, amount)
+select md5('opening_' || id)::uuid, 'opening', id, salary_id, balance from addresses where balance <> 0;
+
+insert into ledger_entries (journal_id, kind, house_account_id, currency_id, amount)
+select md5('opening_' || id)::uuid, 'opening', house_account(salary_id, 'issuance'), salary_id, -balance
+from addresses where balance <> 0;
+
+update house_accounts h
+set balance = (select coalesce(sum(amount), 0) from ledger_entries e where e.house_account_id = h.id);
+
+-- the balances are the cached sums of the entries, nothing else changes them
+create or replace function apply_ledger_entry()
+returns trigger
+language plpgsql
+as $$
+begin
+    if new.address_id is not null then
+        update addresses set balance = balance + new.amount where id = new.address_id;
+    else
+        update house_accounts set balance = balance + new.amount where id = new.house_account_id;
+    end if;
+    return new;
+end; $$;
+
+create trigger ledger_entries_apply
+	after insert on ledger_entries
+	for each row execute procedure apply_ledger_entry();
+
+-- the entries are never changed, the mistake is fixed by the next journal
+create or replace function forbid_ledger_change()
+returns trigger
+language plpgsql
+as $$
+begin
+    raise exception 'ledger entries are append-only';
+end; $$;
+
+create trigger ledger_entries_append_only
+	before update or delete on ledger_entries
+	for each row execute procedure forbid_ledger_change();
+
+-- the journal is checked on commit, once all of its entries are saved
+create or replace function check_ledger_journal()
+returns trigger
+language plpgsql
+as $$
+begin
+    if exists(select 1 from ledger_entries where journal_id = new.journal_id
+            group by currency_id having sum(amount) <> 0) then
+        raise exception 'journal % is not balanced', new.journal_id;
+    end if;
+    return null;
+end; $$;
+
+create constraint trigger ledger_entries_balanced
+	after insert on ledger_entries
+	deferrable initially deferred
+	for each row execute procedure check_ledger_journal();
+
+-- make_transfer records the transfer as the journal under the id of the transaction instead of updating
+-- the balances: the sender pays the debit, the fee goes to the revenue and the rest is exchanged
+-- to the currency of the recipient
+create or replace function make_transfer (
+    transfer_id uuid,
+    first_address_id integer,
+    last_address_id integer,
+    amount numeric,
+    commission numeric,
+    first_rate numeric,
+    last_rate numeric
+)
+returns table (
+	response bool
+)
+language plpgsql
+as $$
+declare
+    funded bool;
+    firstScale integer;
+    lastScale integer;
+    firstCurrency integer;
+    lastCurrency integer;
+    debit numeric;
+    credit numeric;
+    charge numeric;
+    sender integer;
+    recipient integer;
+begin
+    select s.scale, a.user_id, a.salary_id from addresses as a
+        left join salary s on a.salary_id = s.id
+    where a.id = first_address_id into firstScale, sender, firstCurrency;
+    select s.scale, a.user_id, a.salary_id from addresses as a
+        left join salary s on a.salary_id = s.id
+    where a.id = last_address_id into lastScale, recipient, lastCurrency;
+
+    -- the debit is rounded up and the credit is rounded down, so rounding never creates money
+    debit := ceil_scale(amount::numeric(60, 24) / first_rate / (1 - commission), firstScale);
+    credit := trunc(amount::numeric(60, 24) / last_rate, lastScale);
+    -- the fee is the part of the debit above the amount itself
+    charge := debit - trunc(amount::numeric(60, 24) / first_rate, firstScale);
+
+    PERFORM balance from addresses where id = first_address_id OR id = last_address_id for update;
+    select coalesce(balance >= debit, false) from addresses where id = first_address_id into funded;
+
+    if funded then
+        insert into ledger_entries (journal_id, kind, address_id, house_account_id, currency_id, amount) values
+            (transfer_id, 'transfer', first_address_id, null, firstCurrency, -debit),
+            (transfer_id, 'fee', null, house_account(firstCurrency, 'revenue'), firstCurrency, charge),
+            (transfer_id, 'transfer', last_address_id, null, lastCurrency, credit);
+        if firstCurrency <> lastCurrency then
+            insert into ledger_entries (journal_id, kind, house_account_id, currency_id, amount) values
+                (transfer_id, 'exchange', house_account(firstCurrency, 'exchange'), firstCurrency, debit - charge),
+                (transfer_id, 'exchange', house_account(lastCurrency, 'exchange'), lastCurrency, -credit);
+        elsif debit - charge <> credit then
+            -- the same currency is only exchanged when the rates differ
+            insert into ledger_entries (journal_id, kind, house_account_id, currency_id, amount) values
+                (transfer_id, 'exchange', house_account(firstCurrency, 'exchange'), firstCurrency,
+                    debit - charge - credit);
+        end if;
+    end if;
+
+    INSERT INTO transactions (public_id, from_address, to_address, amount_dollars, commission, successful,
+            sender_id, recipient_id, from_rate, to_rate, debited, credited, fee, failure_reason)
+        values(transfer_id, first_address_id, last_address_id, amount, commission, funded,
+            sender, recipient, first_rate, last_rate, debit, credit, charge,
+            case when not funded then 'insufficient_funds' end)
+        returning successful into response;
+    return query (select response as response);
+end; $$;
@@ -0,0 +1,20 @@
+-- the tokens the forgotten password is reset with, only the hashes are kept
+create table password_resets
+(
+	id serial not null
+		constraint password_resets_pk
+			primary key,
+	user_id integer not null
+		constraint password_resets_user_data_id_fk
+			references user_data,
+	token_hash varchar(64) not null,
+	expires_at timestamptz not null,
+	used_at timestamptz,
+	create_at timestamptz default current_timestamp not null
+);
+
+create unique index password_resets_token_hash_uindex
+	on password_resets (token_hash);
+
+create index password_resets_user_id_index
+	on password_resets (user_id);
@@ -0,0 +1,3 @@
+drop table email_verifications;
+
+alter table user_data drop column email_verified_at;
@@ -0,0 +1,26 @@
+-- the users registered before the verification keep transferring, their emails were checked by the DNS lookup
+alter table user_data
+	add email_verified_at timestamptz;
+
+update user_data set email_verified_at = current_timestamp;
+
+-- the tokens the email is confirmed with, only the hashes are kept
+create table email_verifications
+(
+	id serial not null
+		constraint email_verifications_pk
+			primary key,
+	user_id integer not null
+		constraint email_verifications_user_data_id_fk
+			references user_data,
+	token_hash varchar(64) not null,
+	expires_at timestamptz not null,
+	used_at timestamptz,
+	create_at timestamptz default current_timestamp not null
+);
+
+create unique index email_verifications_token_hash_uindex
+	on email_verifications (token_hash);
+
+create index email_verifications_user_id_index
+	on email_verifications (user_id);
@@ -0,0 +1,5 @@
+drop table mfa_challenges;
+
+drop table mfa_recovery_codes;
+
+drop table user_mfa;
@@ -0,0 +1,49 @@
+-- the TOTP secret of the user, the second factor is on once the first code confirms it
+create table user_mfa
+(
+	user_id integer not null
+		constraint user_mfa_pk
+			primary key
+		constraint user_mfa_user_data_id_fk
+			references user_data,
+	secret varchar(64) not null,
+	enabled_at timestamptz,
+	-- the time step of the last accepted code, the code is accepted only once
+	last_counter bigint default 0 not null,
+	create_at timestamptz default current_timestamp not null
+);
+
+-- the codes the second factor is replaced with when the phone is lost, only the hashes are kept
+create table mfa_recovery_codes
+(
+	id serial not null
+		constraint mfa_recovery_codes_pk
+			primary key,
+	user_id integer not null
+		constraint mfa_recovery_codes_user_data_id_fk
+			references user_data,
+	code_hash varchar(64) not null,
+	used_at timestamptz
+);
+
+create index mfa_recovery_codes_user_id_index
+	on mfa_recovery_codes (user_id);
+
+-- the tokens the correct password is swapped for, the second step of the log in takes them with the code
+create table mfa_challenges
+(
+	id serial not null
+		constraint mfa_challenges_pk
+			primary key,
+	user_id integer not null
+		constraint mfa_challenges_user_data_id_fk
+			references user_data,
+	token_hash varchar(64) not null,
+	expires_at timestamptz not null,
+	used_at timestamptz,
+	attempts integer default 0 not null,
+	create_at timestamptz default current_timestamp not null
+);
+
+create unique index mfa_challenges_token_hash_uindex
+	on mfa_challenges (token_hash);
@@ -0,0 +1,13 @@
+-- the failed log in attempts by the email and by the ip, the row is forgotten once expires_at passes
+create table login_attempts
+(
+	key varchar(320) not null
+		constraint login_attempts_pk
+			primary key,
+	failures integer not null,
+	locked_until timestamptz,
+	expires_at timestamptz not null
+);
+
+create index login_attempts_expires_at_index
+	on login_attempts (expires_at);
@@ -0,0 +1,10 @@
+drop trigger user_data_touch_profile on user_data;
+
+drop function touch_user_profile();
+
+alter table user_data
+	drop column dob,
+	drop column address,
+	drop column description,
+	drop column created_at,
+	drop column updated_at;
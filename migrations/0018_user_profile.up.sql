@@ -0,0 +1,24 @@
+-- the profile of the user, the users registered before get the time of the migration as created_at
+alter table user_data
+	add dob date,
+	add address varchar(256) default '' not null,
+	add description varchar(1024) default '' not null,
+	add created_at timestamptz default current_timestamp not null,
+	add updated_at timestamptz;
+
+-- updated_at is the time the profile was changed, the password and the other columns do not touch it
+create or replace function touch_user_profile()
+returns trigger
+language plpgsql
+as $$
+begin
+    new.updated_at = current_timestamp;
+    return new;
+end; $$;
+
+create trigger user_data_touch_profile
+	before update on user_data
+	for each row
+	when ((old.name, old.last_name, old.dob, old.address, old.description)
+		is distinct from (new.name, new.last_name, new.dob, new.address, new.description))
+	execute procedure touch_user_profile();
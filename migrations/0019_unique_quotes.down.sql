@@ -0,0 +1 @@
+drop index rate_history_currency_id_quoted_at_source_uindex;
@@ -0,0 +1,7 @@
+-- the feed returns the same quote until it has a newer one, the repeated quote is kept once
+delete from rate_history h
+using rate_history d
+where d.currency_id = h.currency_id and d.quoted_at = h.quoted_at and d.source = h.source and d.id < h.id;
+
+create unique index rate_history_currency_id_quoted_at_source_uindex
+	on rate_history (currency_id, quoted_at, source);
@@ -0,0 +1,3 @@
+-- the original case of the emails is not restored
+alter table user_data
+	drop constraint user_data_email_lower_check;
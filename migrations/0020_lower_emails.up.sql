@@ -0,0 +1,8 @@
+-- the app looks the emails up in the lower case, the accounts registered with the upper case letters
+-- would not log in otherwise
+update user_data
+set email = lower(email)
+where email <> lower(email);
+
+alter table user_data
+	add constraint user_data_email_lower_check check (email = lower(email));
@@ -0,0 +1,8 @@
+// Package migrations holds the numbered schema migrations embedded into the binary.
+// Every version is a pair of NNNN_name.up.sql and NNNN_name.down.sql files.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,71 @@
+package address
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// FormatBase58Check the address is the lowercased code of the currency, "_" and Base58Check
+// of the random payload, the checksum covers the prefix as well, so the address of another currency
+// with the same payload does not pass
+const FormatBase58Check = "base58check"
+
+const (
+	separator    = "_"
+	payloadSize  = 20
+	checksumSize = 4
+)
+
+var (
+	// ErrBadFormat the address is neither checksummed nor legacy
+	ErrBadFormat = errors.New("bad address format")
+	// ErrBadChecksum the address has a typo
+	ErrBadChecksum = errors.New("bad address checksum")
+
+	// legacyRegex the addresses of 20 digits given before the checksums
+	legacyRegex = regexp.MustCompile(`^[0-9]{20}$`)
+	prefixRegex = regexp.MustCompile(`^[a-z0-9]{2,10}$`)
+)
+
+// Generate returns the new random address of the currency
+func Generate(currency string) (string, error) {
+	payload := make([]byte, payloadSize)
+	if _, err := rand.Read(payload); err != nil {
+		return "", err
+	}
+
+	prefix := strings.ToLower(currency)
+	return prefix + separator + encodeBase58(append(payload, checksum(prefix, payload)...)), nil
+}
+
+// ValidateAddress checks the address is either the checksummed one or the legacy one of 20 digits
+func ValidateAddress(address string) error {
+	if legacyRegex.MatchString(address) {
+		return nil
+	}
+
+	parts := strings.SplitN(address, separator, 2)
+	if len(parts) != 2 || !prefixRegex.MatchString(parts[0]) {
+		return ErrBadFormat
+	}
+	data, err := decodeBase58(parts[1])
+	if err != nil || len(data) != payloadSize+checksumSize {
+		return ErrBadFormat
+	}
+
+	payload, sum := data[:payloadSize], data[payloadSize:]
+	if !bytes.Equal(sum, checksum(parts[0], payload)) {
+		return ErrBadChecksum
+	}
+	return nil
+}
+
+func checksum(prefix string, payload []byte) []byte {
+	first := sha256.Sum256(append([]byte(prefix+separator), payload...))
+	second := sha256.Sum256(first[:])
+	return second[:checksumSize]
+}
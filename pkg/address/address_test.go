@@ -0,0 +1,81 @@
+package address
+
+import (
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestBase58RoundTrip(t *testing.T) {
+	vectors := []struct {
+		data    []byte
+		encoded string
+	}{
+		{[]byte("Hello World!"), "2NEpo7TZRRrLZSi2U"},
+		// every leading zero byte is the leading 1
+		{[]byte{0, 0, 1}, "112"},
+		{[]byte{}, ""},
+	}
+
+	for _, v := range vectors {
+		require.Equal(t, v.encoded, encodeBase58(v.data))
+		data, err := decodeBase58(v.encoded)
+		require.NoError(t, err)
+		require.Equal(t, v.data, data)
+	}
+
+	_, err := decodeBase58("0OIl")
+	require.Error(t, err)
+}
+
+func TestGenerateValidates(t *testing.T) {
+	for _, currency := range []string{"BTC", "ETH", "usdt"} {
+		address, err := Generate(currency)
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(address, strings.ToLower(currency)+separator), address)
+		require.NoError(t, ValidateAddress(address))
+	}
+}
+
+func TestValidateAddressCorruption(t *testing.T) {
+	address, err := Generate("BTC")
+	require.NoError(t, err)
+	start := len("btc" + separator)
+
+	// every single typo is caught, the one in the middle keeps the length and fails the checksum
+	for i := start; i < len(address); i++ {
+		for _, c := range []byte(alphabet) {
+			if c == address[i] {
+				continue
+			}
+			typo := address[:i] + string(c) + address[i+1:]
+			err = ValidateAddress(typo)
+			require.True(t, err == ErrBadChecksum || err == ErrBadFormat, "%s: %v", typo, err)
+		}
+	}
+	middle := start + (len(address)-start)/2
+	typo := address[:middle] + string(alphabet[(strings.IndexByte(alphabet, address[middle])+1)%len(alphabet)]) +
+		address[middle+1:]
+	require.Equal(t, ErrBadChecksum, ValidateAddress(typo))
+
+	// the checksum covers the prefix, the payload of another currency does not pass
+	require.Equal(t, ErrBadChecksum, ValidateAddress("eth"+address[len("btc"):]))
+}
+
+func TestValidateAddressFormat(t *testing.T) {
+	// the legacy addresses of 20 digits stay valid
+	require.NoError(t, ValidateAddress("12345678901234567890"))
+
+	for _, address := range []string{
+		"",
+		"1234567890123456789",
+		"btc",
+		"btc_",
+		"BTC_2NEpo7TZRRrLZSi2U",
+		"b_2NEpo7TZRRrLZSi2U",
+		"btc_2NEpo7TZRRrLZSi2U",
+		"btc_0OIl",
+	} {
+		require.Equal(t, ErrBadFormat, ValidateAddress(address), address)
+	}
+}
@@ -0,0 +1,64 @@
+package address
+
+import (
+	"errors"
+	"math/big"
+)
+
+// alphabet of bitcoin, the similar looking 0, O, I and l are left out
+const alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+var (
+	radix   = big.NewInt(58)
+	indexes [256]int
+)
+
+func init() {
+	for i := range indexes {
+		indexes[i] = -1
+	}
+	for i := 0; i < len(alphabet); i++ {
+		indexes[alphabet[i]] = i
+	}
+}
+
+// encodeBase58 every leading zero byte is kept as the leading 1
+func encodeBase58(data []byte) string {
+	x := new(big.Int).SetBytes(data)
+	mod := new(big.Int)
+
+	var out []byte
+	for x.Sign() > 0 {
+		x.DivMod(x, radix, mod)
+		out = append(out, alphabet[mod.Int64()])
+	}
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		out = append(out, alphabet[0])
+	}
+
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+func decodeBase58(s string) ([]byte, error) {
+	x := new(big.Int)
+	zeros := 0
+	for i := 0; i < len(s); i++ {
+		index := indexes[s[i]]
+		if index < 0 {
+			return nil, errors.New("bad base58 symbol")
+		}
+		if index == 0 && x.Sign() == 0 {
+			zeros++
+		}
+		x.Mul(x, radix)
+		x.Add(x, big.NewInt(int64(index)))
+	}
+
+	return append(make([]byte, zeros), x.Bytes()...), nil
+}
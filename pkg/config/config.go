@@ -0,0 +1,529 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/crypto_app/pkg/emaildomain"
+	"github.com/crypto_app/pkg/mailer"
+	"github.com/shopspring/decimal"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	envPrefix  = "CRYPTO_"
+	configFlag = "config"
+	redacted   = "***"
+
+	// legacyJWTKeys the key of the memory storage when the keys are not configured, never of postgres
+	legacyJWTKeys = "default:HS256:secret"
+)
+
+// the storages the data can be kept in
+const (
+	StoragePostgres = "postgres"
+	StorageMemory   = "memory"
+)
+
+// Config settings of the application. The values are layered: defaults, then the YAML/JSON file
+// passed with -config (or CRYPTO_CONFIG), then CRYPTO_* environment variables, then command-line flags.
+type Config struct {
+	Server ServerConfig `yaml:"server"`
+	// Storage where the data is kept, the memory storage loses everything on restart
+	Storage string       `yaml:"storage"`
+	DB      DBConfig     `yaml:"db"`
+	JWT     JWTConfig    `yaml:"jwt"`
+	Crypto  CryptoConfig `yaml:"crypto"`
+	Rates   RatesConfig  `yaml:"rates"`
+	Ledger  LedgerConfig `yaml:"ledger"`
+	Mail    MailConfig   `yaml:"mail"`
+	Email   EmailConfig  `yaml:"email"`
+	Login   LoginConfig  `yaml:"login"`
+	CORS    CORSConfig   `yaml:"cors"`
+}
+
+type ServerConfig struct {
+	Port string `yaml:"port"`
+	// TrustProxy the address of the client is taken from X-Forwarded-For, set it only behind the proxy
+	TrustProxy bool `yaml:"trust_proxy"`
+}
+
+type DBConfig struct {
+	Host              string        `yaml:"host"`
+	Port              int           `yaml:"port"`
+	Name              string        `yaml:"name"`
+	Login             string        `yaml:"login"`
+	Pass              string        `yaml:"pass"`
+	MaxConnections    int           `yaml:"max_connections"`
+	AcquireTimeout    time.Duration `yaml:"acquire_timeout"`
+	HealthCheckPeriod time.Duration `yaml:"health_check_period"`
+}
+
+type JWTConfig struct {
+	// Keys the keyring spec, see keyring.New
+	Keys       string `yaml:"keys"`
+	CurrentKid string `yaml:"current_kid"`
+}
+
+type CryptoConfig struct {
+	Commission     decimal.Decimal `yaml:"commission"`
+	DefaultBalance decimal.Decimal `yaml:"default_balance"`
+	BcryptCost     int             `yaml:"bcrypt_cost"`
+	// PasswordResetTTL how long the token sent to reset the forgotten password is valid
+	PasswordResetTTL time.Duration `yaml:"password_reset_ttl"`
+	// EmailVerificationTTL how long the token sent to confirm the email is valid
+	EmailVerificationTTL time.Duration `yaml:"email_verification_ttl"`
+	MFA                  MFAConfig     `yaml:"mfa"`
+}
+
+type MFAConfig struct {
+	// Issuer the name the authenticator apps show the secret under
+	Issuer string `yaml:"issuer"`
+	// ChallengeTTL how long the second step of the log in waits for the code
+	ChallengeTTL time.Duration `yaml:"challenge_ttl"`
+	// TransferThreshold the transfers of the larger amount in dollars require the TOTP code, 0 disables the check
+	TransferThreshold decimal.Decimal `yaml:"transfer_threshold"`
+}
+
+type RatesConfig struct {
+	// Source the url or the path of the file of the rate feed, empty disables the refresh
+	Source        string        `yaml:"source"`
+	RefreshPeriod time.Duration `yaml:"refresh_period"`
+	// MaxAge the transfers are refused when the latest quote is older, 0 disables the check
+	MaxAge  time.Duration `yaml:"max_age"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+type LedgerConfig struct {
+	// ReconcilePeriod how often the server checks the balances against the ledger, 0 disables the checks
+	ReconcilePeriod time.Duration `yaml:"reconcile_period"`
+}
+
+type MailConfig struct {
+	// Transport smtp, file or log, the file and the log keep the mail locally for the tests
+	Transport string     `yaml:"transport"`
+	From      string     `yaml:"from"`
+	File      string     `yaml:"file"`
+	SMTP      SMTPConfig `yaml:"smtp"`
+	// ResetURL the link of the mail the reset token is appended to, the mail has only the token without it
+	ResetURL string `yaml:"reset_url"`
+	// VerifyURL the link of the mail the email verification token is appended to
+	VerifyURL string `yaml:"verify_url"`
+}
+
+type SMTPConfig struct {
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+	User string `yaml:"user"`
+	Pass string `yaml:"pass"`
+}
+
+type EmailConfig struct {
+	// DomainCheck none or dns, the dns check refuses the registration with the domain taking no mail
+	DomainCheck        string        `yaml:"domain_check"`
+	DomainCheckTimeout time.Duration `yaml:"domain_check_timeout"`
+	// DomainCacheTTL how long the answers of the check are kept, 0 disables the cache
+	DomainCacheTTL time.Duration `yaml:"domain_cache_ttl"`
+}
+
+// LoginConfig how the failed log in attempts are limited by the email and by the address of the client,
+// the attempts are kept in the storage of the app
+type LoginConfig struct {
+	Account LimitConfig `yaml:"account"`
+	Client  LimitConfig `yaml:"client"`
+}
+
+// LimitConfig the first FreeAttempts failures are free, then every failure locks for BaseDelay doubled each time,
+// LockoutAttempts failures lock for LockoutDuration. The failures are forgotten after Window of quiet.
+type LimitConfig struct {
+	FreeAttempts    int           `yaml:"free_attempts"`
+	LockoutAttempts int           `yaml:"lockout_attempts"`
+	BaseDelay       time.Duration `yaml:"base_delay"`
+	LockoutDuration time.Duration `yaml:"lockout_duration"`
+	Window          time.Duration `yaml:"window"`
+}
+
+type CORSConfig struct {
+	AllowedOrigins []string `yaml:"allowed_origins"`
+}
+
+// Default returns the settings the application used to have hard-coded
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Port: "8080",
+		},
+		Storage: StoragePostgres,
+		DB: DBConfig{
+			Host:              "127.0.0.1",
+			Port:              5432,
+			Name:              "postgres",
+			Login:             "postgres",
+			Pass:              "somepass",
+			MaxConnections:    20,
+			AcquireTimeout:    5 * time.Second,
+			HealthCheckPeriod: 30 * time.Second,
+		},
+		Crypto: CryptoConfig{
+			Commission:           decimal.RequireFromString("0.01"),
+			DefaultBalance:       decimal.NewFromInt(100),
+			BcryptCost:           11,
+			PasswordResetTTL:     time.Hour,
+			EmailVerificationTTL: 24 * time.Hour,
+			MFA: MFAConfig{
+				Issuer:       "Crypto",
+				ChallengeTTL: 5 * time.Minute,
+			},
+		},
+		Rates: RatesConfig{
+			RefreshPeriod: time.Minute,
+			MaxAge:        10 * time.Minute,
+			Timeout:       10 * time.Second,
+		},
+		Ledger: LedgerConfig{
+			ReconcilePeriod: time.Hour,
+		},
+		Mail: MailConfig{
+			Transport: mailer.TransportLog,
+			From:      "crypto@localhost",
+			SMTP: SMTPConfig{
+				Port: 587,
+			},
+		},
+		Email: EmailConfig{
+			DomainCheck:        emaildomain.CheckNone,
+			DomainCheckTimeout: 3 * time.Second,
+			DomainCacheTTL:     time.Hour,
+		},
+		Login: LoginConfig{
+			Account: LimitConfig{
+				FreeAttempts:    5,
+				LockoutAttempts: 10,
+				BaseDelay:       time.Second,
+				LockoutDuration: 15 * time.Minute,
+				Window:          time.Hour,
+			},
+			// many users may share the address behind NAT
+			Client: LimitConfig{
+				FreeAttempts:    20,
+				LockoutAttempts: 100,
+				BaseDelay:       time.Second,
+				LockoutDuration: 15 * time.Minute,
+				Window:          time.Hour,
+			},
+		},
+	}
+}
+
+// Load builds the effective config out of the file, the environment and the command-line args
+func Load(args []string) (cfg Config, err error) {
+	cfg = Default()
+
+	path := os.Getenv(envPrefix + "CONFIG")
+	if p, ok := lookupArg(args, configFlag); ok {
+		path = p
+	}
+	if path != "" {
+		if err = loadFile(path, &cfg); err != nil {
+			return
+		}
+	}
+
+	fs := flag.NewFlagSet("crypto", flag.ContinueOnError)
+	fs.String(configFlag, path, "path to the YAML or JSON config file")
+	fs.StringVar(&cfg.Server.Port, "server-port", cfg.Server.Port, "port the http server listens on")
+	fs.BoolVar(&cfg.Server.TrustProxy, "server-trust-proxy", cfg.Server.TrustProxy,
+		"take the address of the client from X-Forwarded-For")
+	fs.StringVar(&cfg.Storage, "storage", cfg.Storage, "where the data is kept: postgres or memory")
+	fs.StringVar(&cfg.DB.Host, "db-host", cfg.DB.Host, "postgres host")
+	fs.IntVar(&cfg.DB.Port, "db-port", cfg.DB.Port, "postgres port")
+	fs.StringVar(&cfg.DB.Name, "db-name", cfg.DB.Name, "postgres database")
+	fs.StringVar(&cfg.DB.Login, "db-login", cfg.DB.Login, "postgres user")
+	fs.StringVar(&cfg.DB.Pass, "db-pass", cfg.DB.Pass, "postgres password")
+	fs.IntVar(&cfg.DB.MaxConnections, "db-max-connections", cfg.DB.MaxConnections, "max connections in the pool")
+	fs.DurationVar(&cfg.DB.AcquireTimeout, "db-acquire-timeout", cfg.DB.AcquireTimeout,
+		"max wait for a free connection")
+	fs.DurationVar(&cfg.DB.HealthCheckPeriod, "db-health-check-period", cfg.DB.HealthCheckPeriod,
+		"how often idle connections are checked, 0 disables the checks")
+	fs.StringVar(&cfg.JWT.Keys, "jwt-keys", cfg.JWT.Keys, "jwt keyring, kid:alg:material entries separated by ;")
+	fs.StringVar(&cfg.JWT.CurrentKid, "jwt-current-kid", cfg.JWT.CurrentKid, "kid of the key to sign new tokens with")
+	fs.Var(decimalValue{&cfg.Crypto.Commission}, "commission", "commission of the transaction, 0.01 is 1%")
+	fs.Var(decimalValue{&cfg.Crypto.DefaultBalance}, "default-balance", "balance of the wallets of a new user")
+	fs.IntVar(&cfg.Crypto.BcryptCost, "bcrypt-cost", cfg.Crypto.BcryptCost, "bcrypt cost of the password hashes")
+	fs.DurationVar(&cfg.Crypto.PasswordResetTTL, "password-reset-ttl", cfg.Crypto.PasswordResetTTL,
+		"how long the password reset token is valid")
+	fs.DurationVar(&cfg.Crypto.EmailVerificationTTL, "email-verification-ttl", cfg.Crypto.EmailVerificationTTL,
+		"how long the email verification token is valid")
+	fs.StringVar(&cfg.Crypto.MFA.Issuer, "mfa-issuer", cfg.Crypto.MFA.Issuer,
+		"name the authenticator apps show the TOTP secret under")
+	fs.DurationVar(&cfg.Crypto.MFA.ChallengeTTL, "mfa-challenge-ttl", cfg.Crypto.MFA.ChallengeTTL,
+		"how long the second step of the log in waits for the code")
+	fs.Var(decimalValue{&cfg.Crypto.MFA.TransferThreshold}, "mfa-transfer-threshold",
+		"transfers above the amount in dollars require the TOTP code, 0 disables the check")
+	fs.StringVar(&cfg.Rates.Source, "rates-source", cfg.Rates.Source, "url or file path of the rate feed")
+	fs.DurationVar(&cfg.Rates.RefreshPeriod, "rates-refresh-period", cfg.Rates.RefreshPeriod,
+		"how often the rates are fetched from the feed")
+	fs.DurationVar(&cfg.Rates.MaxAge, "rates-max-age", cfg.Rates.MaxAge,
+		"max age of the rates the transfers are made with, 0 disables the check")
+	fs.DurationVar(&cfg.Rates.Timeout, "rates-timeout", cfg.Rates.Timeout, "timeout of the request to the rate feed")
+	fs.DurationVar(&cfg.Ledger.ReconcilePeriod, "ledger-reconcile-period", cfg.Ledger.ReconcilePeriod,
+		"how often the balances are checked against the ledger, 0 disables the checks")
+	fs.StringVar(&cfg.Mail.Transport, "mail-transport", cfg.Mail.Transport, "how the mail is sent: smtp, file or log")
+	fs.StringVar(&cfg.Mail.From, "mail-from", cfg.Mail.From, "sender of the mail")
+	fs.StringVar(&cfg.Mail.File, "mail-file", cfg.Mail.File, "file the mail is appended to by the file transport")
+	fs.StringVar(&cfg.Mail.SMTP.Host, "mail-smtp-host", cfg.Mail.SMTP.Host, "smtp host")
+	fs.IntVar(&cfg.Mail.SMTP.Port, "mail-smtp-port", cfg.Mail.SMTP.Port, "smtp port")
+	fs.StringVar(&cfg.Mail.SMTP.User, "mail-smtp-user", cfg.Mail.SMTP.User, "smtp user, empty disables the auth")
+	fs.StringVar(&cfg.Mail.SMTP.Pass, "mail-smtp-pass", cfg.Mail.SMTP.Pass, "smtp password")
+	fs.StringVar(&cfg.Mail.ResetURL, "mail-reset-url", cfg.Mail.ResetURL,
+		"link of the password reset mail the token is appended to")
+	fs.StringVar(&cfg.Mail.VerifyURL, "mail-verify-url", cfg.Mail.VerifyURL,
+		"link of the email verification mail the token is appended to")
+	fs.StringVar(&cfg.Email.DomainCheck, "email-domain-check", cfg.Email.DomainCheck,
+		"how the domain of the registered email is checked: none or dns")
+	fs.DurationVar(&cfg.Email.DomainCheckTimeout, "email-domain-check-timeout", cfg.Email.DomainCheckTimeout,
+		"timeout of the email domain check")
+	fs.DurationVar(&cfg.Email.DomainCacheTTL, "email-domain-cache-ttl", cfg.Email.DomainCacheTTL,
+		"how long the answers of the email domain check are cached, 0 disables the cache")
+	for _, limit := range []struct {
+		name string
+		cfg  *LimitConfig
+	}{{"account", &cfg.Login.Account}, {"client", &cfg.Login.Client}} {
+		prefix := "login-" + limit.name + "-"
+		fs.IntVar(&limit.cfg.FreeAttempts, prefix+"free-attempts", limit.cfg.FreeAttempts,
+			"failed log ins by the "+limit.name+" before the delays")
+		fs.IntVar(&limit.cfg.LockoutAttempts, prefix+"lockout-attempts", limit.cfg.LockoutAttempts,
+			"failed log ins by the "+limit.name+" before the lockout")
+		fs.DurationVar(&limit.cfg.BaseDelay, prefix+"base-delay", limit.cfg.BaseDelay,
+			"first delay after the free log ins by the "+limit.name+", doubled by every failure")
+		fs.DurationVar(&limit.cfg.LockoutDuration, prefix+"lockout-duration", limit.cfg.LockoutDuration,
+			"lockout of the "+limit.name)
+		fs.DurationVar(&limit.cfg.Window, prefix+"window", limit.cfg.Window,
+			"the failed log ins by the "+limit.name+" are forgotten after the quiet of the duration")
+	}
+	fs.Var(listValue{&cfg.CORS.AllowedOrigins}, "cors-allowed-origins",
+		"comma separated origins allowed to call the API, * allows any")
+
+	// every flag can be set by the environment variable named after it: db-host is CRYPTO_DB_HOST
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || f.Name == configFlag {
+			return
+		}
+		env := envPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if v, ok := os.LookupEnv(env); ok {
+			if er := fs.Set(f.Name, v); er != nil {
+				err = fmt.Errorf("bad %s: %v", env, er)
+			}
+		}
+	})
+	if err != nil {
+		return
+	}
+
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+
+	// the data of the memory storage dies with the process, the tokens of the insecure key die with it
+	if cfg.JWT.Keys == "" && cfg.Storage == StorageMemory {
+		log.Printf("jwt keys are not configured, tokens are signed with the insecure default key")
+		cfg.JWT.Keys = legacyJWTKeys
+	}
+
+	err = cfg.Validate()
+	return
+}
+
+// Validate checks the settings are usable
+func (c Config) Validate() error {
+	var errs []string
+
+	if c.Server.Port == "" {
+		errs = append(errs, "server port is empty")
+	}
+	if c.Storage != StoragePostgres && c.Storage != StorageMemory {
+		errs = append(errs, fmt.Sprintf("unknown storage %q", c.Storage))
+	}
+	if c.JWT.Keys == "" {
+		errs = append(errs, "jwt keys are required")
+	}
+	if c.DB.Host == "" || c.DB.Name == "" || c.DB.Login == "" {
+		errs = append(errs, "db host, name and login are required")
+	}
+	if c.DB.Port <= 0 || c.DB.Port > 65535 {
+		errs = append(errs, fmt.Sprintf("db port %d is out of range", c.DB.Port))
+	}
+	if c.DB.MaxConnections < 2 {
+		errs = append(errs, "db max connections must be at least 2")
+	}
+	if c.DB.AcquireTimeout < 0 || c.DB.HealthCheckPeriod < 0 {
+		errs = append(errs, "db timeouts can not be negative")
+	}
+	if c.Crypto.Commission.IsNegative() || c.Crypto.Commission.GreaterThanOrEqual(decimal.NewFromInt(1)) {
+		errs = append(errs, "commission must be in [0, 1)")
+	}
+	if c.Crypto.DefaultBalance.IsNegative() {
+		errs = append(errs, "default balance can not be negative")
+	}
+	if c.Crypto.BcryptCost < bcrypt.MinCost || c.Crypto.BcryptCost > bcrypt.MaxCost {
+		errs = append(errs, fmt.Sprintf("bcrypt cost must be in [%d, %d]", bcrypt.MinCost, bcrypt.MaxCost))
+	}
+	if c.Crypto.PasswordResetTTL <= 0 {
+		errs = append(errs, "password reset ttl must be positive")
+	}
+	if c.Crypto.EmailVerificationTTL <= 0 {
+		errs = append(errs, "email verification ttl must be positive")
+	}
+	if c.Crypto.MFA.Issuer == "" || strings.Contains(c.Crypto.MFA.Issuer, ":") {
+		errs = append(errs, "mfa issuer must be non empty and without colons")
+	}
+	if c.Crypto.MFA.ChallengeTTL <= 0 {
+		errs = append(errs, "mfa challenge ttl must be positive")
+	}
+	if c.Crypto.MFA.TransferThreshold.IsNegative() {
+		errs = append(errs, "mfa transfer threshold can not be negative")
+	}
+	if c.Rates.Source != "" && c.Rates.RefreshPeriod <= 0 {
+		errs = append(errs, "rates refresh period must be positive")
+	}
+	if c.Rates.MaxAge < 0 || c.Rates.Timeout < 0 {
+		errs = append(errs, "rates max age and timeout can not be negative")
+	}
+	if c.Ledger.ReconcilePeriod < 0 {
+		errs = append(errs, "ledger reconcile period can not be negative")
+	}
+	switch c.Mail.Transport {
+	case mailer.TransportSMTP:
+		if c.Mail.SMTP.Host == "" || c.Mail.SMTP.Port <= 0 || c.Mail.SMTP.Port > 65535 {
+			errs = append(errs, "mail smtp host and port are required")
+		}
+	case mailer.TransportFile:
+		if c.Mail.File == "" {
+			errs = append(errs, "mail file is required")
+		}
+	case mailer.TransportLog:
+	default:
+		errs = append(errs, fmt.Sprintf("unknown mail transport %q", c.Mail.Transport))
+	}
+	if c.Email.DomainCheck != emaildomain.CheckNone && c.Email.DomainCheck != emaildomain.CheckDNS {
+		errs = append(errs, fmt.Sprintf("unknown email domain check %q", c.Email.DomainCheck))
+	}
+	for _, limit := range []struct {
+		name string
+		LimitConfig
+	}{{"account", c.Login.Account}, {"client", c.Login.Client}} {
+		if limit.FreeAttempts < 0 || limit.LockoutAttempts <= limit.FreeAttempts {
+			errs = append(errs, fmt.Sprintf("login %s lockout attempts must be above the free attempts", limit.name))
+		}
+		if limit.BaseDelay <= 0 || limit.LockoutDuration < limit.BaseDelay || limit.Window <= 0 {
+			errs = append(errs, fmt.Sprintf("login %s delays must be positive, the lockout not shorter "+
+				"than the base delay", limit.name))
+		}
+	}
+	if c.Email.DomainCheckTimeout < 0 || c.Email.DomainCacheTTL < 0 {
+		errs = append(errs, "email domain check timeout and cache ttl can not be negative")
+	}
+
+	if len(errs) > 0 {
+		return errors.New("bad config: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// String prints the config as YAML with the secrets redacted
+func (c Config) String() string {
+	if c.DB.Pass != "" {
+		c.DB.Pass = redacted
+	}
+	if c.Mail.SMTP.Pass != "" {
+		c.Mail.SMTP.Pass = redacted
+	}
+	c.JWT.Keys = redactKeys(c.JWT.Keys)
+
+	out, err := yaml.Marshal(c)
+	if err != nil {
+		return err.Error()
+	}
+	return string(out)
+}
+
+// redactKeys hides HMAC secrets of the keyring spec, the other keys are only paths to PEM files
+func redactKeys(spec string) string {
+	entries := strings.Split(spec, ";")
+	for i, entry := range entries {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+		if len(parts) == 3 && strings.HasPrefix(parts[1], "HS") {
+			entries[i] = parts[0] + ":" + parts[1] + ":" + redacted
+		}
+	}
+	return strings.Join(entries, ";")
+}
+
+// loadFile reads YAML or JSON config, JSON is valid YAML so both are decoded the same way
+func loadFile(path string, cfg *Config) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error while reading config file: %v", err)
+	}
+	if err = yaml.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("error while parsing config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// lookupArg finds the value of the flag before the flags are parsed
+func lookupArg(args []string, name string) (string, bool) {
+	for i, arg := range args {
+		arg = strings.TrimLeft(arg, "-")
+		if arg == name && i+1 < len(args) {
+			return args[i+1], true
+		}
+		if strings.HasPrefix(arg, name+"=") {
+			return strings.TrimPrefix(arg, name+"="), true
+		}
+	}
+	return "", false
+}
+
+type decimalValue struct {
+	d *decimal.Decimal
+}
+
+func (v decimalValue) String() string {
+	if v.d == nil {
+		return ""
+	}
+	return v.d.String()
+}
+
+func (v decimalValue) Set(s string) (err error) {
+	*v.d, err = decimal.NewFromString(s)
+	return
+}
+
+type listValue struct {
+	l *[]string
+}
+
+func (v listValue) String() string {
+	if v.l == nil {
+		return ""
+	}
+	return strings.Join(*v.l, ",")
+}
+
+func (v listValue) Set(s string) error {
+	*v.l = nil
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*v.l = append(*v.l, item)
+		}
+	}
+	return nil
+}
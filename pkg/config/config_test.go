@@ -0,0 +1,199 @@
+package config
+
+import (
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLoadLayers(t *testing.T) {
+	path := writeConfig(t, "config.yaml", `
+server:
+  port: "9000"
+db:
+  host: file-host
+  name: file-name
+  acquire_timeout: 2s
+crypto:
+  commission: "0.02"
+cors:
+  allowed_origins: ["https://file.example.com"]
+`)
+	t.Setenv("CRYPTO_JWT_KEYS", "test:HS256:secret")
+	t.Setenv("CRYPTO_DB_NAME", "env-name")
+	t.Setenv("CRYPTO_DB_LOGIN", "env-login")
+	t.Setenv("CRYPTO_CORS_ALLOWED_ORIGINS", "https://a.example.com, https://b.example.com")
+
+	cfg, err := Load([]string{"-config", path, "-db-login", "flag-login", "-default-balance", "50"})
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		name     string
+		got      interface{}
+		expected interface{}
+	}{
+		{"default", cfg.DB.Port, 5432},
+		{"default", cfg.DB.MaxConnections, 20},
+		{"file", cfg.Server.Port, "9000"},
+		{"file", cfg.DB.Host, "file-host"},
+		{"file", cfg.DB.AcquireTimeout, 2 * time.Second},
+		{"file", cfg.Crypto.Commission.String(), "0.02"},
+		{"env over file", cfg.DB.Name, "env-name"},
+		{"env over file", cfg.CORS.AllowedOrigins, []string{"https://a.example.com", "https://b.example.com"}},
+		{"flag over env", cfg.DB.Login, "flag-login"},
+		{"flag", cfg.Crypto.DefaultBalance.String(), "50"},
+	} {
+		require.Equal(t, c.expected, c.got, c.name)
+	}
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	// JSON is read the same way as YAML
+	path := writeConfig(t, "config.json", `{"server": {"port": "9100"}}`)
+	t.Setenv("CRYPTO_CONFIG", path)
+	t.Setenv("CRYPTO_JWT_KEYS", "test:HS256:secret")
+
+	cfg, err := Load([]string{})
+	require.NoError(t, err)
+	require.Equal(t, "9100", cfg.Server.Port)
+}
+
+func TestLoadJWTKeys(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{"configured keys", []string{"-jwt-keys", "test:HS256:secret"}, "test:HS256:secret"},
+		// the tokens of the insecure key die with the data of the memory storage
+		{"memory storage", []string{"-storage", "memory"}, legacyJWTKeys},
+		{"postgres storage", []string{}, ""},
+	} {
+		cfg, err := Load(c.args)
+		if c.expected == "" {
+			require.Error(t, err, c.name)
+			require.Contains(t, err.Error(), "jwt keys are required", c.name)
+			continue
+		}
+		require.NoError(t, err, c.name)
+		require.Equal(t, c.expected, cfg.JWT.Keys, c.name)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		args []string
+		env  map[string]string
+	}{
+		{"missing file", []string{"-config", filepath.Join(t.TempDir(), "missing.yaml")}, nil},
+		{"broken file", []string{"-config", writeConfig(t, "broken.yaml", "db: [")}, nil},
+		{"unknown flag", []string{"-unknown", "1"}, nil},
+		{"bad env", []string{}, map[string]string{"CRYPTO_DB_PORT": "port"}},
+		{"bad decimal", []string{"-commission", "one"}, nil},
+		{"invalid value", []string{"-db-max-connections", "1"}, nil},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			for k, v := range c.env {
+				t.Setenv(k, v)
+			}
+			_, err := Load(c.args)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		change func(cfg *Config)
+		errMsg string
+	}{
+		{"no port", func(cfg *Config) { cfg.Server.Port = "" }, "server port is empty"},
+		{"unknown storage", func(cfg *Config) { cfg.Storage = "redis" }, `unknown storage "redis"`},
+		{"no jwt keys", func(cfg *Config) { cfg.JWT.Keys = "" }, "jwt keys are required"},
+		{"no db host", func(cfg *Config) { cfg.DB.Host = "" }, "db host, name and login are required"},
+		{"db port out of range", func(cfg *Config) { cfg.DB.Port = 70000 }, "db port 70000 is out of range"},
+		{"one connection", func(cfg *Config) { cfg.DB.MaxConnections = 1 }, "db max connections must be at least 2"},
+		{"negative timeout", func(cfg *Config) { cfg.DB.AcquireTimeout = -time.Second },
+			"db timeouts can not be negative"},
+		{"commission of 100%", func(cfg *Config) { cfg.Crypto.Commission = decimal.NewFromInt(1) },
+			"commission must be in [0, 1)"},
+		{"negative balance", func(cfg *Config) { cfg.Crypto.DefaultBalance = decimal.NewFromInt(-1) },
+			"default balance can not be negative"},
+		{"bcrypt cost", func(cfg *Config) { cfg.Crypto.BcryptCost = 1 }, "bcrypt cost must be in [4, 31]"},
+		{"rates without refresh period", func(cfg *Config) {
+			cfg.Rates.Source = "rates.json"
+			cfg.Rates.RefreshPeriod = 0
+		}, "rates refresh period must be positive"},
+		{"negative rates max age", func(cfg *Config) { cfg.Rates.MaxAge = -time.Minute },
+			"rates max age and timeout can not be negative"},
+		{"negative rates timeout", func(cfg *Config) { cfg.Rates.Timeout = -time.Second },
+			"rates max age and timeout can not be negative"},
+		{"negative reconcile period", func(cfg *Config) { cfg.Ledger.ReconcilePeriod = -time.Minute },
+			"ledger reconcile period can not be negative"},
+		{"no password reset ttl", func(cfg *Config) { cfg.Crypto.PasswordResetTTL = 0 },
+			"password reset ttl must be positive"},
+		{"unknown mail transport", func(cfg *Config) { cfg.Mail.Transport = "pigeon" },
+			`unknown mail transport "pigeon"`},
+		{"smtp without host", func(cfg *Config) { cfg.Mail.Transport = "smtp" },
+			"mail smtp host and port are required"},
+		{"smtp port out of range", func(cfg *Config) {
+			cfg.Mail.Transport = "smtp"
+			cfg.Mail.SMTP.Host = "localhost"
+			cfg.Mail.SMTP.Port = 0
+		}, "mail smtp host and port are required"},
+		{"file without path", func(cfg *Config) { cfg.Mail.Transport = "file" }, "mail file is required"},
+		{"no email verification ttl", func(cfg *Config) { cfg.Crypto.EmailVerificationTTL = 0 },
+			"email verification ttl must be positive"},
+		{"unknown domain check", func(cfg *Config) { cfg.Email.DomainCheck = "smtp" },
+			`unknown email domain check "smtp"`},
+		{"issuer with colon", func(cfg *Config) { cfg.Crypto.MFA.Issuer = "Crypto:App" },
+			"mfa issuer must be non empty and without colons"},
+		{"no mfa challenge ttl", func(cfg *Config) { cfg.Crypto.MFA.ChallengeTTL = 0 },
+			"mfa challenge ttl must be positive"},
+		{"negative transfer threshold", func(cfg *Config) { cfg.Crypto.MFA.TransferThreshold = decimal.NewFromInt(-1) },
+			"mfa transfer threshold can not be negative"},
+		{"lockout before the free attempts", func(cfg *Config) { cfg.Login.Account.LockoutAttempts = 5 },
+			"login account lockout attempts must be above the free attempts"},
+		{"lockout shorter than the delay", func(cfg *Config) { cfg.Login.Client.LockoutDuration = time.Millisecond },
+			"login client delays must be positive"},
+		{"no login window", func(cfg *Config) { cfg.Login.Account.Window = 0 }, "login account delays must be positive"},
+		{"negative domain cache ttl", func(cfg *Config) { cfg.Email.DomainCacheTTL = -time.Minute },
+			"email domain check timeout and cache ttl can not be negative"},
+	} {
+		cfg := Default()
+		cfg.JWT.Keys = "test:HS256:secret"
+		require.NoError(t, cfg.Validate(), c.name)
+
+		c.change(&cfg)
+		err := cfg.Validate()
+		require.Error(t, err, c.name)
+		require.Contains(t, err.Error(), c.errMsg, c.name)
+	}
+}
+
+func TestStringRedactsSecrets(t *testing.T) {
+	cfg := Default()
+	cfg.DB.Pass = "db-secret"
+	cfg.Mail.SMTP.Pass = "smtp-secret"
+	cfg.JWT.Keys = "old:HS256:hmac-secret;new:EdDSA:/etc/crypto/new.pem"
+
+	out := cfg.String()
+	require.False(t, strings.Contains(out, "db-secret"))
+	require.False(t, strings.Contains(out, "hmac-secret"))
+	require.False(t, strings.Contains(out, "smtp-secret"))
+	// the paths to PEM files are not secret
+	require.Contains(t, out, "old:HS256:***;new:EdDSA:/etc/crypto/new.pem")
+}
@@ -2,15 +2,27 @@ package crypto_app
 
 import (
 	"context"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
 	"github.com/dgrijalva/jwt-go"
-	"github.com/jackc/pgx"
-	"github.com/lib/pq"
-	"math/rand"
+	"github.com/shopspring/decimal"
+	"github.com/crypto_app/pkg/address"
+	"github.com/crypto_app/pkg/keyring"
+	"github.com/crypto_app/pkg/limiter"
+	"github.com/crypto_app/pkg/mailer"
 	"github.com/crypto_app/pkg/models"
+	"github.com/crypto_app/pkg/storage"
+	"github.com/crypto_app/pkg/totp"
 	"github.com/crypto_app/tools"
-	"net"
 	"net/http"
+	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
@@ -19,30 +31,77 @@ import (
 )
 
 const (
-	defaultBalance = float64(100)
-	btc            = 1
-	eth            = 2
+	accessTokenTTL  = int64(3600)
+	refreshTokenTTL = 30 * 24 * time.Hour
+
+	defaultTransactionsLimit = 20
+	maxTransactionsLimit     = 100
+
+	// defaultCandles the number of the candles returned when the range is not set
+	defaultCandles = 100
+	maxCandles     = 1000
+
+	// maxAddressAttempts the new address is generated again when it is taken, the collision is almost impossible
+	maxAddressAttempts = 5
+	// maxPrecision the balances are kept as numeric(38, 18)
+	maxPrecision = 18
+	// maxWalletLabelLen the label is kept as varchar(64)
+	maxWalletLabelLen = 64
+
+	// maxNameLen the names and the address are kept as varchar(256)
+	maxNameLen = 256
+	// maxDescriptionLen the description is kept as varchar(1024)
+	maxDescriptionLen = 1024
+	dobLayout         = "2006-01-02"
+
+	recoveryCodesCount = 10
+	// mfaSkew the codes of the neighbour time steps are accepted too, the clocks of the phones drift
+	mfaSkew = 1
+	// maxMFAAttempts the wrong codes the log in challenge survives, the transfer codes are locked after as many
+	maxMFAAttempts = 5
 )
 
+// addressFormats the generators of the addresses by the format of the currency
+var addressFormats = map[string]func(currency storage.Currency) (string, error){
+	address.FormatBase58Check: func(currency storage.Currency) (string, error) {
+		return address.Generate(currency.Name)
+	},
+}
+
+var currencyCodeRegex = regexp.MustCompile(`^[A-Z0-9]{2,10}$`)
+
+// candleIntervals the intervals the candles can be grouped by
+var candleIntervals = map[string]time.Duration{
+	"1m": time.Minute,
+	"1h": time.Hour,
+	"1d": 24 * time.Hour,
+}
+
 var emailRegex = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 
-// isEmailValid checks if the email provided passes the required structure and length.
+// isEmailValid checks if the email provided passes the required structure and length,
+// the domain is checked only at the registration, see crypto.checkEmailDomain
+// normalizeEmail the email is kept and looked up in the lower case, so the case typed by the user
+// does not make another account or another set of the log in attempts
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
 func isEmailValid(email string) bool {
-	if len(email) < 3 && len(email) > 254 {
+	if len(email) < 3 || len(email) > 254 {
 		return false
 	}
-	preValid := emailRegex.MatchString(email)
-	if !preValid {
-		return preValid
-	}
+	return emailRegex.MatchString(email)
+}
 
-	some := strings.Split(email, "@")
-	if len(some) != 2 {
-		return false
+// userIDFromContext returns the id of the user the auth middleware put into the context. The request without it
+// is not authorized, whatever handler it reached.
+func userIDFromContext(ctx context.Context) (userID int, err error) {
+	id, _ := ctx.Value(models.CtxKey("id")).(string)
+	if userID, err = strconv.Atoi(id); err != nil {
+		err = tools.NewErrorMessage(err, "Ошибка при получении user_id из контекста", http.StatusUnauthorized)
 	}
-
-	_, err := net.LookupIP(some[1])
-	return err == nil
+	return
 }
 
 func checkThePass(pass string) (err error) {
@@ -76,80 +135,667 @@ func checkTheUserData(firstName, lastName string) (err error) {
 	return
 }
 
-func generateToken(userID int32) (response string, err error) {
+// checkTheProfile trims the fields of the update and checks them, the names are checked as at the registration
+func checkTheProfile(input *models.UpdateUserData) (err error) {
+	if input.Name == nil && input.LastName == nil && input.DOB == nil && input.Address == nil &&
+		input.Description == nil {
+		return tools.NewErrorMessage(errors.New("nothing to update"), "Нет полей для изменения", http.StatusBadRequest)
+	}
+
+	var names [2]string
+	for i, field := range []*string{input.Name, input.LastName} {
+		if field == nil {
+			continue
+		}
+		*field = strings.TrimSpace(*field)
+		if *field == "" {
+			return tools.NewErrorMessage(errors.New("empty name"), "Имя и фамилия не могут быть пустыми",
+				http.StatusBadRequest)
+		}
+		if len([]rune(*field)) > maxNameLen {
+			return tools.NewErrorMessage(errors.New("name is too long"),
+				fmt.Sprintf("Имя и фамилия должны быть не длиннее %d символов", maxNameLen), http.StatusBadRequest)
+		}
+		names[i] = *field
+	}
+	if err = checkTheUserData(names[0], names[1]); err != nil {
+		return
+	}
+
+	if input.DOB != nil && *input.DOB != "" {
+		dob, er := time.Parse(dobLayout, *input.DOB)
+		if er != nil {
+			return tools.NewErrorMessage(er, "Дата рождения должна быть в формате ГГГГ-ММ-ДД", http.StatusBadRequest)
+		}
+		if dob.Year() < 1900 || dob.After(time.Now()) {
+			return tools.NewErrorMessage(errors.New("bad dob"), "Некорректная дата рождения", http.StatusBadRequest)
+		}
+	}
+
+	if input.Address != nil {
+		if *input.Address = strings.TrimSpace(*input.Address); len([]rune(*input.Address)) > maxNameLen {
+			return tools.NewErrorMessage(errors.New("address is too long"),
+				fmt.Sprintf("Адрес должен быть не длиннее %d символов", maxNameLen), http.StatusBadRequest)
+		}
+	}
+	if input.Description != nil {
+		if *input.Description = strings.TrimSpace(*input.Description); len([]rune(*input.Description)) > maxDescriptionLen {
+			return tools.NewErrorMessage(errors.New("description is too long"),
+				fmt.Sprintf("Описание должно быть не длиннее %d символов", maxDescriptionLen), http.StatusBadRequest)
+		}
+	}
+	return
+}
+
+// profileResponse formats the dates of the profile
+func profileResponse(profile models.SingleUserDataDbResponse) (output models.SingleUserData) {
+	output = models.SingleUserData{
+		ID:            profile.ID,
+		Name:          profile.Name,
+		LastName:      profile.LastName,
+		Email:         profile.Email,
+		EmailVerified: profile.EmailVerified,
+		Address:       profile.Address,
+		Description:   profile.Description,
+		CreateAt:      profile.CreateAt.Time.UTC().Format(time.RFC3339),
+	}
+	if profile.DOB.Valid {
+		dob := profile.DOB.Time.Format(dobLayout)
+		output.DOB = &dob
+	}
+	if profile.UpdatedAt.Valid {
+		updatedAt := profile.UpdatedAt.Time.UTC().Format(time.RFC3339)
+		output.UpdatedAt = &updatedAt
+	}
+	return
+}
+
+func generateToken(keys *keyring.Keyring, userID int32, sessionID string, admin bool) (response string, err error) {
+	jti, err := randToken(16)
+	if err != nil {
+		return
+	}
+
 	claims := models.ClaimWithID{
-		ID: strconv.Itoa(int(userID)),
+		ID:        strconv.Itoa(int(userID)),
+		SessionID: sessionID,
+		Admin:     admin,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Unix() + 3600,
+			Id:        jti,
+			ExpiresAt: time.Now().Unix() + accessTokenTTL,
 			IssuedAt:  time.Now().Unix(),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	response, err = token.SignedString(models.JwtSigningKey)
+	response, err = keys.Sign(claims)
 	return
 }
 
-func createDefaultWalletsWithDefaultBalance(ctx context.Context, tx *pgx.Tx, userID int32) (err error) {
-	const (
-		queryToAddNewWallet = `insert into addresses (address, user_id, salary_id, balance) values ($1,$2,$3,$4);`
-	)
+// generateTokenPair issues a new access token and a refresh token belonging to the given family.
+// Only the hash of the refresh token is stored, the token itself is returned to the client once.
+func generateTokenPair(ctx context.Context, store storage.Tokens, keys *keyring.Keyring, userID int32, familyID string,
+	admin bool) (output models.RegisterResponse, err error) {
+	output.AccessToken, err = generateToken(keys, userID, familyID, admin)
+	if err != nil {
+		err = tools.NewErrorMessage(err, "Ошибка при создании токена", http.StatusInternalServerError)
+		return
+	}
 
-	address := randNumberString(20)
-	rows, err := tx.QueryEx(ctx, queryToAddNewWallet, nil, address, userID, btc, defaultBalance)
+	output.RefreshToken, err = randToken(32)
 	if err != nil {
-		err = tools.NewErrorMessage(err, "Ошибка при создании кошелька",
-			http.StatusInternalServerError)
+		err = tools.NewErrorMessage(err, "Ошибка при создании refresh токена", http.StatusInternalServerError)
 		return
 	}
-	rows.Close()
 
-	address = randNumberString(20)
-	rows, err = tx.QueryEx(ctx, queryToAddNewWallet, nil, address, userID, eth, defaultBalance)
+	if err = store.SaveRefreshToken(ctx, hashToken(output.RefreshToken), userID, familyID,
+		refreshTokenTTL); err != nil {
+		err = tools.NewErrorMessage(err, "Ошибка при сохранении refresh токена", http.StatusInternalServerError)
+	}
+	return
+}
+
+// randToken returns n cryptographically random bytes encoded as url safe base64
+func randToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := cryptorand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// passwordResetMessage the mail with the token the password is reset with
+func passwordResetMessage(email string, token string, settings Settings) mailer.Message {
+	var body strings.Builder
+	body.WriteString("Здравствуйте!\n\n")
+	if settings.PasswordResetURL != "" {
+		fmt.Fprintf(&body, "Чтобы задать новый пароль, перейдите по ссылке: %s%s\n", settings.PasswordResetURL,
+			url.QueryEscape(token))
+	} else {
+		fmt.Fprintf(&body, "Токен для сброса пароля: %s\n", token)
+	}
+	fmt.Fprintf(&body, "Срок действия истекает %s UTC.\n\n",
+		time.Now().Add(settings.PasswordResetTTL).UTC().Format("2006-01-02 15:04"))
+	body.WriteString("Если вы не запрашивали сброс пароля, просто проигнорируйте это письмо.\n")
+
+	return mailer.Message{
+		To:      email,
+		Subject: "Сброс пароля",
+		Body:    body.String(),
+	}
+}
+
+// newRecoveryCodes returns the recovery codes shown to the user once and the hashes of them to keep
+func newRecoveryCodes() (codes []string, hashes []string, err error) {
+	for i := 0; i < recoveryCodesCount; i++ {
+		b := make([]byte, 5)
+		if _, err = cryptorand.Read(b); err != nil {
+			return nil, nil, tools.NewErrorMessage(err, "Ошибка при создании кодов восстановления",
+				http.StatusInternalServerError)
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		code = code[:4] + "-" + code[4:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return
+}
+
+// hashRecoveryCode the code is hashed regardless of the case and the dashes it is typed with
+func hashRecoveryCode(code string) string {
+	return hashToken(strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code)))
+}
+
+// checkMFACode accepts the TOTP code of the secret only once, the recovery code is accepted when recovery is set
+func checkMFACode(ctx context.Context, tx storage.MFA, secret storage.MFASecret, code string, recovery bool) (
+	ok bool, err error) {
+	code = strings.TrimSpace(code)
+	if counter, valid := totp.Validate(secret.Secret, code, time.Now(), mfaSkew); valid {
+		if counter <= secret.LastCounter {
+			return false, nil
+		}
+		if err = tx.SetMFACounter(ctx, secret.UserID, counter); err != nil {
+			return false, tools.NewErrorMessage(err, "Ошибка при сохранении кода", http.StatusInternalServerError)
+		}
+		return true, nil
+	}
+
+	if !recovery || code == "" {
+		return false, nil
+	}
+	if ok, err = tx.UseRecoveryCode(ctx, secret.UserID, hashRecoveryCode(code)); err != nil {
+		err = tools.NewErrorMessage(err, "Ошибка при проверке кода восстановления", http.StatusInternalServerError)
+	}
+	return
+}
+
+// checkTransferCode requires the fresh TOTP code of the user, the recovery codes are only for the log in.
+// The codes are counted by the limiter outside the transaction, the rollback of the transfer does not take them back.
+func checkTransferCode(ctx context.Context, tx storage.MFA, codes *limiter.Limiter, userID int32, code string) (
+	err error) {
+	secret, err := tx.GetMFASecret(ctx, userID)
+	if err != nil && err != storage.ErrNotFound {
+		return tools.NewErrorMessage(err, "Ошибка при получении второго фактора", http.StatusInternalServerError)
+	}
+	if err == storage.ErrNotFound || !secret.Enabled {
+		return tools.NewErrorMessage(errors.New("mfa is not enabled"),
+			"Для переводов на такую сумму включите двухфакторную аутентификацию", http.StatusForbidden)
+	}
+	if code == "" {
+		return tools.NewErrorMessage(errors.New("otp is required"),
+			"Для перевода на такую сумму нужен код двухфакторной аутентификации", http.StatusForbidden)
+	}
+
+	key := strconv.Itoa(int(userID))
+	retryAfter, err := codes.Attempt(ctx, key)
 	if err != nil {
-		err = tools.NewErrorMessage(err, "Ошибка при создании кошелька",
-			http.StatusInternalServerError)
+		return tools.NewErrorMessage(err, "Ошибка при сохранении попытки ввода кода", http.StatusInternalServerError)
+	}
+	if retryAfter > 0 {
+		return tools.NewErrorMessage(errors.New("too many otp attempts"),
+			fmt.Sprintf("Слишком много неверных кодов, повторите через %d сек", int(math.Ceil(retryAfter.Seconds()))),
+			http.StatusTooManyRequests)
+	}
+
+	ok, err := checkMFACode(ctx, tx, secret, code, false)
+	if err != nil {
+		return
+	}
+	if !ok {
+		return tools.NewErrorMessage(errors.New("bad otp"), "Неверный код двухфакторной аутентификации",
+			http.StatusForbidden)
+	}
+
+	if err = codes.Reset(ctx, key); err != nil {
+		return tools.NewErrorMessage(err, "Ошибка при сбросе попыток ввода кода", http.StatusInternalServerError)
+	}
+	return
+}
+
+// saveEmailVerificationToken creates the token the email of the user is confirmed with
+func saveEmailVerificationToken(ctx context.Context, tx storage.Storage, userID int32, ttl time.Duration) (
+	token string, err error) {
+	if token, err = randToken(32); err != nil {
+		return "", tools.NewErrorMessage(err, "Ошибка при создании токена", http.StatusInternalServerError)
+	}
+	if err = tx.SaveEmailVerificationToken(ctx, hashToken(token), userID, ttl); err != nil {
+		return "", tools.NewErrorMessage(err, "Ошибка при сохранении токена", http.StatusInternalServerError)
 	}
-	rows.Close()
 	return
 }
 
-func randNumberString(n int) string {
-	var addressSymbols = "1234567890"
-	b := make([]uint8, n)
-	for i := range b {
-		b[i] = addressSymbols[rand.Intn(len(addressSymbols))]
+// emailVerificationMessage the mail with the token the email is confirmed with
+func emailVerificationMessage(email string, token string, settings Settings) mailer.Message {
+	var body strings.Builder
+	body.WriteString("Здравствуйте!\n\n")
+	if settings.EmailVerificationURL != "" {
+		fmt.Fprintf(&body, "Чтобы подтвердить емейл, перейдите по ссылке: %s%s\n", settings.EmailVerificationURL,
+			url.QueryEscape(token))
+	} else {
+		fmt.Fprintf(&body, "Токен для подтверждения емейла: %s\n", token)
+	}
+	fmt.Fprintf(&body, "Срок действия истекает %s UTC.\n\n",
+		time.Now().Add(settings.EmailVerificationTTL).UTC().Format("2006-01-02 15:04"))
+	body.WriteString("Переводы станут доступны после подтверждения. " +
+		"Если вы не регистрировались, просто проигнорируйте это письмо.\n")
+
+	return mailer.Message{
+		To:      email,
+		Subject: "Подтверждение емейла",
+		Body:    body.String(),
 	}
-	return string(b)
 }
 
-func checkTheAddressesBelongToPerson(ctx context.Context, tx *pgx.Tx, addresses []int32, userID int32) (err error) {
-	var users []int32
-	const query = `select distinct user_id from addresses where id = any($1);`
+// createDefaultWalletsWithDefaultBalance opens the wallet in every enabled currency of the registry,
+// the default balance is granted by the ledger
+func createDefaultWalletsWithDefaultBalance(ctx context.Context, tx storage.Storage, userID int32,
+	defaultBalance decimal.Decimal) (err error) {
+	currencies, err := tx.GetCurrencies(ctx)
+	if err != nil {
+		return tools.NewErrorMessage(err, "Ошибка при получении валют", http.StatusInternalServerError)
+	}
 
-	rows, err := tx.QueryEx(ctx, query, nil, pq.Array(addresses))
+	for _, currency := range currencies {
+		if !currency.Enabled {
+			continue
+		}
+		walletID, err := createWallet(ctx, tx, currency, storage.Wallet{UserID: userID})
+		if err != nil {
+			return err
+		}
+		if !defaultBalance.IsPositive() {
+			continue
+		}
+		if err = tx.GrantBalance(ctx, walletID, defaultBalance); err != nil {
+			return tools.NewErrorMessage(err, "Ошибка при начислении баланса", http.StatusInternalServerError)
+		}
+	}
+	return
+}
+
+// createWallet saves the wallet in the currency under the new address in the format of the currency,
+// the address is generated again while it is taken
+func createWallet(ctx context.Context, tx storage.Wallets, currency storage.Currency, wallet storage.Wallet) (
+	walletID int32, err error) {
+	generate, ok := addressFormats[currency.AddressFormat]
+	if !ok {
+		err = tools.NewErrorMessage(fmt.Errorf("unknown address format %q of %s", currency.AddressFormat,
+			currency.Name), "Ошибка при создании кошелька", http.StatusInternalServerError)
+		return
+	}
+
+	wallet.CurrencyID = currency.ID
+	for attempt := 0; attempt < maxAddressAttempts; attempt++ {
+		if wallet.Address, err = generate(currency); err != nil {
+			return 0, tools.NewErrorMessage(err, "Ошибка при создании адреса кошелька", http.StatusInternalServerError)
+		}
+
+		walletID, err = tx.CreateWallet(ctx, wallet)
+		if err != storage.ErrAddressTaken {
+			break
+		}
+	}
+	if err != nil {
+		err = tools.NewErrorMessage(err, "Ошибка при создании кошелька", http.StatusInternalServerError)
+	}
+	return
+}
+
+// validateAddress refuses the malformed address before it is looked up
+func validateAddress(addr string) (err error) {
+	if err = address.ValidateAddress(addr); err != nil {
+		err = tools.NewErrorMessage(err, fmt.Sprintf("Невалидный адрес %s", addr), http.StatusBadRequest)
+	}
+	return
+}
+
+// resolveWalletID returns the id of the wallet, the wallet given by the public address is looked up
+// whoever its owner is
+func resolveWalletID(ctx context.Context, tx storage.Wallets, ref models.WalletRef) (walletID int32, err error) {
+	if ref.Address == "" {
+		return ref.ID, nil
+	}
+	if err = validateAddress(ref.Address); err != nil {
+		return
+	}
+
+	wallet, err := tx.GetWalletByAddress(ctx, ref.Address)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			err = tools.NewErrorMessage(err, fmt.Sprintf("Кошелек %s не найден", ref.Address), http.StatusNotFound)
+			return
+		}
+		err = tools.NewErrorMessage(err, "Ошибка при получении кошелька", http.StatusInternalServerError)
+		return
+	}
+	return wallet.ID, nil
+}
+
+// reserveIdempotencyKey stores the key with the fingerprint of the request. When the key is already known
+// the stored outcome is returned, the concurrent request with the same key waits until the first one commits.
+func reserveIdempotencyKey(ctx context.Context, tx storage.Idempotency, userID int32, input models.TransactionRequest) (
+	replayed bool, transactionID string, success bool, err error) {
+	// the code changes every 30 seconds, the retry with the fresh one is the same request
+	input.OTP = ""
+	body, err := json.Marshal(input)
+	if err != nil {
+		err = tools.NewErrorMessage(err, "Ошибка при обработке Idempotency-Key", http.StatusInternalServerError)
+		return
+	}
+	fingerprint := hashToken(string(body))
+
+	reserved, err := tx.ReserveIdempotencyKey(ctx, userID, input.IdempotencyKey, fingerprint)
+	if err != nil {
+		err = tools.NewErrorMessage(err, "Ошибка при сохранении Idempotency-Key", http.StatusInternalServerError)
+		return
+	}
+	if reserved {
+		return
+	}
+
+	storedFingerprint, transactionID, success, err := tx.GetIdempotencyKey(ctx, userID, input.IdempotencyKey)
+	if err != nil {
+		err = tools.NewErrorMessage(err, "Ошибка при получении Idempotency-Key", http.StatusInternalServerError)
+		return
+	}
+
+	if storedFingerprint != fingerprint {
+		err = tools.NewErrorMessage(errors.New("idempotency key reused with another request"),
+			"Данный Idempotency-Key уже использован для другого запроса", http.StatusConflict)
+		return
+	}
+	replayed = true
+	return
+}
+
+func saveIdempotentResult(ctx context.Context, tx storage.Idempotency, userID int32, key string, transactionID string,
+	success bool) (err error) {
+	if err = tx.SaveIdempotentResult(ctx, userID, key, transactionID, success); err != nil {
+		err = tools.NewErrorMessage(err, "Ошибка при сохранении результата транзакции",
+			http.StatusInternalServerError)
+	}
+	return
+}
+
+func getTransaction(ctx context.Context, tx storage.Transactions, userID int32, transactionID string,
+	output *models.TransactionDetail) (err error) {
+	if *output, err = tx.GetTransaction(ctx, userID, transactionID); err != nil {
+		if err == storage.ErrNotFound {
+			return tools.NewErrorMessage(err, "Транзакция не найдена", http.StatusNotFound)
+		}
+		return tools.NewErrorMessage(err, "Ошибка при получении транзакции", http.StatusInternalServerError)
+	}
+	return
+}
+
+// getTransferWallets returns the wallets of the transfer, the source has to belong to the user,
+// the destination only when the user moves the money between own wallets
+func getTransferWallets(ctx context.Context, tx storage.Wallets, fromID int32, toID int32, userID int32,
+	ownDestination bool) (from storage.Wallet, to storage.Wallet, err error) {
+	wallets, err := tx.GetWalletsByIDs(ctx, []int32{fromID, toID})
 	if err != nil {
 		err = tools.NewErrorMessage(err, "Ошибка при получении данных о адресах",
 			http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var localUser int32
-		err = rows.Scan(&localUser)
-		if err != nil {
-			err = tools.NewErrorMessage(err, "Ошибка при сканировании юзера при проверке",
-				http.StatusInternalServerError)
-			break
+	var fromFound, toFound bool
+	for _, wallet := range wallets {
+		switch wallet.ID {
+		case fromID:
+			from, fromFound = wallet, true
+		case toID:
+			to, toFound = wallet, true
+		}
+	}
+
+	if !fromFound || !toFound {
+		err = tools.NewErrorMessage(errors.New("wallet not found"), "Кошелек не найден", http.StatusNotFound)
+		return
+	}
+	if from.UserID != userID || (ownDestination && to.UserID != userID) {
+		err = tools.NewErrorMessage(errors.New("wallet of another user"), "Кошелек принадлежит другому пользователю",
+			http.StatusForbidden)
+		return
+	}
+	if from.ArchivedAt != nil || to.ArchivedAt != nil {
+		err = tools.NewErrorMessage(errors.New("wallet is archived"), "Кошелек архивирован", http.StatusBadRequest)
+	}
+	return
+}
+
+// checkCurrenciesEnabled refuses the transfer in the currency disabled in the registry
+func checkCurrenciesEnabled(ctx context.Context, tx storage.Currencies, currencyIDs ...int32) (err error) {
+	currencies, err := tx.GetCurrencies(ctx)
+	if err != nil {
+		return tools.NewErrorMessage(err, "Ошибка при получении валют", http.StatusInternalServerError)
+	}
+
+	enabled := make(map[int32]bool, len(currencies))
+	for _, currency := range currencies {
+		enabled[currency.ID] = currency.Enabled
+	}
+	for _, currencyID := range currencyIDs {
+		if !enabled[currencyID] {
+			return tools.NewErrorMessage(fmt.Errorf("currency %d is disabled", currencyID),
+				"Переводы в данной валюте отключены", http.StatusBadRequest)
+		}
+	}
+	return
+}
+
+// getRate returns the price of the currency the transfer is made with. The prices of the feed older
+// than maxAge are refused, the price set by the admin is used until it expires.
+func getRate(ctx context.Context, tx storage.Rates, currencyID int32, maxAge time.Duration) (rate decimal.Decimal,
+	err error) {
+	quote, err := tx.GetLatestQuote(ctx, currencyID)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			err = tools.NewErrorMessage(errors.New("no rate"), "Курс валюты неизвестен, перевод невозможен",
+				http.StatusServiceUnavailable)
+			return
+		}
+		err = tools.NewErrorMessage(err, "Ошибка при получении курса валюты", http.StatusInternalServerError)
+		return
+	}
+
+	if isQuoteStale(quote, maxAge) {
+		err = tools.NewErrorMessage(fmt.Errorf("rate of currency %d is stale since %s", currencyID,
+			quote.QuotedAt.Format(time.RFC3339)), "Курсы валют устарели, перевод невозможен",
+			http.StatusServiceUnavailable)
+		return
+	}
+	return quote.Price, nil
+}
+
+// isQuoteStale the price set by the admin is never stale, it is used until it expires
+func isQuoteStale(quote storage.Quote, maxAge time.Duration) bool {
+	return maxAge > 0 && quote.Source != storage.SourceManual && time.Since(quote.QuotedAt) > maxAge
+}
+
+// getCurrencyByName resolves the currency the admin refers to by its ticker
+func getCurrencyByName(ctx context.Context, tx storage.Currencies, name string) (currency storage.Currency, err error) {
+	if currency, err = tx.GetCurrencyByName(ctx, strings.ToUpper(name)); err != nil {
+		if err == storage.ErrNotFound {
+			err = tools.NewErrorMessage(err, "Валюта не найдена", http.StatusNotFound)
+			return
+		}
+		err = tools.NewErrorMessage(err, "Ошибка при получении валюты", http.StatusInternalServerError)
+	}
+	return
+}
+
+// validateCurrency checks the currency the admin saves to the registry
+func validateCurrency(currency storage.Currency) (err error) {
+	if !currencyCodeRegex.MatchString(currency.Name) {
+		return tools.NewErrorMessage(errors.New("bad code"),
+			"Код валюты должен состоять из 2-10 латинских букв и цифр", http.StatusBadRequest)
+	}
+	if name := strings.TrimSpace(currency.DisplayName); name == "" || len([]rune(name)) > 64 {
+		return tools.NewErrorMessage(errors.New("bad display name"),
+			"Название валюты должно быть от 1 до 64 символов", http.StatusBadRequest)
+	}
+	if currency.Scale < 0 || currency.Scale > maxPrecision {
+		return tools.NewErrorMessage(errors.New("bad precision"),
+			fmt.Sprintf("precision должен быть от 0 до %d", maxPrecision), http.StatusBadRequest)
+	}
+	if _, ok := addressFormats[currency.AddressFormat]; !ok {
+		return tools.NewErrorMessage(errors.New("bad address format"), "Неизвестный формат адреса",
+			http.StatusBadRequest)
+	}
+	return
+}
+
+func currencyResponse(currency storage.Currency) *models.CurrencyResponse {
+	return &models.CurrencyResponse{
+		Code:          currency.Name,
+		DisplayName:   currency.DisplayName,
+		Precision:     currency.Scale,
+		AddressFormat: currency.AddressFormat,
+		Enabled:       currency.Enabled,
+	}
+}
+
+// newCandleFilter validates the query of the candles, the missing end of the range is now
+// and the missing start is defaultCandles intervals before the end
+func newCandleFilter(input models.GetCandlesRequest, currencyID int32) (filter storage.CandleFilter, err error) {
+	interval, ok := candleIntervals[input.Interval]
+	if !ok {
+		err = tools.NewErrorMessage(errors.New("bad interval"), "interval должен быть одним из 1m, 1h, 1d",
+			http.StatusBadRequest)
+		return
+	}
+
+	filter = storage.CandleFilter{
+		CurrencyID: currencyID,
+		Interval:   interval,
+		To:         time.Now(),
+	}
+	if input.To != nil {
+		filter.To = *input.To
+	}
+	filter.From = filter.To.Add(-defaultCandles * interval).Truncate(interval)
+	if input.From != nil {
+		filter.From = *input.From
+	}
+
+	if !filter.From.Before(filter.To) {
+		err = tools.NewErrorMessage(errors.New("bad range"), "from должен быть раньше to", http.StatusBadRequest)
+		return
+	}
+	if filter.To.Sub(filter.From) > maxCandles*interval {
+		err = tools.NewErrorMessage(errors.New("range is too wide"),
+			fmt.Sprintf("Диапазон не должен превышать %d интервалов", maxCandles), http.StatusBadRequest)
+	}
+	return
+}
+
+// newTransactionFilter validates the query of the transaction list
+func newTransactionFilter(input models.GetTransactionsRequest) (filter storage.TransactionFilter, err error) {
+	filter = storage.TransactionFilter{
+		Limit:     input.Limit,
+		DateFrom:  input.DateFrom,
+		DateTo:    input.DateTo,
+		Currency:  strings.ToUpper(input.Currency),
+		Address:   input.Address,
+		Direction: input.Direction,
+		Success:   input.Success,
+		MinAmount: input.MinAmount,
+		MaxAmount: input.MaxAmount,
+	}
+
+	if filter.Limit == 0 {
+		filter.Limit = defaultTransactionsLimit
+	}
+	if filter.Limit < 0 || filter.Limit > maxTransactionsLimit {
+		err = tools.NewErrorMessage(errors.New("bad limit"),
+			fmt.Sprintf("limit должен быть от 1 до %d", maxTransactionsLimit), http.StatusBadRequest)
+		return
+	}
+
+	switch filter.Direction {
+	case "", models.DirectionInternal, models.DirectionOutgoing, models.DirectionIncoming:
+	default:
+		err = tools.NewErrorMessage(errors.New("bad direction"),
+			"direction может быть internal, outgoing или incoming", http.StatusBadRequest)
+		return
+	}
+
+	if filter.DateFrom != nil && filter.DateTo != nil && !filter.DateFrom.Before(*filter.DateTo) {
+		err = tools.NewErrorMessage(errors.New("bad date range"), "date_from должен быть раньше date_to",
+			http.StatusBadRequest)
+		return
+	}
+	if filter.MinAmount != nil && filter.MaxAmount != nil && filter.MinAmount.GreaterThan(*filter.MaxAmount) {
+		err = tools.NewErrorMessage(errors.New("bad amount range"), "min_amount больше max_amount",
+			http.StatusBadRequest)
+		return
+	}
+	if filter.Address != "" {
+		if err = validateAddress(filter.Address); err != nil {
+			return
 		}
-		users = append(users, localUser)
 	}
 
-	if len(users) == 1 && users[0] == userID {
-		return nil
+	if input.Cursor != "" {
+		var key storage.TransactionKey
+		if key, err = decodeCursor(input.Cursor); err != nil {
+			err = tools.NewErrorMessage(err, "Невалидный cursor", http.StatusBadRequest)
+			return
+		}
+		filter.After = &key
+	}
+	return
+}
+
+// encodeCursor the cursor is opaque for the client, it is the position of the last transaction of the page
+func encodeCursor(key storage.TransactionKey) string {
+	raw := strconv.FormatInt(key.CreateAt.UnixNano(), 10) + ":" + strconv.FormatInt(key.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (key storage.TransactionKey, err error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return
+	}
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 2 {
+		err = errors.New("bad cursor")
+		return
+	}
+
+	nano, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return
+	}
+	if key.ID, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+		return
 	}
-	err = tools.NewErrorMessage(errors.New("bad addresses"), "В данном наборе адресов есть адреса принадлежащие нескольким пользователям",
-		http.StatusBadRequest)
+	key.CreateAt = time.Unix(0, nano).UTC()
 	return
 }
@@ -0,0 +1,639 @@
+package crypto_app
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/crypto_app/pkg/address"
+	"github.com/crypto_app/pkg/keyring"
+	"github.com/crypto_app/pkg/limiter"
+	"github.com/crypto_app/pkg/models"
+	"github.com/crypto_app/pkg/storage"
+	"github.com/crypto_app/pkg/totp"
+	"github.com/crypto_app/tools"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the ids of the currencies the memory storage starts with
+const (
+	btc = 1
+	eth = 2
+)
+
+// failingTokens fails to save the refresh tokens
+type failingTokens struct {
+	storage.Tokens
+}
+
+func (f failingTokens) SaveRefreshToken(ctx context.Context, tokenHash string, userID int32, familyID string,
+	ttl time.Duration) (err error) {
+	return errors.New("db is down")
+}
+
+// takenAddresses refuses the first addresses as taken
+type takenAddresses struct {
+	storage.Wallets
+	taken     int
+	addresses []string
+}
+
+func (w *takenAddresses) CreateWallet(ctx context.Context, wallet storage.Wallet) (walletID int32, err error) {
+	w.addresses = append(w.addresses, wallet.Address)
+	if len(w.addresses) <= w.taken {
+		return 0, storage.ErrAddressTaken
+	}
+	return w.Wallets.CreateWallet(ctx, wallet)
+}
+
+func TestIsEmailValid(t *testing.T) {
+	for _, c := range []struct {
+		email string
+		valid bool
+	}{
+		{"alice@localhost", true},
+		{"alice.petrova+crypto@mail.example.com", true},
+		// the domain is not looked up, it is checked at the registration only
+		{"alice@unresolvable.invalid", true},
+		{"a@", false},
+		{"alice", false},
+		{"alice@-example.com", false},
+		{"alice@" + strings.Repeat("a", 63) + "." + strings.Repeat("b", 63) + "." + strings.Repeat("c", 63) + "." +
+			strings.Repeat("d", 60), false},
+	} {
+		require.Equal(t, c.valid, isEmailValid(c.email), c.email)
+	}
+}
+
+func TestUserIDFromContext(t *testing.T) {
+	ctx := context.Background()
+
+	for _, c := range []struct {
+		name   string
+		ctx    context.Context
+		userID int
+		ok     bool
+	}{
+		{"user id", context.WithValue(ctx, models.CtxKey("id"), "42"), 42, true},
+		{"no user id", ctx, 0, false},
+		{"not a number", context.WithValue(ctx, models.CtxKey("id"), "alice"), 0, false},
+		{"not a string", context.WithValue(ctx, models.CtxKey("id"), 42), 0, false},
+	} {
+		userID, err := userIDFromContext(c.ctx)
+		if !c.ok {
+			requireCode(t, http.StatusUnauthorized, err, c.name)
+			continue
+		}
+		require.NoError(t, err, c.name)
+		require.Equal(t, c.userID, userID, c.name)
+	}
+}
+
+func TestCheckTheProfile(t *testing.T) {
+	str := func(s string) *string { return &s }
+
+	for _, c := range []struct {
+		name  string
+		input models.UpdateUserData
+		ok    bool
+	}{
+		{"nothing to update", models.UpdateUserData{}, false},
+		{"name", models.UpdateUserData{Name: str("Ivan")}, true},
+		{"blank name", models.UpdateUserData{Name: str("  ")}, false},
+		{"blank last name", models.UpdateUserData{LastName: str("")}, false},
+		{"digits in name", models.UpdateUserData{Name: str("Ivan2")}, false},
+		{"long name", models.UpdateUserData{LastName: str(strings.Repeat("я", maxNameLen+1))}, false},
+		{"dob", models.UpdateUserData{DOB: str("1990-05-17")}, true},
+		{"cleared dob", models.UpdateUserData{DOB: str("")}, true},
+		{"dob of other format", models.UpdateUserData{DOB: str("17.05.1990")}, false},
+		{"dob too old", models.UpdateUserData{DOB: str("1899-12-31")}, false},
+		{"dob in future", models.UpdateUserData{DOB: str(time.Now().AddDate(1, 0, 0).Format(dobLayout))}, false},
+		{"empty address", models.UpdateUserData{Address: str("")}, true},
+		{"long address", models.UpdateUserData{Address: str(strings.Repeat("a", maxNameLen+1))}, false},
+		{"long description", models.UpdateUserData{Description: str(strings.Repeat("a", maxDescriptionLen+1))},
+			false},
+	} {
+		err := checkTheProfile(&c.input)
+		if c.ok {
+			require.NoError(t, err, c.name)
+		} else {
+			requireCode(t, http.StatusBadRequest, err, c.name)
+		}
+	}
+
+	// the fields are trimmed in place
+	input := models.UpdateUserData{Name: str(" Ivan "), Address: str(" Moscow "), Description: str(" hi ")}
+	require.NoError(t, checkTheProfile(&input))
+	require.Equal(t, "Ivan", *input.Name)
+	require.Equal(t, "Moscow", *input.Address)
+	require.Equal(t, "hi", *input.Description)
+}
+
+func TestRandToken(t *testing.T) {
+	for _, c := range []struct {
+		bytes   int
+		encoded int
+	}{
+		{16, 22},
+		{32, 43},
+	} {
+		token, err := randToken(c.bytes)
+		require.NoError(t, err)
+		require.Len(t, token, c.encoded)
+
+		other, err := randToken(c.bytes)
+		require.NoError(t, err)
+		require.NotEqual(t, token, other)
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	hash := hashToken("token")
+	require.Len(t, hash, 64)
+	require.Equal(t, hash, hashToken("token"))
+	require.NotEqual(t, hash, hashToken("token2"))
+}
+
+func TestGenerateTokenPair(t *testing.T) {
+	ctx := context.Background()
+	keys, err := keyring.New("current:HS256:secret", "")
+	require.NoError(t, err)
+
+	store := storage.NewMemoryStorage()
+	output, err := generateTokenPair(ctx, store, keys, 7, "family", true)
+	require.NoError(t, err)
+
+	// only the hash of the refresh token is saved, in the family it was issued in
+	token, err := store.GetRefreshToken(ctx, hashToken(output.RefreshToken))
+	require.NoError(t, err)
+	require.Equal(t, storage.RefreshToken{UserID: 7, FamilyID: "family"}, token)
+	_, err = store.GetRefreshToken(ctx, output.RefreshToken)
+	require.Equal(t, storage.ErrNotFound, err)
+
+	claims := &models.ClaimWithID{}
+	_, err = jwt.ParseWithClaims(output.AccessToken, claims, keys.Keyfunc)
+	require.NoError(t, err)
+	require.Equal(t, "7", claims.ID)
+	// the jti revokes the token alone, the session id revokes it with the refresh family on log out
+	require.NotEmpty(t, claims.Id)
+	require.Equal(t, "family", claims.SessionID)
+	require.True(t, claims.Admin)
+	require.Equal(t, accessTokenTTL, claims.ExpiresAt-claims.IssuedAt)
+
+	_, err = generateTokenPair(ctx, failingTokens{store}, keys, 7, "family", false)
+	require.Error(t, err)
+	require.Equal(t, http.StatusInternalServerError, err.(tools.ErrorMessage).GetCode())
+}
+
+func TestReserveIdempotencyKey(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStorage()
+	request := models.TransactionRequest{FromAddress: models.WalletRef{ID: 1}, ToAddress: models.WalletRef{ID: 2},
+		Amount: decimal.NewFromInt(10), IdempotencyKey: "key"}
+	other := request
+	other.Amount = decimal.NewFromInt(20)
+
+	for _, c := range []struct {
+		name          string
+		userID        int32
+		input         models.TransactionRequest
+		save          bool
+		replayed      bool
+		transactionID string
+		success       bool
+		code          int
+	}{
+		{"new key", 1, request, false, false, "", false, 0},
+		{"repeated before the result is saved", 1, request, true, true, "", false, 0},
+		{"repeated after the result is saved", 1, request, false, true, "id", true, 0},
+		{"same key of another request", 1, other, false, false, "", false, http.StatusConflict},
+		{"same key of another user", 2, other, false, false, "", false, 0},
+	} {
+		replayed, transactionID, success, err := reserveIdempotencyKey(ctx, store, c.userID, c.input)
+		if c.code != 0 {
+			require.Error(t, err, c.name)
+			require.Equal(t, c.code, err.(tools.ErrorMessage).GetCode(), c.name)
+			continue
+		}
+		require.NoError(t, err, c.name)
+		require.Equal(t, c.replayed, replayed, c.name)
+		require.Equal(t, c.success, success, c.name)
+		require.Equal(t, c.transactionID, transactionID, c.name)
+
+		if c.save {
+			require.NoError(t, saveIdempotentResult(ctx, store, c.userID, c.input.IdempotencyKey, "id", true),
+				c.name)
+		}
+	}
+}
+
+func TestGetRate(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStorage()
+	require.NoError(t, store.SaveQuotes(ctx, []storage.Quote{
+		{CurrencyID: btc, Price: decimal.NewFromInt(40000), Source: "http", QuotedAt: time.Now().Add(-time.Hour)},
+	}))
+	require.NoError(t, store.SetOverride(ctx, storage.Override{CurrencyID: eth, Price: decimal.NewFromInt(3000)}))
+	require.NoError(t, store.SaveQuotes(ctx, []storage.Quote{
+		{CurrencyID: eth, Price: decimal.NewFromInt(2500), Source: "http", QuotedAt: time.Now().Add(time.Minute)},
+	}))
+
+	for _, c := range []struct {
+		name       string
+		currencyID int32
+		maxAge     time.Duration
+		price      string
+		code       int
+	}{
+		// the memory storage starts with the quotes taken at its creation
+		{"fresh quote", btc, time.Minute, "32853.856", 0},
+		{"stale quote", btc, time.Nanosecond, "", http.StatusServiceUnavailable},
+		{"check disabled", btc, 0, "32853.856", 0},
+		// the override wins over the newer quote of the feed and never gets stale
+		{"override", eth, time.Nanosecond, "3000", 0},
+		{"unknown currency", 100, time.Minute, "", http.StatusServiceUnavailable},
+	} {
+		price, err := getRate(ctx, store, c.currencyID, c.maxAge)
+		if c.code != 0 {
+			require.Error(t, err, c.name)
+			require.Equal(t, c.code, err.(tools.ErrorMessage).GetCode(), c.name)
+			continue
+		}
+		require.NoError(t, err, c.name)
+		require.Equal(t, c.price, price.String(), c.name)
+	}
+}
+
+func TestCreateWallet(t *testing.T) {
+	ctx := context.Background()
+
+	for _, c := range []struct {
+		name  string
+		taken int
+		code  int
+	}{
+		{"free address", 0, 0},
+		{"taken address", maxAddressAttempts - 1, 0},
+		{"every address is taken", maxAddressAttempts, http.StatusInternalServerError},
+	} {
+		store := storage.NewMemoryStorage()
+		userID, err := store.CreateUser(ctx, storage.User{Email: "alice@localhost"})
+		require.NoError(t, err)
+		currency, err := store.GetCurrencyByName(ctx, "BTC")
+		require.NoError(t, err)
+		wallets := &takenAddresses{Wallets: store, taken: c.taken}
+
+		walletID, err := createWallet(ctx, wallets, currency, storage.Wallet{UserID: userID})
+		if c.code != 0 {
+			require.Error(t, err, c.name)
+			require.Equal(t, c.code, err.(tools.ErrorMessage).GetCode(), c.name)
+			require.Len(t, wallets.addresses, maxAddressAttempts, c.name)
+			continue
+		}
+		require.NoError(t, err, c.name)
+		require.Len(t, wallets.addresses, c.taken+1, c.name)
+
+		// every attempt gets the new address
+		saved, err := store.GetWalletsByIDs(ctx, []int32{walletID})
+		require.NoError(t, err, c.name)
+		require.Equal(t, wallets.addresses[c.taken], saved[0].Address, c.name)
+		require.NoError(t, address.ValidateAddress(saved[0].Address), c.name)
+		for i := 0; i < c.taken; i++ {
+			require.NotEqual(t, saved[0].Address, wallets.addresses[i], c.name)
+		}
+	}
+
+	currency := storage.Currency{ID: btc, Name: "BTC", AddressFormat: "numeric"}
+	_, err := createWallet(ctx, storage.NewMemoryStorage(), currency, storage.Wallet{UserID: 1})
+	require.Error(t, err)
+	require.Equal(t, http.StatusInternalServerError, err.(tools.ErrorMessage).GetCode())
+}
+
+func TestGetTransferWallets(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStorage()
+
+	var wallets []storage.Wallet
+	for _, email := range []string{"alice@localhost", "bob@localhost"} {
+		userID, err := store.CreateUser(ctx, storage.User{Email: email})
+		require.NoError(t, err)
+		for _, currencyID := range []int32{btc, eth} {
+			wallet := storage.Wallet{UserID: userID, CurrencyID: currencyID,
+				Address: fmt.Sprintf("%s/%d", email, currencyID)}
+			wallet.ID, err = store.CreateWallet(ctx, wallet)
+			require.NoError(t, err)
+			wallets = append(wallets, wallet)
+		}
+	}
+	aliceBTC, aliceETH, bobBTC, bobETH := wallets[0], wallets[1], wallets[2], wallets[3]
+	archived, err := store.ArchiveWallet(ctx, bobETH.ID)
+	require.NoError(t, err)
+	require.True(t, archived)
+
+	for _, c := range []struct {
+		name           string
+		from           storage.Wallet
+		to             storage.Wallet
+		ownDestination bool
+		code           int
+	}{
+		{"own wallets", aliceBTC, aliceETH, true, 0},
+		{"to another user", aliceBTC, bobBTC, false, 0},
+		{"to another user as own", aliceBTC, bobBTC, true, http.StatusForbidden},
+		{"from another user", bobBTC, aliceBTC, false, http.StatusForbidden},
+		{"unknown destination", aliceBTC, storage.Wallet{ID: 100}, false, http.StatusNotFound},
+		{"archived destination", aliceBTC, bobETH, false, http.StatusBadRequest},
+	} {
+		from, to, err := getTransferWallets(ctx, store, c.from.ID, c.to.ID, aliceBTC.UserID, c.ownDestination)
+		if c.code != 0 {
+			require.Error(t, err, c.name)
+			require.Equal(t, c.code, err.(tools.ErrorMessage).GetCode(), c.name)
+			continue
+		}
+		require.NoError(t, err, c.name)
+		require.Equal(t, c.from.ID, from.ID, c.name)
+		require.Equal(t, c.to.ID, to.ID, c.name)
+	}
+}
+
+func TestResolveWalletID(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStorage()
+	userID, err := store.CreateUser(ctx, storage.User{Email: "alice@localhost"})
+	require.NoError(t, err)
+	walletID, err := store.CreateWallet(ctx, storage.Wallet{UserID: userID, CurrencyID: btc, Address: "12345678901234567890"})
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		name     string
+		ref      models.WalletRef
+		walletID int32
+		code     int
+	}{
+		// the id is checked later along with the owner of the wallet
+		{"id", models.WalletRef{ID: 100}, 100, 0},
+		{"address", models.WalletRef{Address: "12345678901234567890"}, walletID, 0},
+		{"address wins", models.WalletRef{ID: 100, Address: "12345678901234567890"}, walletID, 0},
+		{"unknown address", models.WalletRef{Address: "09876543210987654321"}, 0, http.StatusNotFound},
+		{"malformed address", models.WalletRef{Address: "12345"}, 0, http.StatusBadRequest},
+	} {
+		id, err := resolveWalletID(ctx, store, c.ref)
+		if c.code != 0 {
+			require.Error(t, err, c.name)
+			require.Equal(t, c.code, err.(tools.ErrorMessage).GetCode(), c.name)
+			continue
+		}
+		require.NoError(t, err, c.name)
+		require.Equal(t, c.walletID, id, c.name)
+	}
+}
+
+func TestValidateCurrency(t *testing.T) {
+	valid := storage.Currency{Name: "USDT", DisplayName: "Tether", Scale: 6, AddressFormat: address.FormatBase58Check}
+
+	for _, c := range []struct {
+		name   string
+		change func(currency *storage.Currency)
+		isErr  bool
+	}{
+		{"valid", func(currency *storage.Currency) {}, false},
+		{"digits in code", func(currency *storage.Currency) { currency.Name = "1INCH" }, false},
+		{"max precision", func(currency *storage.Currency) { currency.Scale = maxPrecision }, false},
+		{"short code", func(currency *storage.Currency) { currency.Name = "X" }, true},
+		{"long code", func(currency *storage.Currency) { currency.Name = "ABCDEFGHIJK" }, true},
+		{"lower case code", func(currency *storage.Currency) { currency.Name = "usdt" }, true},
+		{"empty display name", func(currency *storage.Currency) { currency.DisplayName = "  " }, true},
+		{"long display name", func(currency *storage.Currency) {
+			currency.DisplayName = strings.Repeat("ы", 65)
+		}, true},
+		{"negative precision", func(currency *storage.Currency) { currency.Scale = -1 }, true},
+		{"precision over max", func(currency *storage.Currency) { currency.Scale = maxPrecision + 1 }, true},
+		{"unknown address format", func(currency *storage.Currency) { currency.AddressFormat = "base58" }, true},
+	} {
+		currency := valid
+		c.change(&currency)
+		err := validateCurrency(currency)
+		if c.isErr {
+			require.Error(t, err, c.name)
+			require.Equal(t, http.StatusBadRequest, err.(tools.ErrorMessage).GetCode(), c.name)
+			continue
+		}
+		require.NoError(t, err, c.name)
+	}
+}
+
+func TestCheckCurrenciesEnabled(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStorage()
+	currency, err := store.GetCurrencyByName(ctx, "ETH")
+	require.NoError(t, err)
+	currency.Enabled = false
+	require.NoError(t, store.UpdateCurrency(ctx, currency))
+
+	require.NoError(t, checkCurrenciesEnabled(ctx, store, btc, btc))
+	for _, currencyIDs := range [][]int32{{btc, eth}, {eth, btc}, {btc, 100}} {
+		err := checkCurrenciesEnabled(ctx, store, currencyIDs...)
+		require.Error(t, err, "currencies %v", currencyIDs)
+		require.Equal(t, http.StatusBadRequest, err.(tools.ErrorMessage).GetCode(), "currencies %v", currencyIDs)
+	}
+}
+
+func TestNewRecoveryCodes(t *testing.T) {
+	codes, hashes, err := newRecoveryCodes()
+	require.NoError(t, err)
+	require.Len(t, codes, recoveryCodesCount)
+	require.Len(t, hashes, recoveryCodesCount)
+
+	seen := make(map[string]bool)
+	for i, code := range codes {
+		require.Regexp(t, "^[a-z2-7]{4}-[a-z2-7]{4}$", code)
+		require.Equal(t, hashes[i], hashRecoveryCode(code))
+		require.False(t, seen[code], code)
+		seen[code] = true
+	}
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	// the code is typed in any case, with or without the dash
+	for _, code := range []string{"abcd-efgh", "ABCD-EFGH", "abcdefgh", "abcd efgh"} {
+		require.Equal(t, hashRecoveryCode("abcd-efgh"), hashRecoveryCode(code), code)
+	}
+	require.NotEqual(t, hashRecoveryCode("abcd-efgh"), hashRecoveryCode("abcd-efgi"))
+}
+
+func TestCheckMFACodeReplay(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStorage()
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	require.NoError(t, store.SaveMFASecret(ctx, 1, secret))
+
+	code, err := totp.Code(secret, totp.Counter(time.Now()))
+	require.NoError(t, err)
+
+	mfa, err := store.GetMFASecret(ctx, 1)
+	require.NoError(t, err)
+	ok, err := checkMFACode(ctx, store, mfa, code, false)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// the code is accepted only once, the step is remembered
+	mfa, err = store.GetMFASecret(ctx, 1)
+	require.NoError(t, err)
+	ok, err = checkMFACode(ctx, store, mfa, code, false)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestCheckMFACodeRecovery(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStorage()
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	require.NoError(t, store.SaveMFASecret(ctx, 1, secret))
+
+	codes, hashes, err := newRecoveryCodes()
+	require.NoError(t, err)
+	require.NoError(t, store.EnableMFA(ctx, 1, 0, hashes))
+	mfa, err := store.GetMFASecret(ctx, 1)
+	require.NoError(t, err)
+
+	// the recovery codes are not accepted for the transfers
+	ok, err := checkMFACode(ctx, store, mfa, codes[0], false)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	ok, err = checkMFACode(ctx, store, mfa, codes[0], true)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = checkMFACode(ctx, store, mfa, codes[0], true)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestCheckTransferCode(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStorage()
+	codes := limiter.NewLimiter(limiter.NewMemoryStore(), "otp:", TransferCodePolicy)
+
+	// the user 1 has the second factor on, the user 2 only enrolled it, the user 3 has none
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	require.NoError(t, store.SaveMFASecret(ctx, 1, secret))
+	recoveryCodes, hashes, err := newRecoveryCodes()
+	require.NoError(t, err)
+	require.NoError(t, store.EnableMFA(ctx, 1, 0, hashes))
+	require.NoError(t, store.SaveMFASecret(ctx, 2, secret))
+	require.NoError(t, store.SaveMFASecret(ctx, 4, secret))
+	require.NoError(t, store.EnableMFA(ctx, 4, 0, nil))
+
+	code, err := totp.Code(secret, totp.Counter(time.Now()))
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		name   string
+		userID int32
+		code   string
+		status int
+	}{
+		{"no second factor", 3, code, http.StatusForbidden},
+		{"unconfirmed second factor", 2, code, http.StatusForbidden},
+		{"no code", 1, "", http.StatusForbidden},
+		{"recovery code", 1, recoveryCodes[0], http.StatusForbidden},
+		{"wrong code", 1, "000000", http.StatusForbidden},
+		// the right code forgets the wrong ones
+		{"fresh code", 1, code, 0},
+		{"replayed code", 1, code, http.StatusForbidden},
+		{"wrong code again", 1, "000000", http.StatusForbidden},
+		{"wrong code again", 1, "000000", http.StatusForbidden},
+		{"wrong code again", 1, "000000", http.StatusForbidden},
+		// the codes of other users are counted apart
+		{"code of other user", 4, code, 0},
+		{"fifth wrong code", 1, "000000", http.StatusForbidden},
+		{"locked", 1, code, http.StatusTooManyRequests},
+	} {
+		err = checkTransferCode(ctx, store, codes, c.userID, c.code)
+		if c.status == 0 {
+			require.NoError(t, err, c.name)
+		} else {
+			requireCode(t, c.status, err, c.name)
+		}
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	key := storage.TransactionKey{CreateAt: time.Date(2021, 9, 1, 12, 30, 0, 123456000, time.UTC), ID: 42}
+
+	decoded, err := decodeCursor(encodeCursor(key))
+	require.NoError(t, err)
+	require.True(t, key.CreateAt.Equal(decoded.CreateAt))
+	require.Equal(t, key.ID, decoded.ID)
+}
+
+func TestDecodeCursorMalformed(t *testing.T) {
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+
+	for _, cursor := range []string{
+		"not base64!",
+		encode(""),
+		encode("1630499400123456000"),
+		encode("1630499400123456000:42:7"),
+		encode("yesterday:42"),
+		encode("1630499400123456000:last"),
+		encode(":42"),
+	} {
+		_, err := decodeCursor(cursor)
+		require.Error(t, err, "cursor %q", cursor)
+	}
+}
+
+func TestNewTransactionFilter(t *testing.T) {
+	now := time.Now()
+	earlier := now.Add(-time.Hour)
+	one, two := decimal.NewFromInt(1), decimal.NewFromInt(2)
+	cursor := encodeCursor(storage.TransactionKey{CreateAt: now, ID: 7})
+
+	for _, c := range []struct {
+		name  string
+		input models.GetTransactionsRequest
+		isErr bool
+	}{
+		{"defaults", models.GetTransactionsRequest{}, false},
+		{"max limit", models.GetTransactionsRequest{Limit: maxTransactionsLimit}, false},
+		{"limit over max", models.GetTransactionsRequest{Limit: maxTransactionsLimit + 1}, true},
+		{"negative limit", models.GetTransactionsRequest{Limit: -1}, true},
+		{"direction", models.GetTransactionsRequest{Direction: models.DirectionIncoming}, false},
+		{"unknown direction", models.GetTransactionsRequest{Direction: "sideways"}, true},
+		{"date range", models.GetTransactionsRequest{DateFrom: &earlier, DateTo: &now}, false},
+		{"reversed date range", models.GetTransactionsRequest{DateFrom: &now, DateTo: &earlier}, true},
+		{"empty date range", models.GetTransactionsRequest{DateFrom: &now, DateTo: &now}, true},
+		{"amount range", models.GetTransactionsRequest{MinAmount: &one, MaxAmount: &two}, false},
+		{"reversed amount range", models.GetTransactionsRequest{MinAmount: &two, MaxAmount: &one}, true},
+		{"cursor", models.GetTransactionsRequest{Cursor: cursor}, false},
+		{"bad cursor", models.GetTransactionsRequest{Cursor: "bm90IGEgY3Vyc29y"}, true},
+	} {
+		filter, err := newTransactionFilter(c.input)
+		if c.isErr {
+			require.Error(t, err, c.name)
+			require.Equal(t, http.StatusBadRequest, err.(tools.ErrorMessage).GetCode(), c.name)
+			continue
+		}
+		require.NoError(t, err, c.name)
+		require.Greater(t, filter.Limit, 0, c.name)
+	}
+
+	filter, err := newTransactionFilter(models.GetTransactionsRequest{Currency: "btc", Cursor: cursor})
+	require.NoError(t, err)
+	require.Equal(t, defaultTransactionsLimit, filter.Limit)
+	require.Equal(t, "BTC", filter.Currency)
+	require.Equal(t, int64(7), filter.After.ID)
+}
@@ -3,38 +3,149 @@ package crypto_app
 import (
 	"context"
 	"errors"
-	"github.com/jackc/pgx"
-	"golang.org/x/crypto/bcrypt"
+	"fmt"
 	"log"
+	"math"
+	"github.com/shopspring/decimal"
+	"golang.org/x/crypto/bcrypt"
+	"github.com/crypto_app/pkg/address"
+	"github.com/crypto_app/pkg/emaildomain"
+	"github.com/crypto_app/pkg/keyring"
+	"github.com/crypto_app/pkg/limiter"
+	"github.com/crypto_app/pkg/mailer"
 	"github.com/crypto_app/pkg/models"
+	"github.com/crypto_app/pkg/revocation"
+	"github.com/crypto_app/pkg/storage"
+	"github.com/crypto_app/pkg/totp"
 	"github.com/crypto_app/tools"
+	"github.com/gofrs/uuid"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 )
 
 const (
-	defaultCommission = float64(0.01)
-	bcryptCost        = 11
+	usdScale = 2
 )
 
 type Crypto interface {
 	Alive(ctx context.Context) (output models.AliveResponse, err error)
 	Sign(ctx context.Context, input *models.RegisterRequest) (output models.RegisterResponse, err error)
 	LogIn(ctx context.Context, input *models.LogInRequest) (output models.RegisterResponse, err error)
+	LogInMFA(ctx context.Context, input models.LogInMFARequest) (output models.RegisterResponse, err error)
+	RefreshToken(ctx context.Context, input *models.RefreshTokenRequest) (output models.RegisterResponse, err error)
+	LogOut(ctx context.Context) (err error)
+	RevokeAllSessions(ctx context.Context) (err error)
+	GetMe(ctx context.Context) (output models.SingleUserData, err error)
+	UpdateMe(ctx context.Context, input models.UpdateUserData) (output models.SingleUserData, err error)
+	ForgotPassword(ctx context.Context, input models.ForgotPasswordRequest) (err error)
+	ResetPassword(ctx context.Context, input models.ResetPasswordRequest) (err error)
+	VerifyEmail(ctx context.Context, input models.VerifyEmailRequest) (err error)
+	ResendVerificationEmail(ctx context.Context) (err error)
+	EnrollMFA(ctx context.Context) (output models.MFAEnrollResponse, err error)
+	ConfirmMFA(ctx context.Context, input models.MFACodeRequest) (output models.MFAConfirmResponse, err error)
+	DisableMFA(ctx context.Context, input models.MFACodeRequest) (err error)
+	GetJWKS(ctx context.Context) (output models.JWKSResponse, err error)
+	GetPoolStats(ctx context.Context) (output models.PoolStatsResponse, err error)
 	GetWallets(ctx context.Context) (output []*models.WalletsResponse, err error)
-	Transaction(ctx context.Context, input models.TransactionRequest) (success bool, err error)
-	GetTransactions(ctx context.Context, perPage int, pageNum int) (response models.GetTransactionResponse, err error)
+	OpenWallet(ctx context.Context, input models.OpenWalletRequest) (output models.WalletsResponse, err error)
+	ArchiveWallet(ctx context.Context, address string) (err error)
+	Transaction(ctx context.Context, input models.TransactionRequest) (output models.TransactionDetail, err error)
+	GetTransaction(ctx context.Context, transactionID string) (output models.TransactionDetail, err error)
+	GetTransactions(ctx context.Context, input models.GetTransactionsRequest) (response models.GetTransactionResponse, err error)
+	GetRates(ctx context.Context) (output []*models.RateResponse, err error)
+	GetCandles(ctx context.Context, input models.GetCandlesRequest) (output models.GetCandlesResponse, err error)
+	SetRateOverride(ctx context.Context, input models.RateOverrideRequest) (err error)
+	DeleteRateOverride(ctx context.Context, currency string) (err error)
+	GetCurrencies(ctx context.Context) (output []*models.CurrencyResponse, err error)
+	CreateCurrency(ctx context.Context, input models.CreateCurrencyRequest) (output models.CurrencyResponse, err error)
+	UpdateCurrency(ctx context.Context, input models.UpdateCurrencyRequest) (output models.CurrencyResponse, err error)
+	GetHouseAccounts(ctx context.Context) (output []*models.HouseAccountResponse, err error)
+	UnlockLogIn(ctx context.Context, input models.UnlockLogInRequest) (err error)
+}
+
+// Settings business rules of the app which differ between environments
+type Settings struct {
+	Commission     decimal.Decimal
+	DefaultBalance decimal.Decimal
+	BcryptCost     int
+	// RateMaxAge the transfers are refused when the price of the feed is older, 0 disables the check
+	RateMaxAge time.Duration
+	// PasswordResetTTL how long the token sent to reset the password is valid
+	PasswordResetTTL time.Duration
+	// PasswordResetURL the link the reset token is appended to in the mail, the mail has only the token without it
+	PasswordResetURL string
+	// EmailVerificationTTL how long the token sent to confirm the email is valid
+	EmailVerificationTTL time.Duration
+	// EmailVerificationURL the link the verification token is appended to in the mail
+	EmailVerificationURL string
+	// MFAIssuer the name the authenticator apps show the secret under
+	MFAIssuer string
+	// MFAChallengeTTL how long the second step of the log in waits for the code
+	MFAChallengeTTL time.Duration
+	// MFATransferThreshold the transfers of the larger amount in dollars require the TOTP code, 0 disables the check
+	MFATransferThreshold decimal.Decimal
+}
+
+// Limiters slow down the guessing of the passwords by the email and by the address of the client,
+// and of the transfer codes by the user
+type Limiters struct {
+	Accounts *limiter.Limiter
+	Clients  *limiter.Limiter
+	// TransferCodes the keys are the ids of the users, see TransferCodePolicy
+	TransferCodes *limiter.Limiter
+}
+
+// TransferCodePolicy locks the transfers which need the code after maxMFAAttempts wrong codes in a row
+var TransferCodePolicy = limiter.Policy{
+	FreeAttempts:    maxMFAAttempts - 1,
+	LockoutAttempts: maxMFAAttempts,
+	BaseDelay:       15 * time.Minute,
+	LockoutDuration: 15 * time.Minute,
+	Window:          time.Hour,
 }
 
 type crypto struct {
-	db *pgx.Conn
+	store    storage.Storage
+	revoked  revocation.Store
+	keys     *keyring.Keyring
+	mailer   mailer.Mailer
+	domains  emaildomain.Checker
+	limiters Limiters
+	// dummyPassHash the unknown email is checked against it, so it takes as long as the wrong password
+	dummyPassHash []byte
+	settings      Settings
+}
+
+// inTx runs fn in the transaction of the storage, the errors of the storage itself are wrapped
+// the same way the errors of fn are
+func (r *crypto) inTx(ctx context.Context, fn func(tx storage.Storage) error) (err error) {
+	if err = r.store.InTx(ctx, fn); err != nil {
+		if _, ok := err.(tools.ErrorMessage); !ok {
+			err = tools.NewErrorMessage(err, "Ошибка при выполнении транзакции", http.StatusInternalServerError)
+		}
+	}
+	return
+}
+
+// checkEmailDomain refuses the email of the domain which definitely takes no mail. The failed check lets
+// the email through, the verification mail proves the mailbox anyway.
+func (r *crypto) checkEmailDomain(ctx context.Context, email string) (err error) {
+	domain := email[strings.LastIndex(email, "@")+1:]
+	if err = r.domains.Check(ctx, domain); err != nil {
+		if err == emaildomain.ErrNoMail {
+			return tools.NewErrorMessage(err, "Домен емейла не принимает почту", http.StatusBadRequest)
+		}
+		log.Printf("error while checking the email domain %s: %v", domain, err)
+	}
+	return nil
 }
 
 func (r *crypto) Alive(ctx context.Context) (output models.AliveResponse, err error) {
-	preID, err := strconv.Atoi(ctx.Value(models.CtxKey("id")).(string))
+	preID, err := userIDFromContext(ctx)
 	if err != nil {
-		err = tools.NewErrorMessage(err, "Ошибка при получении user_id из контекста",
-			http.StatusInternalServerError)
+		return
 	}
 	output.UserID = int32(preID)
 	output.Text = "service is okay"
@@ -42,285 +153,1238 @@ func (r *crypto) Alive(ctx context.Context) (output models.AliveResponse, err er
 }
 
 func (r *crypto) Sign(ctx context.Context, input *models.RegisterRequest) (output models.RegisterResponse, err error) {
-	const (
-		checkEmailExistence = `select exists(select * from user_data where email = $1);`
-		dbRequestToAddData  = `insert  into user_data (name, last_name, email, pass_hash) values 
-			($1, $2, $3, $4) returning id`
-	)
 	var (
 		passHash    []byte
 		emailExists bool
 		userID      int32
+		verifyToken string
 	)
 
+	input.Email = normalizeEmail(input.Email)
+	if input.Name == "" || input.LastName == "" || input.Pass == "" || input.Email == "" {
+		err = tools.NewErrorMessage(errors.New("bad request"), "Какое то из полей пустое", http.StatusBadRequest)
+		return
+	}
 	if err = checkThePass(input.Pass); err != nil {
 		return
 	}
 	if err = checkTheUserData(input.Name, input.LastName); err != nil {
 		return
 	}
-
-	tx, err := r.db.Begin()
-	if err != nil {
-		err = tools.NewErrorMessage(err, "Ошибка при создании транзакции", http.StatusInternalServerError)
+	if !isEmailValid(input.Email) {
+		err = tools.NewErrorMessage(errors.New("bad email"), "Невалидный емейл", http.StatusBadRequest)
+		return
+	}
+	// the domain is checked before the transaction, the lookup may take a while
+	if err = r.checkEmailDomain(ctx, input.Email); err != nil {
 		return
 	}
 
-	defer func() {
+	err = r.inTx(ctx, func(tx storage.Storage) (err error) {
+		if emailExists, err = tx.EmailExists(ctx, input.Email); err != nil {
+			return tools.NewErrorMessage(err, "Ошибка при проверке на сущестование емейла", http.StatusInternalServerError)
+		}
+
+		if emailExists {
+			return tools.NewErrorMessage(errors.New("this email is already registered"),
+				"Данный емейл уже зарегестрирован", http.StatusBadRequest)
+		}
+
+		if passHash, err = bcrypt.GenerateFromPassword([]byte(input.Pass), r.settings.BcryptCost); err != nil {
+			return tools.NewErrorMessage(err, "Внутренняя ошибка", http.StatusInternalServerError)
+		}
+
+		userID, err = tx.CreateUser(ctx, storage.User{
+			Name:     input.Name,
+			LastName: input.LastName,
+			Email:    input.Email,
+			PassHash: string(passHash),
+		})
 		if err != nil {
-			er := tx.Rollback()
-			if er != nil {
-				log.Printf("error while rolling up the transaction: %v", er)
-			}
+			return tools.NewErrorMessage(err, "Ошибка при сохранении данных", http.StatusInternalServerError)
+		}
+
+		if err = createDefaultWalletsWithDefaultBalance(ctx, tx, userID, r.settings.DefaultBalance); err != nil {
+			return
+		}
+
+		if verifyToken, err = saveEmailVerificationToken(ctx, tx, userID, r.settings.EmailVerificationTTL); err != nil {
 			return
 		}
-		if err = tx.Commit(); err != nil {
-			err = tools.NewErrorMessage(err, "Ошибка при tx.Commit", http.StatusInternalServerError)
+
+		familyID, err := randToken(16)
+		if err != nil {
+			return tools.NewErrorMessage(err, "Ошибка при создании сессии", http.StatusInternalServerError)
 		}
-	}()
 
-	if input.Name == "" || input.LastName == "" || input.Pass == "" || input.Email == "" {
-		err = tools.NewErrorMessage(errors.New("bad request"), "Какое то из полей пустое", http.StatusBadRequest)
+		output, err = generateTokenPair(ctx, tx, r.keys, userID, familyID, false)
+		return
+	})
+	if err != nil {
+		return
+	}
+
+	// the user is already registered, the lost mail is sent again by ResendVerificationEmail
+	if er := r.mailer.Send(ctx, emailVerificationMessage(input.Email, verifyToken, r.settings)); er != nil {
+		log.Printf("error while sending the verification mail to the user %d: %v", userID, er)
+	}
+	return
+}
+
+func (r *crypto) LogIn(ctx context.Context, input *models.LogInRequest) (output models.RegisterResponse, err error) {
+	// the case of the email does not give the attacker the new set of attempts
+	email := normalizeEmail(input.Email)
+	if !isEmailValid(email) {
+		err = tools.NewErrorMessage(errors.New("bad email"),
+			"Невалидный емейл", http.StatusBadRequest)
 		return
 	}
+	ip, _ := ctx.Value(models.CtxKey("ip")).(string)
 
-	if err = tx.QueryRowEx(ctx, checkEmailExistence, nil, input.Email).Scan(&emailExists); err != nil {
-		err = tools.NewErrorMessage(err, "Ошибка при проверке на сущестование емейла", http.StatusInternalServerError)
+	if err = r.attemptLogIn(ctx, email, ip); err != nil {
 		return
 	}
 
-	if emailExists {
-		err = tools.NewErrorMessage(errors.New("this email is already registered"),
-			"Данный емейл уже зарегестрирован", http.StatusBadRequest)
+	user, err := r.store.GetUserByEmail(ctx, email)
+	if err != nil && err != storage.ErrNotFound {
+		err = tools.NewErrorMessage(err, "Ошибка при получении данынх по емейлу",
+			http.StatusInternalServerError)
 		return
 	}
 
-	if !isEmailValid(input.Email) {
-		err = tools.NewErrorMessage(errors.New("bad email"),
-			"Невалидный емейл", http.StatusBadRequest)
+	passHash := r.dummyPassHash
+	if err == nil {
+		passHash = []byte(user.PassHash)
+	}
+	// the unknown email and the wrong password get the same answer, so the answer does not tell who is registered
+	if er := bcrypt.CompareHashAndPassword(passHash, []byte(input.Pass)); er != nil || err != nil {
+		err = tools.NewErrorMessage(errors.New("bad credentials"), "Неверный емейл или пароль",
+			http.StatusUnauthorized)
 		return
 	}
 
-	if passHash, err = bcrypt.GenerateFromPassword([]byte(input.Pass), bcryptCost); err != nil {
-		err = tools.NewErrorMessage(err, "Внутренняя ошибка", http.StatusInternalServerError)
+	// the password of the user with the second factor is swapped only for the challenge, the attempts
+	// are forgotten once the code is right, see LogInMFA
+	secret, err := r.store.GetMFASecret(ctx, user.ID)
+	if err != nil && err != storage.ErrNotFound {
+		err = tools.NewErrorMessage(err, "Ошибка при получении второго фактора", http.StatusInternalServerError)
+		return
+	}
+	if err == nil && secret.Enabled {
+		output.MFARequired = true
+		if output.MFAToken, err = randToken(32); err != nil {
+			err = tools.NewErrorMessage(err, "Ошибка при создании токена", http.StatusInternalServerError)
+			return
+		}
+		if err = r.store.SaveMFAChallenge(ctx, hashToken(output.MFAToken), user.ID,
+			r.settings.MFAChallengeTTL); err != nil {
+			err = tools.NewErrorMessage(err, "Ошибка при сохранении токена", http.StatusInternalServerError)
+		}
 		return
 	}
 
-	if err = tx.QueryRowEx(ctx, dbRequestToAddData, nil, input.Name, input.LastName, input.Email, string(passHash)).Scan(&userID); err != nil {
-		err = tools.NewErrorMessage(err, "Ошибка при сохранении данных", http.StatusInternalServerError)
+	if err = r.passLogIn(ctx, email, ip); err != nil {
 		return
 	}
 
-	err = createDefaultWalletsWithDefaultBalance(ctx, tx, userID)
+	familyID, err := randToken(16)
 	if err != nil {
+		err = tools.NewErrorMessage(err, "Ошибка при создании сессии", http.StatusInternalServerError)
 		return
 	}
 
-	output.AccessToken, err = generateToken(userID)
+	output, err = generateTokenPair(ctx, r.store, r.keys, user.ID, familyID, user.IsAdmin)
+	return
+}
+
+// attemptLogIn counts the attempt against the email and the client before the password is checked, so the
+// parallel guesses can not slip past the lock. The attempt is refused while the email or the client is locked.
+func (r *crypto) attemptLogIn(ctx context.Context, email string, ip string) (err error) {
+	retryAfter, err := r.limiters.Accounts.Attempt(ctx, email)
+	if err == nil && retryAfter == 0 && ip != "" {
+		retryAfter, err = r.limiters.Clients.Attempt(ctx, ip)
+	}
 	if err != nil {
-		err = tools.NewErrorMessage(err, "Ошибка при создании токена", http.StatusInternalServerError)
+		return tools.NewErrorMessage(err, "Ошибка при сохранении попытки входа", http.StatusInternalServerError)
+	}
+
+	if retryAfter > 0 {
+		return tools.NewErrorMessage(errors.New("too many log in attempts"),
+			fmt.Sprintf("Слишком много попыток входа, повторите через %d сек", int(math.Ceil(retryAfter.Seconds()))),
+			http.StatusTooManyRequests)
 	}
 	return
 }
 
-func (r *crypto) LogIn(ctx context.Context, input *models.LogInRequest) (output models.RegisterResponse, err error) {
-	const (
-		getPassData = `select pass_hash,id from user_data where email = $1;`
-	)
+// passLogIn forgets the attempts of the email and takes back the attempt of the client, the other users
+// behind the same address keep their failures counted
+func (r *crypto) passLogIn(ctx context.Context, email string, ip string) (err error) {
+	if err = r.limiters.Accounts.Reset(ctx, email); err == nil && ip != "" {
+		err = r.limiters.Clients.Refund(ctx, ip)
+	}
+	if err != nil {
+		err = tools.NewErrorMessage(err, "Ошибка при сбросе попыток входа", http.StatusInternalServerError)
+	}
+	return
+}
+
+// UnlockLogIn forgets the failed log in attempts of the email or the client, e.g. after the user proved
+// the identity to the support
+func (r *crypto) UnlockLogIn(ctx context.Context, input models.UnlockLogInRequest) (err error) {
+	email, ip := normalizeEmail(input.Email), strings.TrimSpace(input.IP)
+	if email == "" && ip == "" {
+		err = tools.NewErrorMessage(errors.New("bad request"), "Не указан ни емейл, ни ip", http.StatusBadRequest)
+		return
+	}
+
+	if email != "" {
+		if err = r.limiters.Accounts.Reset(ctx, email); err != nil {
+			err = tools.NewErrorMessage(err, "Ошибка при сбросе попыток входа", http.StatusInternalServerError)
+			return
+		}
+	}
+	if ip != "" {
+		if err = r.limiters.Clients.Reset(ctx, ip); err != nil {
+			err = tools.NewErrorMessage(err, "Ошибка при сбросе попыток входа", http.StatusInternalServerError)
+		}
+	}
+	return
+}
 
+// LogInMFA swaps the challenge returned by LogIn and the TOTP or the recovery code for the pair of tokens.
+// The challenge is passed once and dies after maxMFAAttempts wrong codes, every code is also counted as the log in
+// attempt of the email, so the new challenges do not give the new guesses.
+func (r *crypto) LogInMFA(ctx context.Context, input models.LogInMFARequest) (output models.RegisterResponse, err error) {
+	// wrongCodeErr is returned after the commit, the failed attempt has to survive the error
 	var (
-		passHash string
-		userID   int32
+		wrongCodeErr error
+		email        string
 	)
+	ip, _ := ctx.Value(models.CtxKey("ip")).(string)
 
-	if !isEmailValid(input.Email) {
-		err = tools.NewErrorMessage(errors.New("bad email"),
-			"Невалидный емейл", http.StatusBadRequest)
+	if input.MFAToken == "" || input.Code == "" {
+		err = tools.NewErrorMessage(errors.New("bad request"), "Токен или код не переданы", http.StatusBadRequest)
 		return
 	}
+	tokenHash := hashToken(input.MFAToken)
 
-	if err = r.db.QueryRowEx(ctx, getPassData, nil, input.Email).Scan(&passHash, &userID); err != nil {
-		err = tools.NewErrorMessage(err, "Ошибка при получении данынх по емейлу",
-			http.StatusInternalServerError)
+	err = r.inTx(ctx, func(tx storage.Storage) (err error) {
+		challenge, err := tx.GetMFAChallenge(ctx, tokenHash)
+		if err != nil {
+			if err == storage.ErrNotFound {
+				return tools.NewErrorMessage(err, "Некорректный токен входа", http.StatusUnauthorized)
+			}
+			return tools.NewErrorMessage(err, "Ошибка при получении токена", http.StatusInternalServerError)
+		}
+		if challenge.Spent {
+			return tools.NewErrorMessage(errors.New("mfa challenge is spent"), "Токен входа уже использован",
+				http.StatusUnauthorized)
+		}
+		if challenge.Expired {
+			return tools.NewErrorMessage(errors.New("mfa challenge expired"),
+				"Срок действия токена входа истек, войдите заново", http.StatusUnauthorized)
+		}
+		if challenge.Attempts >= maxMFAAttempts {
+			return tools.NewErrorMessage(errors.New("too many mfa attempts"),
+				"Слишком много неверных кодов, войдите заново", http.StatusUnauthorized)
+		}
+
+		secret, err := tx.GetMFASecret(ctx, challenge.UserID)
+		if err != nil {
+			if err == storage.ErrNotFound {
+				return tools.NewErrorMessage(err, "Двухфакторная аутентификация отключена, войдите заново",
+					http.StatusUnauthorized)
+			}
+			return tools.NewErrorMessage(err, "Ошибка при получении второго фактора", http.StatusInternalServerError)
+		}
+
+		user, err := tx.GetUser(ctx, challenge.UserID)
+		if err != nil {
+			return tools.NewErrorMessage(err, "Ошибка при получении пользователя", http.StatusInternalServerError)
+		}
+		// the attempts are kept by the limiter outside the transaction, the rollback does not take them back
+		email = normalizeEmail(user.Email)
+		if err = r.attemptLogIn(ctx, email, ip); err != nil {
+			return
+		}
+
+		ok, err := checkMFACode(ctx, tx, secret, input.Code, true)
+		if err != nil {
+			return
+		}
+		if !ok {
+			if err = tx.FailMFAChallenge(ctx, tokenHash); err != nil {
+				return tools.NewErrorMessage(err, "Ошибка при обновлении токена", http.StatusInternalServerError)
+			}
+			wrongCodeErr = tools.NewErrorMessage(errors.New("bad mfa code"), "Неверный код",
+				http.StatusUnauthorized)
+			return
+		}
+
+		if err = tx.SpendMFAChallenge(ctx, tokenHash); err != nil {
+			return tools.NewErrorMessage(err, "Ошибка при обновлении токена", http.StatusInternalServerError)
+		}
+
+		familyID, err := randToken(16)
+		if err != nil {
+			return tools.NewErrorMessage(err, "Ошибка при создании сессии", http.StatusInternalServerError)
+		}
+
+		output, err = generateTokenPair(ctx, tx, r.keys, user.ID, familyID, user.IsAdmin)
+		return
+	})
+	if err != nil {
 		return
 	}
+	if wrongCodeErr != nil {
+		return models.RegisterResponse{}, wrongCodeErr
+	}
+
+	// the tokens are already saved, the attempts left behind are forgotten after the window anyway
+	if er := r.passLogIn(ctx, email, ip); er != nil {
+		log.Printf("error while resetting the log in attempts of the user %s: %v", email, er)
+	}
+	return
+}
+
+// RefreshToken swaps the refresh token for a new pair of tokens. Every refresh token can be used only once,
+// presenting an already used token revokes the whole family, so a stolen token dies together with the original.
+func (r *crypto) RefreshToken(ctx context.Context, input *models.RefreshTokenRequest) (output models.RegisterResponse, err error) {
+	// reuseErr is returned after the commit, the revocation of the family has to survive the error
+	var reuseErr error
 
-	if err = bcrypt.CompareHashAndPassword([]byte(passHash), []byte(input.Pass)); err != nil {
-		err = tools.NewErrorMessage(err, "Некорректный пароль", http.StatusInternalServerError)
+	if input.RefreshToken == "" {
+		err = tools.NewErrorMessage(errors.New("bad request"), "Refresh токен не передан", http.StatusBadRequest)
 		return
 	}
+	tokenHash := hashToken(input.RefreshToken)
 
-	output.AccessToken, err = generateToken(userID)
-	if err != nil {
-		err = tools.NewErrorMessage(err, "Ошибка при создании токена", http.StatusInternalServerError)
+	err = r.inTx(ctx, func(tx storage.Storage) (err error) {
+		token, err := tx.GetRefreshToken(ctx, tokenHash)
+		if err != nil {
+			if err == storage.ErrNotFound {
+				return tools.NewErrorMessage(err, "Некорректный refresh токен", http.StatusUnauthorized)
+			}
+			return tools.NewErrorMessage(err, "Ошибка при получении refresh токена", http.StatusInternalServerError)
+		}
+
+		if token.Spent {
+			if err = tx.RevokeRefreshTokenFamily(ctx, token.FamilyID); err != nil {
+				return tools.NewErrorMessage(err, "Ошибка при отзыве сессии", http.StatusInternalServerError)
+			}
+			reuseErr = tools.NewErrorMessage(errors.New("refresh token reuse detected"),
+				"Refresh токен уже был использован, сессия отозвана", http.StatusUnauthorized)
+			return
+		}
+
+		if token.Expired {
+			return tools.NewErrorMessage(errors.New("refresh token expired"), "Срок действия refresh токена истек",
+				http.StatusUnauthorized)
+		}
+
+		if err = tx.MarkRefreshTokenUsed(ctx, tokenHash); err != nil {
+			return tools.NewErrorMessage(err, "Ошибка при обновлении refresh токена", http.StatusInternalServerError)
+		}
+
+		// the admin flag is read again, so the refreshed token loses it together with the user
+		user, err := tx.GetUser(ctx, token.UserID)
+		if err != nil {
+			return tools.NewErrorMessage(err, "Ошибка при получении пользователя", http.StatusInternalServerError)
+		}
+
+		output, err = generateTokenPair(ctx, tx, r.keys, token.UserID, token.FamilyID, user.IsAdmin)
+		return
+	})
+	if err == nil && reuseErr != nil {
+		err = reuseErr
 	}
 	return
 }
 
-func (r *crypto) GetWallets(ctx context.Context) (output []*models.WalletsResponse, err error) {
-	const queryToGetWallets = `select address, name, balance from addresses as a 
-    	left join salary s on a.salary_id = s.id
-	where user_id = $1;`
+// LogOut revokes the access token of the request together with the refresh tokens of its session
+func (r *crypto) LogOut(ctx context.Context) (err error) {
+	jti, _ := ctx.Value(models.CtxKey("jti")).(string)
+	sessionID, _ := ctx.Value(models.CtxKey("sid")).(string)
+	expiresAt, _ := ctx.Value(models.CtxKey("exp")).(time.Time)
 
-	preID, err := strconv.Atoi(ctx.Value(models.CtxKey("id")).(string))
-	if err != nil {
-		err = tools.NewErrorMessage(err, "Ошибка при получении user_id из контекста",
-			http.StatusInternalServerError)
+	if err = r.revoked.Revoke(ctx, jti, expiresAt); err != nil {
+		err = tools.NewErrorMessage(err, "Ошибка при отзыве токена", http.StatusInternalServerError)
+		return
 	}
-	userID := int32(preID)
 
-	rows, err := r.db.QueryEx(ctx, queryToGetWallets, nil, userID)
+	if err = r.store.RevokeRefreshTokenFamily(ctx, sessionID); err != nil {
+		err = tools.NewErrorMessage(err, "Ошибка при отзыве сессии", http.StatusInternalServerError)
+	}
+	return
+}
+
+// RevokeAllSessions revokes every access and refresh token of the user issued so far
+func (r *crypto) RevokeAllSessions(ctx context.Context) (err error) {
+	preID, err := userIDFromContext(ctx)
 	if err != nil {
-		err = tools.NewErrorMessage(err, "Ошибка при получении данных по кошелькам",
-			http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
+	userID := int32(preID)
 
-	for rows.Next() {
-		local := new(models.WalletsResponse)
-		err = rows.Scan(
-			&local.Address,
-			&local.Salary,
-			&local.Balance)
-		if err != nil {
-			err = tools.NewErrorMessage(err, "Ошибка при сканировании кошелька",
-				http.StatusInternalServerError)
-			break
-		}
-		output = append(output, local)
+	if err = r.revokeAccessTokens(ctx, userID); err != nil {
+		return
 	}
 
+	if err = r.store.RevokeUserRefreshTokens(ctx, userID); err != nil {
+		err = tools.NewErrorMessage(err, "Ошибка при отзыве сессий", http.StatusInternalServerError)
+	}
 	return
 }
 
-func (r *crypto) Transaction(ctx context.Context, input models.TransactionRequest) (success bool, err error) {
-	const (
-		queryToMakeTransaction = `select make_transaction($1,$2,$3,$4)`
-	)
+// GetMe returns the profile of the user
+func (r *crypto) GetMe(ctx context.Context) (output models.SingleUserData, err error) {
+	preID, err := userIDFromContext(ctx)
+	if err != nil {
+		return
+	}
 
-	if input.FromAddress == input.ToAddress {
-		err = tools.NewErrorMessage(err, "Адрес не может быть одним и тем же", http.StatusBadRequest)
+	profile, err := r.store.GetProfile(ctx, int32(preID))
+	if err != nil {
+		err = tools.NewErrorMessage(err, "Ошибка при получении профиля", http.StatusInternalServerError)
 		return
 	}
+	output = profileResponse(profile)
+	return
+}
 
-	tx, err := r.db.Begin()
+// UpdateMe changes the fields of the profile given in the input, the others are kept
+func (r *crypto) UpdateMe(ctx context.Context, input models.UpdateUserData) (output models.SingleUserData, err error) {
+	preID, err := userIDFromContext(ctx)
 	if err != nil {
-		err = tools.NewErrorMessage(err, "Ошибка при создании транзакции", http.StatusInternalServerError)
 		return
 	}
+	input.ID = preID
 
-	defer func() {
-		if err != nil {
-			er := tx.Rollback()
-			if er != nil {
-				log.Printf("error while rolling up the transaction: %v", er)
-			}
-			return
+	if err = checkTheProfile(&input); err != nil {
+		return
+	}
+
+	err = r.inTx(ctx, func(tx storage.Storage) (err error) {
+		if err = tx.UpdateProfile(ctx, input); err != nil {
+			return tools.NewErrorMessage(err, "Ошибка при сохранении профиля", http.StatusInternalServerError)
 		}
-		if err = tx.Commit(); err != nil {
-			err = tools.NewErrorMessage(err, "Ошибка при tx.Commit", http.StatusInternalServerError)
+
+		profile, err := tx.GetProfile(ctx, int32(preID))
+		if err != nil {
+			return tools.NewErrorMessage(err, "Ошибка при получении профиля", http.StatusInternalServerError)
 		}
-	}()
+		output = profileResponse(profile)
+		return
+	})
+	return
+}
 
-	preID, err := strconv.Atoi(ctx.Value(models.CtxKey("id")).(string))
+// revokeAccessTokens revokes every access token of the user issued so far
+func (r *crypto) revokeAccessTokens(ctx context.Context, userID int32) (err error) {
+	now := time.Now()
+	err = r.revoked.RevokeUser(ctx, strconv.Itoa(int(userID)), now, now.Add(time.Duration(accessTokenTTL)*time.Second))
 	if err != nil {
-		err = tools.NewErrorMessage(err, "Ошибка при получении user_id из контекста",
-			http.StatusInternalServerError)
+		err = tools.NewErrorMessage(err, "Ошибка при отзыве токенов", http.StatusInternalServerError)
+	}
+	return
+}
+
+// ForgotPassword mails the token the password is reset with. The unknown email gets the same response,
+// so the endpoint does not tell who is registered.
+func (r *crypto) ForgotPassword(ctx context.Context, input models.ForgotPasswordRequest) (err error) {
+	email := normalizeEmail(input.Email)
+	if !isEmailValid(email) {
+		err = tools.NewErrorMessage(errors.New("bad email"), "Невалидный емейл", http.StatusBadRequest)
+		return
 	}
-	userID := int32(preID)
 
-	err = checkTheAddressesBelongToPerson(ctx, tx, []int32{input.FromAddress, input.ToAddress}, userID)
+	user, err := r.store.GetUserByEmail(ctx, email)
 	if err != nil {
+		if err == storage.ErrNotFound {
+			return nil
+		}
+		err = tools.NewErrorMessage(err, "Ошибка при получении данынх по емейлу", http.StatusInternalServerError)
 		return
 	}
 
-	err = tx.QueryRowEx(ctx, queryToMakeTransaction, nil, input.FromAddress,
-		input.ToAddress, input.Amount, defaultCommission).Scan(&success)
+	token, err := randToken(32)
 	if err != nil {
-		err = tools.NewErrorMessage(err, "Ошибка при переводе средств",
-			http.StatusInternalServerError)
+		err = tools.NewErrorMessage(err, "Ошибка при создании токена", http.StatusInternalServerError)
+		return
+	}
+	if err = r.store.SavePasswordResetToken(ctx, hashToken(token), user.ID, r.settings.PasswordResetTTL); err != nil {
+		err = tools.NewErrorMessage(err, "Ошибка при сохранении токена", http.StatusInternalServerError)
+		return
+	}
+
+	if err = r.mailer.Send(ctx, passwordResetMessage(user.Email, token, r.settings)); err != nil {
+		err = tools.NewErrorMessage(err, "Ошибка при отправке письма", http.StatusInternalServerError)
 	}
 	return
 }
 
-func (r *crypto) GetTransactions(ctx context.Context, perPage int, pageNum int) (response models.GetTransactionResponse, err error) {
-	const query = `
-		select a_from.address as from_address, a_to.address as to_address,amount_dollars as sum, commission, 
-				cast(create_at as text) as date, successful as success from transactions as t
-		    left join addresses a_from on a_from.id = t.from_address
-		    left join addresses a_to on a_to.id = t.to_address
-		where a_from.user_id = $1 or a_to.user_id = $1
-		order by create_at desc`
-
-	if pageNum < 0 || perPage <= 0 {
-		err = tools.NewErrorMessage(errors.New("bad query params"), "Невалидные query параметры",
-			http.StatusBadRequest)
+// ResetPassword sets the new password by the mailed token. The token is spent together with the other tokens
+// of the user and every session of the user is revoked.
+func (r *crypto) ResetPassword(ctx context.Context, input models.ResetPasswordRequest) (err error) {
+	if input.Token == "" {
+		err = tools.NewErrorMessage(errors.New("bad request"), "Токен не передан", http.StatusBadRequest)
 		return
 	}
+	if err = checkThePass(input.Pass); err != nil {
+		return
+	}
+
+	var userID int32
+	err = r.inTx(ctx, func(tx storage.Storage) (err error) {
+		token, err := tx.GetPasswordResetToken(ctx, hashToken(input.Token))
+		if err != nil {
+			if err == storage.ErrNotFound {
+				return tools.NewErrorMessage(err, "Некорректный токен сброса пароля", http.StatusBadRequest)
+			}
+			return tools.NewErrorMessage(err, "Ошибка при получении токена", http.StatusInternalServerError)
+		}
+		if token.Spent {
+			return tools.NewErrorMessage(errors.New("reset token is spent"), "Токен сброса пароля уже использован",
+				http.StatusBadRequest)
+		}
+		if token.Expired {
+			return tools.NewErrorMessage(errors.New("reset token expired"), "Срок действия токена сброса пароля истек",
+				http.StatusBadRequest)
+		}
+		userID = token.UserID
 
-	preID, err := strconv.Atoi(ctx.Value(models.CtxKey("id")).(string))
+		passHash, err := bcrypt.GenerateFromPassword([]byte(input.Pass), r.settings.BcryptCost)
+		if err != nil {
+			return tools.NewErrorMessage(err, "Внутренняя ошибка", http.StatusInternalServerError)
+		}
+		if err = tx.UpdatePassHash(ctx, userID, string(passHash)); err != nil {
+			return tools.NewErrorMessage(err, "Ошибка при сохранении пароля", http.StatusInternalServerError)
+		}
+		if err = tx.SpendPasswordResetTokens(ctx, userID); err != nil {
+			return tools.NewErrorMessage(err, "Ошибка при обновлении токена", http.StatusInternalServerError)
+		}
+		// the token came by the mail, so the user owns the mailbox
+		if err = tx.MarkEmailVerified(ctx, userID); err != nil {
+			return tools.NewErrorMessage(err, "Ошибка при подтверждении емейла", http.StatusInternalServerError)
+		}
+		if err = tx.RevokeUserRefreshTokens(ctx, userID); err != nil {
+			return tools.NewErrorMessage(err, "Ошибка при отзыве сессий", http.StatusInternalServerError)
+		}
+		return
+	})
 	if err != nil {
-		err = tools.NewErrorMessage(err, "Ошибка при получении user_id из контекста",
-			http.StatusInternalServerError)
+		return
 	}
-	userID := int32(preID)
 
-	rows, err := r.db.QueryEx(ctx, query, nil, userID)
-	if err != nil {
-		err = tools.NewErrorMessage(err, "Ошибка при получении данных по транзакциям",
-			http.StatusInternalServerError)
+	// the access tokens live elsewhere, they are revoked once the new password is saved
+	err = r.revokeAccessTokens(ctx, userID)
+	return
+}
+
+// VerifyEmail confirms the email of the user by the mailed token, the transfers are allowed since then
+func (r *crypto) VerifyEmail(ctx context.Context, input models.VerifyEmailRequest) (err error) {
+	if input.Token == "" {
+		err = tools.NewErrorMessage(errors.New("bad request"), "Токен не передан", http.StatusBadRequest)
 		return
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		local := new(models.SingleTransaction)
-		err = rows.Scan(
-			&local.FromAddress,
-			&local.ToAddress,
-			&local.Sum,
-			&local.Commission,
-			&local.Date,
-			&local.Success)
+	err = r.inTx(ctx, func(tx storage.Storage) (err error) {
+		token, err := tx.GetEmailVerificationToken(ctx, hashToken(input.Token))
 		if err != nil {
-			err = tools.NewErrorMessage(err, "Ошибка при сканировании списка транзакций",
-				http.StatusInternalServerError)
-			break
+			if err == storage.ErrNotFound {
+				return tools.NewErrorMessage(err, "Некорректный токен подтверждения", http.StatusBadRequest)
+			}
+			return tools.NewErrorMessage(err, "Ошибка при получении токена", http.StatusInternalServerError)
 		}
-		response.Items = append(response.Items, local)
-	}
+		if token.Spent {
+			return tools.NewErrorMessage(errors.New("verification token is spent"),
+				"Токен подтверждения уже использован", http.StatusBadRequest)
+		}
+		if token.Expired {
+			return tools.NewErrorMessage(errors.New("verification token expired"),
+				"Срок действия токена подтверждения истек", http.StatusBadRequest)
+		}
+
+		if err = tx.MarkEmailVerified(ctx, token.UserID); err != nil {
+			return tools.NewErrorMessage(err, "Ошибка при подтверждении емейла", http.StatusInternalServerError)
+		}
+		if err = tx.SpendEmailVerificationTokens(ctx, token.UserID); err != nil {
+			return tools.NewErrorMessage(err, "Ошибка при обновлении токена", http.StatusInternalServerError)
+		}
+		return
+	})
+	return
+}
 
-	response.Meta.Total = int32(len(response.Items))
-	response.Meta.PagesCount = response.Meta.Total / int32(perPage)
-	if response.Meta.Total%int32(perPage) != 0 {
-		response.Meta.PagesCount++
+// ResendVerificationEmail mails the new verification token to the user with the unconfirmed email
+func (r *crypto) ResendVerificationEmail(ctx context.Context) (err error) {
+	preID, err := userIDFromContext(ctx)
+	if err != nil {
+		return
 	}
-	response.Meta.PageNum = int32(pageNum)
+	userID := int32(preID)
 
-	if pageNum >= int(response.Meta.PagesCount) {
-		err = tools.NewErrorMessageEncodeIntoWriter(errors.New("bad query params"), "Слишком большое значение page_num",
+	user, err := r.store.GetUser(ctx, userID)
+	if err != nil {
+		err = tools.NewErrorMessage(err, "Ошибка при получении пользователя", http.StatusInternalServerError)
+		return
+	}
+	if user.EmailVerified {
+		err = tools.NewErrorMessage(errors.New("email is already verified"), "Емейл уже подтвержден",
 			http.StatusBadRequest)
-		return models.GetTransactionResponse{}, err
+		return
 	}
 
-	var (
-		firstVal int
-		lastVal  int
-	)
+	token, err := saveEmailVerificationToken(ctx, r.store, userID, r.settings.EmailVerificationTTL)
+	if err != nil {
+		return
+	}
 
-	firstVal = perPage * pageNum
-	lastVal = firstVal + perPage
-	if lastVal > int(response.Meta.Total) {
-		lastVal = int(response.Meta.Total)
+	if err = r.mailer.Send(ctx, emailVerificationMessage(user.Email, token, r.settings)); err != nil {
+		err = tools.NewErrorMessage(err, "Ошибка при отправке письма", http.StatusInternalServerError)
 	}
+	return
+}
 
-	response.Items = response.Items[firstVal:lastVal]
+// EnrollMFA creates the TOTP secret of the user, the second factor is on once ConfirmMFA gets the first code
+func (r *crypto) EnrollMFA(ctx context.Context) (output models.MFAEnrollResponse, err error) {
+	preID, err := userIDFromContext(ctx)
+	if err != nil {
+		return
+	}
+	userID := int32(preID)
+
+	err = r.inTx(ctx, func(tx storage.Storage) (err error) {
+		user, err := tx.GetUser(ctx, userID)
+		if err != nil {
+			return tools.NewErrorMessage(err, "Ошибка при получении пользователя", http.StatusInternalServerError)
+		}
+
+		current, err := tx.GetMFASecret(ctx, userID)
+		if err != nil && err != storage.ErrNotFound {
+			return tools.NewErrorMessage(err, "Ошибка при получении второго фактора", http.StatusInternalServerError)
+		}
+		if err == nil && current.Enabled {
+			return tools.NewErrorMessage(errors.New("mfa is already enabled"),
+				"Двухфакторная аутентификация уже включена", http.StatusBadRequest)
+		}
+
+		if output.Secret, err = totp.GenerateSecret(); err != nil {
+			return tools.NewErrorMessage(err, "Ошибка при создании секрета", http.StatusInternalServerError)
+		}
+		if err = tx.SaveMFASecret(ctx, userID, output.Secret); err != nil {
+			return tools.NewErrorMessage(err, "Ошибка при сохранении секрета", http.StatusInternalServerError)
+		}
+		output.URI = totp.URI(r.settings.MFAIssuer, user.Email, output.Secret)
+		return
+	})
+	return
+}
+
+// ConfirmMFA turns the second factor on by the first code of the enrolled secret and returns the recovery codes
+func (r *crypto) ConfirmMFA(ctx context.Context, input models.MFACodeRequest) (output models.MFAConfirmResponse,
+	err error) {
+	preID, err := userIDFromContext(ctx)
+	if err != nil {
+		return
+	}
+	userID := int32(preID)
+
+	err = r.inTx(ctx, func(tx storage.Storage) (err error) {
+		secret, err := tx.GetMFASecret(ctx, userID)
+		if err != nil {
+			if err == storage.ErrNotFound {
+				return tools.NewErrorMessage(err, "Сначала получите секрет двухфакторной аутентификации",
+					http.StatusBadRequest)
+			}
+			return tools.NewErrorMessage(err, "Ошибка при получении второго фактора", http.StatusInternalServerError)
+		}
+		if secret.Enabled {
+			return tools.NewErrorMessage(errors.New("mfa is already enabled"),
+				"Двухфакторная аутентификация уже включена", http.StatusBadRequest)
+		}
+
+		counter, ok := totp.Validate(secret.Secret, strings.TrimSpace(input.Code), time.Now(), mfaSkew)
+		if !ok {
+			return tools.NewErrorMessage(errors.New("bad mfa code"), "Неверный код", http.StatusBadRequest)
+		}
+
+		codes, hashes, err := newRecoveryCodes()
+		if err != nil {
+			return
+		}
+		if err = tx.EnableMFA(ctx, userID, counter, hashes); err != nil {
+			return tools.NewErrorMessage(err, "Ошибка при включении второго фактора", http.StatusInternalServerError)
+		}
+		output.RecoveryCodes = codes
+		return
+	})
+	return
+}
+
+// DisableMFA turns the second factor off by the TOTP or the recovery code
+func (r *crypto) DisableMFA(ctx context.Context, input models.MFACodeRequest) (err error) {
+	preID, err := userIDFromContext(ctx)
+	if err != nil {
+		return
+	}
+	userID := int32(preID)
+
+	err = r.inTx(ctx, func(tx storage.Storage) (err error) {
+		secret, err := tx.GetMFASecret(ctx, userID)
+		if err != nil && err != storage.ErrNotFound {
+			return tools.NewErrorMessage(err, "Ошибка при получении второго фактора", http.StatusInternalServerError)
+		}
+		if err == storage.ErrNotFound || !secret.Enabled {
+			return tools.NewErrorMessage(errors.New("mfa is not enabled"),
+				"Двухфакторная аутентификация не включена", http.StatusBadRequest)
+		}
+
+		ok, err := checkMFACode(ctx, tx, secret, input.Code, true)
+		if err != nil {
+			return
+		}
+		if !ok {
+			return tools.NewErrorMessage(errors.New("bad mfa code"), "Неверный код", http.StatusBadRequest)
+		}
+
+		if err = tx.DisableMFA(ctx, userID); err != nil {
+			return tools.NewErrorMessage(err, "Ошибка при отключении второго фактора", http.StatusInternalServerError)
+		}
+		return
+	})
+	return
+}
+
+// GetJWKS returns the public keys other services can verify our tokens with
+func (r *crypto) GetJWKS(ctx context.Context) (output models.JWKSResponse, err error) {
+	output.Keys = r.keys.JWKS()
+	return
+}
+
+// GetPoolStats returns the state of the db connection pool for monitoring
+func (r *crypto) GetPoolStats(ctx context.Context) (output models.PoolStatsResponse, err error) {
+	output = r.store.Stats()
+	return
+}
+
+func (r *crypto) GetWallets(ctx context.Context) (output []*models.WalletsResponse, err error) {
+	preID, err := userIDFromContext(ctx)
+	if err != nil {
+		return
+	}
+	userID := int32(preID)
+
+	if output, err = r.store.GetWallets(ctx, userID); err != nil {
+		err = tools.NewErrorMessage(err, "Ошибка при получении данных по кошелькам",
+			http.StatusInternalServerError)
+	}
+	return
+}
+
+// OpenWallet opens the empty wallet in the enabled currency, the user can have any number of wallets
+// in the same currency
+func (r *crypto) OpenWallet(ctx context.Context, input models.OpenWalletRequest) (output models.WalletsResponse, err error) {
+	label := strings.TrimSpace(input.Label)
+	if len([]rune(label)) > maxWalletLabelLen {
+		err = tools.NewErrorMessage(errors.New("label is too long"),
+			fmt.Sprintf("Метка кошелька должна быть не длиннее %d символов", maxWalletLabelLen), http.StatusBadRequest)
+		return
+	}
+
+	preID, err := userIDFromContext(ctx)
+	if err != nil {
+		return
+	}
+
+	err = r.inTx(ctx, func(tx storage.Storage) (err error) {
+		currency, err := getCurrencyByName(ctx, tx, input.Currency)
+		if err != nil {
+			return
+		}
+		if !currency.Enabled {
+			return tools.NewErrorMessage(fmt.Errorf("currency %s is disabled", currency.Name),
+				"Данная валюта отключена", http.StatusBadRequest)
+		}
+
+		walletID, err := createWallet(ctx, tx, currency, storage.Wallet{
+			UserID: int32(preID),
+			Label:  label,
+		})
+		if err != nil {
+			return
+		}
+
+		wallets, err := tx.GetWalletsByIDs(ctx, []int32{walletID})
+		if err != nil || len(wallets) != 1 {
+			return tools.NewErrorMessage(fmt.Errorf("wallet %d is not found: %v", walletID, err),
+				"Ошибка при получении кошелька", http.StatusInternalServerError)
+		}
+		output = models.WalletsResponse{
+			ID:        wallets[0].ID,
+			Salary:    currency.Name,
+			Balance:   wallets[0].Balance,
+			Address:   wallets[0].Address,
+			Label:     wallets[0].Label,
+			CreatedAt: wallets[0].CreatedAt,
+		}
+		return
+	})
+	return
+}
+
+// ArchiveWallet archives the empty wallet of the user, the wallet stays in the list and the history
+func (r *crypto) ArchiveWallet(ctx context.Context, publicAddress string) (err error) {
+	if err = validateAddress(publicAddress); err != nil {
+		return
+	}
+
+	preID, err := userIDFromContext(ctx)
+	if err != nil {
+		return
+	}
+
+	wallet, err := r.store.GetWalletByAddress(ctx, publicAddress)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			err = tools.NewErrorMessage(err, "Кошелек не найден", http.StatusNotFound)
+			return
+		}
+		err = tools.NewErrorMessage(err, "Ошибка при получении кошелька", http.StatusInternalServerError)
+		return
+	}
+	if wallet.UserID != int32(preID) {
+		err = tools.NewErrorMessage(errors.New("wallet of another user"), "Кошелек принадлежит другому пользователю",
+			http.StatusForbidden)
+		return
+	}
+	if wallet.ArchivedAt != nil {
+		err = tools.NewErrorMessage(errors.New("wallet is archived"), "Кошелек уже архивирован", http.StatusConflict)
+		return
+	}
+
+	// the balance is checked once more by the storage, the money could arrive meanwhile
+	archived, err := r.store.ArchiveWallet(ctx, wallet.ID)
+	if err != nil {
+		err = tools.NewErrorMessage(err, "Ошибка при архивации кошелька", http.StatusInternalServerError)
+		return
+	}
+	if !archived {
+		err = tools.NewErrorMessage(errors.New("balance is not zero"),
+			"Архивировать можно только кошелек с нулевым балансом", http.StatusConflict)
+	}
+	return
+}
+
+// Transaction moves the money and returns the details of the transfer, the failed transfer is returned as well
+func (r *crypto) Transaction(ctx context.Context, input models.TransactionRequest) (output models.TransactionDetail, err error) {
+	if !input.Amount.IsPositive() || !input.Amount.Equal(input.Amount.Truncate(usdScale)) {
+		err = tools.NewErrorMessage(errors.New("bad amount"),
+			"Сумма должна быть положительной и содержать не более двух знаков после запятой", http.StatusBadRequest)
+		return
+	}
+
+	// the input is kept as it is, it is the fingerprint of the idempotent request
+	toRef := input.ToAddress
+	if input.Recipient != "" {
+		toRef = models.WalletRef{Address: input.Recipient}
+	}
+	if input.FromAddress.IsZero() || toRef.IsZero() {
+		err = tools.NewErrorMessage(errors.New("no address"), "Не указан адрес отправителя или получателя",
+			http.StatusBadRequest)
+		return
+	}
+
+	preID, err := userIDFromContext(ctx)
+	if err != nil {
+		return
+	}
+	userID := int32(preID)
+
+	// the money moves only from the confirmed email, the unconfirmed one may be a typo or somebody else's
+	user, err := r.store.GetUser(ctx, userID)
+	if err != nil {
+		err = tools.NewErrorMessage(err, "Ошибка при получении пользователя", http.StatusInternalServerError)
+		return
+	}
+	if !user.EmailVerified {
+		err = tools.NewErrorMessage(errors.New("email is not verified"),
+			"Подтвердите емейл, чтобы совершать переводы", http.StatusForbidden)
+		return
+	}
+
+	err = r.inTx(ctx, func(tx storage.Storage) (err error) {
+		if input.IdempotencyKey != "" {
+			var (
+				replayed      bool
+				transactionID string
+			)
+			// the repeated request gets the outcome of the original one without moving the money again
+			replayed, transactionID, output.Success, err = reserveIdempotencyKey(ctx, tx, userID, input)
+			if err != nil {
+				return
+			}
+			if replayed {
+				// only the outcome is known for the keys saved before the transactions had the id
+				if transactionID == "" {
+					return
+				}
+				return getTransaction(ctx, tx, userID, transactionID, &output)
+			}
+		}
+
+		// the large transfer needs the fresh code, the stolen access token alone does not empty the wallet
+		threshold := r.settings.MFATransferThreshold
+		if threshold.IsPositive() && input.Amount.GreaterThan(threshold) {
+			if err = checkTransferCode(ctx, tx, r.limiters.TransferCodes, userID, input.OTP); err != nil {
+				return
+			}
+		}
+
+		fromID, err := resolveWalletID(ctx, tx, input.FromAddress)
+		if err != nil {
+			return
+		}
+		toID, err := resolveWalletID(ctx, tx, toRef)
+		if err != nil {
+			return
+		}
+		if fromID == toID {
+			return tools.NewErrorMessage(errors.New("same address"), "Адрес не может быть одним и тем же",
+				http.StatusBadRequest)
+		}
+
+		// the wallet given by the public address may belong to anybody, the one given by the id only to the user
+		from, to, err := getTransferWallets(ctx, tx, fromID, toID, userID, toRef.Address == "")
+		if err != nil {
+			return
+		}
+
+		if err = checkCurrenciesEnabled(ctx, tx, from.CurrencyID, to.CurrencyID); err != nil {
+			return
+		}
+
+		fromRate, err := getRate(ctx, tx, from.CurrencyID, r.settings.RateMaxAge)
+		if err != nil {
+			return
+		}
+		toRate, err := getRate(ctx, tx, to.CurrencyID, r.settings.RateMaxAge)
+		if err != nil {
+			return
+		}
+
+		transactionID, err := uuid.NewV4()
+		if err != nil {
+			return tools.NewErrorMessage(err, "Ошибка при создании id транзакции", http.StatusInternalServerError)
+		}
+
+		success, err := tx.MakeTransaction(ctx, transactionID.String(), from.ID, to.ID,
+			input.Amount, r.settings.Commission, fromRate, toRate)
+		if err != nil {
+			return tools.NewErrorMessage(err, "Ошибка при переводе средств",
+				http.StatusInternalServerError)
+		}
+
+		if input.IdempotencyKey != "" {
+			if err = saveIdempotentResult(ctx, tx, userID, input.IdempotencyKey, transactionID.String(), success); err != nil {
+				return
+			}
+		}
+		return getTransaction(ctx, tx, userID, transactionID.String(), &output)
+	})
+	return
+}
+
+// GetTransaction returns the transaction the user sent or received
+func (r *crypto) GetTransaction(ctx context.Context, transactionID string) (output models.TransactionDetail, err error) {
+	preID, err := userIDFromContext(ctx)
+	if err != nil {
+		return
+	}
+
+	err = getTransaction(ctx, r.store, int32(preID), transactionID, &output)
+	return
+}
+
+// GetTransactions returns the page of the transactions matching the filters. The page starts after the cursor,
+// the cursor of the next page is returned only when there is one.
+func (r *crypto) GetTransactions(ctx context.Context, input models.GetTransactionsRequest) (response models.GetTransactionResponse, err error) {
+	filter, err := newTransactionFilter(input)
+	if err != nil {
+		return
+	}
+
+	preID, err := userIDFromContext(ctx)
+	if err != nil {
+		return
+	}
+	filter.UserID = int32(preID)
+
+	limit := filter.Limit
+	// one more transaction tells whether the next page exists
+	filter.Limit++
+	items, err := r.store.GetTransactions(ctx, filter)
+	if err != nil {
+		err = tools.NewErrorMessage(err, "Ошибка при получении данных по транзакциям",
+			http.StatusInternalServerError)
+		return
+	}
+
+	if len(items) > limit {
+		items = items[:limit]
+		last := items[limit-1]
+		response.Meta.NextCursor = encodeCursor(storage.TransactionKey{CreateAt: last.CreateAt, ID: last.Seq})
+	}
+	response.Items = append([]*models.SingleTransaction{}, items...)
+	response.Meta.Limit = int32(limit)
+	return
+}
+
+// GetRates returns the prices the transfers are made with now, the disabled currencies and those
+// without any price are skipped
+func (r *crypto) GetRates(ctx context.Context) (output []*models.RateResponse, err error) {
+	currencies, err := r.store.GetCurrencies(ctx)
+	if err != nil {
+		err = tools.NewErrorMessage(err, "Ошибка при получении валют", http.StatusInternalServerError)
+		return
+	}
+
+	output = make([]*models.RateResponse, 0, len(currencies))
+	for _, currency := range currencies {
+		if !currency.Enabled {
+			continue
+		}
+		quote, er := r.store.GetLatestQuote(ctx, currency.ID)
+		if er == storage.ErrNotFound {
+			continue
+		}
+		if er != nil {
+			err = tools.NewErrorMessage(er, "Ошибка при получении курса валюты", http.StatusInternalServerError)
+			return
+		}
+
+		output = append(output, &models.RateResponse{
+			Currency: currency.Name,
+			Price:    quote.Price,
+			Source:   quote.Source,
+			QuotedAt: quote.QuotedAt.UTC(),
+			Stale:    isQuoteStale(quote, r.settings.RateMaxAge),
+		})
+	}
+	return
+}
+
+// GetCandles returns the prices of the currency grouped by the interval, the oldest first
+func (r *crypto) GetCandles(ctx context.Context, input models.GetCandlesRequest) (output models.GetCandlesResponse, err error) {
+	currency, err := getCurrencyByName(ctx, r.store, input.Currency)
+	if err != nil {
+		return
+	}
+
+	filter, err := newCandleFilter(input, currency.ID)
+	if err != nil {
+		return
+	}
+
+	candles, err := r.store.GetCandles(ctx, filter)
+	if err != nil {
+		err = tools.NewErrorMessage(err, "Ошибка при получении истории курса", http.StatusInternalServerError)
+		return
+	}
+
+	output = models.GetCandlesResponse{
+		Currency: currency.Name,
+		Interval: input.Interval,
+		From:     filter.From.UTC(),
+		To:       filter.To.UTC(),
+		Items:    make([]*models.Candle, 0, len(candles)),
+	}
+	for _, candle := range candles {
+		output.Items = append(output.Items, &models.Candle{
+			Time:   candle.Time.UTC(),
+			Open:   candle.Open,
+			High:   candle.High,
+			Low:    candle.Low,
+			Close:  candle.Close,
+			Quotes: candle.Quotes,
+		})
+	}
+	return
+}
+
+// SetRateOverride sets the price of the currency the transfers are made with instead of the feed
+func (r *crypto) SetRateOverride(ctx context.Context, input models.RateOverrideRequest) (err error) {
+	if !input.Price.IsPositive() {
+		err = tools.NewErrorMessage(errors.New("bad price"), "Курс должен быть положительным", http.StatusBadRequest)
+		return
+	}
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		err = tools.NewErrorMessage(errors.New("bad expires_at"), "Срок действия курса уже истек",
+			http.StatusBadRequest)
+		return
+	}
+
+	preID, err := userIDFromContext(ctx)
+	if err != nil {
+		return
+	}
+
+	currency, err := getCurrencyByName(ctx, r.store, input.Currency)
+	if err != nil {
+		return
+	}
+
+	if err = r.store.SetOverride(ctx, storage.Override{
+		CurrencyID: currency.ID,
+		Price:      input.Price,
+		ExpiresAt:  input.ExpiresAt,
+		CreatedBy:  int32(preID),
+	}); err != nil {
+		err = tools.NewErrorMessage(err, "Ошибка при сохранении курса", http.StatusInternalServerError)
+	}
+	return
+}
+
+// DeleteRateOverride returns the currency to the prices of the feed
+func (r *crypto) DeleteRateOverride(ctx context.Context, currency string) (err error) {
+	c, err := getCurrencyByName(ctx, r.store, currency)
+	if err != nil {
+		return
+	}
+
+	if err = r.store.DeleteOverride(ctx, c.ID); err != nil {
+		if err == storage.ErrNotFound {
+			err = tools.NewErrorMessage(err, "Курс для данной валюты не задан", http.StatusNotFound)
+			return
+		}
+		err = tools.NewErrorMessage(err, "Ошибка при удалении курса", http.StatusInternalServerError)
+	}
+	return
+}
+
+// GetCurrencies returns the whole registry including the disabled currencies
+func (r *crypto) GetCurrencies(ctx context.Context) (output []*models.CurrencyResponse, err error) {
+	currencies, err := r.store.GetCurrencies(ctx)
+	if err != nil {
+		err = tools.NewErrorMessage(err, "Ошибка при получении валют", http.StatusInternalServerError)
+		return
+	}
+
+	output = make([]*models.CurrencyResponse, 0, len(currencies))
+	for _, currency := range currencies {
+		output = append(output, currencyResponse(currency))
+	}
+	return
+}
+
+// CreateCurrency adds the currency to the registry, the new users get the wallet in it.
+// The transfers in the currency wait until the feed or the admin sets its price.
+func (r *crypto) CreateCurrency(ctx context.Context, input models.CreateCurrencyRequest) (output models.CurrencyResponse, err error) {
+	currency := storage.Currency{
+		Name:          strings.ToUpper(input.Code),
+		DisplayName:   strings.TrimSpace(input.DisplayName),
+		Scale:         input.Precision,
+		AddressFormat: input.AddressFormat,
+		Enabled:       input.Enabled == nil || *input.Enabled,
+	}
+	if currency.AddressFormat == "" {
+		currency.AddressFormat = address.FormatBase58Check
+	}
+	if err = validateCurrency(currency); err != nil {
+		return
+	}
+
+	err = r.inTx(ctx, func(tx storage.Storage) (err error) {
+		if _, err = tx.GetCurrencyByName(ctx, currency.Name); err != storage.ErrNotFound {
+			if err == nil {
+				return tools.NewErrorMessage(errors.New("currency exists"), "Данная валюта уже существует",
+					http.StatusConflict)
+			}
+			return tools.NewErrorMessage(err, "Ошибка при получении валюты", http.StatusInternalServerError)
+		}
+
+		if currency.ID, err = tx.CreateCurrency(ctx, currency); err != nil {
+			return tools.NewErrorMessage(err, "Ошибка при сохранении валюты", http.StatusInternalServerError)
+		}
+		return
+	})
+	if err == nil {
+		output = *currencyResponse(currency)
+	}
+	return
+}
+
+// UpdateCurrency changes the currency of the registry, disabling the currency stops its transfers
+func (r *crypto) UpdateCurrency(ctx context.Context, input models.UpdateCurrencyRequest) (output models.CurrencyResponse, err error) {
+	err = r.inTx(ctx, func(tx storage.Storage) (err error) {
+		currency, err := getCurrencyByName(ctx, tx, input.Code)
+		if err != nil {
+			return
+		}
+
+		if input.DisplayName != nil {
+			currency.DisplayName = strings.TrimSpace(*input.DisplayName)
+		}
+		if input.AddressFormat != nil {
+			currency.AddressFormat = *input.AddressFormat
+		}
+		if input.Enabled != nil {
+			currency.Enabled = *input.Enabled
+		}
+		if err = validateCurrency(currency); err != nil {
+			return
+		}
+
+		if err = tx.UpdateCurrency(ctx, currency); err != nil {
+			return tools.NewErrorMessage(err, "Ошибка при сохранении валюты", http.StatusInternalServerError)
+		}
+		output = *currencyResponse(currency)
+		return
+	})
+	return
+}
+
+// GetHouseAccounts returns the balances of the house accounts, the revenue keeps the fees of the transfers
+func (r *crypto) GetHouseAccounts(ctx context.Context) (output []*models.HouseAccountResponse, err error) {
+	currencies, err := r.store.GetCurrencies(ctx)
+	if err != nil {
+		err = tools.NewErrorMessage(err, "Ошибка при получении валют", http.StatusInternalServerError)
+		return
+	}
+	names := make(map[int32]string, len(currencies))
+	for _, currency := range currencies {
+		names[currency.ID] = currency.Name
+	}
+
+	accounts, err := r.store.GetHouseAccounts(ctx)
+	if err != nil {
+		err = tools.NewErrorMessage(err, "Ошибка при получении счетов", http.StatusInternalServerError)
+		return
+	}
+
+	output = make([]*models.HouseAccountResponse, 0, len(accounts))
+	for _, account := range accounts {
+		output = append(output, &models.HouseAccountResponse{
+			Currency: names[account.CurrencyID],
+			Account:  account.Kind,
+			Balance:  account.Balance,
+		})
+	}
 	return
 }
 
-func NewCrypto(db *pgx.Conn) Crypto {
+func NewCrypto(store storage.Storage, revoked revocation.Store, keys *keyring.Keyring, mail mailer.Mailer,
+	domains emaildomain.Checker, limiters Limiters, settings Settings) Crypto {
+	// the cost is validated by the config, so the hash of the short password can not fail
+	dummyPassHash, _ := bcrypt.GenerateFromPassword([]byte("not a password of anybody"), settings.BcryptCost)
 	return &crypto{
-		db: db,
+		store:         store,
+		revoked:       revoked,
+		keys:          keys,
+		mailer:        mail,
+		domains:       domains,
+		limiters:      limiters,
+		dummyPassHash: dummyPassHash,
+		settings:      settings,
 	}
 }
@@ -0,0 +1,1540 @@
+package crypto_app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/crypto_app/pkg/address"
+	"github.com/crypto_app/pkg/emaildomain"
+	"github.com/crypto_app/pkg/keyring"
+	"github.com/crypto_app/pkg/limiter"
+	"github.com/crypto_app/pkg/mailer"
+	"github.com/crypto_app/pkg/models"
+	"github.com/crypto_app/pkg/revocation"
+	"github.com/crypto_app/pkg/storage"
+	"github.com/crypto_app/pkg/totp"
+	"github.com/crypto_app/tools"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPass = "Passw0rd!x"
+
+// testMailer keeps the mails instead of sending them
+type testMailer struct {
+	sent []mailer.Message
+}
+
+func (m *testMailer) Send(ctx context.Context, msg mailer.Message) (err error) {
+	m.sent = append(m.sent, msg)
+	return
+}
+
+// newTestCrypto creates the app on the memory storage, every user gets 100 of every currency
+func newTestCrypto(t *testing.T) (*crypto, storage.Storage) {
+	t.Helper()
+
+	store := storage.NewMemoryStorage()
+	keys, err := keyring.New("test:HS256:secret", "test")
+	require.NoError(t, err)
+
+	domains, err := emaildomain.New(emaildomain.Settings{Kind: emaildomain.CheckNone})
+	require.NoError(t, err)
+
+	attempts := limiter.NewMemoryStore()
+	policy := limiter.Policy{FreeAttempts: 5, LockoutAttempts: 10, BaseDelay: time.Second,
+		LockoutDuration: time.Minute, Window: time.Hour}
+	limiters := Limiters{
+		Accounts:      limiter.NewLimiter(attempts, "email:", policy),
+		Clients:       limiter.NewLimiter(attempts, "ip:", policy),
+		TransferCodes: limiter.NewLimiter(attempts, "otp:", TransferCodePolicy),
+	}
+
+	r := NewCrypto(store, revocation.NewMemoryStore(), keys, &testMailer{}, domains, limiters, Settings{
+		Commission:           decimal.RequireFromString("0.01"),
+		DefaultBalance:       decimal.NewFromInt(100),
+		BcryptCost:           bcrypt.MinCost,
+		PasswordResetTTL:     time.Hour,
+		EmailVerificationTTL: time.Hour,
+		MFAIssuer:            "Crypto",
+		MFAChallengeTTL:      time.Minute,
+	})
+	return r.(*crypto), store
+}
+
+// newTestUser registers the user with the confirmed email and returns the context of the user
+func newTestUser(t *testing.T, r *crypto, store storage.Storage, email string) context.Context {
+	t.Helper()
+	ctx := context.Background()
+
+	_, err := r.Sign(ctx, &models.RegisterRequest{Name: "Ivan", LastName: "Petrov", Email: email, Pass: testPass})
+	require.NoError(t, err)
+	user, err := store.GetUserByEmail(ctx, email)
+	require.NoError(t, err)
+	require.NoError(t, store.MarkEmailVerified(ctx, user.ID))
+
+	return context.WithValue(ctx, models.CtxKey("id"), strconv.Itoa(int(user.ID)))
+}
+
+// authContext fills the context from the access token the same way the auth middleware does
+func authContext(t *testing.T, r *crypto, accessToken string) context.Context {
+	t.Helper()
+
+	claims := &models.ClaimWithID{}
+	_, err := jwt.ParseWithClaims(accessToken, claims, r.keys.Keyfunc)
+	require.NoError(t, err)
+
+	ctx := context.WithValue(context.Background(), models.CtxKey("id"), claims.ID)
+	ctx = context.WithValue(ctx, models.CtxKey("jti"), claims.Id)
+	ctx = context.WithValue(ctx, models.CtxKey("sid"), claims.SessionID)
+	return context.WithValue(ctx, models.CtxKey("exp"), time.Unix(claims.ExpiresAt, 0))
+}
+
+// isRevoked tells whether the auth middleware would reject the access token
+func isRevoked(t *testing.T, r *crypto, accessToken string) bool {
+	t.Helper()
+
+	claims := &models.ClaimWithID{}
+	_, err := jwt.ParseWithClaims(accessToken, claims, r.keys.Keyfunc)
+	require.NoError(t, err)
+
+	revoked, err := r.revoked.IsRevoked(context.Background(), claims.Id, claims.ID, time.Unix(claims.IssuedAt, 0))
+	require.NoError(t, err)
+	return revoked
+}
+
+// waitNextSecond sleeps till the next whole second, the tokens issued before are older than the revoke all then,
+// as the iat is in whole seconds
+func waitNextSecond() {
+	now := time.Now()
+	time.Sleep(now.Truncate(time.Second).Add(time.Second).Sub(now))
+}
+
+// walletOf returns the wallet of the user in the currency
+func walletOf(t *testing.T, r *crypto, store storage.Storage, ctx context.Context, currency string) storage.Wallet {
+	t.Helper()
+
+	wallets, err := r.GetWallets(ctx)
+	require.NoError(t, err)
+	for _, wallet := range wallets {
+		if wallet.Salary == currency {
+			stored, err := store.GetWalletByAddress(ctx, wallet.Address)
+			require.NoError(t, err)
+			return stored
+		}
+	}
+	t.Fatalf("no %s wallet", currency)
+	return storage.Wallet{}
+}
+
+func requireCode(t *testing.T, code int, err error, msgAndArgs ...interface{}) {
+	t.Helper()
+	require.Error(t, err, msgAndArgs...)
+	require.Equal(t, code, err.(tools.ErrorMessage).GetCode(), msgAndArgs...)
+}
+
+func TestLogIn(t *testing.T) {
+	r, store := newTestCrypto(t)
+	newTestUser(t, r, store, "alice@localhost")
+
+	output, err := r.LogIn(context.Background(), &models.LogInRequest{Email: "alice@localhost", Pass: testPass})
+	require.NoError(t, err)
+	require.NotEmpty(t, output.AccessToken)
+	require.NotEmpty(t, output.RefreshToken)
+
+	for _, c := range []models.LogInRequest{
+		{Email: "alice@localhost", Pass: "wrong-pass"},
+		{Email: "bob@localhost", Pass: testPass},
+		{Email: "alice", Pass: testPass},
+	} {
+		_, err = r.LogIn(context.Background(), &c)
+		require.Error(t, err, c.Email)
+	}
+}
+
+func TestLogInLockout(t *testing.T) {
+	r, store := newTestCrypto(t)
+	newTestUser(t, r, store, "alice@localhost")
+	ctx := context.Background()
+	logIn := func(email string, pass string) error {
+		_, err := r.LogIn(ctx, &models.LogInRequest{Email: email, Pass: pass})
+		return err
+	}
+
+	// the free failures and the one which sets the lock are answered as the wrong password,
+	// the unknown email gets the same answer
+	for i := 0; i < 6; i++ {
+		requireCode(t, http.StatusUnauthorized, logIn("alice@localhost", "wrong-pass"), "failure %d", i)
+		requireCode(t, http.StatusUnauthorized, logIn("bob@localhost", "wrong-pass"), "unknown %d", i)
+	}
+
+	// the case of the email gives no new attempts, the right password waits for the lock too
+	requireCode(t, http.StatusTooManyRequests, logIn("ALICE@localhost", "wrong-pass"))
+	requireCode(t, http.StatusTooManyRequests, logIn("alice@localhost", testPass))
+
+	require.NoError(t, r.UnlockLogIn(ctx, models.UnlockLogInRequest{Email: " Alice@localhost "}))
+	require.NoError(t, logIn("alice@localhost", testPass))
+
+	// the successful log in forgets the failures
+	for i := 0; i < 5; i++ {
+		requireCode(t, http.StatusUnauthorized, logIn("alice@localhost", "wrong-pass"), "failure %d", i)
+	}
+	require.NoError(t, logIn("alice@localhost", testPass))
+	requireCode(t, http.StatusUnauthorized, logIn("alice@localhost", "wrong-pass"))
+}
+
+func TestEmailCase(t *testing.T) {
+	r, _ := newTestCrypto(t)
+	ctx := context.Background()
+
+	// the email registered in the mixed case is kept in the lower one
+	_, err := r.Sign(ctx, &models.RegisterRequest{Name: "Ivan", LastName: "Petrov", Email: " Alice@LocalHost ",
+		Pass: testPass})
+	require.NoError(t, err)
+	mails := r.mailer.(*testMailer)
+	require.Equal(t, "alice@localhost", mails.sent[len(mails.sent)-1].To)
+
+	for _, email := range []string{"alice@localhost", "ALICE@LOCALHOST", "Alice@LocalHost", " alice@Localhost "} {
+		_, err = r.Sign(ctx, &models.RegisterRequest{Name: "Ivan", LastName: "Petrov", Email: email, Pass: testPass})
+		requireCode(t, http.StatusBadRequest, err, email)
+
+		_, err = r.LogIn(ctx, &models.LogInRequest{Email: email, Pass: testPass})
+		require.NoError(t, err, email)
+
+		sent := len(mails.sent)
+		require.NoError(t, r.ForgotPassword(ctx, models.ForgotPasswordRequest{Email: email}), email)
+		require.Len(t, mails.sent, sent+1, email)
+		require.Equal(t, "alice@localhost", mails.sent[sent].To, email)
+	}
+}
+
+func TestLogInClientLockout(t *testing.T) {
+	r, store := newTestCrypto(t)
+	newTestUser(t, r, store, "alice@localhost")
+	client := context.WithValue(context.Background(), models.CtxKey("ip"), "192.0.2.1")
+	other := context.WithValue(context.Background(), models.CtxKey("ip"), "192.0.2.2")
+
+	// the client guessing the passwords of many emails is locked by the address
+	for i := 0; i < 6; i++ {
+		_, err := r.LogIn(client, &models.LogInRequest{Email: fmt.Sprintf("user%d@localhost", i), Pass: testPass})
+		requireCode(t, http.StatusUnauthorized, err, "failure %d", i)
+	}
+	_, err := r.LogIn(client, &models.LogInRequest{Email: "alice@localhost", Pass: testPass})
+	requireCode(t, http.StatusTooManyRequests, err)
+
+	_, err = r.LogIn(other, &models.LogInRequest{Email: "alice@localhost", Pass: testPass})
+	require.NoError(t, err)
+
+	require.NoError(t, r.UnlockLogIn(context.Background(), models.UnlockLogInRequest{IP: "192.0.2.1"}))
+	_, err = r.LogIn(client, &models.LogInRequest{Email: "alice@localhost", Pass: testPass})
+	require.NoError(t, err)
+}
+
+func TestUnlockLogInBadRequest(t *testing.T) {
+	r, _ := newTestCrypto(t)
+	err := r.UnlockLogIn(context.Background(), models.UnlockLogInRequest{Email: " ", IP: ""})
+	requireCode(t, http.StatusBadRequest, err)
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	r, store := newTestCrypto(t)
+	newTestUser(t, r, store, "alice@localhost")
+	ctx := context.Background()
+
+	first, err := r.LogIn(ctx, &models.LogInRequest{Email: "alice@localhost", Pass: testPass})
+	require.NoError(t, err)
+
+	// every refresh token is swapped for a new pair once
+	second, err := r.RefreshToken(ctx, &models.RefreshTokenRequest{RefreshToken: first.RefreshToken})
+	require.NoError(t, err)
+	require.NotEqual(t, first.RefreshToken, second.RefreshToken)
+	third, err := r.RefreshToken(ctx, &models.RefreshTokenRequest{RefreshToken: second.RefreshToken})
+	require.NoError(t, err)
+
+	// the reuse of the spent token revokes the whole family, the latest token included
+	_, err = r.RefreshToken(ctx, &models.RefreshTokenRequest{RefreshToken: first.RefreshToken})
+	requireCode(t, http.StatusUnauthorized, err)
+	_, err = r.RefreshToken(ctx, &models.RefreshTokenRequest{RefreshToken: third.RefreshToken})
+	requireCode(t, http.StatusUnauthorized, err)
+
+	// the other sessions of the user are not touched
+	other, err := r.LogIn(ctx, &models.LogInRequest{Email: "alice@localhost", Pass: testPass})
+	require.NoError(t, err)
+	_, err = r.RefreshToken(ctx, &models.RefreshTokenRequest{RefreshToken: other.RefreshToken})
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		token string
+		code  int
+	}{
+		{"", http.StatusBadRequest},
+		{"unknown", http.StatusUnauthorized},
+	} {
+		_, err = r.RefreshToken(ctx, &models.RefreshTokenRequest{RefreshToken: c.token})
+		requireCode(t, c.code, err, c.token)
+	}
+}
+
+func TestLogOut(t *testing.T) {
+	r, store := newTestCrypto(t)
+	newTestUser(t, r, store, "alice@localhost")
+	ctx := context.Background()
+
+	session, err := r.LogIn(ctx, &models.LogInRequest{Email: "alice@localhost", Pass: testPass})
+	require.NoError(t, err)
+	other, err := r.LogIn(ctx, &models.LogInRequest{Email: "alice@localhost", Pass: testPass})
+	require.NoError(t, err)
+
+	require.NoError(t, r.LogOut(authContext(t, r, session.AccessToken)))
+
+	// only the session logged out of is revoked
+	require.True(t, isRevoked(t, r, session.AccessToken))
+	_, err = r.RefreshToken(ctx, &models.RefreshTokenRequest{RefreshToken: session.RefreshToken})
+	requireCode(t, http.StatusUnauthorized, err)
+
+	require.False(t, isRevoked(t, r, other.AccessToken))
+	_, err = r.RefreshToken(ctx, &models.RefreshTokenRequest{RefreshToken: other.RefreshToken})
+	require.NoError(t, err)
+}
+
+func TestRevokeAllSessions(t *testing.T) {
+	r, store := newTestCrypto(t)
+	newTestUser(t, r, store, "alice@localhost")
+	newTestUser(t, r, store, "bob@localhost")
+	ctx := context.Background()
+
+	var sessions []models.RegisterResponse
+	for i := 0; i < 2; i++ {
+		session, err := r.LogIn(ctx, &models.LogInRequest{Email: "alice@localhost", Pass: testPass})
+		require.NoError(t, err)
+		sessions = append(sessions, session)
+	}
+	bob, err := r.LogIn(ctx, &models.LogInRequest{Email: "bob@localhost", Pass: testPass})
+	require.NoError(t, err)
+
+	waitNextSecond()
+	require.NoError(t, r.RevokeAllSessions(authContext(t, r, sessions[0].AccessToken)))
+
+	for _, session := range sessions {
+		require.True(t, isRevoked(t, r, session.AccessToken))
+		_, err = r.RefreshToken(ctx, &models.RefreshTokenRequest{RefreshToken: session.RefreshToken})
+		requireCode(t, http.StatusUnauthorized, err)
+	}
+
+	// the sessions of other users are not touched
+	require.False(t, isRevoked(t, r, bob.AccessToken))
+	_, err = r.RefreshToken(ctx, &models.RefreshTokenRequest{RefreshToken: bob.RefreshToken})
+	require.NoError(t, err)
+}
+
+// resetToken asks for the password reset and returns the token of the mail
+func resetToken(t *testing.T, r *crypto, email string) string {
+	t.Helper()
+
+	mails := r.mailer.(*testMailer)
+	sent := len(mails.sent)
+	require.NoError(t, r.ForgotPassword(context.Background(), models.ForgotPasswordRequest{Email: email}))
+	require.Len(t, mails.sent, sent+1)
+
+	require.Equal(t, email, mails.sent[sent].To)
+	return tokenOf(t, mails.sent[sent], "Токен для сброса пароля: ")
+}
+
+// tokenOf returns the token following the prefix in the mail
+func tokenOf(t *testing.T, msg mailer.Message, prefix string) string {
+	t.Helper()
+
+	i := strings.Index(msg.Body, prefix)
+	require.True(t, i >= 0, msg.Body)
+	return strings.Fields(msg.Body[i+len(prefix):])[0]
+}
+
+func TestResetPassword(t *testing.T) {
+	r, store := newTestCrypto(t)
+	newTestUser(t, r, store, "alice@localhost")
+	ctx := context.Background()
+
+	session, err := r.LogIn(ctx, &models.LogInRequest{Email: "alice@localhost", Pass: testPass})
+	require.NoError(t, err)
+
+	const newPass = "N3wPassw0rd!"
+	token := resetToken(t, r, "alice@localhost")
+	waitNextSecond()
+	require.NoError(t, r.ResetPassword(ctx, models.ResetPasswordRequest{Token: token, Pass: newPass}))
+
+	// the sessions opened with the old password are closed
+	require.True(t, isRevoked(t, r, session.AccessToken))
+	_, err = r.RefreshToken(ctx, &models.RefreshTokenRequest{RefreshToken: session.RefreshToken})
+	requireCode(t, http.StatusUnauthorized, err)
+
+	_, err = r.LogIn(ctx, &models.LogInRequest{Email: "alice@localhost", Pass: testPass})
+	require.Error(t, err)
+	_, err = r.LogIn(ctx, &models.LogInRequest{Email: "alice@localhost", Pass: newPass})
+	require.NoError(t, err)
+}
+
+func TestResetPasswordRefused(t *testing.T) {
+	r, store := newTestCrypto(t)
+	newTestUser(t, r, store, "alice@localhost")
+	ctx := context.Background()
+
+	spent := resetToken(t, r, "alice@localhost")
+	// the second token is spent together with the first one
+	sibling := resetToken(t, r, "alice@localhost")
+	require.NoError(t, r.ResetPassword(ctx, models.ResetPasswordRequest{Token: spent, Pass: "N3wPassw0rd!"}))
+
+	r.settings.PasswordResetTTL = -time.Second
+	expired := resetToken(t, r, "alice@localhost")
+	r.settings.PasswordResetTTL = time.Hour
+	fresh := resetToken(t, r, "alice@localhost")
+
+	for _, c := range []struct {
+		name  string
+		input models.ResetPasswordRequest
+		code  int
+	}{
+		{"no token", models.ResetPasswordRequest{Pass: "N3wPassw0rd!"}, http.StatusBadRequest},
+		{"unknown token", models.ResetPasswordRequest{Token: "nope", Pass: "N3wPassw0rd!"}, http.StatusBadRequest},
+		{"spent token", models.ResetPasswordRequest{Token: spent, Pass: "N3wPassw0rd!"}, http.StatusBadRequest},
+		{"sibling token", models.ResetPasswordRequest{Token: sibling, Pass: "N3wPassw0rd!"}, http.StatusBadRequest},
+		{"expired token", models.ResetPasswordRequest{Token: expired, Pass: "N3wPassw0rd!"}, http.StatusBadRequest},
+		{"weak password", models.ResetPasswordRequest{Token: fresh, Pass: "short"}, http.StatusBadRequest},
+	} {
+		err := r.ResetPassword(ctx, c.input)
+		requireCode(t, c.code, err, c.name)
+	}
+
+	// the weak password does not spend the token
+	require.NoError(t, r.ResetPassword(ctx, models.ResetPasswordRequest{Token: fresh, Pass: "An0therPass!"}))
+}
+
+func TestForgotPassword(t *testing.T) {
+	r, store := newTestCrypto(t)
+	newTestUser(t, r, store, "alice@localhost")
+	mails := r.mailer.(*testMailer)
+
+	for _, c := range []struct {
+		name  string
+		email string
+		code  int
+		sent  int
+	}{
+		{"bad email", "alice", http.StatusBadRequest, 0},
+		{"unknown email", "bob@localhost", 0, 0},
+		{"known email", "alice@localhost", 0, 1},
+	} {
+		mails.sent = nil
+		err := r.ForgotPassword(context.Background(), models.ForgotPasswordRequest{Email: c.email})
+		if c.code != 0 {
+			requireCode(t, c.code, err, c.name)
+		} else {
+			require.NoError(t, err, c.name)
+		}
+		require.Len(t, mails.sent, c.sent, c.name)
+	}
+}
+
+func TestPasswordResetMessage(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		url      string
+		contains string
+	}{
+		{"token only", "", "Токен для сброса пароля: a+b"},
+		{"link", "https://crypto.example/reset?token=", "https://crypto.example/reset?token=a%2Bb"},
+	} {
+		msg := passwordResetMessage("alice@localhost", "a+b",
+			Settings{PasswordResetTTL: time.Hour, PasswordResetURL: c.url})
+		require.Equal(t, "alice@localhost", msg.To, c.name)
+		require.Contains(t, msg.Body, c.contains, c.name)
+	}
+}
+
+// stubDomains answers the domain check from the map, the other domains take mail
+type stubDomains map[string]error
+
+func (d stubDomains) Check(ctx context.Context, domain string) (err error) {
+	return d[domain]
+}
+
+func TestSignEmailDomain(t *testing.T) {
+	r, _ := newTestCrypto(t)
+	r.domains = stubDomains{
+		"nomail.localhost": emaildomain.ErrNoMail,
+		"down.localhost":   errors.New("resolver is unreachable"),
+	}
+
+	for _, c := range []struct {
+		name  string
+		email string
+		code  int
+	}{
+		{"domain taking mail", "alice@localhost", 0},
+		{"domain taking no mail", "alice@nomail.localhost", http.StatusBadRequest},
+		// the failed check lets the email through, the verification mail proves the mailbox anyway
+		{"failed check", "alice@down.localhost", 0},
+		{"bad email", "alice@", http.StatusBadRequest},
+	} {
+		_, err := r.Sign(context.Background(), &models.RegisterRequest{Name: "Ivan", LastName: "Petrov",
+			Email: c.email, Pass: testPass})
+		if c.code != 0 {
+			requireCode(t, c.code, err, c.name)
+		} else {
+			require.NoError(t, err, c.name)
+		}
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	r, store := newTestCrypto(t)
+	newTestUser(t, r, store, "bob@localhost")
+	ctx := context.Background()
+	mails := r.mailer.(*testMailer)
+
+	mails.sent = nil
+	session, err := r.Sign(ctx, &models.RegisterRequest{Name: "Ivan", LastName: "Petrov", Email: "alice@localhost",
+		Pass: testPass})
+	require.NoError(t, err)
+	require.Len(t, mails.sent, 1)
+	require.Equal(t, "alice@localhost", mails.sent[0].To)
+	token := tokenOf(t, mails.sent[0], "Токен для подтверждения емейла: ")
+	alice := authContext(t, r, session.AccessToken)
+
+	// the transfers wait for the confirmed email
+	transfer := models.TransactionRequest{
+		FromAddress: models.WalletRef{ID: walletOf(t, r, store, alice, "BTC").ID},
+		ToAddress:   models.WalletRef{Address: walletOf(t, r, store, alice, "ETH").Address},
+		Amount:      decimal.NewFromInt(10),
+	}
+	_, err = r.Transaction(alice, transfer)
+	requireCode(t, http.StatusForbidden, err)
+
+	require.NoError(t, r.VerifyEmail(ctx, models.VerifyEmailRequest{Token: token}))
+	user, err := store.GetUserByEmail(ctx, "alice@localhost")
+	require.NoError(t, err)
+	require.True(t, user.EmailVerified)
+	_, err = r.Transaction(alice, transfer)
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		name  string
+		token string
+	}{
+		{"no token", ""},
+		{"unknown token", "nope"},
+		{"spent token", token},
+	} {
+		err = r.VerifyEmail(ctx, models.VerifyEmailRequest{Token: c.token})
+		requireCode(t, http.StatusBadRequest, err, c.name)
+	}
+}
+
+func TestVerifyEmailExpired(t *testing.T) {
+	r, _ := newTestCrypto(t)
+	r.settings.EmailVerificationTTL = -time.Second
+	mails := r.mailer.(*testMailer)
+
+	_, err := r.Sign(context.Background(), &models.RegisterRequest{Name: "Ivan", LastName: "Petrov",
+		Email: "alice@localhost", Pass: testPass})
+	require.NoError(t, err)
+
+	token := tokenOf(t, mails.sent[0], "Токен для подтверждения емейла: ")
+	err = r.VerifyEmail(context.Background(), models.VerifyEmailRequest{Token: token})
+	requireCode(t, http.StatusBadRequest, err)
+}
+
+func TestResendVerificationEmail(t *testing.T) {
+	r, store := newTestCrypto(t)
+	verified := newTestUser(t, r, store, "bob@localhost")
+	ctx := context.Background()
+	mails := r.mailer.(*testMailer)
+
+	session, err := r.Sign(ctx, &models.RegisterRequest{Name: "Ivan", LastName: "Petrov", Email: "alice@localhost",
+		Pass: testPass})
+	require.NoError(t, err)
+	alice := authContext(t, r, session.AccessToken)
+
+	// the lost mail is sent again, any of the tokens confirms the email
+	mails.sent = nil
+	require.NoError(t, r.ResendVerificationEmail(alice))
+	require.Len(t, mails.sent, 1)
+	require.Equal(t, "alice@localhost", mails.sent[0].To)
+	token := tokenOf(t, mails.sent[0], "Токен для подтверждения емейла: ")
+	require.NoError(t, r.VerifyEmail(ctx, models.VerifyEmailRequest{Token: token}))
+
+	for _, c := range []struct {
+		name string
+		ctx  context.Context
+	}{
+		{"confirmed by the token", alice},
+		{"confirmed before", verified},
+	} {
+		err = r.ResendVerificationEmail(c.ctx)
+		requireCode(t, http.StatusBadRequest, err, c.name)
+	}
+}
+
+func TestResetPasswordVerifiesEmail(t *testing.T) {
+	r, store := newTestCrypto(t)
+	ctx := context.Background()
+
+	_, err := r.Sign(ctx, &models.RegisterRequest{Name: "Ivan", LastName: "Petrov", Email: "alice@localhost",
+		Pass: testPass})
+	require.NoError(t, err)
+
+	// the reset token came by the mail, so the mailbox is proven
+	token := resetToken(t, r, "alice@localhost")
+	require.NoError(t, r.ResetPassword(ctx, models.ResetPasswordRequest{Token: token, Pass: "N3wPassw0rd!"}))
+	user, err := store.GetUserByEmail(ctx, "alice@localhost")
+	require.NoError(t, err)
+	require.True(t, user.EmailVerified)
+}
+
+// enableMFA turns the second factor of the user on with the code of the current step,
+// the next code the tests may pass is the one of the step after
+func enableMFA(t *testing.T, r *crypto, ctx context.Context) (secret string, recoveryCodes []string) {
+	t.Helper()
+
+	enrolled, err := r.EnrollMFA(ctx)
+	require.NoError(t, err)
+	confirmed, err := r.ConfirmMFA(ctx, models.MFACodeRequest{Code: totpCode(t, enrolled.Secret, 0)})
+	require.NoError(t, err)
+	return enrolled.Secret, confirmed.RecoveryCodes
+}
+
+// totpCode the code of the secret for the step relative to the current one
+func totpCode(t *testing.T, secret string, step int64) string {
+	t.Helper()
+
+	code, err := totp.Code(secret, totp.Counter(time.Now())+step)
+	require.NoError(t, err)
+	return code
+}
+
+func TestEnrollMFA(t *testing.T) {
+	r, store := newTestCrypto(t)
+	ctx := newTestUser(t, r, store, "alice@localhost")
+
+	_, err := r.ConfirmMFA(ctx, models.MFACodeRequest{Code: "123456"})
+	requireCode(t, http.StatusBadRequest, err, "confirm before enroll")
+
+	enrolled, err := r.EnrollMFA(ctx)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(enrolled.URI, "otpauth://totp/Crypto:alice@localhost?"), enrolled.URI)
+	require.Contains(t, enrolled.URI, "secret="+enrolled.Secret)
+
+	// the second enroll replaces the unconfirmed secret
+	reenrolled, err := r.EnrollMFA(ctx)
+	require.NoError(t, err)
+	require.NotEqual(t, enrolled.Secret, reenrolled.Secret)
+
+	for _, c := range []struct {
+		name string
+		code string
+	}{
+		{"no code", ""},
+		{"code of the replaced secret", totpCode(t, enrolled.Secret, 0)},
+		{"code of the far step", totpCode(t, reenrolled.Secret, 5)},
+	} {
+		_, err = r.ConfirmMFA(ctx, models.MFACodeRequest{Code: c.code})
+		requireCode(t, http.StatusBadRequest, err, c.name)
+	}
+
+	confirmed, err := r.ConfirmMFA(ctx, models.MFACodeRequest{Code: " " + totpCode(t, reenrolled.Secret, 0) + " "})
+	require.NoError(t, err)
+	require.Len(t, confirmed.RecoveryCodes, recoveryCodesCount)
+
+	_, err = r.EnrollMFA(ctx)
+	requireCode(t, http.StatusBadRequest, err, "enroll when enabled")
+	_, err = r.ConfirmMFA(ctx, models.MFACodeRequest{Code: totpCode(t, reenrolled.Secret, 1)})
+	requireCode(t, http.StatusBadRequest, err, "confirm when enabled")
+}
+
+func TestLogInMFA(t *testing.T) {
+	r, store := newTestCrypto(t)
+	secret, _ := enableMFA(t, r, newTestUser(t, r, store, "alice@localhost"))
+	ctx := context.Background()
+
+	// the password alone gives only the challenge
+	challenge, err := r.LogIn(ctx, &models.LogInRequest{Email: "alice@localhost", Pass: testPass})
+	require.NoError(t, err)
+	require.True(t, challenge.MFARequired)
+	require.NotEmpty(t, challenge.MFAToken)
+	require.Empty(t, challenge.AccessToken)
+	require.Empty(t, challenge.RefreshToken)
+
+	for _, c := range []struct {
+		name  string
+		input models.LogInMFARequest
+		code  int
+	}{
+		{"no token", models.LogInMFARequest{Code: "123456"}, http.StatusBadRequest},
+		{"no code", models.LogInMFARequest{MFAToken: challenge.MFAToken}, http.StatusBadRequest},
+		{"unknown token", models.LogInMFARequest{MFAToken: "nope", Code: "123456"}, http.StatusUnauthorized},
+		// the code of the confirmation is spent
+		{"replayed code", models.LogInMFARequest{MFAToken: challenge.MFAToken, Code: totpCode(t, secret, 0)},
+			http.StatusUnauthorized},
+	} {
+		_, err = r.LogInMFA(ctx, c.input)
+		requireCode(t, c.code, err, c.name)
+	}
+
+	output, err := r.LogInMFA(ctx, models.LogInMFARequest{MFAToken: challenge.MFAToken, Code: totpCode(t, secret, 1)})
+	require.NoError(t, err)
+	require.NotEmpty(t, output.AccessToken)
+	require.NotEmpty(t, output.RefreshToken)
+	require.False(t, isRevoked(t, r, output.AccessToken))
+
+	// the challenge is passed once
+	_, err = r.LogInMFA(ctx, models.LogInMFARequest{MFAToken: challenge.MFAToken, Code: totpCode(t, secret, 1)})
+	requireCode(t, http.StatusUnauthorized, err)
+}
+
+func TestLogInMFAAttempts(t *testing.T) {
+	r, store := newTestCrypto(t)
+	_, recoveryCodes := enableMFA(t, r, newTestUser(t, r, store, "alice@localhost"))
+	ctx := context.Background()
+	// the challenge dies before the email is locked
+	r.limiters.Accounts = limiter.NewLimiter(limiter.NewMemoryStore(), "email:", limiter.Policy{FreeAttempts: 100,
+		LockoutAttempts: 200, BaseDelay: time.Second, LockoutDuration: time.Minute, Window: time.Hour})
+
+	challenge, err := r.LogIn(ctx, &models.LogInRequest{Email: "alice@localhost", Pass: testPass})
+	require.NoError(t, err)
+
+	// the wrong codes are counted, the error does not roll the attempt back
+	for i := 0; i < maxMFAAttempts; i++ {
+		_, err = r.LogInMFA(ctx, models.LogInMFARequest{MFAToken: challenge.MFAToken, Code: "000000"})
+		requireCode(t, http.StatusUnauthorized, err, "attempt %d", i)
+	}
+	_, err = r.LogInMFA(ctx, models.LogInMFARequest{MFAToken: challenge.MFAToken, Code: recoveryCodes[0]})
+	requireCode(t, http.StatusUnauthorized, err)
+
+	// the dead challenge did not spend the recovery code
+	challenge, err = r.LogIn(ctx, &models.LogInRequest{Email: "alice@localhost", Pass: testPass})
+	require.NoError(t, err)
+	_, err = r.LogInMFA(ctx, models.LogInMFARequest{MFAToken: challenge.MFAToken, Code: recoveryCodes[0]})
+	require.NoError(t, err)
+}
+
+func TestLogInMFALockout(t *testing.T) {
+	r, store := newTestCrypto(t)
+	secret, _ := enableMFA(t, r, newTestUser(t, r, store, "alice@localhost"))
+	ctx := context.Background()
+	logIn := func() (challenge models.RegisterResponse) {
+		challenge, err := r.LogIn(ctx, &models.LogInRequest{Email: "alice@localhost", Pass: testPass})
+		require.NoError(t, err)
+		return challenge
+	}
+
+	// every password and every code is the attempt of the email, the new challenge gives no new guesses
+	for i := 0; i < 3; i++ {
+		_, err := r.LogInMFA(ctx, models.LogInMFARequest{MFAToken: logIn().MFAToken, Code: "000000"})
+		requireCode(t, http.StatusUnauthorized, err, "attempt %d", i)
+	}
+	_, err := r.LogIn(ctx, &models.LogInRequest{Email: "alice@localhost", Pass: testPass})
+	requireCode(t, http.StatusTooManyRequests, err)
+
+	// the right password alone does not forget the attempts, the right code does
+	require.NoError(t, r.UnlockLogIn(ctx, models.UnlockLogInRequest{Email: "alice@localhost"}))
+	for i := 0; i < 2; i++ {
+		_, err = r.LogInMFA(ctx, models.LogInMFARequest{MFAToken: logIn().MFAToken, Code: "000000"})
+		requireCode(t, http.StatusUnauthorized, err, "attempt %d", i)
+	}
+	_, err = r.LogInMFA(ctx, models.LogInMFARequest{MFAToken: logIn().MFAToken, Code: totpCode(t, secret, 1)})
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		_, err = r.LogInMFA(ctx, models.LogInMFARequest{MFAToken: logIn().MFAToken, Code: "000000"})
+		requireCode(t, http.StatusUnauthorized, err, "attempt after the reset %d", i)
+	}
+}
+
+func TestLogInMFAExpired(t *testing.T) {
+	r, store := newTestCrypto(t)
+	secret, _ := enableMFA(t, r, newTestUser(t, r, store, "alice@localhost"))
+	r.settings.MFAChallengeTTL = -time.Second
+
+	challenge, err := r.LogIn(context.Background(), &models.LogInRequest{Email: "alice@localhost", Pass: testPass})
+	require.NoError(t, err)
+	_, err = r.LogInMFA(context.Background(), models.LogInMFARequest{MFAToken: challenge.MFAToken,
+		Code: totpCode(t, secret, 1)})
+	requireCode(t, http.StatusUnauthorized, err)
+}
+
+func TestLogInMFARecoveryCode(t *testing.T) {
+	r, store := newTestCrypto(t)
+	_, recoveryCodes := enableMFA(t, r, newTestUser(t, r, store, "alice@localhost"))
+	ctx := context.Background()
+
+	for _, c := range []struct {
+		name string
+		code string
+		ok   bool
+	}{
+		// the code is typed in any case and without the dash
+		{"recovery code", strings.ToUpper(strings.Replace(recoveryCodes[0], "-", "", 1)), true},
+		{"used recovery code", recoveryCodes[0], false},
+		{"other recovery code", recoveryCodes[1], true},
+	} {
+		challenge, err := r.LogIn(ctx, &models.LogInRequest{Email: "alice@localhost", Pass: testPass})
+		require.NoError(t, err, c.name)
+
+		_, err = r.LogInMFA(ctx, models.LogInMFARequest{MFAToken: challenge.MFAToken, Code: c.code})
+		if c.ok {
+			require.NoError(t, err, c.name)
+		} else {
+			requireCode(t, http.StatusUnauthorized, err, c.name)
+		}
+	}
+}
+
+func TestDisableMFA(t *testing.T) {
+	r, store := newTestCrypto(t)
+	alice := newTestUser(t, r, store, "alice@localhost")
+	ctx := context.Background()
+
+	err := r.DisableMFA(alice, models.MFACodeRequest{Code: "123456"})
+	requireCode(t, http.StatusBadRequest, err, "disable when not enabled")
+
+	_, recoveryCodes := enableMFA(t, r, alice)
+	err = r.DisableMFA(alice, models.MFACodeRequest{Code: "000000"})
+	requireCode(t, http.StatusBadRequest, err, "wrong code")
+	require.NoError(t, r.DisableMFA(alice, models.MFACodeRequest{Code: recoveryCodes[0]}))
+
+	// the password is enough again
+	output, err := r.LogIn(ctx, &models.LogInRequest{Email: "alice@localhost", Pass: testPass})
+	require.NoError(t, err)
+	require.False(t, output.MFARequired)
+	require.NotEmpty(t, output.AccessToken)
+}
+
+func TestTransactionMFAThreshold(t *testing.T) {
+	r, store := newTestCrypto(t)
+	r.settings.MFATransferThreshold = decimal.NewFromInt(50)
+	alice := newTestUser(t, r, store, "alice@localhost")
+	from := models.WalletRef{ID: walletOf(t, r, store, alice, "BTC").ID}
+	to := models.WalletRef{Address: walletOf(t, r, store, alice, "ETH").Address}
+	transfer := func(amount int64, otp string) error {
+		_, err := r.Transaction(alice, models.TransactionRequest{FromAddress: from, ToAddress: to,
+			Amount: decimal.NewFromInt(amount), OTP: otp})
+		return err
+	}
+
+	require.NoError(t, transfer(50, ""), "small transfer")
+	requireCode(t, http.StatusForbidden, transfer(60, ""), "large transfer without the second factor")
+
+	secret, recoveryCodes := enableMFA(t, r, alice)
+	for _, c := range []struct {
+		name string
+		otp  string
+		code int
+	}{
+		{"no code", "", http.StatusForbidden},
+		{"wrong code", "000000", http.StatusForbidden},
+		{"recovery code", recoveryCodes[0], http.StatusForbidden},
+		{"fresh code", totpCode(t, secret, 1), 0},
+		{"replayed code", totpCode(t, secret, 1), http.StatusForbidden},
+	} {
+		err := transfer(60, c.otp)
+		if c.code != 0 {
+			requireCode(t, c.code, err, c.name)
+		} else {
+			require.NoError(t, err, c.name)
+		}
+	}
+}
+
+func TestMe(t *testing.T) {
+	r, store := newTestCrypto(t)
+	alice := newTestUser(t, r, store, "alice@localhost")
+	bob := newTestUser(t, r, store, "bob@localhost")
+	str := func(s string) *string { return &s }
+
+	profile, err := r.GetMe(alice)
+	require.NoError(t, err)
+	require.Equal(t, "Ivan", profile.Name)
+	require.Equal(t, "Petrov", profile.LastName)
+	require.Equal(t, "alice@localhost", profile.Email)
+	require.True(t, profile.EmailVerified)
+	require.Nil(t, profile.DOB)
+	require.Nil(t, profile.UpdatedAt)
+	_, err = time.Parse(time.RFC3339, profile.CreateAt)
+	require.NoError(t, err)
+
+	// the absent fields are kept
+	profile, err = r.UpdateMe(alice, models.UpdateUserData{Name: str(" Anna "), DOB: str("1990-05-17"),
+		Description: str("hodler")})
+	require.NoError(t, err)
+	require.Equal(t, "Anna", profile.Name)
+	require.Equal(t, "Petrov", profile.LastName)
+	require.Equal(t, "1990-05-17", *profile.DOB)
+	require.Equal(t, "hodler", profile.Description)
+	require.NotNil(t, profile.UpdatedAt)
+
+	profile, err = r.UpdateMe(alice, models.UpdateUserData{DOB: str("")})
+	require.NoError(t, err)
+	require.Nil(t, profile.DOB)
+	require.Equal(t, "Anna", profile.Name)
+
+	// the refused update changes nothing, the profiles of others are not touched
+	_, err = r.UpdateMe(alice, models.UpdateUserData{Name: str("Anna"), LastName: str("P3trova")})
+	requireCode(t, http.StatusBadRequest, err)
+	profile, err = r.GetMe(alice)
+	require.NoError(t, err)
+	require.Equal(t, "Petrov", profile.LastName)
+
+	profile, err = r.GetMe(bob)
+	require.NoError(t, err)
+	require.Equal(t, "Ivan", profile.Name)
+	require.Nil(t, profile.UpdatedAt)
+}
+
+func TestTransactionMFALockout(t *testing.T) {
+	r, store := newTestCrypto(t)
+	r.settings.MFATransferThreshold = decimal.NewFromInt(50)
+	alice := newTestUser(t, r, store, "alice@localhost")
+	secret, _ := enableMFA(t, r, alice)
+	transfer := models.TransactionRequest{
+		FromAddress: models.WalletRef{ID: walletOf(t, r, store, alice, "BTC").ID},
+		ToAddress:   models.WalletRef{Address: walletOf(t, r, store, alice, "ETH").Address},
+		Amount:      decimal.NewFromInt(60),
+	}
+
+	// the wrong codes survive the rollback of the transfer
+	transfer.OTP = "000000"
+	for i := 0; i < maxMFAAttempts; i++ {
+		_, err := r.Transaction(alice, transfer)
+		requireCode(t, http.StatusForbidden, err, "attempt %d", i)
+	}
+	transfer.OTP = totpCode(t, secret, 1)
+	_, err := r.Transaction(alice, transfer)
+	requireCode(t, http.StatusTooManyRequests, err)
+
+	// the small transfers need no code and are not locked
+	transfer.Amount, transfer.OTP = decimal.NewFromInt(10), ""
+	_, err = r.Transaction(alice, transfer)
+	require.NoError(t, err)
+}
+
+func TestUnauthorizedContext(t *testing.T) {
+	r, _ := newTestCrypto(t)
+	ctx := context.Background()
+
+	for _, c := range []struct {
+		name string
+		call func() error
+	}{
+		{"alive", func() error { _, err := r.Alive(ctx); return err }},
+		{"me", func() error { _, err := r.GetMe(ctx); return err }},
+		{"wallets", func() error { _, err := r.GetWallets(ctx); return err }},
+		{"revoke all sessions", func() error { return r.RevokeAllSessions(ctx) }},
+		{"enroll mfa", func() error { _, err := r.EnrollMFA(ctx); return err }},
+	} {
+		requireCode(t, http.StatusUnauthorized, c.call(), c.name)
+	}
+}
+
+func TestLogInAfterRevokeAllSessions(t *testing.T) {
+	r, store := newTestCrypto(t)
+	newTestUser(t, r, store, "alice@localhost")
+	ctx := context.Background()
+
+	session, err := r.LogIn(ctx, &models.LogInRequest{Email: "alice@localhost", Pass: testPass})
+	require.NoError(t, err)
+	require.NoError(t, r.RevokeAllSessions(authContext(t, r, session.AccessToken)))
+
+	// the new session is opened in the same second the old ones were revoked
+	session, err = r.LogIn(ctx, &models.LogInRequest{Email: "alice@localhost", Pass: testPass})
+	require.NoError(t, err)
+	require.False(t, isRevoked(t, r, session.AccessToken))
+	refreshed, err := r.RefreshToken(ctx, &models.RefreshTokenRequest{RefreshToken: session.RefreshToken})
+	require.NoError(t, err)
+	require.False(t, isRevoked(t, r, refreshed.AccessToken))
+}
+
+func TestOpenWallet(t *testing.T) {
+	r, store := newTestCrypto(t)
+	alice := newTestUser(t, r, store, "alice@localhost")
+	disabled := false
+	_, err := r.CreateCurrency(alice, models.CreateCurrencyRequest{Code: "DOGE", DisplayName: "Dogecoin",
+		Precision: 8, Enabled: &disabled})
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		name  string
+		input models.OpenWalletRequest
+		code  int
+	}{
+		{"second wallet in the currency", models.OpenWalletRequest{Currency: "eth", Label: " savings "}, 0},
+		{"without label", models.OpenWalletRequest{Currency: "BTC"}, 0},
+		{"long label", models.OpenWalletRequest{Currency: "BTC", Label: strings.Repeat("ы", maxWalletLabelLen+1)},
+			http.StatusBadRequest},
+		{"unknown currency", models.OpenWalletRequest{Currency: "XRP"}, http.StatusNotFound},
+		{"disabled currency", models.OpenWalletRequest{Currency: "DOGE"}, http.StatusBadRequest},
+	} {
+		output, err := r.OpenWallet(alice, c.input)
+		if c.code != 0 {
+			requireCode(t, c.code, err, c.name)
+			continue
+		}
+		require.NoError(t, err, c.name)
+		require.NotZero(t, output.ID, c.name)
+		require.Equal(t, strings.ToUpper(c.input.Currency), output.Salary, c.name)
+		require.Equal(t, strings.TrimSpace(c.input.Label), output.Label, c.name)
+		require.True(t, output.Balance.IsZero(), c.name)
+		require.False(t, output.CreatedAt.IsZero(), c.name)
+	}
+
+	wallets, err := r.GetWallets(alice)
+	require.NoError(t, err)
+	require.Len(t, wallets, 4)
+}
+
+func TestArchiveWallet(t *testing.T) {
+	r, store := newTestCrypto(t)
+	alice := newTestUser(t, r, store, "alice@localhost")
+	bob := newTestUser(t, r, store, "bob@localhost")
+	empty, err := r.OpenWallet(alice, models.OpenWalletRequest{Currency: "BTC"})
+	require.NoError(t, err)
+	full := walletOf(t, r, store, alice, "ETH")
+	bobs := walletOf(t, r, store, bob, "BTC")
+
+	for _, c := range []struct {
+		name    string
+		address string
+		code    int
+	}{
+		{"empty wallet", empty.Address, 0},
+		{"archived wallet", empty.Address, http.StatusConflict},
+		{"wallet with money", full.Address, http.StatusConflict},
+		{"wallet of another user", bobs.Address, http.StatusForbidden},
+		{"unknown wallet", "00000000000000000000", http.StatusNotFound},
+	} {
+		err := r.ArchiveWallet(alice, c.address)
+		if c.code != 0 {
+			requireCode(t, c.code, err, c.name)
+			continue
+		}
+		require.NoError(t, err, c.name)
+	}
+
+	// the archived wallet stays in the list but takes no transfers
+	wallets, err := r.GetWallets(alice)
+	require.NoError(t, err)
+	require.Len(t, wallets, 3)
+	require.True(t, wallets[2].Archived)
+	_, err = r.Transaction(bob, models.TransactionRequest{FromAddress: models.WalletRef{ID: bobs.ID},
+		Recipient: empty.Address, Amount: decimal.NewFromInt(10)})
+	requireCode(t, http.StatusBadRequest, err)
+}
+
+func TestTransactionBadAmount(t *testing.T) {
+	// the amount is checked before the database is touched
+	r := &crypto{}
+
+	for _, amount := range []string{"0", "-1", "0.001", "10.999"} {
+		_, err := r.Transaction(context.Background(), models.TransactionRequest{
+			FromAddress: models.WalletRef{ID: 1},
+			ToAddress:   models.WalletRef{ID: 2},
+			Amount:      decimal.RequireFromString(amount),
+		})
+		requireCode(t, http.StatusBadRequest, err, amount)
+	}
+}
+
+func TestTransactionAmounts(t *testing.T) {
+	r, store := newTestCrypto(t)
+	alice := newTestUser(t, r, store, "alice@localhost")
+	bob := newTestUser(t, r, store, "bob@localhost")
+	from, to := walletOf(t, r, store, alice, "BTC"), walletOf(t, r, store, bob, "BTC")
+
+	detail, err := r.Transaction(alice, models.TransactionRequest{
+		FromAddress: models.WalletRef{ID: from.ID},
+		Recipient:   to.Address,
+		Amount:      decimal.NewFromInt(10),
+	})
+	require.NoError(t, err)
+	require.True(t, detail.Success)
+	require.NotEmpty(t, detail.ID)
+	require.Equal(t, models.DirectionOutgoing, detail.Direction)
+
+	// 10$ at 32853.856: the debit with 1% commission is rounded up, the credit is rounded down
+	debit, credit, fee := decimal.RequireFromString("0.00030746"), decimal.RequireFromString("0.00030437"),
+		decimal.RequireFromString("0.00000309")
+	require.True(t, detail.Debited.Decimal.Equal(debit), "debited %s", detail.Debited.Decimal)
+	require.True(t, detail.Credited.Decimal.Equal(credit), "credited %s", detail.Credited.Decimal)
+	require.True(t, detail.Fee.Decimal.Equal(fee), "fee %s", detail.Fee.Decimal)
+	require.True(t, detail.FromRate.Decimal.Equal(decimal.RequireFromString("32853.856")))
+	require.True(t, walletOf(t, r, store, alice, "BTC").Balance.Equal(decimal.NewFromInt(100).Sub(debit)))
+	require.True(t, walletOf(t, r, store, bob, "BTC").Balance.Equal(decimal.NewFromInt(100).Add(credit)))
+}
+
+func TestTransactionStaleRate(t *testing.T) {
+	r, store := newTestCrypto(t)
+	alice := newTestUser(t, r, store, "alice@localhost")
+	bob := newTestUser(t, r, store, "bob@localhost")
+	from, to := walletOf(t, r, store, alice, "BTC"), walletOf(t, r, store, bob, "BTC")
+	request := models.TransactionRequest{FromAddress: models.WalletRef{ID: from.ID}, Recipient: to.Address,
+		Amount: decimal.NewFromInt(10)}
+
+	// the quotes of the memory storage are taken at its creation, they are stale at once
+	r.settings.RateMaxAge = time.Nanosecond
+	_, err := r.Transaction(alice, request)
+	requireCode(t, http.StatusServiceUnavailable, err)
+	require.True(t, walletOf(t, r, store, alice, "BTC").Balance.Equal(decimal.NewFromInt(100)))
+
+	// the price set by the admin does not get stale
+	require.NoError(t, r.SetRateOverride(alice, models.RateOverrideRequest{Currency: "btc",
+		Price: decimal.NewFromInt(10)}))
+	detail, err := r.Transaction(alice, request)
+	require.NoError(t, err)
+	require.True(t, detail.Debited.Decimal.Equal(decimal.RequireFromString("1.01010102")), "debited %s",
+		detail.Debited.Decimal)
+	require.True(t, detail.Credited.Decimal.Equal(decimal.NewFromInt(1)), "credited %s", detail.Credited.Decimal)
+
+	require.NoError(t, r.DeleteRateOverride(alice, "BTC"))
+	_, err = r.Transaction(alice, request)
+	requireCode(t, http.StatusServiceUnavailable, err)
+}
+
+func TestRateOverride(t *testing.T) {
+	r, store := newTestCrypto(t)
+	admin := newTestUser(t, r, store, "admin@localhost")
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+
+	for _, c := range []struct {
+		name  string
+		input models.RateOverrideRequest
+		code  int
+	}{
+		{"price", models.RateOverrideRequest{Currency: "BTC", Price: decimal.NewFromInt(30000)}, 0},
+		{"price until", models.RateOverrideRequest{Currency: "eth", Price: decimal.NewFromInt(2000),
+			ExpiresAt: &future}, 0},
+		{"zero price", models.RateOverrideRequest{Currency: "BTC"}, http.StatusBadRequest},
+		{"negative price", models.RateOverrideRequest{Currency: "BTC", Price: decimal.NewFromInt(-1)},
+			http.StatusBadRequest},
+		{"expired", models.RateOverrideRequest{Currency: "BTC", Price: decimal.NewFromInt(30000), ExpiresAt: &past},
+			http.StatusBadRequest},
+		{"unknown currency", models.RateOverrideRequest{Currency: "DOGE", Price: decimal.NewFromInt(1)},
+			http.StatusNotFound},
+	} {
+		err := r.SetRateOverride(admin, c.input)
+		if c.code != 0 {
+			requireCode(t, c.code, err, c.name)
+			continue
+		}
+		require.NoError(t, err, c.name)
+
+		currency, err := store.GetCurrencyByName(admin, strings.ToUpper(c.input.Currency))
+		require.NoError(t, err, c.name)
+		quote, err := store.GetLatestQuote(admin, currency.ID)
+		require.NoError(t, err, c.name)
+		require.Equal(t, storage.SourceManual, quote.Source, c.name)
+		require.True(t, c.input.Price.Equal(quote.Price), c.name)
+	}
+
+	require.NoError(t, r.DeleteRateOverride(admin, "BTC"))
+	requireCode(t, http.StatusNotFound, r.DeleteRateOverride(admin, "BTC"))
+	requireCode(t, http.StatusNotFound, r.DeleteRateOverride(admin, "DOGE"))
+}
+
+func TestGetRates(t *testing.T) {
+	r, store := newTestCrypto(t)
+	ctx := newTestUser(t, r, store, "alice@localhost")
+	require.NoError(t, r.SetRateOverride(ctx, models.RateOverrideRequest{Currency: "ETH",
+		Price: decimal.NewFromInt(3000)}))
+
+	r.settings.RateMaxAge = time.Nanosecond
+	rates, err := r.GetRates(ctx)
+	require.NoError(t, err)
+	require.Len(t, rates, 2)
+
+	// the price of the feed is stale at once, the price set by the admin never is
+	require.Equal(t, "BTC", rates[0].Currency)
+	require.True(t, rates[0].Price.Equal(decimal.RequireFromString("32853.856")))
+	require.True(t, rates[0].Stale)
+	require.Equal(t, "ETH", rates[1].Currency)
+	require.True(t, rates[1].Price.Equal(decimal.NewFromInt(3000)))
+	require.Equal(t, storage.SourceManual, rates[1].Source)
+	require.False(t, rates[1].Stale)
+}
+
+func TestGetCandles(t *testing.T) {
+	r, store := newTestCrypto(t)
+	ctx := newTestUser(t, r, store, "alice@localhost")
+	to := time.Now().Truncate(time.Minute).Add(time.Minute)
+	require.NoError(t, store.SaveQuotes(ctx, []storage.Quote{
+		{CurrencyID: btc, Price: decimal.NewFromInt(40000), Source: "http", QuotedAt: to.Add(-90 * time.Second)},
+	}))
+
+	output, err := r.GetCandles(ctx, models.GetCandlesRequest{Currency: "btc", Interval: "1m", To: &to})
+	require.NoError(t, err)
+	require.Equal(t, "BTC", output.Currency)
+	require.True(t, output.From.Equal(to.Add(-defaultCandles*time.Minute)))
+	// the quote of the feed and the quote of the memory storage taken at its creation
+	require.Len(t, output.Items, 2)
+	require.True(t, output.Items[0].Open.Equal(decimal.NewFromInt(40000)))
+	require.Equal(t, int64(1), output.Items[1].Quotes)
+
+	for _, c := range []struct {
+		name  string
+		input models.GetCandlesRequest
+		code  int
+	}{
+		{"unknown currency", models.GetCandlesRequest{Currency: "DOGE", Interval: "1m"}, http.StatusNotFound},
+		{"unknown interval", models.GetCandlesRequest{Currency: "BTC", Interval: "5m"}, http.StatusBadRequest},
+	} {
+		_, err := r.GetCandles(ctx, c.input)
+		requireCode(t, c.code, err, c.name)
+	}
+}
+
+func TestCurrencyRegistry(t *testing.T) {
+	r, store := newTestCrypto(t)
+	admin := newTestUser(t, r, store, "admin@localhost")
+	disabled := false
+
+	for _, c := range []struct {
+		name  string
+		input models.CreateCurrencyRequest
+		code  int
+	}{
+		{"currency", models.CreateCurrencyRequest{Code: "usdt", DisplayName: " Tether ", Precision: 6}, 0},
+		{"disabled currency", models.CreateCurrencyRequest{Code: "DOGE", DisplayName: "Dogecoin", Precision: 8,
+			Enabled: &disabled}, 0},
+		{"existing currency", models.CreateCurrencyRequest{Code: "BTC", DisplayName: "Bitcoin", Precision: 8},
+			http.StatusConflict},
+		{"bad code", models.CreateCurrencyRequest{Code: "US DT", DisplayName: "Tether", Precision: 6},
+			http.StatusBadRequest},
+		{"bad address format", models.CreateCurrencyRequest{Code: "XRP", DisplayName: "Ripple", Precision: 6,
+			AddressFormat: "base58"}, http.StatusBadRequest},
+	} {
+		output, err := r.CreateCurrency(admin, c.input)
+		if c.code != 0 {
+			requireCode(t, c.code, err, c.name)
+			continue
+		}
+		require.NoError(t, err, c.name)
+		require.Equal(t, strings.ToUpper(c.input.Code), output.Code, c.name)
+		require.Equal(t, address.FormatBase58Check, output.AddressFormat, c.name)
+		require.Equal(t, c.input.Enabled == nil, output.Enabled, c.name)
+	}
+
+	currencies, err := r.GetCurrencies(admin)
+	require.NoError(t, err)
+	require.Len(t, currencies, 4)
+	require.Equal(t, models.CurrencyResponse{Code: "USDT", DisplayName: "Tether", Precision: 6,
+		AddressFormat: address.FormatBase58Check, Enabled: true}, *currencies[2])
+
+	// the new users get the wallets in the enabled currencies only
+	alice := newTestUser(t, r, store, "alice@localhost")
+	wallets, err := r.GetWallets(alice)
+	require.NoError(t, err)
+	var names []string
+	for _, wallet := range wallets {
+		names = append(names, wallet.Salary)
+	}
+	require.Equal(t, []string{"BTC", "ETH", "USDT"}, names)
+
+	// the disabled currency takes no transfers and has no rate
+	bob := newTestUser(t, r, store, "bob@localhost")
+	from, to := walletOf(t, r, store, alice, "ETH"), walletOf(t, r, store, bob, "ETH")
+	output, err := r.UpdateCurrency(admin, models.UpdateCurrencyRequest{Code: "eth", Enabled: &disabled})
+	require.NoError(t, err)
+	require.False(t, output.Enabled)
+	require.Equal(t, "Ethereum", output.DisplayName)
+
+	_, err = r.Transaction(alice, models.TransactionRequest{FromAddress: models.WalletRef{ID: from.ID},
+		Recipient: to.Address, Amount: decimal.NewFromInt(10)})
+	requireCode(t, http.StatusBadRequest, err)
+	rates, err := r.GetRates(alice)
+	require.NoError(t, err)
+	require.Len(t, rates, 1)
+	require.Equal(t, "BTC", rates[0].Currency)
+
+	empty := " "
+	_, err = r.UpdateCurrency(admin, models.UpdateCurrencyRequest{Code: "ETH", DisplayName: &empty})
+	requireCode(t, http.StatusBadRequest, err)
+	_, err = r.UpdateCurrency(admin, models.UpdateCurrencyRequest{Code: "XRP", Enabled: &disabled})
+	requireCode(t, http.StatusNotFound, err)
+}
+
+func TestGetHouseAccounts(t *testing.T) {
+	r, store := newTestCrypto(t)
+	alice := newTestUser(t, r, store, "alice@localhost")
+	bob := newTestUser(t, r, store, "bob@localhost")
+
+	// the default balances are issued by the ledger
+	accounts, err := r.GetHouseAccounts(alice)
+	require.NoError(t, err)
+	require.Equal(t, []string{"BTC/issuance -200", "ETH/issuance -200"}, houseAccounts(accounts))
+
+	from, to := walletOf(t, r, store, alice, "BTC"), walletOf(t, r, store, bob, "ETH")
+	_, err = r.Transaction(alice, models.TransactionRequest{FromAddress: models.WalletRef{ID: from.ID},
+		Recipient: to.Address, Amount: decimal.NewFromInt(10)})
+	require.NoError(t, err)
+
+	accounts, err = r.GetHouseAccounts(alice)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"BTC/exchange 0.00030437", "BTC/issuance -200", "BTC/revenue 0.00000309",
+		"ETH/exchange -0.004944009096976738", "ETH/issuance -200",
+	}, houseAccounts(accounts))
+}
+
+func houseAccounts(accounts []*models.HouseAccountResponse) (out []string) {
+	for _, account := range accounts {
+		out = append(out, account.Currency+"/"+account.Account+" "+account.Balance.String())
+	}
+	return
+}
+
+func TestTransactionInsufficientFunds(t *testing.T) {
+	r, store := newTestCrypto(t)
+	alice := newTestUser(t, r, store, "alice@localhost")
+	bob := newTestUser(t, r, store, "bob@localhost")
+	from, to := walletOf(t, r, store, alice, "BTC"), walletOf(t, r, store, bob, "BTC")
+
+	detail, err := r.Transaction(alice, models.TransactionRequest{
+		FromAddress: models.WalletRef{ID: from.ID},
+		Recipient:   to.Address,
+		Amount:      decimal.NewFromInt(99999999),
+	})
+	require.NoError(t, err)
+	require.False(t, detail.Success)
+	require.Equal(t, storage.FailureInsufficientFunds, detail.FailureReason)
+
+	// the failed transfer is recorded, but nothing is moved
+	recorded, err := r.GetTransaction(alice, detail.ID)
+	require.NoError(t, err)
+	require.False(t, recorded.Success)
+	require.True(t, walletOf(t, r, store, alice, "BTC").Balance.Equal(decimal.NewFromInt(100)))
+	require.True(t, walletOf(t, r, store, bob, "BTC").Balance.Equal(decimal.NewFromInt(100)))
+}
+
+func TestTransactionAddresses(t *testing.T) {
+	r, store := newTestCrypto(t)
+	alice := newTestUser(t, r, store, "alice@localhost")
+	bob := newTestUser(t, r, store, "bob@localhost")
+	aliceBTC, aliceETH := walletOf(t, r, store, alice, "BTC"), walletOf(t, r, store, alice, "ETH")
+	bobBTC := walletOf(t, r, store, bob, "BTC")
+	byID := func(wallet storage.Wallet) models.WalletRef {
+		return models.WalletRef{ID: wallet.ID}
+	}
+	byAddress := func(wallet storage.Wallet) models.WalletRef {
+		return models.WalletRef{Address: wallet.Address}
+	}
+	// typo changes the last symbol of the address, the checksum catches it
+	typo := func(address string) string {
+		last := "2"
+		if strings.HasSuffix(address, last) {
+			last = "3"
+		}
+		return address[:len(address)-1] + last
+	}
+
+	for _, c := range []struct {
+		name  string
+		input models.TransactionRequest
+		code  int
+	}{
+		{"between own wallets by ids", models.TransactionRequest{FromAddress: byID(aliceBTC),
+			ToAddress: byID(aliceETH)}, 0},
+		{"between own wallets by addresses", models.TransactionRequest{FromAddress: byAddress(aliceBTC),
+			ToAddress: byAddress(aliceETH)}, 0},
+		{"to the address of another user", models.TransactionRequest{FromAddress: byID(aliceBTC),
+			ToAddress: byAddress(bobBTC)}, 0},
+		{"to the recipient", models.TransactionRequest{FromAddress: byAddress(aliceBTC),
+			Recipient: bobBTC.Address}, 0},
+		{"recipient wins", models.TransactionRequest{FromAddress: byID(aliceBTC), ToAddress: byID(aliceETH),
+			Recipient: bobBTC.Address}, 0},
+		{"no source", models.TransactionRequest{ToAddress: byID(aliceETH)}, http.StatusBadRequest},
+		{"no destination", models.TransactionRequest{FromAddress: byID(aliceBTC)}, http.StatusBadRequest},
+		{"to the wallet id of another user", models.TransactionRequest{FromAddress: byID(aliceBTC),
+			ToAddress: byID(bobBTC)}, http.StatusForbidden},
+		{"from the wallet id of another user", models.TransactionRequest{FromAddress: byID(bobBTC),
+			Recipient: aliceBTC.Address}, http.StatusForbidden},
+		{"from the address of another user", models.TransactionRequest{FromAddress: byAddress(bobBTC),
+			ToAddress: byID(aliceBTC)}, http.StatusForbidden},
+		{"from the unknown wallet id", models.TransactionRequest{FromAddress: models.WalletRef{ID: 100},
+			ToAddress: byID(aliceBTC)}, http.StatusNotFound},
+		{"to the same wallet", models.TransactionRequest{FromAddress: byID(aliceBTC), ToAddress: byID(aliceBTC)},
+			http.StatusBadRequest},
+		{"to the same wallet by its address", models.TransactionRequest{FromAddress: byID(aliceBTC),
+			Recipient: aliceBTC.Address}, http.StatusBadRequest},
+		{"to the unknown address", models.TransactionRequest{FromAddress: byID(aliceBTC),
+			Recipient: "12345678901234567890"}, http.StatusNotFound},
+		{"from the unknown address", models.TransactionRequest{
+			FromAddress: models.WalletRef{Address: "12345678901234567890"}, ToAddress: byID(aliceBTC)},
+			http.StatusNotFound},
+		{"to the malformed address", models.TransactionRequest{FromAddress: byID(aliceBTC), Recipient: "unknown"},
+			http.StatusBadRequest},
+		{"to the address with a typo", models.TransactionRequest{FromAddress: byID(aliceBTC),
+			Recipient: typo(bobBTC.Address)}, http.StatusBadRequest},
+	} {
+		c.input.Amount = decimal.NewFromInt(1)
+		detail, err := r.Transaction(alice, c.input)
+		if c.code != 0 {
+			requireCode(t, c.code, err, c.name)
+			continue
+		}
+		require.NoError(t, err, c.name)
+		require.True(t, detail.Success, c.name)
+	}
+}
+
+func TestTransactionIdempotency(t *testing.T) {
+	r, store := newTestCrypto(t)
+	alice := newTestUser(t, r, store, "alice@localhost")
+	bob := newTestUser(t, r, store, "bob@localhost")
+	from, to := walletOf(t, r, store, alice, "BTC"), walletOf(t, r, store, bob, "BTC")
+
+	request := models.TransactionRequest{
+		FromAddress:    models.WalletRef{ID: from.ID},
+		Recipient:      to.Address,
+		Amount:         decimal.NewFromInt(10),
+		IdempotencyKey: "key",
+	}
+	first, err := r.Transaction(alice, request)
+	require.NoError(t, err)
+	require.True(t, first.Success)
+
+	// the replays get the outcome of the first request without moving the money again
+	for i := 0; i < 2; i++ {
+		replayed, err := r.Transaction(alice, request)
+		require.NoError(t, err)
+		require.Equal(t, first, replayed)
+	}
+	require.True(t, walletOf(t, r, store, bob, "BTC").Balance.Equal(
+		decimal.NewFromInt(100).Add(decimal.RequireFromString("0.00030437"))))
+	transactions, err := r.GetTransactions(alice, models.GetTransactionsRequest{})
+	require.NoError(t, err)
+	require.Len(t, transactions.Items, 1)
+
+	request.Amount = decimal.NewFromInt(20)
+	_, err = r.Transaction(alice, request)
+	requireCode(t, http.StatusConflict, err)
+
+	// every user has keys of their own
+	bobFrom := walletOf(t, r, store, bob, "ETH")
+	_, err = r.Transaction(bob, models.TransactionRequest{FromAddress: models.WalletRef{ID: bobFrom.ID},
+		Recipient: from.Address, Amount: decimal.NewFromInt(20), IdempotencyKey: "key"})
+	require.NoError(t, err)
+}
+
+func TestInTxRollback(t *testing.T) {
+	r, store := newTestCrypto(t)
+	alice := newTestUser(t, r, store, "alice@localhost")
+	bob := newTestUser(t, r, store, "bob@localhost")
+	from, to := walletOf(t, r, store, alice, "BTC"), walletOf(t, r, store, bob, "BTC")
+
+	errAbort := errors.New("abort")
+	err := r.inTx(alice, func(tx storage.Storage) (err error) {
+		success, err := tx.MakeTransaction(alice, "00000000-0000-0000-0000-000000000001", from.ID, to.ID,
+			decimal.NewFromInt(10), r.settings.Commission, decimal.NewFromInt(1), decimal.NewFromInt(1))
+		require.NoError(t, err)
+		require.True(t, success)
+		return errAbort
+	})
+	// the error of the storage is wrapped like the errors of the app
+	requireCode(t, http.StatusInternalServerError, err)
+
+	// neither the balances nor the transaction survive the rollback
+	require.True(t, walletOf(t, r, store, alice, "BTC").Balance.Equal(decimal.NewFromInt(100)))
+	require.True(t, walletOf(t, r, store, bob, "BTC").Balance.Equal(decimal.NewFromInt(100)))
+	_, err = r.GetTransaction(alice, "00000000-0000-0000-0000-000000000001")
+	requireCode(t, http.StatusNotFound, err)
+}
+
+func TestGetTransaction(t *testing.T) {
+	r, store := newTestCrypto(t)
+	alice := newTestUser(t, r, store, "alice@localhost")
+	bob := newTestUser(t, r, store, "bob@localhost")
+	carol := newTestUser(t, r, store, "carol@localhost")
+	from, to := walletOf(t, r, store, alice, "BTC"), walletOf(t, r, store, bob, "ETH")
+
+	made, err := r.Transaction(alice, models.TransactionRequest{
+		FromAddress: models.WalletRef{ID: from.ID},
+		Recipient:   to.Address,
+		Amount:      decimal.NewFromInt(10),
+	})
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		name      string
+		ctx       context.Context
+		id        string
+		direction string
+		code      int
+	}{
+		{"sender", alice, made.ID, models.DirectionOutgoing, 0},
+		{"recipient", bob, made.ID, models.DirectionIncoming, 0},
+		// the transaction of other users does not exist for the user
+		{"stranger", carol, made.ID, "", http.StatusNotFound},
+		{"unknown", alice, "00000000-0000-0000-0000-000000000001", "", http.StatusNotFound},
+	} {
+		detail, err := r.GetTransaction(c.ctx, c.id)
+		if c.code != 0 {
+			requireCode(t, c.code, err, c.name)
+			continue
+		}
+		require.NoError(t, err, c.name)
+		require.Equal(t, made.ID, detail.ID, c.name)
+		require.Equal(t, c.direction, detail.Direction, c.name)
+		require.Equal(t, "BTC", detail.FromCurrency, c.name)
+		require.Equal(t, "ETH", detail.ToCurrency, c.name)
+	}
+}
+
+func TestGetTransactionsPagination(t *testing.T) {
+	r, store := newTestCrypto(t)
+	alice := newTestUser(t, r, store, "alice@localhost")
+	bob := newTestUser(t, r, store, "bob@localhost")
+	from, to := walletOf(t, r, store, alice, "BTC"), walletOf(t, r, store, bob, "BTC")
+
+	for i := 0; i < 5; i++ {
+		_, err := r.Transaction(alice, models.TransactionRequest{
+			FromAddress: models.WalletRef{ID: from.ID},
+			Recipient:   to.Address,
+			Amount:      decimal.NewFromInt(int64(i + 1)),
+		})
+		require.NoError(t, err)
+	}
+
+	var (
+		sums   []string
+		pages  int
+		cursor string
+	)
+	for {
+		response, err := r.GetTransactions(alice, models.GetTransactionsRequest{Limit: 2, Cursor: cursor})
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(response.Items), 2)
+		for _, item := range response.Items {
+			sums = append(sums, item.Sum.String())
+		}
+		pages++
+		if cursor = response.Meta.NextCursor; cursor == "" {
+			break
+		}
+		require.Less(t, pages, 5, "the cursor does not move")
+	}
+
+	// the newest transfers come first, every transfer is listed once
+	require.Equal(t, 3, pages)
+	require.Equal(t, []string{"5", "4", "3", "2", "1"}, sums)
+
+	// the filters apply to the user's side of the transfer
+	received, err := r.GetTransactions(bob, models.GetTransactionsRequest{Direction: models.DirectionIncoming})
+	require.NoError(t, err)
+	require.Len(t, received.Items, 5)
+	sent, err := r.GetTransactions(bob, models.GetTransactionsRequest{Direction: models.DirectionOutgoing})
+	require.NoError(t, err)
+	require.Empty(t, sent.Items)
+}
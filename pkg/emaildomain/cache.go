@@ -0,0 +1,72 @@
+package emaildomain
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCacheEntries the cache is purged of the expired answers once it grows that big
+const maxCacheEntries = 10000
+
+type cacheEntry struct {
+	err       error
+	expiresAt time.Time
+}
+
+// cachedChecker keeps the definite answers of the checker, the failures of the check are asked again
+type cachedChecker struct {
+	next    Checker
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+func (c *cachedChecker) Check(ctx context.Context, domain string) (err error) {
+	domain = strings.ToLower(domain)
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[domain]
+	c.mu.Unlock()
+	if ok && entry.expiresAt.After(now) {
+		return entry.err
+	}
+
+	err = c.next.Check(ctx, domain)
+	if err != nil && err != ErrNoMail {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= maxCacheEntries {
+		c.purge(now)
+	}
+	c.entries[domain] = cacheEntry{
+		err:       err,
+		expiresAt: now.Add(c.ttl),
+	}
+	return
+}
+
+// purge drops the expired answers, or all of them when none has expired, must be called under the lock
+func (c *cachedChecker) purge(now time.Time) {
+	for domain, entry := range c.entries {
+		if !entry.expiresAt.After(now) {
+			delete(c.entries, domain)
+		}
+	}
+	if len(c.entries) >= maxCacheEntries {
+		c.entries = make(map[string]cacheEntry)
+	}
+}
+
+func newCachedChecker(next Checker, ttl time.Duration) *cachedChecker {
+	return &cachedChecker{
+		next:    next,
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+	}
+}
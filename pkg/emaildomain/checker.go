@@ -0,0 +1,58 @@
+package emaildomain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// the kinds of the checkers
+const (
+	// CheckNone every domain is accepted, the ownership of the mailbox is proven by the verification mail anyway
+	CheckNone = "none"
+	// CheckDNS the domain must resolve to the mail server or at least to the host
+	CheckDNS = "dns"
+)
+
+// ErrNoMail the domain definitely can not receive mail
+var ErrNoMail = errors.New("the domain does not receive mail")
+
+// Checker tells whether the domain of the email can receive mail. ErrNoMail is the definite answer,
+// any other error means the check itself failed, e.g. the resolver is unreachable.
+type Checker interface {
+	Check(ctx context.Context, domain string) (err error)
+}
+
+// Settings of the checker
+type Settings struct {
+	// Kind none or dns
+	Kind    string
+	Timeout time.Duration
+	// CacheTTL how long the answers are kept, 0 disables the cache
+	CacheTTL time.Duration
+}
+
+// New creates the checker of the kind, the answers are cached when the ttl is positive
+func New(settings Settings) (Checker, error) {
+	var checker Checker
+	switch settings.Kind {
+	case CheckNone, "":
+		return noneChecker{}, nil
+	case CheckDNS:
+		checker = newDNSChecker(settings.Timeout)
+	default:
+		return nil, fmt.Errorf("unknown email domain check %q", settings.Kind)
+	}
+
+	if settings.CacheTTL > 0 {
+		checker = newCachedChecker(checker, settings.CacheTTL)
+	}
+	return checker, nil
+}
+
+type noneChecker struct{}
+
+func (noneChecker) Check(ctx context.Context, domain string) (err error) {
+	return
+}
@@ -0,0 +1,106 @@
+package emaildomain
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countingChecker answers from the map and counts the questions
+type countingChecker struct {
+	answers map[string]error
+	asked   map[string]int
+}
+
+func (c *countingChecker) Check(ctx context.Context, domain string) (err error) {
+	c.asked[domain]++
+	return c.answers[domain]
+}
+
+func TestNew(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		settings Settings
+		expected interface{}
+	}{
+		{"default", Settings{}, noneChecker{}},
+		{"none", Settings{Kind: CheckNone, CacheTTL: time.Hour}, noneChecker{}},
+		{"dns", Settings{Kind: CheckDNS}, &dnsChecker{}},
+		{"cached dns", Settings{Kind: CheckDNS, CacheTTL: time.Hour}, &cachedChecker{}},
+	} {
+		checker, err := New(c.settings)
+		require.NoError(t, err, c.name)
+		require.IsType(t, c.expected, checker, c.name)
+	}
+
+	_, err := New(Settings{Kind: "smtp"})
+	require.Error(t, err)
+}
+
+func TestCachedChecker(t *testing.T) {
+	failure := errors.New("resolver is unreachable")
+	next := &countingChecker{
+		answers: map[string]error{"nomail.example": ErrNoMail, "down.example": failure},
+		asked:   make(map[string]int),
+	}
+	checker := newCachedChecker(next, time.Hour)
+	ctx := context.Background()
+
+	for _, c := range []struct {
+		domain   string
+		expected error
+		asked    int
+	}{
+		{"mail.example", nil, 1},
+		// the domain is case insensitive
+		{"MAIL.example", nil, 1},
+		{"nomail.example", ErrNoMail, 1},
+		{"nomail.example", ErrNoMail, 1},
+		// the failures are not cached
+		{"down.example", failure, 1},
+		{"down.example", failure, 2},
+	} {
+		require.Equal(t, c.expected, checker.Check(ctx, c.domain), c.domain)
+		require.Equal(t, c.asked, next.asked[strings.ToLower(c.domain)], c.domain)
+	}
+}
+
+func TestCachedCheckerExpiry(t *testing.T) {
+	next := &countingChecker{asked: make(map[string]int)}
+	checker := newCachedChecker(next, time.Hour)
+	ctx := context.Background()
+
+	require.NoError(t, checker.Check(ctx, "mail.example"))
+	checker.entries["mail.example"] = cacheEntry{expiresAt: time.Now().Add(-time.Second)}
+	require.NoError(t, checker.Check(ctx, "mail.example"))
+	require.Equal(t, 2, next.asked["mail.example"])
+}
+
+func TestCachedCheckerPurge(t *testing.T) {
+	checker := newCachedChecker(&countingChecker{asked: make(map[string]int)}, time.Hour)
+	now := time.Now()
+
+	for _, c := range []struct {
+		name     string
+		expired  int
+		fresh    int
+		expected int
+	}{
+		{"expired answers are dropped", 10, maxCacheEntries - 10, maxCacheEntries - 10},
+		{"everything is dropped when nothing expired", 0, maxCacheEntries, 0},
+	} {
+		checker.entries = make(map[string]cacheEntry)
+		for i := 0; i < c.expired; i++ {
+			checker.entries[string(rune('a'+i))+".expired"] = cacheEntry{expiresAt: now.Add(-time.Second)}
+		}
+		for i := 0; i < c.fresh; i++ {
+			checker.entries[time.Duration(i).String()] = cacheEntry{expiresAt: now.Add(time.Hour)}
+		}
+
+		checker.purge(now)
+		require.Len(t, checker.entries, c.expected, c.name)
+	}
+}
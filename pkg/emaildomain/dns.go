@@ -0,0 +1,54 @@
+package emaildomain
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// dnsChecker accepts the domain with the MX record or, as the implicit MX of RFC 5321, with the address
+type dnsChecker struct {
+	resolver *net.Resolver
+	timeout  time.Duration
+}
+
+func (c *dnsChecker) Check(ctx context.Context, domain string) (err error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	mx, err := c.resolver.LookupMX(ctx, domain)
+	if err == nil && len(mx) > 0 {
+		// the null MX of RFC 7505 says the domain takes no mail
+		if len(mx) == 1 && mx[0].Host == "." {
+			return ErrNoMail
+		}
+		return nil
+	}
+	if err != nil && !isNotFound(err) {
+		return
+	}
+
+	if _, err = c.resolver.LookupHost(ctx, domain); err != nil {
+		if isNotFound(err) {
+			return ErrNoMail
+		}
+		return
+	}
+	return nil
+}
+
+// isNotFound the resolver answered there is no such record, unlike the timeout or the network failure
+func isNotFound(err error) bool {
+	dnsErr, ok := err.(*net.DNSError)
+	return ok && dnsErr.IsNotFound
+}
+
+func newDNSChecker(timeout time.Duration) *dnsChecker {
+	return &dnsChecker{
+		resolver: net.DefaultResolver,
+		timeout:  timeout,
+	}
+}
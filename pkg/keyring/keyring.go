@@ -0,0 +1,198 @@
+package keyring
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/crypto_app/pkg/models"
+	"github.com/dgrijalva/jwt-go"
+	"io/ioutil"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// Key a single key identified by its kid, keys loaded from a public key file can only verify tokens
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// Keyring holds every key the tokens are verified with and the current key new tokens are signed with.
+// To rotate keys add the new key, make it current and remove the old one once its tokens have expired.
+type Keyring struct {
+	current *Key
+	keys    map[string]*Key
+}
+
+// Sign signs the claims with the current key, the kid header tells the verifier which key to use
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.current.Method, claims)
+	token.Header["kid"] = k.current.ID
+	return token.SignedString(k.current.signKey)
+}
+
+// Keyfunc resolves the verification key by the kid header, tokens without kid are checked with the current key
+func (k *Keyring) Keyfunc(token *jwt.Token) (interface{}, error) {
+	key := k.current
+	if kid, ok := token.Header["kid"].(string); ok {
+		if key, ok = k.keys[kid]; !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+	}
+
+	// the alg of the token has to match the key, otherwise a public key could be used as a HMAC secret
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s for key %q", token.Method.Alg(), key.ID)
+	}
+	return key.verifyKey, nil
+}
+
+// JWKS returns the public part of the asymmetric keys, HMAC secrets are never published
+func (k *Keyring) JWKS() (keys []models.JWK) {
+	keys = make([]models.JWK, 0, len(k.keys))
+	for _, key := range k.keys {
+		jwk := models.JWK{
+			Kid: key.ID,
+			Use: "sig",
+			Alg: key.Method.Alg(),
+		}
+		switch pub := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = jwt.EncodeSegment(pub.N.Bytes())
+			jwk.E = jwt.EncodeSegment(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = jwt.EncodeSegment(pub)
+		default:
+			continue
+		}
+		keys = append(keys, jwk)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Kid < keys[j].Kid
+	})
+	return
+}
+
+// New builds the keyring from the spec of keys separated by ";", every key is written as kid:alg:material.
+// For HS256, HS384 and HS512 the material is the secret itself, for RS256 and EdDSA it is a path
+// to a PEM file with a private key or, for verification only keys, with a public key.
+// The key with currentKid signs new tokens, when currentKid is empty the first key is used.
+func New(spec, currentKid string) (*Keyring, error) {
+	k := &Keyring{
+		keys: make(map[string]*Key),
+	}
+
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("bad key spec %q, expected kid:alg:material", entry)
+		}
+
+		key, err := parseKey(parts[0], parts[1], parts[2])
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := k.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicated key %q", key.ID)
+		}
+		k.keys[key.ID] = key
+
+		if (currentKid == "" && k.current == nil) || currentKid == key.ID {
+			k.current = key
+		}
+	}
+
+	if len(k.keys) == 0 {
+		return nil, errors.New("no signing keys configured")
+	}
+	if k.current == nil {
+		return nil, fmt.Errorf("current key %q is not in the keyring", currentKid)
+	}
+	if k.current.signKey == nil {
+		return nil, fmt.Errorf("current key %q has no private part", k.current.ID)
+	}
+	return k, nil
+}
+
+func parseKey(kid, alg, material string) (*Key, error) {
+	key := &Key{
+		ID:     kid,
+		Method: jwt.GetSigningMethod(alg),
+	}
+
+	switch alg {
+	case jwt.SigningMethodHS256.Alg(), jwt.SigningMethodHS384.Alg(), jwt.SigningMethodHS512.Alg():
+		key.signKey = []byte(material)
+		key.verifyKey = []byte(material)
+		return key, nil
+	case jwt.SigningMethodRS256.Alg(), SigningMethodEdDSA.Alg():
+	default:
+		return nil, fmt.Errorf("key %q: unsupported alg %q", kid, alg)
+	}
+
+	block, err := readPEM(material)
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %v", kid, err)
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		err = fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %v", kid, err)
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.signKey, key.verifyKey = k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.verifyKey = k
+	case ed25519.PrivateKey:
+		key.signKey, key.verifyKey = k, k.Public().(ed25519.PublicKey)
+	case ed25519.PublicKey:
+		key.verifyKey = k
+	}
+
+	_, isRSA := key.verifyKey.(*rsa.PublicKey)
+	_, isEd25519 := key.verifyKey.(ed25519.PublicKey)
+	if (alg == jwt.SigningMethodRS256.Alg() && !isRSA) || (alg == SigningMethodEdDSA.Alg() && !isEd25519) {
+		return nil, fmt.Errorf("key %q: the PEM key does not match alg %s", kid, alg)
+	}
+	return key, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", path)
+	}
+	return block, nil
+}
@@ -0,0 +1,152 @@
+package keyring
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// writePEM writes the key to the temporary file and returns its path
+func writePEM(t *testing.T, name string, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600))
+	return path
+}
+
+// ed25519PEM writes the new Ed25519 key and returns the paths of its private and public parts
+func ed25519PEM(t *testing.T) (private string, public string) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	require.NoError(t, err)
+	return writePEM(t, "ed25519.pem", "PRIVATE KEY", privDER), writePEM(t, "ed25519.pub.pem", "PUBLIC KEY", pubDER)
+}
+
+func sign(t *testing.T, k *Keyring) string {
+	t.Helper()
+	token, err := k.Sign(jwt.StandardClaims{Subject: "1"})
+	require.NoError(t, err)
+	return token
+}
+
+func verify(k *Keyring, token string) error {
+	_, err := jwt.Parse(token, k.Keyfunc)
+	return err
+}
+
+func TestKidSelection(t *testing.T) {
+	old, err := New("old:HS256:old-secret", "")
+	require.NoError(t, err)
+	oldToken := sign(t, old)
+
+	k, err := New("old:HS256:old-secret;new:HS256:new-secret", "new")
+	require.NoError(t, err)
+
+	// the new tokens are signed with the current key and carry its kid
+	token := sign(t, k)
+	parsed, err := jwt.Parse(token, k.Keyfunc)
+	require.NoError(t, err)
+	require.Equal(t, "new", parsed.Header["kid"])
+
+	// the other keys still verify the tokens they signed
+	require.NoError(t, verify(k, oldToken))
+
+	// without currentKid the first key signs
+	first, err := New("a:HS256:a-secret;b:HS256:b-secret", "")
+	require.NoError(t, err)
+	parsed, err = jwt.Parse(sign(t, first), first.Keyfunc)
+	require.NoError(t, err)
+	require.Equal(t, "a", parsed.Header["kid"])
+}
+
+func TestRetiredKey(t *testing.T) {
+	old, err := New("old:HS256:old-secret;new:HS256:new-secret", "old")
+	require.NoError(t, err)
+	oldToken := sign(t, old)
+
+	// the key removed from the keyring no longer verifies its tokens
+	k, err := New("new:HS256:new-secret", "new")
+	require.NoError(t, err)
+	require.Error(t, verify(k, oldToken))
+
+	// the token signed with the same kid but another secret is refused too
+	forged, err := New("new:HS256:other-secret", "new")
+	require.NoError(t, err)
+	require.Error(t, verify(k, sign(t, forged)))
+}
+
+func TestAlgMismatch(t *testing.T) {
+	private, public := ed25519PEM(t)
+	k, err := New("ed:EdDSA:"+private, "ed")
+	require.NoError(t, err)
+	require.NoError(t, verify(k, sign(t, k)))
+
+	// the public key used as the HMAC secret under the kid of the Ed25519 key is refused
+	pub, err := readPEM(public)
+	require.NoError(t, err)
+	confused := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{Subject: "1"})
+	confused.Header["kid"] = "ed"
+	token, err := confused.SignedString(pem.EncodeToMemory(pub))
+	require.NoError(t, err)
+	require.Error(t, verify(k, token))
+
+	// so is the token without kid of the other alg than the current key
+	noKid, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{Subject: "1"}).
+		SignedString(pem.EncodeToMemory(pub))
+	require.NoError(t, err)
+	require.Error(t, verify(k, noKid))
+}
+
+func TestNewErrors(t *testing.T) {
+	private, public := ed25519PEM(t)
+
+	for _, c := range []struct {
+		name       string
+		spec       string
+		currentKid string
+	}{
+		{"empty", "", ""},
+		{"no material", "a:HS256:", ""},
+		{"unsupported alg", "a:none:secret", ""},
+		{"duplicated kid", "a:HS256:one;a:HS256:two", ""},
+		{"unknown current", "a:HS256:secret", "b"},
+		{"pem of another alg", "a:RS256:" + private, ""},
+		{"current without private part", "a:EdDSA:" + public, "a"},
+		{"missing file", "a:EdDSA:" + filepath.Join(t.TempDir(), "missing.pem"), ""},
+	} {
+		_, err := New(c.spec, c.currentKid)
+		require.Error(t, err, c.name)
+	}
+
+	// the public key only verifies, it may stay in the keyring while the other key signs
+	_, err := New("pub:EdDSA:"+public+";cur:HS256:secret", "cur")
+	require.NoError(t, err)
+}
+
+func TestJWKS(t *testing.T) {
+	private, public := ed25519PEM(t)
+	k, err := New("hs:HS256:secret;ed:EdDSA:"+private+";pub:EdDSA:"+public, "ed")
+	require.NoError(t, err)
+
+	// the HMAC secrets are never published
+	keys := k.JWKS()
+	require.Len(t, keys, 2)
+	require.Equal(t, "ed", keys[0].Kid)
+	require.Equal(t, "pub", keys[1].Kid)
+	for _, key := range keys {
+		require.Equal(t, "OKP", key.Kty)
+		require.Equal(t, "Ed25519", key.Crv)
+		require.NotEmpty(t, key.X)
+	}
+}
@@ -0,0 +1,81 @@
+package limiter
+
+import (
+	"context"
+	"time"
+)
+
+// Store keeps the attempts by the key, the keys of the different limiters must not clash
+type Store interface {
+	// Hit counts the attempt of the key and sets the lock the policy gives to the count at once, so the
+	// parallel attempts can not slip past the lock. The locked key is refused without counting, retryAfter
+	// tells how long it stays locked. The attempts are forgotten once the window passes since the last one
+	// and the lock is over.
+	Hit(ctx context.Context, key string, policy Policy) (retryAfter time.Duration, err error)
+	// Refund takes back one attempt of the key, the lock is kept
+	Refund(ctx context.Context, key string) (err error)
+	// Reset forgets the attempts and the lock of the key
+	Reset(ctx context.Context, key string) (err error)
+}
+
+// Policy how the attempts slow down: the first FreeAttempts attempts are free, then every attempt locks the key
+// for BaseDelay doubled each time, LockoutAttempts attempts lock the key for LockoutDuration
+type Policy struct {
+	FreeAttempts    int
+	LockoutAttempts int
+	BaseDelay       time.Duration
+	LockoutDuration time.Duration
+	// Window the attempts are forgotten once it passes since the last one
+	Window time.Duration
+}
+
+// lockFor returns the lock the number of the attempts deserves
+func (p Policy) lockFor(attempts int) time.Duration {
+	switch {
+	case attempts <= p.FreeAttempts:
+		return 0
+	case attempts >= p.LockoutAttempts:
+		return p.LockoutDuration
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < attempts && delay < p.LockoutDuration; i++ {
+		delay *= 2
+	}
+	if delay > p.LockoutDuration {
+		delay = p.LockoutDuration
+	}
+	return delay
+}
+
+// Limiter applies the policy to the keys of the store
+type Limiter struct {
+	store  Store
+	prefix string
+	policy Policy
+}
+
+// Attempt counts the attempt of the key before it is checked, retryAfter > 0 refuses it. The attempt is counted
+// as failed until Reset or Refund says otherwise.
+func (l *Limiter) Attempt(ctx context.Context, key string) (retryAfter time.Duration, err error) {
+	return l.store.Hit(ctx, l.prefix+key, l.policy)
+}
+
+// Refund takes back the attempt which succeeded, e.g. for the client which also made the failed ones
+func (l *Limiter) Refund(ctx context.Context, key string) (err error) {
+	return l.store.Refund(ctx, l.prefix+key)
+}
+
+// Reset forgets the attempts of the key, after the successful attempt or by the admin
+func (l *Limiter) Reset(ctx context.Context, key string) (err error) {
+	return l.store.Reset(ctx, l.prefix+key)
+}
+
+// NewLimiter creates the limiter of the keys under the prefix of the store, e.g. "email:" or "ip:"
+func NewLimiter(store Store, prefix string, policy Policy) *Limiter {
+	return &Limiter{
+		store:  store,
+		prefix: prefix,
+		policy: policy,
+	}
+}
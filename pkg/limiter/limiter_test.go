@@ -0,0 +1,117 @@
+package limiter
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{
+	FreeAttempts:    5,
+	LockoutAttempts: 10,
+	BaseDelay:       time.Second,
+	LockoutDuration: 15 * time.Minute,
+	Window:          time.Hour,
+}
+
+func TestLockFor(t *testing.T) {
+	for attempts, lock := range map[int]time.Duration{
+		1:  0,
+		5:  0,
+		6:  time.Second,
+		7:  2 * time.Second,
+		9:  8 * time.Second,
+		10: 15 * time.Minute,
+		50: 15 * time.Minute,
+	} {
+		require.Equal(t, lock, testPolicy.lockFor(attempts), "attempts %d", attempts)
+	}
+}
+
+func TestAttemptParallel(t *testing.T) {
+	l := NewLimiter(NewMemoryStore(), "email:", testPolicy)
+
+	// the free attempts and the one which sets the lock pass, the rest are refused however they race
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		passed int
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			retryAfter, err := l.Attempt(context.Background(), "alice@example.com")
+			require.NoError(t, err)
+			if retryAfter == 0 {
+				mu.Lock()
+				passed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, testPolicy.FreeAttempts+1, passed)
+}
+
+func TestResetAndRefund(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	accounts := NewLimiter(store, "email:", testPolicy)
+	clients := NewLimiter(store, "ip:", testPolicy)
+
+	for i := 0; i < testPolicy.FreeAttempts; i++ {
+		retryAfter, err := accounts.Attempt(ctx, "alice@example.com")
+		require.NoError(t, err)
+		require.Zero(t, retryAfter)
+	}
+	// the keys of the limiters do not clash
+	retryAfter, err := clients.Attempt(ctx, "alice@example.com")
+	require.NoError(t, err)
+	require.Zero(t, retryAfter)
+
+	// the refunded attempt is not counted, so the next one is still free
+	require.NoError(t, accounts.Refund(ctx, "alice@example.com"))
+	retryAfter, err = accounts.Attempt(ctx, "alice@example.com")
+	require.NoError(t, err)
+	require.Zero(t, retryAfter)
+	retryAfter, err = accounts.Attempt(ctx, "alice@example.com")
+	require.NoError(t, err)
+	require.Zero(t, retryAfter)
+
+	retryAfter, err = accounts.Attempt(ctx, "alice@example.com")
+	require.NoError(t, err)
+	require.Equal(t, time.Second, retryAfter.Round(time.Second))
+
+	require.NoError(t, accounts.Reset(ctx, "alice@example.com"))
+	retryAfter, err = accounts.Attempt(ctx, "alice@example.com")
+	require.NoError(t, err)
+	require.Zero(t, retryAfter)
+}
+
+func TestMemoryStoreWindow(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	quiet := testPolicy
+	quiet.Window = -time.Second
+
+	// the attempts are forgotten once the window passes since the last one
+	for i := 0; i < testPolicy.LockoutAttempts; i++ {
+		retryAfter, err := s.Hit(ctx, "key", quiet)
+		require.NoError(t, err)
+		require.Zero(t, retryAfter, "attempt %d", i)
+	}
+
+	// the locked key is refused without counting, so the lock does not grow
+	for i := 0; i <= testPolicy.FreeAttempts; i++ {
+		_, err := s.Hit(ctx, "locked", testPolicy)
+		require.NoError(t, err)
+	}
+	for i := 0; i < 3; i++ {
+		retryAfter, err := s.Hit(ctx, "locked", testPolicy)
+		require.NoError(t, err)
+		require.Equal(t, testPolicy.BaseDelay, retryAfter.Round(time.Second), "attempt %d", i)
+	}
+}
@@ -0,0 +1,76 @@
+package limiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	attempts    int
+	lockedUntil time.Time
+	expiresAt   time.Time
+}
+
+type memoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+func (s *memoryStore) Hit(ctx context.Context, key string, policy Policy) (retryAfter time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.purge(now)
+	e := s.entries[key]
+	if e.lockedUntil.After(now) {
+		return e.lockedUntil.Sub(now), nil
+	}
+
+	e.attempts++
+	lock := policy.lockFor(e.attempts)
+	e.lockedUntil = now.Add(lock)
+	e.expiresAt = now.Add(policy.Window)
+	if e.lockedUntil.After(e.expiresAt) {
+		e.expiresAt = e.lockedUntil
+	}
+	s.entries[key] = e
+	return
+}
+
+func (s *memoryStore) Refund(ctx context.Context, key string) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok && e.attempts > 0 {
+		e.attempts--
+		s.entries[key] = e
+	}
+	return
+}
+
+func (s *memoryStore) Reset(ctx context.Context, key string) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return
+}
+
+// purge drops the forgotten keys, must be called under the lock
+func (s *memoryStore) purge(now time.Time) {
+	for key, e := range s.entries {
+		if !e.expiresAt.After(now) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// NewMemoryStore creates the store keeping the attempts in the process memory, they are lost on restart
+// and are not shared between the instances
+func NewMemoryStore() Store {
+	return &memoryStore{
+		entries: make(map[string]memoryEntry),
+	}
+}
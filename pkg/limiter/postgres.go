@@ -0,0 +1,93 @@
+package limiter
+
+import (
+	"context"
+	"github.com/jackc/pgx"
+	"time"
+)
+
+// hitAttempts and hitLock are the new number of the attempts and the lock it deserves, $3 holds the locks
+// of the attempts by the number, the last one is for the rest
+const (
+	hitAttempts = `case when a.expires_at <= current_timestamp then 1 else a.failures + 1 end`
+	hitLock     = `($3::float8[])[least(` + hitAttempts + `, cardinality($3::float8[]))]`
+)
+
+// queryToHit runs on every log in, so it is worth preparing, see CachedStatements. The locked key is not updated
+// and no row is returned. The forgotten key starts counting again, the row is not deleted until the purge.
+const queryToHit = `insert into login_attempts as a (key, failures, locked_until, expires_at)
+		values ($1, 1, current_timestamp + make_interval(secs => ($3::float8[])[1]),
+			current_timestamp + make_interval(secs => greatest($2, ($3::float8[])[1])))
+	on conflict (key) do update set
+		failures = ` + hitAttempts + `,
+		locked_until = current_timestamp + make_interval(secs => ` + hitLock + `),
+		expires_at = current_timestamp + make_interval(secs => greatest($2, ` + hitLock + `))
+	where a.locked_until is null or a.locked_until <= current_timestamp
+	returning failures;`
+
+// CachedStatements the statements to prepare on every new connection
+var CachedStatements = []string{queryToHit}
+
+type postgresStore struct {
+	db *pgx.ConnPool
+}
+
+func (s *postgresStore) Hit(ctx context.Context, key string, policy Policy) (retryAfter time.Duration, err error) {
+	const queryToGetLock = `select coalesce(extract(epoch from locked_until - current_timestamp)::float8, 0)
+		from login_attempts where key = $1;`
+
+	if err = s.purge(ctx); err != nil {
+		return
+	}
+
+	locks := make([]float64, 0, policy.LockoutAttempts)
+	for i := 1; len(locks) == 0 || i <= policy.LockoutAttempts; i++ {
+		locks = append(locks, policy.lockFor(i).Seconds())
+	}
+
+	var attempts int
+	err = s.db.QueryRowEx(ctx, queryToHit, nil, key, policy.Window.Seconds(), locks).Scan(&attempts)
+	if err != pgx.ErrNoRows {
+		return
+	}
+
+	var seconds float64
+	if err = s.db.QueryRowEx(ctx, queryToGetLock, nil, key).Scan(&seconds); err != nil && err != pgx.ErrNoRows {
+		return
+	}
+	// the lock could end or be reset since the hit, the attempt is refused anyway
+	err = nil
+	if retryAfter = time.Duration(seconds * float64(time.Second)); retryAfter < time.Second {
+		retryAfter = time.Second
+	}
+	return
+}
+
+func (s *postgresStore) Refund(ctx context.Context, key string) (err error) {
+	const query = `update login_attempts set failures = greatest(failures - 1, 0) where key = $1;`
+
+	_, err = s.db.ExecEx(ctx, query, nil, key)
+	return
+}
+
+func (s *postgresStore) Reset(ctx context.Context, key string) (err error) {
+	const query = `delete from login_attempts where key = $1;`
+
+	_, err = s.db.ExecEx(ctx, query, nil, key)
+	return
+}
+
+// purge removes the forgotten keys, so the table holds only the attempts which still count
+func (s *postgresStore) purge(ctx context.Context) (err error) {
+	const query = `delete from login_attempts where expires_at <= current_timestamp;`
+
+	_, err = s.db.ExecEx(ctx, query, nil)
+	return
+}
+
+// NewPostgresStore creates the store keeping the attempts in the login_attempts table, shared by the instances
+func NewPostgresStore(db *pgx.ConnPool) Store {
+	return &postgresStore{
+		db: db,
+	}
+}
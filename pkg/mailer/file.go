@@ -0,0 +1,53 @@
+package mailer
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// fileMailer appends the mail to the local file instead of sending it
+type fileMailer struct {
+	mu   sync.Mutex
+	from string
+	path string
+}
+
+func (m *fileMailer) Send(ctx context.Context, msg Message) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(format(m.from, msg, time.Now()), "\r\n"...))
+	return
+}
+
+func newFileMailer(from string, path string) Mailer {
+	return &fileMailer{
+		from: from,
+		path: path,
+	}
+}
+
+// logMailer prints the mail to the log instead of sending it
+type logMailer struct {
+	from string
+}
+
+func (m *logMailer) Send(ctx context.Context, msg Message) (err error) {
+	log.Printf("mail from %s to %s: %s\n%s", m.from, msg.To, msg.Subject, msg.Body)
+	return
+}
+
+func newLogMailer(from string) Mailer {
+	return &logMailer{
+		from: from,
+	}
+}
@@ -0,0 +1,79 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+)
+
+// the transports the mail can be sent with
+const (
+	TransportSMTP = "smtp"
+	TransportFile = "file"
+	TransportLog  = "log"
+)
+
+// Message the plain text mail
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends the mail to the users
+type Mailer interface {
+	Send(ctx context.Context, msg Message) (err error)
+}
+
+// Settings of the mailer, the SMTP fields are used only by the smtp transport
+// and File only by the file one
+type Settings struct {
+	Transport string
+	From      string
+	File      string
+	SMTPHost  string
+	SMTPPort  int
+	SMTPUser  string
+	SMTPPass  string
+}
+
+// New picks the mailer by the transport, the log and the file transports are meant for the local runs
+func New(settings Settings) (Mailer, error) {
+	switch settings.Transport {
+	case TransportSMTP:
+		if settings.SMTPHost == "" {
+			return nil, errors.New("smtp host is empty")
+		}
+		return newSMTPMailer(settings), nil
+	case TransportFile:
+		if settings.File == "" {
+			return nil, errors.New("mail file is empty")
+		}
+		return newFileMailer(settings.From, settings.File), nil
+	case TransportLog, "":
+		return newLogMailer(settings.From), nil
+	default:
+		return nil, fmt.Errorf("unknown mail transport %q", settings.Transport)
+	}
+}
+
+// format builds the RFC 5322 message, the subject is encoded since it is not ASCII
+func format(from string, msg Message, now time.Time) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	// SMTP wants CRLF, the bare LF of the body is refused by some servers
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
@@ -0,0 +1,71 @@
+package mailer
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		settings Settings
+		ok       bool
+	}{
+		{"default", Settings{}, true},
+		{"log", Settings{Transport: TransportLog}, true},
+		{"file", Settings{Transport: TransportFile, File: "mail.txt"}, true},
+		{"file without path", Settings{Transport: TransportFile}, false},
+		{"smtp", Settings{Transport: TransportSMTP, SMTPHost: "localhost", SMTPPort: 25}, true},
+		{"smtp without host", Settings{Transport: TransportSMTP}, false},
+		{"unknown", Settings{Transport: "pigeon"}, false},
+	} {
+		m, err := New(c.settings)
+		if c.ok {
+			require.NoError(t, err, c.name)
+			require.NotNil(t, m, c.name)
+		} else {
+			require.Error(t, err, c.name)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	now := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	out := string(format("crypto@localhost", Message{To: "alice@localhost", Subject: "Сброс пароля",
+		Body: "one\ntwo\r\nthree"}, now))
+
+	for _, line := range []string{
+		"From: crypto@localhost\r\n",
+		"To: alice@localhost\r\n",
+		"Subject: =?utf-8?q?",
+		"Date: Thu, 04 Mar 2021 05:06:07 +0000\r\n",
+		"Content-Type: text/plain; charset=utf-8\r\n",
+		"\r\n\r\none\r\ntwo\r\nthree\r\n",
+	} {
+		require.Contains(t, out, line)
+	}
+	// the bare LF is replaced everywhere
+	require.Equal(t, strings.Count(out, "\n"), strings.Count(out, "\r\n"))
+}
+
+func TestFileMailer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.txt")
+	m, err := New(Settings{Transport: TransportFile, From: "crypto@localhost", File: path})
+	require.NoError(t, err)
+
+	for _, to := range []string{"alice@localhost", "bob@localhost"} {
+		require.NoError(t, m.Send(context.Background(), Message{To: to, Subject: "hi", Body: "token"}))
+	}
+
+	// the mails are appended one after another
+	content, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, 2, strings.Count(string(content), "From: crypto@localhost"))
+	require.Contains(t, string(content), "To: alice@localhost")
+	require.Contains(t, string(content), "To: bob@localhost")
+}
@@ -0,0 +1,32 @@
+package mailer
+
+import (
+	"context"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// smtpMailer sends the mail through the SMTP server, the credentials are optional,
+// the server upgrades the connection with STARTTLS when it supports it
+type smtpMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func (m *smtpMailer) Send(ctx context.Context, msg Message) (err error) {
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, format(m.from, msg, time.Now()))
+}
+
+func newSMTPMailer(settings Settings) Mailer {
+	m := &smtpMailer{
+		addr: net.JoinHostPort(settings.SMTPHost, strconv.Itoa(settings.SMTPPort)),
+		from: settings.From,
+	}
+	if settings.SMTPUser != "" {
+		m.auth = smtp.PlainAuth("", settings.SMTPUser, settings.SMTPPass, settings.SMTPHost)
+	}
+	return m
+}
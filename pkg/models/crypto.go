@@ -2,17 +2,25 @@ package models
 
 import (
 	"database/sql"
+	"encoding/json"
 	"github.com/dgrijalva/jwt-go"
+	"github.com/shopspring/decimal"
+	"time"
 )
 
 type CtxKey string
 
-var JwtSigningKey = []byte("secret")
-
 const (
 	SqlNoRows = "no rows in result set"
 )
 
+// directions of the transaction from the point of view of the user
+const (
+	DirectionInternal = "internal"
+	DirectionOutgoing = "outgoing"
+	DirectionIncoming = "incoming"
+)
+
 type AliveResponse struct {
 	Text   string `json:"text"`
 	UserID int32  `json:"user_id"`
@@ -30,73 +38,331 @@ type LogInRequest struct {
 	Pass  string `json:"pass"`
 }
 
+// UnlockLogInRequest the email, the ip or both to forget the failed log in attempts of
+type UnlockLogInRequest struct {
+	Email string `json:"email"`
+	IP    string `json:"ip"`
+}
+
+// LogInMFARequest MFAToken is the one returned by LogIn, Code is the TOTP code or the recovery code
+type LogInMFARequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+// MFACodeRequest Code is the TOTP code, DisableMFA takes the recovery code too
+type MFACodeRequest struct {
+	Code string `json:"code"`
+}
+
+// MFAEnrollResponse URI is the otpauth URI the authenticator app enrolls the secret by
+type MFAEnrollResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// MFAConfirmResponse the recovery codes are shown only once, each of them replaces the TOTP code once
+type MFAConfirmResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// ResetPasswordRequest Token is the one mailed by ForgotPassword
+type ResetPasswordRequest struct {
+	Token string `json:"token"`
+	Pass  string `json:"pass"`
+}
+
+// VerifyEmailRequest Token is the one mailed at the registration or by ResendVerificationEmail
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// WalletRef the wallet given by the public address, the JSON string, or by the internal id, the JSON number
+// the clients used before the addresses were accepted
+type WalletRef struct {
+	ID      int32
+	Address string
+}
+
+func (w WalletRef) IsZero() bool {
+	return w.ID == 0 && w.Address == ""
+}
+
+func (w WalletRef) MarshalJSON() ([]byte, error) {
+	if w.Address != "" {
+		return json.Marshal(w.Address)
+	}
+	return json.Marshal(w.ID)
+}
+
+func (w *WalletRef) UnmarshalJSON(data []byte) error {
+	*w = WalletRef{}
+	if string(data) == "null" {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &w.Address)
+	}
+	return json.Unmarshal(data, &w.ID)
+}
+
+// TransactionRequest the money is sent from the wallet of the user to the wallet of anybody given
+// by the public address, either in ToAddress or in Recipient which wins. The wallets given by the internal id
+// have to belong to the user. Amount is in dollars, money is passed as decimal strings
+// in JSON, so no precision is lost on the way. OTP is the TOTP code the large transfers require
 type TransactionRequest struct {
-	FromAddress int32   `json:"from_address"`
-	ToAddress   int32   `json:"to_address"`
-	Amount      float64 `json:"amount"`
+	FromAddress    WalletRef       `json:"from_address"`
+	ToAddress      WalletRef       `json:"to_address"`
+	Recipient      string          `json:"recipient"`
+	Amount         decimal.Decimal `json:"amount"`
+	OTP            string          `json:"otp,omitempty"`
+	IdempotencyKey string          `json:"-"`
 }
 
+// RateOverrideRequest the price of the currency in dollars set by the admin, without ExpiresAt
+// the price is used until it is deleted
+type RateOverrideRequest struct {
+	Currency  string          `json:"currency"`
+	Price     decimal.Decimal `json:"price"`
+	ExpiresAt *time.Time      `json:"expires_at"`
+}
+
+// CurrencyResponse the currency of the registry, Precision is the number of decimals the amounts are kept with
+type CurrencyResponse struct {
+	Code          string `json:"code"`
+	DisplayName   string `json:"display_name"`
+	Precision     int32  `json:"precision"`
+	AddressFormat string `json:"address_format"`
+	Enabled       bool   `json:"enabled"`
+}
+
+// CreateCurrencyRequest the empty AddressFormat is the default one, Enabled nil enables the currency
+type CreateCurrencyRequest struct {
+	Code          string `json:"code"`
+	DisplayName   string `json:"display_name"`
+	Precision     int32  `json:"precision"`
+	AddressFormat string `json:"address_format"`
+	Enabled       *bool  `json:"enabled"`
+}
+
+// UpdateCurrencyRequest the nil fields are kept, the code and the precision can not be changed
+// since the amounts already kept depend on them
+type UpdateCurrencyRequest struct {
+	Code          string  `json:"-"`
+	DisplayName   *string `json:"display_name"`
+	AddressFormat *string `json:"address_format"`
+	Enabled       *bool   `json:"enabled"`
+}
+
+// HouseAccountResponse the balance of the account of the app, the issuance account is negative by the money issued
+type HouseAccountResponse struct {
+	Currency string          `json:"currency"`
+	Account  string          `json:"account"`
+	Balance  decimal.Decimal `json:"balance"`
+}
+
+// RateResponse the current price of the currency in dollars, Stale is set when the transfers
+// in the currency are refused because the price is too old
+type RateResponse struct {
+	Currency string          `json:"currency"`
+	Price    decimal.Decimal `json:"price"`
+	Source   string          `json:"source"`
+	QuotedAt time.Time       `json:"quoted_at"`
+	Stale    bool            `json:"stale"`
+}
+
+// GetCandlesRequest Interval is one of 1m, 1h and 1d, the empty From and To are picked by the interval
+type GetCandlesRequest struct {
+	Currency string
+	Interval string
+	From     *time.Time
+	To       *time.Time
+}
+
+// Candle the open, high, low and close prices during the interval starting at Time
+type Candle struct {
+	Time   time.Time       `json:"time"`
+	Open   decimal.Decimal `json:"open"`
+	High   decimal.Decimal `json:"high"`
+	Low    decimal.Decimal `json:"low"`
+	Close  decimal.Decimal `json:"close"`
+	Quotes int64           `json:"quotes"`
+}
+
+type GetCandlesResponse struct {
+	Currency string    `json:"currency"`
+	Interval string    `json:"interval"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Items    []*Candle `json:"items"`
+}
+
+// WalletsResponse Salary is the code of the currency, the archived wallet takes no transfers
 type WalletsResponse struct {
-	Salary  string  `json:"salary"`
-	Balance float64 `json:"balance"`
-	Address string  `json:"address"`
+	ID        int32           `json:"id"`
+	Salary    string          `json:"salary"`
+	Balance   decimal.Decimal `json:"balance"`
+	Address   string          `json:"address"`
+	Label     string          `json:"label"`
+	CreatedAt time.Time       `json:"created_at"`
+	Archived  bool            `json:"archived"`
+}
+
+// OpenWalletRequest Currency is the code of the currency, the label is up to the user
+type OpenWalletRequest struct {
+	Currency string `json:"currency"`
+	Label    string `json:"label"`
 }
 
+// RegisterResponse LogIn returns MFAToken instead of the tokens to the user with the second factor,
+// the tokens are returned by LogInMFA then
 type RegisterResponse struct {
-	AccessToken string `json:"access_token"`
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	MFARequired  bool   `json:"mfa_required,omitempty"`
+	MFAToken     string `json:"mfa_token,omitempty"`
 }
 
+// SingleUserDataDbResponse the profile of the user as it is kept, UpdatedAt is the time the profile was changed
 type SingleUserDataDbResponse struct {
-	ID          int
-	Name        string
-	DOB         sql.NullTime
-	Address     string
-	Description string
-	CreateAt    sql.NullTime
-	UpdatedAt   sql.NullTime
+	ID            int
+	Name          string
+	LastName      string
+	Email         string
+	EmailVerified bool
+	DOB           sql.NullTime
+	Address       string
+	Description   string
+	CreateAt      sql.NullTime
+	UpdatedAt     sql.NullTime
 }
 
+// SingleUserData the profile returned by /crypto/me, DOB is 2006-01-02 and the times are RFC 3339.
+// DOB and UpdatedAt are null until set.
 type SingleUserData struct {
-	ID          int     `json:"id"`
-	Name        string  `json:"name"`
-	DOB         *string `json:"dob"`
-	Address     string  `json:"address"`
-	Description string  `json:"description"`
-	CreateAt    string  `json:"createAt"`
-	UpdatedAt   *string `json:"updatedAt"`
+	ID            int     `json:"id"`
+	Name          string  `json:"name"`
+	LastName      string  `json:"last_name"`
+	Email         string  `json:"email"`
+	EmailVerified bool    `json:"email_verified"`
+	DOB           *string `json:"dob"`
+	Address       string  `json:"address"`
+	Description   string  `json:"description"`
+	CreateAt      string  `json:"createAt"`
+	UpdatedAt     *string `json:"updatedAt"`
 }
 
 type AllUsersData []*SingleUserData
 
+// UpdateUserData the partial update of the profile: the absent fields are kept, the empty DOB is cleared.
+// ID is the user of the token.
 type UpdateUserData struct {
-	ID          int
-	Name        *string
-	DOB         *string
-	Address     *string
-	Description *string
+	ID          int     `json:"-"`
+	Name        *string `json:"name"`
+	LastName    *string `json:"last_name"`
+	DOB         *string `json:"dob"`
+	Address     *string `json:"address"`
+	Description *string `json:"description"`
 }
 
+// ClaimWithID the jti of the token is carried in StandardClaims.Id, the sid is the refresh token family
+// the token was issued for
 type ClaimWithID struct {
-	ID string `json:"custom_id"`
+	ID        string `json:"custom_id"`
+	SessionID string `json:"sid"`
+	// Admin the user could manage the app when the token was issued
+	Admin bool `json:"adm,omitempty"`
 	jwt.StandardClaims
 }
 
 type SingleTransaction struct {
-	FromAddress string  `json:"from_address"`
-	ToAddress   string  `json:"to_address"`
-	Sum         float64 `json:"sum"`
-	Commission  float64 `json:"commission"`
-	Date        string  `json:"date"`
-	Success     bool    `json:"success"`
+	ID string `json:"id"`
+	// Seq and CreateAt are the position of the transaction in the list, see GetTransactionResponse.Meta.NextCursor
+	Seq         int64           `json:"-"`
+	CreateAt    time.Time       `json:"-"`
+	FromAddress string          `json:"from_address"`
+	ToAddress   string          `json:"to_address"`
+	Sum         decimal.Decimal `json:"sum"`
+	Commission  decimal.Decimal `json:"commission"`
+	Date        string          `json:"date"`
+	Success     bool            `json:"success"`
+	Direction   string          `json:"direction"`
+}
+
+// TransactionDetail the transfer as it was made: the rates are the ones the crypto amounts were computed with.
+// Nothing is moved when Success is false, the amounts are the ones the transfer needed then.
+// The amounts and the rates are null for the transfers made before they were recorded.
+type TransactionDetail struct {
+	ID            string              `json:"id"`
+	FromAddress   string              `json:"from_address"`
+	ToAddress     string              `json:"to_address"`
+	FromCurrency  string              `json:"from_currency"`
+	ToCurrency    string              `json:"to_currency"`
+	Amount        decimal.Decimal     `json:"amount_usd"`
+	Debited       decimal.NullDecimal `json:"debited"`
+	Credited      decimal.NullDecimal `json:"credited"`
+	Fee           decimal.NullDecimal `json:"fee"`
+	FromRate      decimal.NullDecimal `json:"from_rate"`
+	ToRate        decimal.NullDecimal `json:"to_rate"`
+	Commission    decimal.Decimal     `json:"commission"`
+	Date          string              `json:"date"`
+	Success       bool                `json:"success"`
+	FailureReason string              `json:"failure_reason,omitempty"`
+	Direction     string              `json:"direction"`
 }
 
+// GetTransactionsRequest the query params of the transaction list, the empty fields do not filter anything.
+// DateFrom is inclusive, DateTo is exclusive.
+type GetTransactionsRequest struct {
+	Limit     int
+	Cursor    string
+	DateFrom  *time.Time
+	DateTo    *time.Time
+	Currency  string
+	Address   string
+	Direction string
+	Success   *bool
+	MinAmount *decimal.Decimal
+	MaxAmount *decimal.Decimal
+}
+
+// Meta NextCursor is passed as the cursor to get the next page, it is empty on the last page
 type Meta struct {
-	Total      int32 `json:"total"`
-	PageNum    int32 `json:"page_num"`
-	PagesCount int32 `json:"pages_count"`
+	Limit      int32  `json:"limit"`
+	NextCursor string `json:"next_cursor"`
 }
 
 type GetTransactionResponse struct {
 	Items []*SingleTransaction `json:"items"`
 	Meta  Meta                 `json:"meta"`
 }
+
+// JWK public part of a signing key as described in RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSResponse struct {
+	Keys []JWK `json:"keys"`
+}
+
+type PoolStatsResponse struct {
+	MaxConnections       int `json:"max_connections"`
+	CurrentConnections   int `json:"current_connections"`
+	AvailableConnections int `json:"available_connections"`
+}
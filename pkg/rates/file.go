@@ -0,0 +1,30 @@
+package rates
+
+import (
+	"context"
+	"io/ioutil"
+	"time"
+)
+
+// fileProvider reads the feed from the local file, the file is read again on every fetch
+type fileProvider struct {
+	path string
+}
+
+func (p *fileProvider) Name() string {
+	return "file"
+}
+
+func (p *fileProvider) Fetch(ctx context.Context) (quotes []Quote, err error) {
+	data, err := ioutil.ReadFile(p.path)
+	if err != nil {
+		return
+	}
+	return parseFeed(data, time.Now())
+}
+
+func newFileProvider(path string) Provider {
+	return &fileProvider{
+		path: path,
+	}
+}
@@ -0,0 +1,56 @@
+package rates
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// maxFeedSize the feed is tiny, anything bigger is not the feed
+const maxFeedSize = 1 << 20
+
+// httpProvider fetches the feed with GET, a local stub server serving the file can stand in for the real feed
+type httpProvider struct {
+	url    string
+	client *http.Client
+}
+
+func (p *httpProvider) Name() string {
+	return "http"
+}
+
+func (p *httpProvider) Fetch(ctx context.Context) (quotes []Quote, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rates feed responded with %s", resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxFeedSize))
+	if err != nil {
+		return
+	}
+	return parseFeed(data, time.Now())
+}
+
+func newHTTPProvider(url string, timeout time.Duration) Provider {
+	return &httpProvider{
+		url: url,
+		client: &http.Client{
+			Timeout: timeout,
+		},
+	}
+}
@@ -0,0 +1,74 @@
+package rates
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"strings"
+	"time"
+)
+
+// Quote the price of the currency in dollars reported by the feed
+type Quote struct {
+	Currency string
+	Price    decimal.Decimal
+	QuotedAt time.Time
+}
+
+// Provider fetches the current prices from the feed
+type Provider interface {
+	// Name is saved as the source of the quotes
+	Name() string
+	Fetch(ctx context.Context) (quotes []Quote, err error)
+}
+
+// feed the document served by the feed:
+//
+//	{"timestamp": "2021-06-01T12:00:00Z", "rates": {"BTC": "32853.856", "ETH": "2022.65"}}
+//
+// the timestamp is optional, the quotes are taken at the moment of the fetch without it
+type feed struct {
+	Timestamp *time.Time                 `json:"timestamp"`
+	Rates     map[string]decimal.Decimal `json:"rates"`
+}
+
+// NewProvider picks the provider by the source, the http(s) urls are fetched by HTTP,
+// everything else is the path of the file
+func NewProvider(source string, timeout time.Duration) (Provider, error) {
+	switch {
+	case source == "":
+		return nil, errors.New("rates source is empty")
+	case strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://"):
+		return newHTTPProvider(source, timeout), nil
+	default:
+		return newFileProvider(source), nil
+	}
+}
+
+func parseFeed(data []byte, now time.Time) (quotes []Quote, err error) {
+	var f feed
+	if err = json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("bad rates feed: %v", err)
+	}
+	if len(f.Rates) == 0 {
+		return nil, errors.New("bad rates feed: no rates")
+	}
+
+	quotedAt := now
+	if f.Timestamp != nil {
+		quotedAt = *f.Timestamp
+	}
+	for name, price := range f.Rates {
+		if !price.IsPositive() {
+			return nil, fmt.Errorf("bad rates feed: price of %s is not positive", name)
+		}
+		quotes = append(quotes, Quote{
+			Currency: strings.ToUpper(name),
+			Price:    price,
+			QuotedAt: quotedAt,
+		})
+	}
+	return
+}
@@ -0,0 +1,117 @@
+package rates
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+const testFeed = `{"timestamp": "2021-06-01T12:00:00Z", "rates": {"BTC": "32853.856", "eth": "2022.65"}}`
+
+func TestParseFeed(t *testing.T) {
+	now := time.Date(2021, 6, 1, 13, 0, 0, 0, time.UTC)
+	stamp := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, c := range []struct {
+		name     string
+		data     string
+		quotes   map[string]string
+		quotedAt time.Time
+		isErr    bool
+	}{
+		{"feed", testFeed, map[string]string{"BTC": "32853.856", "ETH": "2022.65"}, stamp, false},
+		{"without timestamp", `{"rates": {"BTC": 40000}}`, map[string]string{"BTC": "40000"}, now, false},
+		{"not json", `BTC=40000`, nil, time.Time{}, true},
+		{"no rates", `{"timestamp": "2021-06-01T12:00:00Z"}`, nil, time.Time{}, true},
+		{"empty rates", `{"rates": {}}`, nil, time.Time{}, true},
+		{"zero price", `{"rates": {"BTC": "0"}}`, nil, time.Time{}, true},
+		{"negative price", `{"rates": {"BTC": "40000", "ETH": "-1"}}`, nil, time.Time{}, true},
+		{"bad price", `{"rates": {"BTC": "a lot"}}`, nil, time.Time{}, true},
+	} {
+		quotes, err := parseFeed([]byte(c.data), now)
+		if c.isErr {
+			require.Error(t, err, c.name)
+			continue
+		}
+		require.NoError(t, err, c.name)
+
+		prices := make(map[string]string, len(quotes))
+		for _, quote := range quotes {
+			prices[quote.Currency] = quote.Price.String()
+			require.True(t, c.quotedAt.Equal(quote.QuotedAt), c.name)
+		}
+		require.Equal(t, c.quotes, prices, c.name)
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+	for _, c := range []struct {
+		source string
+		name   string
+		isErr  bool
+	}{
+		{"", "", true},
+		{"http://localhost:8081/rates.json", "http", false},
+		{"https://rates.example.com/latest", "http", false},
+		{"/etc/crypto/rates.json", "file", false},
+		{"rates.json", "file", false},
+	} {
+		provider, err := NewProvider(c.source, time.Second)
+		if c.isErr {
+			require.Error(t, err, c.source)
+			continue
+		}
+		require.NoError(t, err, c.source)
+		require.Equal(t, c.name, provider.Name(), c.source)
+	}
+}
+
+func TestFileProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.json")
+	provider, err := NewProvider(path, time.Second)
+	require.NoError(t, err)
+
+	_, err = provider.Fetch(context.Background())
+	require.Error(t, err)
+
+	// the file is read again on every fetch
+	require.NoError(t, ioutil.WriteFile(path, []byte(testFeed), 0600))
+	quotes, err := provider.Fetch(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"BTC", "ETH"}, currenciesOf(quotes))
+}
+
+func TestHTTPProvider(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		require.Equal(t, http.MethodGet, req.Method)
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(testFeed))
+	}))
+	defer server.Close()
+
+	provider, err := NewProvider(server.URL, time.Second)
+	require.NoError(t, err)
+
+	quotes, err := provider.Fetch(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"BTC", "ETH"}, currenciesOf(quotes))
+
+	status = http.StatusBadGateway
+	_, err = provider.Fetch(context.Background())
+	require.Error(t, err)
+}
+
+func currenciesOf(quotes []Quote) (currencies []string) {
+	for _, quote := range quotes {
+		currencies = append(currencies, quote.Currency)
+	}
+	sort.Strings(currencies)
+	return
+}
@@ -0,0 +1,85 @@
+package rates
+
+import (
+	"context"
+	"errors"
+	"github.com/crypto_app/pkg/storage"
+	"log"
+	"time"
+)
+
+// Store the storage the quotes are saved to
+type Store interface {
+	storage.Currencies
+	storage.Rates
+}
+
+// Refresher saves the quotes of the provider to the rate history
+type Refresher struct {
+	provider Provider
+	store    Store
+	period   time.Duration
+}
+
+// Run refreshes the quotes right away and then every period until ctx is done,
+// the failed refresh is only logged, the transfers stop by themselves once the quotes get stale
+func (r *Refresher) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.period)
+	defer ticker.Stop()
+
+	for {
+		if err := r.Refresh(ctx); err != nil {
+			log.Printf("error while refreshing the rates from %s: %v", r.provider.Name(), err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh fetches the quotes once and saves those of the known currencies
+func (r *Refresher) Refresh(ctx context.Context) (err error) {
+	fetched, err := r.provider.Fetch(ctx)
+	if err != nil {
+		return
+	}
+
+	currencies, err := r.store.GetCurrencies(ctx)
+	if err != nil {
+		return
+	}
+	byName := make(map[string]int32, len(currencies))
+	for _, currency := range currencies {
+		byName[currency.Name] = currency.ID
+	}
+
+	quotes := make([]storage.Quote, 0, len(fetched))
+	for _, quote := range fetched {
+		currencyID, ok := byName[quote.Currency]
+		if !ok {
+			continue
+		}
+		quotes = append(quotes, storage.Quote{
+			CurrencyID: currencyID,
+			Price:      quote.Price,
+			Source:     r.provider.Name(),
+			QuotedAt:   quote.QuotedAt,
+		})
+	}
+	if len(quotes) == 0 {
+		return errors.New("the feed has no quotes of the known currencies")
+	}
+
+	return r.store.SaveQuotes(ctx, quotes)
+}
+
+func NewRefresher(provider Provider, store Store, period time.Duration) *Refresher {
+	return &Refresher{
+		provider: provider,
+		store:    store,
+		period:   period,
+	}
+}
@@ -0,0 +1,91 @@
+package rates
+
+import (
+	"context"
+	"errors"
+	"github.com/crypto_app/pkg/storage"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// stubProvider returns the same quotes on every fetch
+type stubProvider struct {
+	quotes []Quote
+	err    error
+}
+
+func (p *stubProvider) Name() string {
+	return "stub"
+}
+
+func (p *stubProvider) Fetch(ctx context.Context) ([]Quote, error) {
+	return p.quotes, p.err
+}
+
+func TestRefresh(t *testing.T) {
+	ctx := context.Background()
+	quotedAt := time.Now().Add(time.Minute)
+
+	for _, c := range []struct {
+		name     string
+		provider *stubProvider
+		btc      string
+		isErr    bool
+	}{
+		{"known currencies", &stubProvider{quotes: []Quote{
+			{Currency: "BTC", Price: decimal.NewFromInt(40000), QuotedAt: quotedAt},
+			{Currency: "ETH", Price: decimal.NewFromInt(3000), QuotedAt: quotedAt},
+		}}, "40000", false},
+		// the currencies the app does not know are skipped
+		{"unknown currency", &stubProvider{quotes: []Quote{
+			{Currency: "BTC", Price: decimal.NewFromInt(41000), QuotedAt: quotedAt},
+			{Currency: "DOGE", Price: decimal.NewFromInt(1), QuotedAt: quotedAt},
+		}}, "41000", false},
+		{"only unknown currencies", &stubProvider{quotes: []Quote{
+			{Currency: "DOGE", Price: decimal.NewFromInt(1), QuotedAt: quotedAt},
+		}}, "", true},
+		{"feed is down", &stubProvider{err: errors.New("timeout")}, "", true},
+	} {
+		store := storage.NewMemoryStorage()
+		err := NewRefresher(c.provider, store, time.Minute).Refresh(ctx)
+		if c.isErr {
+			require.Error(t, err, c.name)
+			continue
+		}
+		require.NoError(t, err, c.name)
+
+		quote, err := store.GetLatestQuote(ctx, 1)
+		require.NoError(t, err, c.name)
+		require.Equal(t, c.btc, quote.Price.String(), c.name)
+		require.Equal(t, "stub", quote.Source, c.name)
+	}
+}
+
+func TestRunRefreshesUntilDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	store := storage.NewMemoryStorage()
+	provider := &stubProvider{quotes: []Quote{
+		{Currency: "BTC", Price: decimal.NewFromInt(40000), QuotedAt: time.Now().Add(time.Minute)},
+	}}
+
+	done := make(chan struct{})
+	go func() {
+		NewRefresher(provider, store, time.Hour).Run(ctx)
+		close(done)
+	}()
+
+	// the first refresh does not wait for the period
+	require.Eventually(t, func() bool {
+		quote, err := store.GetLatestQuote(ctx, 1)
+		return err == nil && quote.Source == "stub"
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not stop after the context was done")
+	}
+}
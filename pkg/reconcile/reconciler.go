@@ -0,0 +1,179 @@
+package reconcile
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/crypto_app/pkg/storage"
+	"github.com/shopspring/decimal"
+	"log"
+	"time"
+)
+
+// the kinds of the discrepancies
+const (
+	// KindSupply the balances of the currency do not sum to the money minted less the money burned
+	KindSupply = "supply"
+	// KindBalance the cached balance of the account differs from the sum of its entries
+	KindBalance = "balance"
+	// KindJournal the entries of the journal do not sum to zero in the currency
+	KindJournal = "journal"
+	// KindTransferDebit the transfer journal took other amount from the sender than the transaction says
+	KindTransferDebit = "transfer_debit"
+	// KindTransferCredit the transfer journal gave other amount to the recipient than the transaction says
+	KindTransferCredit = "transfer_credit"
+)
+
+// Store the storage the ledger is checked in
+type Store interface {
+	storage.Currencies
+	storage.Ledger
+}
+
+// Currency the totals of the currency
+type Currency struct {
+	Currency string          `json:"currency"`
+	Wallets  decimal.Decimal `json:"wallets"`
+	House    decimal.Decimal `json:"house"`
+	Minted   decimal.Decimal `json:"minted"`
+	Burned   decimal.Decimal `json:"burned"`
+}
+
+// Discrepancy the mismatch found, Expected is the value the ledger should have
+type Discrepancy struct {
+	Kind      string          `json:"kind"`
+	Currency  string          `json:"currency,omitempty"`
+	WalletID  int32           `json:"wallet_id,omitempty"`
+	Address   string          `json:"address,omitempty"`
+	Account   string          `json:"account,omitempty"`
+	JournalID string          `json:"journal_id,omitempty"`
+	Expected  decimal.Decimal `json:"expected"`
+	Actual    decimal.Decimal `json:"actual"`
+}
+
+// Report the result of the reconciliation
+type Report struct {
+	CheckedAt     time.Time     `json:"checked_at"`
+	OK            bool          `json:"ok"`
+	Currencies    []Currency    `json:"currencies"`
+	Discrepancies []Discrepancy `json:"discrepancies"`
+}
+
+// Reconciler checks the balances against the ledger
+type Reconciler struct {
+	store  Store
+	period time.Duration
+}
+
+// Run reconciles right away and then every period until ctx is done, the discrepancies are logged
+// as the JSON report
+func (r *Reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.period)
+	defer ticker.Stop()
+
+	for {
+		report, err := r.Reconcile(ctx)
+		switch {
+		case err != nil:
+			log.Printf("error while reconciling the ledger: %v", err)
+		case !report.OK:
+			out, _ := json.Marshal(report)
+			log.Printf("the ledger has %d discrepancies: %s", len(report.Discrepancies), out)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reconcile checks the ledger once
+func (r *Reconciler) Reconcile(ctx context.Context) (report Report, err error) {
+	report = Report{
+		CheckedAt:     time.Now().UTC(),
+		Currencies:    []Currency{},
+		Discrepancies: []Discrepancy{},
+	}
+
+	currencies, err := r.store.GetCurrencies(ctx)
+	if err != nil {
+		return
+	}
+	names := make(map[int32]string, len(currencies))
+	for _, currency := range currencies {
+		names[currency.ID] = currency.Name
+	}
+
+	totals, err := r.store.GetLedgerTotals(ctx)
+	if err != nil {
+		return
+	}
+	for _, t := range totals {
+		report.Currencies = append(report.Currencies, Currency{
+			Currency: names[t.CurrencyID],
+			Wallets:  t.Wallets,
+			House:    t.House,
+			Minted:   t.Minted,
+			Burned:   t.Burned,
+		})
+		if supply, held := t.Minted.Sub(t.Burned), t.Wallets.Add(t.House); !supply.Equal(held) {
+			report.Discrepancies = append(report.Discrepancies, Discrepancy{
+				Kind:     KindSupply,
+				Currency: names[t.CurrencyID],
+				Expected: supply,
+				Actual:   held,
+			})
+		}
+	}
+
+	balances, err := r.store.GetBalanceMismatches(ctx)
+	if err != nil {
+		return
+	}
+	for _, m := range balances {
+		report.Discrepancies = append(report.Discrepancies, Discrepancy{
+			Kind:     KindBalance,
+			Currency: names[m.CurrencyID],
+			WalletID: m.WalletID,
+			Address:  m.Address,
+			Account:  m.HouseAccount,
+			Expected: m.Entries,
+			Actual:   m.Balance,
+		})
+	}
+
+	journals, err := r.store.GetUnbalancedJournals(ctx)
+	if err != nil {
+		return
+	}
+	for _, j := range journals {
+		report.Discrepancies = append(report.Discrepancies, Discrepancy{
+			Kind:      KindJournal,
+			Currency:  names[j.CurrencyID],
+			JournalID: j.JournalID,
+			Expected:  decimal.Zero,
+			Actual:    j.Sum,
+		})
+	}
+
+	transfers, err := r.store.GetTransferMismatches(ctx)
+	if err != nil {
+		return
+	}
+	for _, m := range transfers {
+		report.Discrepancies = append(report.Discrepancies,
+			Discrepancy{Kind: KindTransferDebit, JournalID: m.JournalID, Expected: m.Debited, Actual: m.LedgerDebited},
+			Discrepancy{Kind: KindTransferCredit, JournalID: m.JournalID, Expected: m.Credited, Actual: m.LedgerCredited})
+	}
+
+	report.OK = len(report.Discrepancies) == 0
+	return
+}
+
+func NewReconciler(store Store, period time.Duration) *Reconciler {
+	return &Reconciler{
+		store:  store,
+		period: period,
+	}
+}
@@ -0,0 +1,111 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"github.com/crypto_app/pkg/storage"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// brokenStore reports the given discrepancies on top of the memory storage
+type brokenStore struct {
+	storage.Storage
+	totals    []storage.LedgerTotals
+	balances  []storage.BalanceMismatch
+	journals  []storage.UnbalancedJournal
+	transfers []storage.TransferMismatch
+	err       error
+}
+
+func (s *brokenStore) GetLedgerTotals(ctx context.Context) ([]storage.LedgerTotals, error) {
+	if s.totals == nil {
+		return s.Storage.GetLedgerTotals(ctx)
+	}
+	return s.totals, nil
+}
+
+func (s *brokenStore) GetBalanceMismatches(ctx context.Context) ([]storage.BalanceMismatch, error) {
+	return s.balances, s.err
+}
+
+func (s *brokenStore) GetUnbalancedJournals(ctx context.Context) ([]storage.UnbalancedJournal, error) {
+	return s.journals, nil
+}
+
+func (s *brokenStore) GetTransferMismatches(ctx context.Context) ([]storage.TransferMismatch, error) {
+	return s.transfers, nil
+}
+
+func TestReconcileCleanLedger(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStorage()
+	userID, err := store.CreateUser(ctx, storage.User{Email: "alice@example.com"})
+	require.NoError(t, err)
+	walletID, err := store.CreateWallet(ctx, storage.Wallet{UserID: userID, CurrencyID: 1, Address: "alice/BTC"})
+	require.NoError(t, err)
+	require.NoError(t, store.GrantBalance(ctx, walletID, decimal.NewFromInt(100)))
+
+	report, err := NewReconciler(store, time.Hour).Reconcile(ctx)
+	require.NoError(t, err)
+	require.True(t, report.OK)
+	require.Empty(t, report.Discrepancies)
+	require.Len(t, report.Currencies, 2)
+	require.Equal(t, "BTC", report.Currencies[0].Currency)
+	require.True(t, report.Currencies[0].Wallets.Equal(decimal.NewFromInt(100)))
+	require.True(t, report.Currencies[0].Minted.Equal(decimal.NewFromInt(100)))
+	require.Equal(t, "ETH", report.Currencies[1].Currency)
+	require.True(t, report.Currencies[1].Minted.IsZero())
+}
+
+func TestReconcileDiscrepancies(t *testing.T) {
+	ctx := context.Background()
+	one, two := decimal.NewFromInt(1), decimal.NewFromInt(2)
+
+	for _, c := range []struct {
+		name  string
+		store *brokenStore
+		kinds []string
+	}{
+		{"supply", &brokenStore{totals: []storage.LedgerTotals{
+			{CurrencyID: 1, Wallets: one, House: one, Minted: one},
+			{CurrencyID: 2, Wallets: one, Minted: two, Burned: one},
+		}}, []string{KindSupply}},
+		{"balance", &brokenStore{balances: []storage.BalanceMismatch{
+			{WalletID: 1, Address: "alice/BTC", CurrencyID: 1, Balance: two, Entries: one},
+			{HouseAccount: storage.HouseRevenue, CurrencyID: 2, Balance: one, Entries: two},
+		}}, []string{KindBalance, KindBalance}},
+		{"journal", &brokenStore{journals: []storage.UnbalancedJournal{
+			{JournalID: "journal", CurrencyID: 1, Sum: one},
+		}}, []string{KindJournal}},
+		// the transfer mismatch is reported for both sides, even the one which matches
+		{"transfer", &brokenStore{transfers: []storage.TransferMismatch{
+			{JournalID: "journal", Debited: two, Credited: one, LedgerDebited: one, LedgerCredited: one},
+		}}, []string{KindTransferDebit, KindTransferCredit}},
+	} {
+		c.store.Storage = storage.NewMemoryStorage()
+		report, err := NewReconciler(c.store, time.Hour).Reconcile(ctx)
+		require.NoError(t, err, c.name)
+		require.False(t, report.OK, c.name)
+
+		var kinds []string
+		for _, d := range report.Discrepancies {
+			kinds = append(kinds, d.Kind)
+		}
+		require.Equal(t, c.kinds, kinds, c.name)
+	}
+
+	// the names of the currencies are reported instead of the ids
+	report, err := NewReconciler(&brokenStore{Storage: storage.NewMemoryStorage(),
+		balances: []storage.BalanceMismatch{{WalletID: 1, CurrencyID: 2, Balance: two, Entries: one}}}, time.Hour).
+		Reconcile(ctx)
+	require.NoError(t, err)
+	require.Equal(t, Discrepancy{Kind: KindBalance, Currency: "ETH", WalletID: 1, Expected: one, Actual: two},
+		report.Discrepancies[0])
+
+	_, err = NewReconciler(&brokenStore{Storage: storage.NewMemoryStorage(), err: errors.New("db is down")},
+		time.Hour).Reconcile(ctx)
+	require.Error(t, err)
+}
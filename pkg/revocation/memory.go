@@ -0,0 +1,76 @@
+package revocation
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type userRevocation struct {
+	issuedBefore time.Time
+	expiresAt    time.Time
+}
+
+type memoryStore struct {
+	mu     sync.Mutex
+	tokens map[string]time.Time
+	users  map[string]userRevocation
+}
+
+func (s *memoryStore) Revoke(ctx context.Context, jti string, expiresAt time.Time) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purge(time.Now())
+	s.tokens[jti] = expiresAt
+	return
+}
+
+func (s *memoryStore) RevokeUser(ctx context.Context, userID string, issuedBefore time.Time, expiresAt time.Time) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purge(time.Now())
+	s.users[userID] = userRevocation{
+		issuedBefore: issuedBefore.Truncate(time.Second),
+		expiresAt:    expiresAt,
+	}
+	return
+}
+
+func (s *memoryStore) IsRevoked(ctx context.Context, jti string, userID string, issuedAt time.Time) (revoked bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if expiresAt, ok := s.tokens[jti]; ok && expiresAt.After(now) {
+		return true, nil
+	}
+	if u, ok := s.users[userID]; ok && u.expiresAt.After(now) && issuedAt.Truncate(time.Second).Before(u.issuedBefore) {
+		return true, nil
+	}
+	return false, nil
+}
+
+// purge drops the entries which are not needed anymore, must be called under the lock
+func (s *memoryStore) purge(now time.Time) {
+	for jti, expiresAt := range s.tokens {
+		if !expiresAt.After(now) {
+			delete(s.tokens, jti)
+		}
+	}
+	for userID, u := range s.users {
+		if !u.expiresAt.After(now) {
+			delete(s.users, userID)
+		}
+	}
+}
+
+// NewMemoryStore creates the store keeping revoked tokens in the process memory, suitable for tests
+// and a single instance setup
+func NewMemoryStore() Store {
+	return &memoryStore{
+		tokens: make(map[string]time.Time),
+		users:  make(map[string]userRevocation),
+	}
+}
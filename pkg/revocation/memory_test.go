@@ -0,0 +1,44 @@
+package revocation
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	s := NewMemoryStore()
+	require.NoError(t, s.Revoke(ctx, "revoked", now.Add(time.Hour)))
+	require.NoError(t, s.Revoke(ctx, "expired", now.Add(-time.Second)))
+	require.NoError(t, s.RevokeUser(ctx, "1", now, now.Add(time.Hour)))
+	require.NoError(t, s.RevokeUser(ctx, "2", now, now.Add(-time.Second)))
+
+	for _, c := range []struct {
+		name     string
+		jti      string
+		userID   string
+		issuedAt time.Time
+		revoked  bool
+	}{
+		{"revoked token", "revoked", "3", now, true},
+		{"other token", "other", "3", now, false},
+		// the entry is forgotten once the token would have expired anyway
+		{"revocation of the expired token", "expired", "3", now, false},
+		{"token of the user issued before revoke all", "other", "1", now.Add(-time.Minute), true},
+		{"token of the user issued after revoke all", "other", "1", now.Add(time.Minute), false},
+		{"token of another user", "other", "3", now.Add(-time.Minute), false},
+		{"expired revoke all", "other", "2", now.Add(-time.Minute), false},
+		// iat is in whole seconds, the token issued right after revoke all in the same second is valid
+		{"token of the user issued in the second of revoke all", "other", "1", now.Truncate(time.Second), false},
+		{"token of the user issued in the second before revoke all", "other", "1",
+			now.Truncate(time.Second).Add(-time.Second), true},
+	} {
+		revoked, err := s.IsRevoked(ctx, c.jti, c.userID, c.issuedAt)
+		require.NoError(t, err, c.name)
+		require.Equal(t, c.revoked, revoked, c.name)
+	}
+}
@@ -0,0 +1,72 @@
+package revocation
+
+import (
+	"context"
+	"github.com/jackc/pgx"
+	"time"
+)
+
+// queryToCheckRevocation runs on every authorized request, so it is worth preparing, see CachedStatements.
+// issued_before is kept in whole seconds as the iat of the token is
+const queryToCheckRevocation = `select exists(select 1 from revoked_tokens where jti = $1 and expires_at > current_timestamp)
+	or exists(select 1 from revoked_users where user_id = $2 and issued_before > date_trunc('second', $3::timestamptz)
+		and expires_at > current_timestamp);`
+
+// CachedStatements the statements to prepare on every new connection
+var CachedStatements = []string{queryToCheckRevocation}
+
+type postgresStore struct {
+	db *pgx.ConnPool
+}
+
+func (s *postgresStore) Revoke(ctx context.Context, jti string, expiresAt time.Time) (err error) {
+	const (
+		queryToRevoke = `insert into revoked_tokens (jti, expires_at) values ($1, $2)
+			on conflict (jti) do update set expires_at = excluded.expires_at;`
+	)
+
+	if err = s.purge(ctx); err != nil {
+		return
+	}
+	_, err = s.db.ExecEx(ctx, queryToRevoke, nil, jti, expiresAt)
+	return
+}
+
+func (s *postgresStore) RevokeUser(ctx context.Context, userID string, issuedBefore time.Time, expiresAt time.Time) (err error) {
+	const (
+		queryToRevokeUser = `insert into revoked_users (user_id, issued_before, expires_at) values ($1, $2, $3)
+			on conflict (user_id) do update set issued_before = excluded.issued_before, expires_at = excluded.expires_at;`
+	)
+
+	if err = s.purge(ctx); err != nil {
+		return
+	}
+	_, err = s.db.ExecEx(ctx, queryToRevokeUser, nil, userID, issuedBefore.Truncate(time.Second), expiresAt)
+	return
+}
+
+func (s *postgresStore) IsRevoked(ctx context.Context, jti string, userID string, issuedAt time.Time) (revoked bool, err error) {
+	err = s.db.QueryRowEx(ctx, queryToCheckRevocation, nil, jti, userID, issuedAt).Scan(&revoked)
+	return
+}
+
+// purge removes expired entries, so the tables hold only the tokens which could still be presented
+func (s *postgresStore) purge(ctx context.Context) (err error) {
+	const (
+		queryToPurgeTokens = `delete from revoked_tokens where expires_at <= current_timestamp;`
+		queryToPurgeUsers  = `delete from revoked_users where expires_at <= current_timestamp;`
+	)
+
+	if _, err = s.db.ExecEx(ctx, queryToPurgeTokens, nil); err != nil {
+		return
+	}
+	_, err = s.db.ExecEx(ctx, queryToPurgeUsers, nil)
+	return
+}
+
+// NewPostgresStore creates the store keeping revoked tokens in the revoked_tokens and revoked_users tables
+func NewPostgresStore(db *pgx.ConnPool) Store {
+	return &postgresStore{
+		db: db,
+	}
+}
@@ -0,0 +1,18 @@
+package revocation
+
+import (
+	"context"
+	"time"
+)
+
+// Store keeps track of access tokens revoked before their expiration.
+// Entries are needed only while the revoked tokens are still valid, so every entry carries its own expiration.
+type Store interface {
+	// Revoke revokes the single token identified by its jti
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) (err error)
+	// RevokeUser revokes every token of the user issued before the given moment. The iat of JWT is in whole
+	// seconds, so the moment is kept at the second precision and the token issued in the same second is valid.
+	RevokeUser(ctx context.Context, userID string, issuedBefore time.Time, expiresAt time.Time) (err error)
+	// IsRevoked reports whether the token was revoked by itself or together with all tokens of the user
+	IsRevoked(ctx context.Context, jti string, userID string, issuedAt time.Time) (revoked bool, err error)
+}
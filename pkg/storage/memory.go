@@ -0,0 +1,1381 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/crypto_app/pkg/models"
+	"github.com/gofrs/uuid"
+	"github.com/shopspring/decimal"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// divisionScale the scale the amounts are divided with before rounding, as numeric(60, 24) in make_transfer
+	divisionScale = 24
+	// rateScale the scale of the price of the currency, as numeric(30, 8) in rate_history
+	rateScale = 8
+	// dateLayout the format postgres prints the timestamp in
+	dateLayout = "2006-01-02 15:04:05.999999"
+)
+
+type memoryRefreshToken struct {
+	userID    int32
+	familyID  string
+	expiresAt time.Time
+	used      bool
+	revoked   bool
+}
+
+type memoryProfile struct {
+	dob         *time.Time
+	address     string
+	description string
+	createdAt   time.Time
+	updatedAt   *time.Time
+}
+
+type memoryPasswordReset struct {
+	userID    int32
+	expiresAt time.Time
+	used      bool
+}
+
+type memoryEmailVerification struct {
+	userID    int32
+	expiresAt time.Time
+	used      bool
+}
+
+type memoryRecoveryCode struct {
+	userID   int32
+	codeHash string
+	used     bool
+}
+
+type memoryMFAChallenge struct {
+	userID    int32
+	expiresAt time.Time
+	used      bool
+	attempts  int32
+}
+
+type memoryTransaction struct {
+	id            int64
+	publicID      string
+	fromWalletID  int32
+	toWalletID    int32
+	senderID      int32
+	recipientID   int32
+	amount        decimal.Decimal
+	commission    decimal.Decimal
+	createAt      time.Time
+	success       bool
+	failureReason string
+	fromRate      decimal.Decimal
+	toRate        decimal.Decimal
+	debited       decimal.Decimal
+	credited      decimal.Decimal
+	fee           decimal.Decimal
+}
+
+type memoryOverride struct {
+	Override
+	createdAt time.Time
+}
+
+type houseAccountID struct {
+	currencyID int32
+	kind       string
+}
+
+// memoryEntry the entry of the ledger, either walletID or houseAccount is set
+type memoryEntry struct {
+	journalID    string
+	kind         string
+	walletID     int32
+	houseAccount string
+	currencyID   int32
+	amount       decimal.Decimal
+	createdAt    time.Time
+}
+
+type idempotencyID struct {
+	userID int32
+	key    string
+}
+
+type memoryIdempotencyKey struct {
+	fingerprint   string
+	transactionID string
+	success       bool
+}
+
+// memoryData the whole state of the memory storage, it is copied when the transaction starts
+// and restored when the transaction fails
+type memoryData struct {
+	lastUserID     int32
+	lastWalletID   int32
+	lastCurrencyID int32
+	users          map[int32]User
+	usersByEmail   map[string]int32
+	profiles       map[int32]memoryProfile
+	refreshTokens  map[string]memoryRefreshToken
+	passwordResets map[string]memoryPasswordReset
+	verifications  map[string]memoryEmailVerification
+	mfaSecrets     map[int32]MFASecret
+	recoveryCodes  []memoryRecoveryCode
+	mfaChallenges  map[string]memoryMFAChallenge
+	wallets        map[int32]Wallet
+	walletsByAddr  map[string]int32
+	currencies     map[int32]Currency
+	quotes         []Quote
+	overrides      map[int32]memoryOverride
+	transactions   []memoryTransaction
+	entries        []memoryEntry
+	houseAccounts  map[houseAccountID]decimal.Decimal
+	idempotencyKey map[idempotencyID]memoryIdempotencyKey
+}
+
+func (d *memoryData) clone() *memoryData {
+	c := *d
+	c.users = make(map[int32]User, len(d.users))
+	for k, v := range d.users {
+		c.users[k] = v
+	}
+	c.usersByEmail = make(map[string]int32, len(d.usersByEmail))
+	for k, v := range d.usersByEmail {
+		c.usersByEmail[k] = v
+	}
+	c.profiles = make(map[int32]memoryProfile, len(d.profiles))
+	for k, v := range d.profiles {
+		c.profiles[k] = v
+	}
+	c.refreshTokens = make(map[string]memoryRefreshToken, len(d.refreshTokens))
+	for k, v := range d.refreshTokens {
+		c.refreshTokens[k] = v
+	}
+	c.passwordResets = make(map[string]memoryPasswordReset, len(d.passwordResets))
+	for k, v := range d.passwordResets {
+		c.passwordResets[k] = v
+	}
+	c.verifications = make(map[string]memoryEmailVerification, len(d.verifications))
+	for k, v := range d.verifications {
+		c.verifications[k] = v
+	}
+	c.mfaSecrets = make(map[int32]MFASecret, len(d.mfaSecrets))
+	for k, v := range d.mfaSecrets {
+		c.mfaSecrets[k] = v
+	}
+	c.recoveryCodes = append([]memoryRecoveryCode(nil), d.recoveryCodes...)
+	c.mfaChallenges = make(map[string]memoryMFAChallenge, len(d.mfaChallenges))
+	for k, v := range d.mfaChallenges {
+		c.mfaChallenges[k] = v
+	}
+	c.wallets = make(map[int32]Wallet, len(d.wallets))
+	for k, v := range d.wallets {
+		c.wallets[k] = v
+	}
+	c.walletsByAddr = make(map[string]int32, len(d.walletsByAddr))
+	for k, v := range d.walletsByAddr {
+		c.walletsByAddr[k] = v
+	}
+	c.currencies = make(map[int32]Currency, len(d.currencies))
+	for k, v := range d.currencies {
+		c.currencies[k] = v
+	}
+	c.quotes = append([]Quote(nil), d.quotes...)
+	c.overrides = make(map[int32]memoryOverride, len(d.overrides))
+	for k, v := range d.overrides {
+		c.overrides[k] = v
+	}
+	c.transactions = append([]memoryTransaction(nil), d.transactions...)
+	c.entries = append([]memoryEntry(nil), d.entries...)
+	c.houseAccounts = make(map[houseAccountID]decimal.Decimal, len(d.houseAccounts))
+	for k, v := range d.houseAccounts {
+		c.houseAccounts[k] = v
+	}
+	c.idempotencyKey = make(map[idempotencyID]memoryIdempotencyKey, len(d.idempotencyKey))
+	for k, v := range d.idempotencyKey {
+		c.idempotencyKey[k] = v
+	}
+	return &c
+}
+
+// memoryStorage keeps everything in the process memory. The transactions are serialized: the lock
+// is held from the start of the transaction till its end, so it behaves like the serializable isolation.
+type memoryStorage struct {
+	mu   *sync.Mutex
+	data *memoryData
+	// inTx the lock is already held by the transaction
+	inTx bool
+}
+
+// lock takes the lock unless it is held by the transaction, the returned func releases it
+func (s *memoryStorage) lock() func() {
+	if s.inTx {
+		return func() {}
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+func (s *memoryStorage) InTx(ctx context.Context, fn func(tx Storage) error) (err error) {
+	if s.inTx {
+		return fn(s)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := s.data.clone()
+	if err = fn(&memoryStorage{mu: s.mu, data: s.data, inTx: true}); err != nil {
+		*s.data = *snapshot
+	}
+	return
+}
+
+func (s *memoryStorage) Stats() (stats models.PoolStatsResponse) {
+	return
+}
+
+func (s *memoryStorage) EmailExists(ctx context.Context, email string) (exists bool, err error) {
+	defer s.lock()()
+
+	_, exists = s.data.usersByEmail[email]
+	return
+}
+
+func (s *memoryStorage) CreateUser(ctx context.Context, user User) (userID int32, err error) {
+	defer s.lock()()
+
+	if _, ok := s.data.usersByEmail[user.Email]; ok {
+		return 0, errDuplicate("user_data_email_uindex")
+	}
+	s.data.lastUserID++
+	user.ID = s.data.lastUserID
+	s.data.users[user.ID] = user
+	s.data.usersByEmail[user.Email] = user.ID
+	s.data.profiles[user.ID] = memoryProfile{createdAt: time.Now()}
+	return user.ID, nil
+}
+
+func (s *memoryStorage) GetUserByEmail(ctx context.Context, email string) (user User, err error) {
+	defer s.lock()()
+
+	userID, ok := s.data.usersByEmail[email]
+	if !ok {
+		return user, ErrNotFound
+	}
+	return s.data.users[userID], nil
+}
+
+func (s *memoryStorage) GetUser(ctx context.Context, userID int32) (user User, err error) {
+	defer s.lock()()
+
+	user, ok := s.data.users[userID]
+	if !ok {
+		return user, ErrNotFound
+	}
+	return
+}
+
+func (s *memoryStorage) UpdatePassHash(ctx context.Context, userID int32, passHash string) (err error) {
+	defer s.lock()()
+
+	if user, ok := s.data.users[userID]; ok {
+		user.PassHash = passHash
+		s.data.users[userID] = user
+	}
+	return
+}
+
+func (s *memoryStorage) MarkEmailVerified(ctx context.Context, userID int32) (err error) {
+	defer s.lock()()
+
+	if user, ok := s.data.users[userID]; ok {
+		user.EmailVerified = true
+		s.data.users[userID] = user
+	}
+	return
+}
+
+func (s *memoryStorage) GetProfile(ctx context.Context, userID int32) (
+	profile models.SingleUserDataDbResponse, err error) {
+	defer s.lock()()
+
+	user, ok := s.data.users[userID]
+	if !ok {
+		return profile, ErrNotFound
+	}
+	p := s.data.profiles[userID]
+	profile = models.SingleUserDataDbResponse{
+		ID:            int(user.ID),
+		Name:          user.Name,
+		LastName:      user.LastName,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Address:       p.address,
+		Description:   p.description,
+		CreateAt:      sql.NullTime{Time: p.createdAt, Valid: true},
+	}
+	if p.dob != nil {
+		profile.DOB = sql.NullTime{Time: *p.dob, Valid: true}
+	}
+	if p.updatedAt != nil {
+		profile.UpdatedAt = sql.NullTime{Time: *p.updatedAt, Valid: true}
+	}
+	return
+}
+
+func (s *memoryStorage) UpdateProfile(ctx context.Context, input models.UpdateUserData) (err error) {
+	defer s.lock()()
+
+	userID := int32(input.ID)
+	user, ok := s.data.users[userID]
+	if !ok {
+		return
+	}
+	p := s.data.profiles[userID]
+	// updated_at is touched only by the actual change, as the trigger of user_data does
+	changed := false
+	set := func(dst *string, src *string) {
+		if src != nil && *dst != *src {
+			*dst = *src
+			changed = true
+		}
+	}
+	set(&user.Name, input.Name)
+	set(&user.LastName, input.LastName)
+	set(&p.address, input.Address)
+	set(&p.description, input.Description)
+	if input.DOB != nil {
+		var dob *time.Time
+		if *input.DOB != "" {
+			d, er := time.Parse("2006-01-02", *input.DOB)
+			if er != nil {
+				return er
+			}
+			dob = &d
+		}
+		if (dob == nil) != (p.dob == nil) || (dob != nil && !dob.Equal(*p.dob)) {
+			p.dob = dob
+			changed = true
+		}
+	}
+	if changed {
+		now := time.Now()
+		p.updatedAt = &now
+	}
+	s.data.users[userID] = user
+	s.data.profiles[userID] = p
+	return
+}
+
+func (s *memoryStorage) SaveRefreshToken(ctx context.Context, tokenHash string, userID int32, familyID string,
+	ttl time.Duration) (err error) {
+	defer s.lock()()
+
+	if _, ok := s.data.refreshTokens[tokenHash]; ok {
+		return errDuplicate("refresh_tokens_token_hash_uindex")
+	}
+	s.data.refreshTokens[tokenHash] = memoryRefreshToken{
+		userID:    userID,
+		familyID:  familyID,
+		expiresAt: time.Now().Add(ttl),
+	}
+	return
+}
+
+func (s *memoryStorage) GetRefreshToken(ctx context.Context, tokenHash string) (token RefreshToken, err error) {
+	defer s.lock()()
+
+	t, ok := s.data.refreshTokens[tokenHash]
+	if !ok {
+		return token, ErrNotFound
+	}
+	token.UserID = t.userID
+	token.FamilyID = t.familyID
+	token.Spent = t.used || t.revoked
+	token.Expired = t.expiresAt.Before(time.Now())
+	return
+}
+
+func (s *memoryStorage) MarkRefreshTokenUsed(ctx context.Context, tokenHash string) (err error) {
+	defer s.lock()()
+
+	if t, ok := s.data.refreshTokens[tokenHash]; ok {
+		t.used = true
+		s.data.refreshTokens[tokenHash] = t
+	}
+	return
+}
+
+func (s *memoryStorage) RevokeRefreshTokenFamily(ctx context.Context, familyID string) (err error) {
+	defer s.lock()()
+
+	for hash, t := range s.data.refreshTokens {
+		if t.familyID == familyID {
+			t.revoked = true
+			s.data.refreshTokens[hash] = t
+		}
+	}
+	return
+}
+
+func (s *memoryStorage) RevokeUserRefreshTokens(ctx context.Context, userID int32) (err error) {
+	defer s.lock()()
+
+	for hash, t := range s.data.refreshTokens {
+		if t.userID == userID {
+			t.revoked = true
+			s.data.refreshTokens[hash] = t
+		}
+	}
+	return
+}
+
+func (s *memoryStorage) SavePasswordResetToken(ctx context.Context, tokenHash string, userID int32,
+	ttl time.Duration) (err error) {
+	defer s.lock()()
+
+	if _, ok := s.data.passwordResets[tokenHash]; ok {
+		return errDuplicate("password_resets_token_hash_uindex")
+	}
+	s.data.passwordResets[tokenHash] = memoryPasswordReset{
+		userID:    userID,
+		expiresAt: time.Now().Add(ttl),
+	}
+	return
+}
+
+func (s *memoryStorage) GetPasswordResetToken(ctx context.Context, tokenHash string) (
+	token PasswordResetToken, err error) {
+	defer s.lock()()
+
+	t, ok := s.data.passwordResets[tokenHash]
+	if !ok {
+		return token, ErrNotFound
+	}
+	token.UserID = t.userID
+	token.Spent = t.used
+	token.Expired = t.expiresAt.Before(time.Now())
+	return
+}
+
+func (s *memoryStorage) SpendPasswordResetTokens(ctx context.Context, userID int32) (err error) {
+	defer s.lock()()
+
+	for hash, t := range s.data.passwordResets {
+		if t.userID == userID {
+			t.used = true
+			s.data.passwordResets[hash] = t
+		}
+	}
+	return
+}
+
+func (s *memoryStorage) SaveEmailVerificationToken(ctx context.Context, tokenHash string, userID int32,
+	ttl time.Duration) (err error) {
+	defer s.lock()()
+
+	if _, ok := s.data.verifications[tokenHash]; ok {
+		return errDuplicate("email_verifications_token_hash_uindex")
+	}
+	s.data.verifications[tokenHash] = memoryEmailVerification{
+		userID:    userID,
+		expiresAt: time.Now().Add(ttl),
+	}
+	return
+}
+
+func (s *memoryStorage) GetEmailVerificationToken(ctx context.Context, tokenHash string) (
+	token EmailVerificationToken, err error) {
+	defer s.lock()()
+
+	t, ok := s.data.verifications[tokenHash]
+	if !ok {
+		return token, ErrNotFound
+	}
+	token.UserID = t.userID
+	token.Spent = t.used
+	token.Expired = t.expiresAt.Before(time.Now())
+	return
+}
+
+func (s *memoryStorage) SpendEmailVerificationTokens(ctx context.Context, userID int32) (err error) {
+	defer s.lock()()
+
+	for hash, t := range s.data.verifications {
+		if t.userID == userID {
+			t.used = true
+			s.data.verifications[hash] = t
+		}
+	}
+	return
+}
+
+func (s *memoryStorage) SaveMFASecret(ctx context.Context, userID int32, secret string) (err error) {
+	defer s.lock()()
+
+	s.data.mfaSecrets[userID] = MFASecret{
+		UserID: userID,
+		Secret: secret,
+	}
+	return
+}
+
+func (s *memoryStorage) GetMFASecret(ctx context.Context, userID int32) (secret MFASecret, err error) {
+	defer s.lock()()
+
+	secret, ok := s.data.mfaSecrets[userID]
+	if !ok {
+		return secret, ErrNotFound
+	}
+	return
+}
+
+func (s *memoryStorage) EnableMFA(ctx context.Context, userID int32, counter int64,
+	recoveryCodeHashes []string) (err error) {
+	defer s.lock()()
+
+	if secret, ok := s.data.mfaSecrets[userID]; ok {
+		secret.Enabled = true
+		secret.LastCounter = counter
+		s.data.mfaSecrets[userID] = secret
+	}
+	s.deleteRecoveryCodes(userID)
+	for _, hash := range recoveryCodeHashes {
+		s.data.recoveryCodes = append(s.data.recoveryCodes, memoryRecoveryCode{userID: userID, codeHash: hash})
+	}
+	return
+}
+
+func (s *memoryStorage) SetMFACounter(ctx context.Context, userID int32, counter int64) (err error) {
+	defer s.lock()()
+
+	if secret, ok := s.data.mfaSecrets[userID]; ok {
+		secret.LastCounter = counter
+		s.data.mfaSecrets[userID] = secret
+	}
+	return
+}
+
+func (s *memoryStorage) DisableMFA(ctx context.Context, userID int32) (err error) {
+	defer s.lock()()
+
+	delete(s.data.mfaSecrets, userID)
+	s.deleteRecoveryCodes(userID)
+	return
+}
+
+// deleteRecoveryCodes must be called under the lock
+func (s *memoryStorage) deleteRecoveryCodes(userID int32) {
+	codes := s.data.recoveryCodes[:0]
+	for _, code := range s.data.recoveryCodes {
+		if code.userID != userID {
+			codes = append(codes, code)
+		}
+	}
+	s.data.recoveryCodes = codes
+}
+
+func (s *memoryStorage) UseRecoveryCode(ctx context.Context, userID int32, codeHash string) (used bool, err error) {
+	defer s.lock()()
+
+	for i, code := range s.data.recoveryCodes {
+		if code.userID == userID && code.codeHash == codeHash && !code.used {
+			s.data.recoveryCodes[i].used = true
+			return true, nil
+		}
+	}
+	return
+}
+
+func (s *memoryStorage) SaveMFAChallenge(ctx context.Context, tokenHash string, userID int32,
+	ttl time.Duration) (err error) {
+	defer s.lock()()
+
+	if _, ok := s.data.mfaChallenges[tokenHash]; ok {
+		return errDuplicate("mfa_challenges_token_hash_uindex")
+	}
+	s.data.mfaChallenges[tokenHash] = memoryMFAChallenge{
+		userID:    userID,
+		expiresAt: time.Now().Add(ttl),
+	}
+	return
+}
+
+func (s *memoryStorage) GetMFAChallenge(ctx context.Context, tokenHash string) (challenge MFAChallenge, err error) {
+	defer s.lock()()
+
+	c, ok := s.data.mfaChallenges[tokenHash]
+	if !ok {
+		return challenge, ErrNotFound
+	}
+	challenge.UserID = c.userID
+	challenge.Spent = c.used
+	challenge.Expired = c.expiresAt.Before(time.Now())
+	challenge.Attempts = c.attempts
+	return
+}
+
+func (s *memoryStorage) FailMFAChallenge(ctx context.Context, tokenHash string) (err error) {
+	defer s.lock()()
+
+	if c, ok := s.data.mfaChallenges[tokenHash]; ok {
+		c.attempts++
+		s.data.mfaChallenges[tokenHash] = c
+	}
+	return
+}
+
+func (s *memoryStorage) SpendMFAChallenge(ctx context.Context, tokenHash string) (err error) {
+	defer s.lock()()
+
+	if c, ok := s.data.mfaChallenges[tokenHash]; ok {
+		c.used = true
+		s.data.mfaChallenges[tokenHash] = c
+	}
+	return
+}
+
+func (s *memoryStorage) CreateWallet(ctx context.Context, wallet Wallet) (walletID int32, err error) {
+	defer s.lock()()
+
+	if _, ok := s.data.users[wallet.UserID]; !ok {
+		return 0, errForeignKey("addresses_user_data_id_fk")
+	}
+	if _, ok := s.data.currencies[wallet.CurrencyID]; !ok {
+		return 0, errForeignKey("addresses_salary_id_fk")
+	}
+	if _, ok := s.data.walletsByAddr[wallet.Address]; ok {
+		return 0, ErrAddressTaken
+	}
+	s.data.lastWalletID++
+	wallet.ID = s.data.lastWalletID
+	wallet.Balance = decimal.Zero
+	wallet.CreatedAt = time.Now()
+	wallet.ArchivedAt = nil
+	s.data.wallets[wallet.ID] = wallet
+	s.data.walletsByAddr[wallet.Address] = wallet.ID
+	return wallet.ID, nil
+}
+
+func (s *memoryStorage) GetWallets(ctx context.Context, userID int32) (wallets []*models.WalletsResponse, err error) {
+	defer s.lock()()
+
+	for _, wallet := range s.sortedWallets() {
+		if wallet.UserID != userID {
+			continue
+		}
+		wallets = append(wallets, &models.WalletsResponse{
+			ID:        wallet.ID,
+			Salary:    s.data.currencies[wallet.CurrencyID].Name,
+			Balance:   wallet.Balance,
+			Address:   wallet.Address,
+			Label:     wallet.Label,
+			CreatedAt: wallet.CreatedAt,
+			Archived:  wallet.ArchivedAt != nil,
+		})
+	}
+	return
+}
+
+func (s *memoryStorage) GetWalletByAddress(ctx context.Context, address string) (wallet Wallet, err error) {
+	defer s.lock()()
+
+	walletID, ok := s.data.walletsByAddr[address]
+	if !ok {
+		return wallet, ErrNotFound
+	}
+	return s.data.wallets[walletID], nil
+}
+
+func (s *memoryStorage) GetWalletsByIDs(ctx context.Context, walletIDs []int32) (wallets []Wallet, err error) {
+	defer s.lock()()
+
+	for _, walletID := range walletIDs {
+		if wallet, ok := s.data.wallets[walletID]; ok {
+			wallets = append(wallets, wallet)
+		}
+	}
+	return
+}
+
+func (s *memoryStorage) ArchiveWallet(ctx context.Context, walletID int32) (archived bool, err error) {
+	defer s.lock()()
+
+	wallet, ok := s.data.wallets[walletID]
+	if !ok || !wallet.Balance.IsZero() || wallet.ArchivedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	wallet.ArchivedAt = &now
+	s.data.wallets[walletID] = wallet
+	return true, nil
+}
+
+func (s *memoryStorage) GetCurrencies(ctx context.Context) (currencies []Currency, err error) {
+	defer s.lock()()
+
+	for _, currency := range s.data.currencies {
+		currencies = append(currencies, currency)
+	}
+	sort.Slice(currencies, func(i, j int) bool {
+		return currencies[i].ID < currencies[j].ID
+	})
+	return
+}
+
+func (s *memoryStorage) GetCurrencyByName(ctx context.Context, name string) (currency Currency, err error) {
+	defer s.lock()()
+
+	for _, currency = range s.data.currencies {
+		if currency.Name == name {
+			return currency, nil
+		}
+	}
+	return Currency{}, ErrNotFound
+}
+
+func (s *memoryStorage) CreateCurrency(ctx context.Context, currency Currency) (currencyID int32, err error) {
+	defer s.lock()()
+
+	for _, c := range s.data.currencies {
+		if c.Name == currency.Name {
+			return 0, errDuplicate("salary_name_uindex")
+		}
+	}
+	s.data.lastCurrencyID++
+	currency.ID = s.data.lastCurrencyID
+	s.data.currencies[currency.ID] = currency
+	return currency.ID, nil
+}
+
+func (s *memoryStorage) UpdateCurrency(ctx context.Context, currency Currency) (err error) {
+	defer s.lock()()
+
+	c, ok := s.data.currencies[currency.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	c.DisplayName = currency.DisplayName
+	c.AddressFormat = currency.AddressFormat
+	c.Enabled = currency.Enabled
+	s.data.currencies[c.ID] = c
+	return
+}
+
+func (s *memoryStorage) SaveQuotes(ctx context.Context, quotes []Quote) (err error) {
+	defer s.lock()()
+
+	// the quotes are checked before any of them is saved, as the transaction of postgres saves none on the error
+	for _, quote := range quotes {
+		if _, ok := s.data.currencies[quote.CurrencyID]; !ok {
+			return errForeignKey("rate_history_salary_id_fk")
+		}
+	}
+
+	for _, quote := range quotes {
+		if s.hasQuote(quote) {
+			continue
+		}
+		quote.Price = quote.Price.Round(rateScale)
+		s.data.quotes = append(s.data.quotes, quote)
+	}
+	return
+}
+
+// hasQuote reports whether the quote is saved already, as the unique index on rate_history does
+func (s *memoryStorage) hasQuote(quote Quote) bool {
+	for _, q := range s.data.quotes {
+		if q.CurrencyID == quote.CurrencyID && q.QuotedAt.Equal(quote.QuotedAt) && q.Source == quote.Source {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *memoryStorage) GetLatestQuote(ctx context.Context, currencyID int32) (quote Quote, err error) {
+	defer s.lock()()
+
+	if o, ok := s.data.overrides[currencyID]; ok && (o.ExpiresAt == nil || o.ExpiresAt.After(time.Now())) {
+		return Quote{
+			CurrencyID: currencyID,
+			Price:      o.Price,
+			Source:     SourceManual,
+			QuotedAt:   o.createdAt,
+		}, nil
+	}
+
+	found := false
+	for _, q := range s.data.quotes {
+		if q.CurrencyID == currencyID && q.Source != SourceManual && (!found || q.QuotedAt.After(quote.QuotedAt)) {
+			quote, found = q, true
+		}
+	}
+	if !found {
+		return quote, ErrNotFound
+	}
+	return
+}
+
+func (s *memoryStorage) SetOverride(ctx context.Context, override Override) (err error) {
+	defer s.lock()()
+
+	if _, ok := s.data.currencies[override.CurrencyID]; !ok {
+		return errForeignKey("rate_overrides_salary_id_fk")
+	}
+	now := time.Now()
+	override.Price = override.Price.Round(rateScale)
+	s.data.overrides[override.CurrencyID] = memoryOverride{Override: override, createdAt: now}
+	s.data.quotes = append(s.data.quotes, Quote{
+		CurrencyID: override.CurrencyID,
+		Price:      override.Price,
+		Source:     SourceManual,
+		QuotedAt:   now,
+	})
+	return
+}
+
+func (s *memoryStorage) DeleteOverride(ctx context.Context, currencyID int32) (err error) {
+	defer s.lock()()
+
+	if _, ok := s.data.overrides[currencyID]; !ok {
+		return ErrNotFound
+	}
+	delete(s.data.overrides, currencyID)
+	return
+}
+
+func (s *memoryStorage) GetCandles(ctx context.Context, filter CandleFilter) (candles []Candle, err error) {
+	defer s.lock()()
+
+	var quotes []Quote
+	for _, q := range s.data.quotes {
+		if q.CurrencyID == filter.CurrencyID && !q.QuotedAt.Before(filter.From) && q.QuotedAt.Before(filter.To) {
+			quotes = append(quotes, q)
+		}
+	}
+	sort.SliceStable(quotes, func(i, j int) bool {
+		return quotes[i].QuotedAt.Before(quotes[j].QuotedAt)
+	})
+
+	for _, q := range quotes {
+		bucket := q.QuotedAt.Truncate(filter.Interval).UTC()
+		if len(candles) == 0 || !candles[len(candles)-1].Time.Equal(bucket) {
+			candles = append(candles, Candle{Time: bucket, Open: q.Price, High: q.Price, Low: q.Price})
+		}
+		candle := &candles[len(candles)-1]
+		candle.High = decimal.Max(candle.High, q.Price)
+		candle.Low = decimal.Min(candle.Low, q.Price)
+		candle.Close = q.Price
+		candle.Quotes++
+	}
+	return
+}
+
+// MakeTransaction does what the make_transfer function does in postgres
+func (s *memoryStorage) MakeTransaction(ctx context.Context, transactionID string, fromWalletID int32,
+	toWalletID int32, amount decimal.Decimal, commission decimal.Decimal, fromRate decimal.Decimal,
+	toRate decimal.Decimal) (success bool, err error) {
+	defer s.lock()()
+
+	if _, ok := s.findTransaction(transactionID); ok {
+		return false, errDuplicate("transactions_public_id_uindex")
+	}
+	from, ok := s.data.wallets[fromWalletID]
+	if !ok {
+		return false, errForeignKey("transactions_addresses_id_fk")
+	}
+	to, ok := s.data.wallets[toWalletID]
+	if !ok {
+		return false, errForeignKey("transactions_addresses_id_fk_2")
+	}
+	fromScale, toScale := s.data.currencies[from.CurrencyID].Scale, s.data.currencies[to.CurrencyID].Scale
+	fromRate, toRate = fromRate.Round(rateScale), toRate.Round(rateScale)
+
+	// the debit is rounded up and the credit is rounded down, so rounding never creates money
+	debit := ceilScale(amount.DivRound(fromRate, divisionScale).
+		DivRound(decimal.NewFromInt(1).Sub(commission), divisionScale), fromScale)
+	credit := amount.DivRound(toRate, divisionScale).Truncate(toScale)
+	// the fee is the part of the debit above the amount itself
+	fee := debit.Sub(amount.DivRound(fromRate, divisionScale).Truncate(fromScale))
+
+	if from.Balance.GreaterThanOrEqual(debit) {
+		entries := []memoryEntry{
+			{kind: EntryTransfer, walletID: from.ID, currencyID: from.CurrencyID, amount: debit.Neg()},
+			{kind: EntryFee, houseAccount: HouseRevenue, currencyID: from.CurrencyID, amount: fee},
+			{kind: EntryTransfer, walletID: to.ID, currencyID: to.CurrencyID, amount: credit},
+		}
+		if from.CurrencyID != to.CurrencyID {
+			entries = append(entries,
+				memoryEntry{kind: EntryExchange, houseAccount: HouseExchange, currencyID: from.CurrencyID,
+					amount: debit.Sub(fee)},
+				memoryEntry{kind: EntryExchange, houseAccount: HouseExchange, currencyID: to.CurrencyID,
+					amount: credit.Neg()})
+		} else if rest := debit.Sub(fee).Sub(credit); !rest.IsZero() {
+			entries = append(entries, memoryEntry{kind: EntryExchange, houseAccount: HouseExchange,
+				currencyID: from.CurrencyID, amount: rest})
+		}
+		if err = s.post(transactionID, entries); err != nil {
+			return
+		}
+		success = true
+	}
+
+	t := memoryTransaction{
+		id:           int64(len(s.data.transactions) + 1),
+		publicID:     transactionID,
+		fromWalletID: from.ID,
+		toWalletID:   to.ID,
+		senderID:     from.UserID,
+		recipientID:  to.UserID,
+		amount:       amount.Round(2),
+		commission:   commission.Round(rateScale),
+		createAt:     time.Now().UTC().Truncate(time.Microsecond),
+		success:      success,
+		fromRate:     fromRate,
+		toRate:       toRate,
+		debited:      debit,
+		credited:     credit,
+		fee:          fee,
+	}
+	if !success {
+		t.failureReason = FailureInsufficientFunds
+	}
+	s.data.transactions = append(s.data.transactions, t)
+	return
+}
+
+func (s *memoryStorage) GetTransaction(ctx context.Context, userID int32, transactionID string) (
+	transaction models.TransactionDetail, err error) {
+	defer s.lock()()
+
+	t, ok := s.findTransaction(transactionID)
+	if !ok || t.senderID != userID && t.recipientID != userID {
+		return transaction, ErrNotFound
+	}
+
+	from, to := s.data.wallets[t.fromWalletID], s.data.wallets[t.toWalletID]
+	return models.TransactionDetail{
+		ID:            t.publicID,
+		FromAddress:   from.Address,
+		ToAddress:     to.Address,
+		FromCurrency:  s.data.currencies[from.CurrencyID].Name,
+		ToCurrency:    s.data.currencies[to.CurrencyID].Name,
+		Amount:        t.amount,
+		Debited:       decimal.NullDecimal{Decimal: t.debited, Valid: true},
+		Credited:      decimal.NullDecimal{Decimal: t.credited, Valid: true},
+		Fee:           decimal.NullDecimal{Decimal: t.fee, Valid: true},
+		FromRate:      decimal.NullDecimal{Decimal: t.fromRate, Valid: true},
+		ToRate:        decimal.NullDecimal{Decimal: t.toRate, Valid: true},
+		Commission:    t.commission,
+		Date:          t.createAt.Format(dateLayout),
+		Success:       t.success,
+		FailureReason: t.failureReason,
+		Direction:     transactionDirection(t, userID),
+	}, nil
+}
+
+func (s *memoryStorage) findTransaction(transactionID string) (memoryTransaction, bool) {
+	for _, t := range s.data.transactions {
+		if t.publicID == transactionID {
+			return t, true
+		}
+	}
+	return memoryTransaction{}, false
+}
+
+func (s *memoryStorage) GetTransactions(ctx context.Context, filter TransactionFilter) (
+	transactions []*models.SingleTransaction, err error) {
+	defer s.lock()()
+
+	var matched []memoryTransaction
+	for _, t := range s.data.transactions {
+		if s.matchTransaction(t, filter) {
+			matched = append(matched, t)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if !matched[i].createAt.Equal(matched[j].createAt) {
+			return matched[i].createAt.After(matched[j].createAt)
+		}
+		return matched[i].id > matched[j].id
+	})
+	if len(matched) > filter.Limit {
+		matched = matched[:filter.Limit]
+	}
+
+	for _, t := range matched {
+		transactions = append(transactions, &models.SingleTransaction{
+			ID:          t.publicID,
+			Seq:         t.id,
+			CreateAt:    t.createAt,
+			FromAddress: s.data.wallets[t.fromWalletID].Address,
+			ToAddress:   s.data.wallets[t.toWalletID].Address,
+			Sum:         t.amount,
+			Commission:  t.commission,
+			Date:        t.createAt.Format(dateLayout),
+			Success:     t.success,
+			Direction:   transactionDirection(t, filter.UserID),
+		})
+	}
+	return
+}
+
+// matchTransaction does what the conditions of buildTransactionFilter do in postgres
+func (s *memoryStorage) matchTransaction(t memoryTransaction, filter TransactionFilter) bool {
+	if t.senderID != filter.UserID && t.recipientID != filter.UserID {
+		return false
+	}
+	if filter.After != nil && !(t.createAt.Before(filter.After.CreateAt) ||
+		t.createAt.Equal(filter.After.CreateAt) && t.id < filter.After.ID) {
+		return false
+	}
+	if filter.DateFrom != nil && t.createAt.Before(*filter.DateFrom) {
+		return false
+	}
+	if filter.DateTo != nil && !t.createAt.Before(*filter.DateTo) {
+		return false
+	}
+
+	from, to := s.data.wallets[t.fromWalletID], s.data.wallets[t.toWalletID]
+	if filter.Currency != "" && s.data.currencies[from.CurrencyID].Name != filter.Currency &&
+		s.data.currencies[to.CurrencyID].Name != filter.Currency {
+		return false
+	}
+	if filter.Address != "" && from.Address != filter.Address && to.Address != filter.Address {
+		return false
+	}
+	if filter.Direction != "" && transactionDirection(t, filter.UserID) != filter.Direction {
+		return false
+	}
+	if filter.Success != nil && t.success != *filter.Success {
+		return false
+	}
+	if filter.MinAmount != nil && t.amount.LessThan(*filter.MinAmount) {
+		return false
+	}
+	if filter.MaxAmount != nil && t.amount.GreaterThan(*filter.MaxAmount) {
+		return false
+	}
+	return true
+}
+
+func transactionDirection(t memoryTransaction, userID int32) string {
+	switch {
+	case t.senderID == t.recipientID:
+		return models.DirectionInternal
+	case t.senderID == userID:
+		return models.DirectionOutgoing
+	default:
+		return models.DirectionIncoming
+	}
+}
+
+func (s *memoryStorage) GrantBalance(ctx context.Context, walletID int32, amount decimal.Decimal) (err error) {
+	defer s.lock()()
+
+	wallet, ok := s.data.wallets[walletID]
+	if !ok {
+		return errForeignKey("ledger_entries_addresses_id_fk")
+	}
+	journalID, err := uuid.NewV4()
+	if err != nil {
+		return
+	}
+	return s.post(journalID.String(), []memoryEntry{
+		{kind: EntryGrant, walletID: wallet.ID, currencyID: wallet.CurrencyID, amount: amount},
+		{kind: EntryGrant, houseAccount: HouseIssuance, currencyID: wallet.CurrencyID, amount: amount.Neg()},
+	})
+}
+
+func (s *memoryStorage) GetHouseAccounts(ctx context.Context) (accounts []HouseAccount, err error) {
+	defer s.lock()()
+
+	for id, balance := range s.data.houseAccounts {
+		accounts = append(accounts, HouseAccount{CurrencyID: id.currencyID, Kind: id.kind, Balance: balance})
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		if accounts[i].CurrencyID != accounts[j].CurrencyID {
+			return accounts[i].CurrencyID < accounts[j].CurrencyID
+		}
+		return accounts[i].Kind < accounts[j].Kind
+	})
+	return
+}
+
+func (s *memoryStorage) GetLedgerTotals(ctx context.Context) (totals []LedgerTotals, err error) {
+	defer s.lock()()
+
+	byCurrency := make(map[int32]*LedgerTotals, len(s.data.currencies))
+	for id := range s.data.currencies {
+		byCurrency[id] = &LedgerTotals{CurrencyID: id}
+	}
+	for _, wallet := range s.data.wallets {
+		if t, ok := byCurrency[wallet.CurrencyID]; ok {
+			t.Wallets = t.Wallets.Add(wallet.Balance)
+		}
+	}
+	for id, balance := range s.data.houseAccounts {
+		if t, ok := byCurrency[id.currencyID]; ok && id.kind != HouseIssuance {
+			t.House = t.House.Add(balance)
+		}
+	}
+	for _, entry := range s.data.entries {
+		t, ok := byCurrency[entry.currencyID]
+		if !ok || entry.houseAccount != HouseIssuance {
+			continue
+		}
+		if entry.amount.IsNegative() {
+			t.Minted = t.Minted.Sub(entry.amount)
+		} else {
+			t.Burned = t.Burned.Add(entry.amount)
+		}
+	}
+
+	for _, t := range byCurrency {
+		totals = append(totals, *t)
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		return totals[i].CurrencyID < totals[j].CurrencyID
+	})
+	return
+}
+
+func (s *memoryStorage) GetBalanceMismatches(ctx context.Context) (mismatches []BalanceMismatch, err error) {
+	defer s.lock()()
+
+	wallets := make(map[int32]decimal.Decimal)
+	houseAccounts := make(map[houseAccountID]decimal.Decimal)
+	for _, entry := range s.data.entries {
+		if entry.houseAccount != "" {
+			id := houseAccountID{currencyID: entry.currencyID, kind: entry.houseAccount}
+			houseAccounts[id] = houseAccounts[id].Add(entry.amount)
+			continue
+		}
+		wallets[entry.walletID] = wallets[entry.walletID].Add(entry.amount)
+	}
+
+	for _, wallet := range s.sortedWallets() {
+		if !wallet.Balance.Equal(wallets[wallet.ID]) {
+			mismatches = append(mismatches, BalanceMismatch{
+				WalletID:   wallet.ID,
+				Address:    wallet.Address,
+				CurrencyID: wallet.CurrencyID,
+				Balance:    wallet.Balance,
+				Entries:    wallets[wallet.ID],
+			})
+		}
+	}
+	for id, balance := range s.data.houseAccounts {
+		if !balance.Equal(houseAccounts[id]) {
+			mismatches = append(mismatches, BalanceMismatch{
+				HouseAccount: id.kind,
+				CurrencyID:   id.currencyID,
+				Balance:      balance,
+				Entries:      houseAccounts[id],
+			})
+		}
+	}
+	return
+}
+
+func (s *memoryStorage) GetUnbalancedJournals(ctx context.Context) (journals []UnbalancedJournal, err error) {
+	defer s.lock()()
+
+	type journalCurrency struct {
+		journalID  string
+		currencyID int32
+	}
+	sums := make(map[journalCurrency]decimal.Decimal)
+	for _, entry := range s.data.entries {
+		id := journalCurrency{journalID: entry.journalID, currencyID: entry.currencyID}
+		sums[id] = sums[id].Add(entry.amount)
+	}
+
+	for id, sum := range sums {
+		if !sum.IsZero() {
+			journals = append(journals, UnbalancedJournal{JournalID: id.journalID, CurrencyID: id.currencyID, Sum: sum})
+		}
+	}
+	sort.Slice(journals, func(i, j int) bool {
+		if journals[i].JournalID != journals[j].JournalID {
+			return journals[i].JournalID < journals[j].JournalID
+		}
+		return journals[i].CurrencyID < journals[j].CurrencyID
+	})
+	return
+}
+
+func (s *memoryStorage) GetTransferMismatches(ctx context.Context) (mismatches []TransferMismatch, err error) {
+	defer s.lock()()
+
+	byJournal := make(map[string]*TransferMismatch)
+	strangers := make(map[string]bool)
+	for _, entry := range s.data.entries {
+		if entry.kind != EntryTransfer {
+			continue
+		}
+		m, ok := byJournal[entry.journalID]
+		if !ok {
+			m = &TransferMismatch{JournalID: entry.journalID}
+			byJournal[entry.journalID] = m
+		}
+		if entry.amount.IsNegative() {
+			m.LedgerDebited = m.LedgerDebited.Sub(entry.amount)
+		} else {
+			m.LedgerCredited = m.LedgerCredited.Add(entry.amount)
+		}
+
+		t, ok := s.findTransaction(entry.journalID)
+		if !ok || entry.walletID != t.fromWalletID && entry.walletID != t.toWalletID {
+			strangers[entry.journalID] = true
+		}
+	}
+
+	for journalID, m := range byJournal {
+		if t, ok := s.findTransaction(journalID); ok && t.success {
+			m.Debited, m.Credited = t.debited, t.credited
+		}
+		if strangers[journalID] || !m.Debited.Equal(m.LedgerDebited) || !m.Credited.Equal(m.LedgerCredited) {
+			mismatches = append(mismatches, *m)
+		}
+	}
+	sort.Slice(mismatches, func(i, j int) bool {
+		return mismatches[i].JournalID < mismatches[j].JournalID
+	})
+	return
+}
+
+// post saves the journal and applies it to the balances, as the triggers of ledger_entries do in postgres
+func (s *memoryStorage) post(journalID string, entries []memoryEntry) error {
+	sums := make(map[int32]decimal.Decimal)
+	for _, entry := range entries {
+		sums[entry.currencyID] = sums[entry.currencyID].Add(entry.amount)
+	}
+	for _, sum := range sums {
+		if !sum.IsZero() {
+			return fmt.Errorf("journal %s is not balanced", journalID)
+		}
+	}
+
+	now := time.Now()
+	for _, entry := range entries {
+		entry.journalID = journalID
+		entry.createdAt = now
+		s.data.entries = append(s.data.entries, entry)
+		if entry.houseAccount != "" {
+			id := houseAccountID{currencyID: entry.currencyID, kind: entry.houseAccount}
+			s.data.houseAccounts[id] = s.data.houseAccounts[id].Add(entry.amount)
+			continue
+		}
+		wallet := s.data.wallets[entry.walletID]
+		wallet.Balance = wallet.Balance.Add(entry.amount)
+		s.data.wallets[wallet.ID] = wallet
+	}
+	return nil
+}
+
+func (s *memoryStorage) ReserveIdempotencyKey(ctx context.Context, userID int32, key string, fingerprint string) (
+	reserved bool, err error) {
+	defer s.lock()()
+
+	id := idempotencyID{userID: userID, key: key}
+	if _, ok := s.data.idempotencyKey[id]; ok {
+		return false, nil
+	}
+	s.data.idempotencyKey[id] = memoryIdempotencyKey{fingerprint: fingerprint}
+	return true, nil
+}
+
+func (s *memoryStorage) GetIdempotencyKey(ctx context.Context, userID int32, key string) (
+	fingerprint string, transactionID string, success bool, err error) {
+	defer s.lock()()
+
+	stored, ok := s.data.idempotencyKey[idempotencyID{userID: userID, key: key}]
+	if !ok {
+		return "", "", false, ErrNotFound
+	}
+	return stored.fingerprint, stored.transactionID, stored.success, nil
+}
+
+func (s *memoryStorage) SaveIdempotentResult(ctx context.Context, userID int32, key string, transactionID string,
+	success bool) (err error) {
+	defer s.lock()()
+
+	id := idempotencyID{userID: userID, key: key}
+	if stored, ok := s.data.idempotencyKey[id]; ok {
+		stored.transactionID = transactionID
+		stored.success = success
+		s.data.idempotencyKey[id] = stored
+	}
+	return
+}
+
+func (s *memoryStorage) sortedWallets() []Wallet {
+	wallets := make([]Wallet, 0, len(s.data.wallets))
+	for _, wallet := range s.data.wallets {
+		wallets = append(wallets, wallet)
+	}
+	sort.Slice(wallets, func(i, j int) bool {
+		return wallets[i].ID < wallets[j].ID
+	})
+	return wallets
+}
+
+// errDuplicate mimics the violation of the unique index
+func errDuplicate(index string) error {
+	return fmt.Errorf("duplicate key value violates unique constraint %q", index)
+}
+
+// errForeignKey mimics the violation of the foreign key
+func errForeignKey(constraint string) error {
+	return fmt.Errorf("violates foreign key constraint %q", constraint)
+}
+
+// ceilScale rounds the value up to the given number of decimals, as ceil_scale in postgres
+func ceilScale(x decimal.Decimal, scale int32) decimal.Decimal {
+	t := x.Truncate(scale)
+	if t.LessThan(x) {
+		t = t.Add(decimal.New(1, -scale))
+	}
+	return t
+}
+
+// NewMemoryStorage creates the storage keeping the data in the process memory, suitable for tests.
+// The currencies are the ones the migrations create, they are quoted at the prices of the initial migration.
+func NewMemoryStorage() Storage {
+	now := time.Now()
+	return &memoryStorage{
+		mu: new(sync.Mutex),
+		data: &memoryData{
+			users:          make(map[int32]User),
+			usersByEmail:   make(map[string]int32),
+			profiles:       make(map[int32]memoryProfile),
+			refreshTokens:  make(map[string]memoryRefreshToken),
+			passwordResets: make(map[string]memoryPasswordReset),
+			verifications:  make(map[string]memoryEmailVerification),
+			mfaSecrets:     make(map[int32]MFASecret),
+			mfaChallenges:  make(map[string]memoryMFAChallenge),
+			wallets:        make(map[int32]Wallet),
+			walletsByAddr:  make(map[string]int32),
+			lastCurrencyID: 2,
+			currencies: map[int32]Currency{
+				1: {ID: 1, Name: "BTC", DisplayName: "Bitcoin", Scale: 8, AddressFormat: "base58check", Enabled: true},
+				2: {ID: 2, Name: "ETH", DisplayName: "Ethereum", Scale: 18, AddressFormat: "base58check", Enabled: true},
+			},
+			quotes: []Quote{
+				{CurrencyID: 1, Price: decimal.RequireFromString("32853.856"), Source: "salary", QuotedAt: now},
+				{CurrencyID: 2, Price: decimal.RequireFromString("2022.65"), Source: "salary", QuotedAt: now},
+			},
+			overrides:      make(map[int32]memoryOverride),
+			houseAccounts:  make(map[houseAccountID]decimal.Decimal),
+			idempotencyKey: make(map[idempotencyID]memoryIdempotencyKey),
+		},
+	}
+}
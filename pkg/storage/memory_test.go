@@ -0,0 +1,947 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/crypto_app/pkg/models"
+	"github.com/gofrs/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// newTestWallets creates the user with a wallet in every currency holding 100 and returns the wallets
+func newTestWallets(t *testing.T, s Storage, email string) (btcWallet Wallet, ethWallet Wallet) {
+	t.Helper()
+	ctx := context.Background()
+
+	userID, err := s.CreateUser(ctx, User{Name: "Ivan", LastName: "Petrov", Email: email, PassHash: "hash"})
+	require.NoError(t, err)
+
+	btcWallet = Wallet{UserID: userID, CurrencyID: 1, Address: email + "/BTC", Balance: decimal.NewFromInt(100)}
+	btcWallet.ID, err = s.CreateWallet(ctx, btcWallet)
+	require.NoError(t, err)
+	require.NoError(t, s.GrantBalance(ctx, btcWallet.ID, btcWallet.Balance))
+	ethWallet = Wallet{UserID: userID, CurrencyID: 2, Address: email + "/ETH", Balance: decimal.NewFromInt(100)}
+	ethWallet.ID, err = s.CreateWallet(ctx, ethWallet)
+	require.NoError(t, err)
+	require.NoError(t, s.GrantBalance(ctx, ethWallet.ID, ethWallet.Balance))
+	return
+}
+
+func balanceOf(t *testing.T, s Storage, wallet Wallet) decimal.Decimal {
+	t.Helper()
+	stored, err := s.GetWalletByAddress(context.Background(), wallet.Address)
+	require.NoError(t, err)
+	return stored.Balance
+}
+
+func TestMemoryUsers(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage()
+
+	userID, err := s.CreateUser(ctx, User{ID: 100, Name: "Ivan", Email: "ivan@example.com"})
+	require.NoError(t, err)
+	// the id of the input is ignored
+	require.Equal(t, int32(1), userID)
+
+	_, err = s.CreateUser(ctx, User{Email: "ivan@example.com"})
+	require.Error(t, err)
+
+	for _, c := range []struct {
+		email  string
+		exists bool
+	}{
+		{"ivan@example.com", true},
+		{"petr@example.com", false},
+	} {
+		exists, err := s.EmailExists(ctx, c.email)
+		require.NoError(t, err)
+		require.Equal(t, c.exists, exists, c.email)
+
+		user, err := s.GetUserByEmail(ctx, c.email)
+		if !c.exists {
+			require.Equal(t, ErrNotFound, err, c.email)
+			continue
+		}
+		require.NoError(t, err)
+		require.Equal(t, userID, user.ID)
+	}
+}
+
+func TestMemoryRefreshTokens(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage()
+
+	require.NoError(t, s.SaveRefreshToken(ctx, "used", 1, "family", time.Hour))
+	require.NoError(t, s.SaveRefreshToken(ctx, "family", 1, "family", time.Hour))
+	require.NoError(t, s.SaveRefreshToken(ctx, "expired", 1, "other", -time.Second))
+	require.NoError(t, s.SaveRefreshToken(ctx, "other user", 2, "third", time.Hour))
+	require.Error(t, s.SaveRefreshToken(ctx, "used", 1, "family", time.Hour))
+
+	require.NoError(t, s.MarkRefreshTokenUsed(ctx, "used"))
+	require.NoError(t, s.RevokeUserRefreshTokens(ctx, 3))
+
+	for _, c := range []struct {
+		hash     string
+		expected RefreshToken
+	}{
+		{"used", RefreshToken{UserID: 1, FamilyID: "family", Spent: true}},
+		{"family", RefreshToken{UserID: 1, FamilyID: "family"}},
+		{"expired", RefreshToken{UserID: 1, FamilyID: "other", Expired: true}},
+		{"other user", RefreshToken{UserID: 2, FamilyID: "third"}},
+	} {
+		token, err := s.GetRefreshToken(ctx, c.hash)
+		require.NoError(t, err, c.hash)
+		require.Equal(t, c.expected, token, c.hash)
+	}
+	_, err := s.GetRefreshToken(ctx, "unknown")
+	require.Equal(t, ErrNotFound, err)
+
+	// the family is revoked together, the revoke of the user spares other users
+	require.NoError(t, s.RevokeRefreshTokenFamily(ctx, "family"))
+	token, err := s.GetRefreshToken(ctx, "family")
+	require.NoError(t, err)
+	require.True(t, token.Spent)
+
+	require.NoError(t, s.RevokeUserRefreshTokens(ctx, 1))
+	for _, c := range []struct {
+		hash  string
+		spent bool
+	}{
+		{"expired", true},
+		{"other user", false},
+	} {
+		token, err = s.GetRefreshToken(ctx, c.hash)
+		require.NoError(t, err)
+		require.Equal(t, c.spent, token.Spent, c.hash)
+	}
+}
+
+func TestMemoryProfile(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage()
+	str := func(s string) *string { return &s }
+
+	userID, err := s.CreateUser(ctx, User{Name: "Ivan", LastName: "Petrov", Email: "alice@localhost", PassHash: "hash"})
+	require.NoError(t, err)
+	_, err = s.GetProfile(ctx, userID+1)
+	require.Equal(t, ErrNotFound, err)
+
+	for _, c := range []struct {
+		name    string
+		input   models.UpdateUserData
+		dob     string
+		touched bool
+	}{
+		{"same name", models.UpdateUserData{Name: str("Ivan")}, "", false},
+		{"dob", models.UpdateUserData{DOB: str("1990-05-17")}, "1990-05-17", true},
+		{"same dob", models.UpdateUserData{DOB: str("1990-05-17"), Address: str("")}, "1990-05-17", false},
+		{"cleared dob", models.UpdateUserData{DOB: str("")}, "", true},
+	} {
+		before, err := s.GetProfile(ctx, userID)
+		require.NoError(t, err, c.name)
+
+		c.input.ID = int(userID)
+		require.NoError(t, s.UpdateProfile(ctx, c.input), c.name)
+		after, err := s.GetProfile(ctx, userID)
+		require.NoError(t, err, c.name)
+
+		// updated_at moves only with the actual change
+		require.Equal(t, c.touched, before.UpdatedAt != after.UpdatedAt, c.name)
+		if c.dob == "" {
+			require.False(t, after.DOB.Valid, c.name)
+		} else {
+			require.Equal(t, c.dob, after.DOB.Time.Format("2006-01-02"), c.name)
+		}
+	}
+
+	require.NoError(t, s.UpdateProfile(ctx, models.UpdateUserData{ID: int(userID), LastName: str("Petrova"),
+		Address: str("Moscow"), Description: str("hodler")}))
+	profile, err := s.GetProfile(ctx, userID)
+	require.NoError(t, err)
+	require.Equal(t, "Ivan", profile.Name)
+	require.Equal(t, "Petrova", profile.LastName)
+	require.Equal(t, "alice@localhost", profile.Email)
+	require.Equal(t, "Moscow", profile.Address)
+	require.Equal(t, "hodler", profile.Description)
+	require.True(t, profile.CreateAt.Valid)
+}
+
+func TestMemoryPasswordResets(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage()
+
+	userID, err := s.CreateUser(ctx, User{Name: "Ivan", LastName: "Petrov", Email: "alice@localhost", PassHash: "old"})
+	require.NoError(t, err)
+	require.NoError(t, s.UpdatePassHash(ctx, userID, "new"))
+	user, err := s.GetUser(ctx, userID)
+	require.NoError(t, err)
+	require.Equal(t, "new", user.PassHash)
+
+	require.NoError(t, s.SavePasswordResetToken(ctx, "first", 1, time.Hour))
+	require.NoError(t, s.SavePasswordResetToken(ctx, "second", 1, time.Hour))
+	require.NoError(t, s.SavePasswordResetToken(ctx, "expired", 1, -time.Second))
+	require.NoError(t, s.SavePasswordResetToken(ctx, "other user", 2, time.Hour))
+	require.Error(t, s.SavePasswordResetToken(ctx, "first", 1, time.Hour))
+
+	_, err = s.GetPasswordResetToken(ctx, "unknown")
+	require.Equal(t, ErrNotFound, err)
+
+	// every token of the user is spent at once, the tokens of other users are kept
+	require.NoError(t, s.SpendPasswordResetTokens(ctx, 1))
+	for _, c := range []struct {
+		hash     string
+		expected PasswordResetToken
+	}{
+		{"first", PasswordResetToken{UserID: 1, Spent: true}},
+		{"second", PasswordResetToken{UserID: 1, Spent: true}},
+		{"expired", PasswordResetToken{UserID: 1, Spent: true, Expired: true}},
+		{"other user", PasswordResetToken{UserID: 2}},
+	} {
+		token, err := s.GetPasswordResetToken(ctx, c.hash)
+		require.NoError(t, err, c.hash)
+		require.Equal(t, c.expected, token, c.hash)
+	}
+}
+
+func TestMemoryEmailVerifications(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage()
+
+	// the new user starts unverified
+	userID, err := s.CreateUser(ctx, User{Name: "Ivan", LastName: "Petrov", Email: "alice@localhost", PassHash: "hash"})
+	require.NoError(t, err)
+	user, err := s.GetUser(ctx, userID)
+	require.NoError(t, err)
+	require.False(t, user.EmailVerified)
+	require.NoError(t, s.MarkEmailVerified(ctx, userID))
+	user, err = s.GetUserByEmail(ctx, "alice@localhost")
+	require.NoError(t, err)
+	require.True(t, user.EmailVerified)
+
+	require.NoError(t, s.SaveEmailVerificationToken(ctx, "first", 1, time.Hour))
+	require.NoError(t, s.SaveEmailVerificationToken(ctx, "second", 1, time.Hour))
+	require.NoError(t, s.SaveEmailVerificationToken(ctx, "expired", 1, -time.Second))
+	require.NoError(t, s.SaveEmailVerificationToken(ctx, "other user", 2, time.Hour))
+	require.Error(t, s.SaveEmailVerificationToken(ctx, "first", 1, time.Hour))
+
+	_, err = s.GetEmailVerificationToken(ctx, "unknown")
+	require.Equal(t, ErrNotFound, err)
+
+	require.NoError(t, s.SpendEmailVerificationTokens(ctx, 1))
+	for _, c := range []struct {
+		hash     string
+		expected EmailVerificationToken
+	}{
+		{"first", EmailVerificationToken{UserID: 1, Spent: true}},
+		{"second", EmailVerificationToken{UserID: 1, Spent: true}},
+		{"expired", EmailVerificationToken{UserID: 1, Spent: true, Expired: true}},
+		{"other user", EmailVerificationToken{UserID: 2}},
+	} {
+		token, err := s.GetEmailVerificationToken(ctx, c.hash)
+		require.NoError(t, err, c.hash)
+		require.Equal(t, c.expected, token, c.hash)
+	}
+}
+
+func TestMemoryMFA(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage()
+
+	_, err := s.GetMFASecret(ctx, 1)
+	require.Equal(t, ErrNotFound, err)
+
+	require.NoError(t, s.SaveMFASecret(ctx, 1, "first"))
+	require.NoError(t, s.EnableMFA(ctx, 1, 10, []string{"a", "b"}))
+	require.NoError(t, s.SetMFACounter(ctx, 1, 11))
+	secret, err := s.GetMFASecret(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, MFASecret{UserID: 1, Secret: "first", Enabled: true, LastCounter: 11}, secret)
+
+	// the replaced secret waits for the confirmation again
+	require.NoError(t, s.SaveMFASecret(ctx, 1, "second"))
+	secret, err = s.GetMFASecret(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, MFASecret{UserID: 1, Secret: "second"}, secret)
+
+	require.NoError(t, s.SaveMFASecret(ctx, 2, "other"))
+	require.NoError(t, s.EnableMFA(ctx, 2, 0, []string{"a"}))
+
+	for _, c := range []struct {
+		name   string
+		userID int32
+		hash   string
+		used   bool
+	}{
+		{"code of the user", 1, "a", true},
+		{"used code", 1, "a", false},
+		{"unknown code", 1, "c", false},
+		{"same code of other user", 2, "a", true},
+	} {
+		used, err := s.UseRecoveryCode(ctx, c.userID, c.hash)
+		require.NoError(t, err, c.name)
+		require.Equal(t, c.used, used, c.name)
+	}
+
+	// enabling again replaces the recovery codes, disabling drops them with the secret
+	require.NoError(t, s.EnableMFA(ctx, 1, 0, []string{"c"}))
+	used, err := s.UseRecoveryCode(ctx, 1, "b")
+	require.NoError(t, err)
+	require.False(t, used)
+	require.NoError(t, s.DisableMFA(ctx, 1))
+	_, err = s.GetMFASecret(ctx, 1)
+	require.Equal(t, ErrNotFound, err)
+	used, err = s.UseRecoveryCode(ctx, 1, "c")
+	require.NoError(t, err)
+	require.False(t, used)
+	_, err = s.GetMFASecret(ctx, 2)
+	require.NoError(t, err)
+}
+
+func TestMemoryMFAChallenges(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage()
+
+	require.NoError(t, s.SaveMFAChallenge(ctx, "failed", 1, time.Hour))
+	require.NoError(t, s.SaveMFAChallenge(ctx, "spent", 1, time.Hour))
+	require.NoError(t, s.SaveMFAChallenge(ctx, "expired", 2, -time.Second))
+	require.Error(t, s.SaveMFAChallenge(ctx, "spent", 1, time.Hour))
+
+	require.NoError(t, s.FailMFAChallenge(ctx, "failed"))
+	require.NoError(t, s.FailMFAChallenge(ctx, "failed"))
+	require.NoError(t, s.SpendMFAChallenge(ctx, "spent"))
+
+	for _, c := range []struct {
+		hash     string
+		expected MFAChallenge
+	}{
+		{"failed", MFAChallenge{UserID: 1, Attempts: 2}},
+		{"spent", MFAChallenge{UserID: 1, Spent: true}},
+		{"expired", MFAChallenge{UserID: 2, Expired: true}},
+	} {
+		challenge, err := s.GetMFAChallenge(ctx, c.hash)
+		require.NoError(t, err, c.hash)
+		require.Equal(t, c.expected, challenge, c.hash)
+	}
+	_, err := s.GetMFAChallenge(ctx, "unknown")
+	require.Equal(t, ErrNotFound, err)
+}
+
+func TestMemoryCreateWallet(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage()
+	btcWallet, ethWallet := newTestWallets(t, s, "ivan@example.com")
+
+	for _, c := range []struct {
+		name   string
+		wallet Wallet
+	}{
+		{"unknown user", Wallet{UserID: 100, CurrencyID: 1, Address: "new"}},
+		{"unknown currency", Wallet{UserID: btcWallet.UserID, CurrencyID: 100, Address: "new"}},
+	} {
+		_, err := s.CreateWallet(ctx, c.wallet)
+		require.Error(t, err, c.name)
+	}
+	_, err := s.CreateWallet(ctx, Wallet{UserID: btcWallet.UserID, CurrencyID: 2, Address: btcWallet.Address})
+	require.Equal(t, ErrAddressTaken, err)
+
+	wallets, err := s.GetWallets(ctx, btcWallet.UserID)
+	require.NoError(t, err)
+	require.Len(t, wallets, 2)
+	require.Equal(t, "BTC", wallets[0].Salary)
+	require.Equal(t, btcWallet.Address, wallets[0].Address)
+	require.Equal(t, "ETH", wallets[1].Salary)
+
+	// the missing wallets are skipped
+	found, err := s.GetWalletsByIDs(ctx, []int32{ethWallet.ID, 100, btcWallet.ID})
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	require.Equal(t, []string{ethWallet.Address, btcWallet.Address}, []string{found[0].Address, found[1].Address})
+}
+
+func TestMemoryMakeTransaction(t *testing.T) {
+	ctx := context.Background()
+	commission := decimal.RequireFromString("0.01")
+	btcRate, ethRate := decimal.RequireFromString("32853.856"), decimal.RequireFromString("2022.65")
+
+	for _, c := range []struct {
+		name    string
+		amount  string
+		toETH   bool
+		success bool
+		debit   string
+		credit  string
+		needed  string
+		failure string
+	}{
+		// 10$ at 32853.856 with 1% commission, the debit is rounded up and the credit down to 8 decimals
+		{"same currency", "10", false, true, "0.00030746", "0.00030437", "0.00030746", ""},
+		// the credit in ETH at 2022.65 keeps 18 decimals
+		{"other currency", "10", true, true, "0.00030746", "0.004944009096976738", "0.00030746", ""},
+		{"insufficient funds", "99999999", false, false, "0", "0", "3074.52799453", FailureInsufficientFunds},
+	} {
+		s := NewMemoryStorage()
+		from, _ := newTestWallets(t, s, "ivan@example.com")
+		toBTC, toETH := newTestWallets(t, s, "petr@example.com")
+		to := toBTC
+		if c.toETH {
+			to = toETH
+		}
+
+		toRate := btcRate
+		if c.toETH {
+			toRate = ethRate
+		}
+		success, err := s.MakeTransaction(ctx, "transaction", from.ID, to.ID, decimal.RequireFromString(c.amount),
+			commission, btcRate, toRate)
+		require.NoError(t, err, c.name)
+		require.Equal(t, c.success, success, c.name)
+
+		// the amounts the transfer needed are recorded even when it fails
+		detail, err := s.GetTransaction(ctx, from.UserID, "transaction")
+		require.NoError(t, err, c.name)
+		require.Equal(t, c.success, detail.Success, c.name)
+		require.Equal(t, c.failure, detail.FailureReason, c.name)
+		require.Equal(t, c.needed, detail.Debited.Decimal.String(), c.name)
+		_, err = s.GetTransaction(ctx, 100, "transaction")
+		require.Equal(t, ErrNotFound, err, c.name)
+
+		require.Equal(t, decimal.NewFromInt(100).Sub(decimal.RequireFromString(c.debit)).String(),
+			balanceOf(t, s, from).String(), c.name)
+		require.Equal(t, decimal.NewFromInt(100).Add(decimal.RequireFromString(c.credit)).String(),
+			balanceOf(t, s, to).String(), c.name)
+
+		// the attempt is recorded for both sides even when it fails
+		for _, userID := range []int32{from.UserID, to.UserID} {
+			transactions, err := s.GetTransactions(ctx, TransactionFilter{UserID: userID, Limit: 10})
+			require.NoError(t, err, c.name)
+			require.Len(t, transactions, 1, c.name)
+			require.Equal(t, c.success, transactions[0].Success, c.name)
+		}
+	}
+}
+
+func TestMemoryInTx(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage()
+	from, _ := newTestWallets(t, s, "ivan@example.com")
+	to, _ := newTestWallets(t, s, "petr@example.com")
+
+	move := func(tx Storage) error {
+		transactionID, err := uuid.NewV4()
+		if err != nil {
+			return err
+		}
+		_, err = tx.MakeTransaction(ctx, transactionID.String(), from.ID, to.ID, decimal.NewFromInt(10), decimal.Zero,
+			decimal.NewFromInt(1), decimal.NewFromInt(1))
+		return err
+	}
+
+	for _, c := range []struct {
+		name    string
+		fn      func(tx Storage) error
+		isErr   bool
+		applied bool
+	}{
+		{"committed", move, false, true},
+		{"rolled back", func(tx Storage) error {
+			require.NoError(t, move(tx))
+			return errors.New("abort")
+		}, true, false},
+		// the nested InTx runs in the same transaction, so its changes are rolled back with the outer one
+		{"nested rolled back", func(tx Storage) error {
+			require.NoError(t, tx.InTx(ctx, move))
+			return errors.New("abort")
+		}, true, false},
+	} {
+		before := balanceOf(t, s, from)
+		err := s.InTx(ctx, c.fn)
+		if c.isErr {
+			require.Error(t, err, c.name)
+		} else {
+			require.NoError(t, err, c.name)
+		}
+		require.Equal(t, c.applied, !balanceOf(t, s, from).Equal(before), c.name)
+	}
+}
+
+func TestMemoryIdempotency(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage()
+
+	reserved, err := s.ReserveIdempotencyKey(ctx, 1, "key", "fingerprint")
+	require.NoError(t, err)
+	require.True(t, reserved)
+	reserved, err = s.ReserveIdempotencyKey(ctx, 1, "key", "other")
+	require.NoError(t, err)
+	require.False(t, reserved)
+	require.NoError(t, s.SaveIdempotentResult(ctx, 1, "key", "transaction", true))
+
+	fingerprint, transactionID, success, err := s.GetIdempotencyKey(ctx, 1, "key")
+	require.NoError(t, err)
+	require.Equal(t, "fingerprint", fingerprint)
+	require.Equal(t, "transaction", transactionID)
+	require.True(t, success)
+
+	_, _, _, err = s.GetIdempotencyKey(ctx, 2, "key")
+	require.Equal(t, ErrNotFound, err)
+}
+
+func TestMemoryGetTransactionsFilter(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage()
+	ivanBTC, ivanETH := newTestWallets(t, s, "ivan@example.com")
+	petrBTC, _ := newTestWallets(t, s, "petr@example.com")
+
+	start := time.Now()
+	for _, transfer := range []struct {
+		from   Wallet
+		to     Wallet
+		amount int64
+	}{
+		{ivanBTC, petrBTC, 1},
+		{ivanBTC, ivanETH, 2},
+		{petrBTC, ivanBTC, 3},
+		{ivanBTC, petrBTC, 99999999},
+	} {
+		transactionID, err := uuid.NewV4()
+		require.NoError(t, err)
+		_, err = s.MakeTransaction(ctx, transactionID.String(), transfer.from.ID, transfer.to.ID,
+			decimal.NewFromInt(transfer.amount), decimal.Zero, decimal.NewFromInt(1), decimal.NewFromInt(1))
+		require.NoError(t, err)
+	}
+
+	failed, two, three := false, decimal.NewFromInt(2), decimal.NewFromInt(3)
+	for _, c := range []struct {
+		name   string
+		filter TransactionFilter
+		sums   []string
+	}{
+		{"all, the latest first", TransactionFilter{}, []string{"99999999", "3", "2", "1"}},
+		{"limit", TransactionFilter{Limit: 2}, []string{"99999999", "3"}},
+		{"currency", TransactionFilter{Currency: "ETH"}, []string{"2"}},
+		{"address", TransactionFilter{Address: ivanETH.Address}, []string{"2"}},
+		{"internal", TransactionFilter{Direction: "internal"}, []string{"2"}},
+		{"outgoing", TransactionFilter{Direction: "outgoing"}, []string{"99999999", "1"}},
+		{"incoming", TransactionFilter{Direction: "incoming"}, []string{"3"}},
+		{"failed", TransactionFilter{Success: &failed}, []string{"99999999"}},
+		{"amount range", TransactionFilter{MinAmount: &two, MaxAmount: &three}, []string{"3", "2"}},
+		{"date from", TransactionFilter{DateFrom: &start}, []string{"99999999", "3", "2", "1"}},
+		{"date to", TransactionFilter{DateTo: &start}, nil},
+	} {
+		c.filter.UserID = ivanBTC.UserID
+		if c.filter.Limit == 0 {
+			c.filter.Limit = 10
+		}
+		transactions, err := s.GetTransactions(ctx, c.filter)
+		require.NoError(t, err, c.name)
+
+		var sums []string
+		for _, transaction := range transactions {
+			sums = append(sums, transaction.Sum.String())
+		}
+		require.Equal(t, c.sums, sums, c.name)
+	}
+
+	// the page after the transaction continues where the previous one stopped
+	page, err := s.GetTransactions(ctx, TransactionFilter{UserID: ivanBTC.UserID, Limit: 2})
+	require.NoError(t, err)
+	last := page[len(page)-1]
+	page, err = s.GetTransactions(ctx, TransactionFilter{UserID: ivanBTC.UserID, Limit: 10,
+		After: &TransactionKey{CreateAt: last.CreateAt, ID: last.Seq}})
+	require.NoError(t, err)
+	require.Len(t, page, 2)
+	require.Equal(t, "2", page[0].Sum.String())
+}
+
+func TestMemoryUserIsAdmin(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage()
+
+	userID, err := s.CreateUser(ctx, User{Email: "admin@example.com", IsAdmin: true})
+	require.NoError(t, err)
+	user, err := s.GetUser(ctx, userID)
+	require.NoError(t, err)
+	require.True(t, user.IsAdmin)
+
+	_, err = s.GetUser(ctx, 100)
+	require.Equal(t, ErrNotFound, err)
+}
+
+func TestMemoryQuotes(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage()
+	now := time.Now()
+
+	currencies, err := s.GetCurrencies(ctx)
+	require.NoError(t, err)
+	require.Len(t, currencies, 2)
+	require.Equal(t, "BTC", currencies[0].Name)
+	require.Equal(t, "ETH", currencies[1].Name)
+	_, err = s.GetCurrencyByName(ctx, "DOGE")
+	require.Equal(t, ErrNotFound, err)
+
+	require.Error(t, s.SaveQuotes(ctx, []Quote{{CurrencyID: 100, Price: decimal.NewFromInt(1), Source: "http"}}))
+	require.NoError(t, s.SaveQuotes(ctx, []Quote{
+		{CurrencyID: 1, Price: decimal.NewFromInt(41000), Source: "http", QuotedAt: now.Add(time.Minute)},
+		{CurrencyID: 1, Price: decimal.NewFromInt(40000), Source: "http", QuotedAt: now.Add(-time.Minute)},
+	}))
+
+	expired := now.Add(-time.Second)
+	for _, c := range []struct {
+		name     string
+		change   func() error
+		price    string
+		source   string
+		notFound bool
+	}{
+		{"latest of the feed", func() error { return nil }, "41000", "http", false},
+		{"override", func() error {
+			return s.SetOverride(ctx, Override{CurrencyID: 1, Price: decimal.NewFromInt(50000)})
+		}, "50000", SourceManual, false},
+		{"expired override", func() error {
+			return s.SetOverride(ctx, Override{CurrencyID: 1, Price: decimal.NewFromInt(60000), ExpiresAt: &expired})
+		}, "41000", "http", false},
+		{"deleted override", func() error {
+			return s.DeleteOverride(ctx, 1)
+		}, "41000", "http", false},
+		{"deleted twice", func() error {
+			return s.DeleteOverride(ctx, 1)
+		}, "", "", true},
+	} {
+		err := c.change()
+		if c.notFound {
+			require.Equal(t, ErrNotFound, err, c.name)
+			continue
+		}
+		require.NoError(t, err, c.name)
+
+		quote, err := s.GetLatestQuote(ctx, 1)
+		require.NoError(t, err, c.name)
+		require.Equal(t, c.price, quote.Price.String(), c.name)
+		require.Equal(t, c.source, quote.Source, c.name)
+	}
+
+	_, err = s.GetLatestQuote(ctx, 100)
+	require.Equal(t, ErrNotFound, err)
+}
+
+func TestMemorySaveQuotes(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage()
+	quotedAt := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	quote := func(currencyID int32, price int64, source string, quotedAt time.Time) Quote {
+		return Quote{CurrencyID: currencyID, Price: decimal.NewFromInt(price), Source: source, QuotedAt: quotedAt}
+	}
+	saved := func() (prices []string) {
+		for _, q := range s.(*memoryStorage).data.quotes {
+			if q.QuotedAt.Equal(quotedAt) || q.QuotedAt.Equal(quotedAt.Add(time.Minute)) {
+				prices = append(prices, fmt.Sprintf("%d %s %s", q.CurrencyID, q.Source, q.Price))
+			}
+		}
+		return
+	}
+
+	for _, c := range []struct {
+		name   string
+		quotes []Quote
+		isErr  bool
+		saved  []string
+	}{
+		{"new quotes", []Quote{quote(1, 40000, "http", quotedAt), quote(2, 2500, "http", quotedAt)}, false,
+			[]string{"1 http 40000", "2 http 2500"}},
+		// the feed repeats the quote until it has a newer one, the first price is kept
+		{"same quote again", []Quote{quote(1, 40001, "http", quotedAt)}, false,
+			[]string{"1 http 40000", "2 http 2500"}},
+		{"repeated in the batch", []Quote{quote(1, 41000, "http", quotedAt.Add(time.Minute)),
+			quote(1, 41001, "http", quotedAt.Add(time.Minute))}, false,
+			[]string{"1 http 40000", "2 http 2500", "1 http 41000"}},
+		{"same moment of another source", []Quote{quote(1, 40500, "file", quotedAt)}, false,
+			[]string{"1 http 40000", "2 http 2500", "1 http 41000", "1 file 40500"}},
+		// none of the batch is saved when a quote of it fails
+		{"unknown currency", []Quote{quote(2, 2600, "file", quotedAt), quote(100, 1, "file", quotedAt)}, true,
+			[]string{"1 http 40000", "2 http 2500", "1 http 41000", "1 file 40500"}},
+	} {
+		err := s.SaveQuotes(ctx, c.quotes)
+		if c.isErr {
+			require.Error(t, err, c.name)
+		} else {
+			require.NoError(t, err, c.name)
+		}
+		require.Equal(t, c.saved, saved(), c.name)
+	}
+}
+
+func TestMemoryCandles(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage()
+	at := func(minute, second int) time.Time {
+		return time.Date(2021, 6, 1, 12, minute, second, 0, time.UTC)
+	}
+	quote := func(currencyID int32, price int64, quotedAt time.Time) Quote {
+		return Quote{CurrencyID: currencyID, Price: decimal.NewFromInt(price), Source: "http", QuotedAt: quotedAt}
+	}
+	// saved out of order, the candles follow the time of the quotes
+	require.NoError(t, s.SaveQuotes(ctx, []Quote{
+		quote(1, 90, at(0, 50)),
+		quote(1, 100, at(0, 10)),
+		quote(1, 120, at(0, 30)),
+		quote(1, 95, at(1, 20)),
+		quote(1, 110, at(3, 0)),
+		quote(2, 2000, at(0, 20)),
+	}))
+
+	for _, c := range []struct {
+		name    string
+		filter  CandleFilter
+		candles []string
+	}{
+		// time open high low close quotes, the end of the range is excluded
+		{"minutes", CandleFilter{CurrencyID: 1, Interval: time.Minute, From: at(0, 0), To: at(3, 0)},
+			[]string{"12:00 100 120 90 90 3", "12:01 95 95 95 95 1"}},
+		{"hour", CandleFilter{CurrencyID: 1, Interval: time.Hour, From: at(0, 0), To: at(59, 0)},
+			[]string{"12:00 100 120 90 110 5"}},
+		{"other currency", CandleFilter{CurrencyID: 2, Interval: time.Minute, From: at(0, 0), To: at(3, 0)},
+			[]string{"12:00 2000 2000 2000 2000 1"}},
+		{"no quotes", CandleFilter{CurrencyID: 1, Interval: time.Minute, From: at(10, 0), To: at(20, 0)}, nil},
+	} {
+		candles, err := s.GetCandles(ctx, c.filter)
+		require.NoError(t, err, c.name)
+
+		var got []string
+		for _, candle := range candles {
+			got = append(got, fmt.Sprintf("%s %s %s %s %s %d", candle.Time.Format("15:04"), candle.Open,
+				candle.High, candle.Low, candle.Close, candle.Quotes))
+		}
+		require.Equal(t, c.candles, got, c.name)
+	}
+}
+
+func TestMemoryCurrencies(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage()
+
+	currencies, err := s.GetCurrencies(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []Currency{
+		{ID: 1, Name: "BTC", DisplayName: "Bitcoin", Scale: 8, AddressFormat: "base58check", Enabled: true},
+		{ID: 2, Name: "ETH", DisplayName: "Ethereum", Scale: 18, AddressFormat: "base58check", Enabled: true},
+	}, currencies)
+
+	usdt := Currency{Name: "USDT", DisplayName: "Tether", Scale: 6, AddressFormat: "numeric", Enabled: true}
+	usdt.ID, err = s.CreateCurrency(ctx, usdt)
+	require.NoError(t, err)
+	require.Equal(t, int32(3), usdt.ID)
+	_, err = s.CreateCurrency(ctx, usdt)
+	require.Error(t, err)
+
+	// the name and the scale are kept
+	update := usdt
+	update.Name, update.Scale = "USDC", 2
+	update.DisplayName, update.Enabled = "Tether USD", false
+	require.NoError(t, s.UpdateCurrency(ctx, update))
+	found, err := s.GetCurrencyByName(ctx, "USDT")
+	require.NoError(t, err)
+	require.Equal(t, Currency{ID: 3, Name: "USDT", DisplayName: "Tether USD", Scale: 6, AddressFormat: "numeric"},
+		found)
+
+	require.Equal(t, ErrNotFound, s.UpdateCurrency(ctx, Currency{ID: 100}))
+}
+
+func TestMemoryArchiveWallet(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage()
+	btcWallet, _ := newTestWallets(t, s, "alice@example.com")
+	empty := Wallet{UserID: btcWallet.UserID, CurrencyID: 1, Address: "alice@example.com/BTC/2", Label: "savings"}
+	var err error
+	empty.ID, err = s.CreateWallet(ctx, empty)
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		name     string
+		walletID int32
+		archived bool
+	}{
+		{"wallet with money", btcWallet.ID, false},
+		{"empty wallet", empty.ID, true},
+		{"archived wallet", empty.ID, false},
+		{"unknown wallet", 100, false},
+	} {
+		archived, err := s.ArchiveWallet(ctx, c.walletID)
+		require.NoError(t, err, c.name)
+		require.Equal(t, c.archived, archived, c.name)
+	}
+
+	wallet, err := s.GetWalletByAddress(ctx, empty.Address)
+	require.NoError(t, err)
+	require.NotNil(t, wallet.ArchivedAt)
+	require.Equal(t, "savings", wallet.Label)
+	require.False(t, wallet.CreatedAt.IsZero())
+
+	wallets, err := s.GetWallets(ctx, btcWallet.UserID)
+	require.NoError(t, err)
+	require.Len(t, wallets, 3)
+	require.Equal(t, []bool{false, false, true}, []bool{wallets[0].Archived, wallets[1].Archived, wallets[2].Archived})
+}
+
+func TestMemoryLedger(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage()
+	btcRate, ethRate := decimal.RequireFromString("32853.856"), decimal.RequireFromString("2022.65")
+	aliceBTC, aliceETH := newTestWallets(t, s, "alice@example.com")
+	bobBTC, _ := newTestWallets(t, s, "bob@example.com")
+
+	require.Error(t, s.GrantBalance(ctx, 100, decimal.NewFromInt(1)))
+
+	// the money of the wallets and the house accounts sums to zero in every currency, whatever is moved
+	requireBalanced := func(name string) map[string]string {
+		t.Helper()
+		sums := map[int32]decimal.Decimal{}
+		for _, wallet := range s.(*memoryStorage).data.wallets {
+			sums[wallet.CurrencyID] = sums[wallet.CurrencyID].Add(wallet.Balance)
+		}
+		accounts, err := s.GetHouseAccounts(ctx)
+		require.NoError(t, err, name)
+		house := map[string]string{}
+		for _, account := range accounts {
+			sums[account.CurrencyID] = sums[account.CurrencyID].Add(account.Balance)
+			house[fmt.Sprintf("%d/%s", account.CurrencyID, account.Kind)] = account.Balance.String()
+		}
+		for currencyID, sum := range sums {
+			require.True(t, sum.IsZero(), "%s: currency %d sums to %s", name, currencyID, sum)
+		}
+		return house
+	}
+
+	for _, c := range []struct {
+		name     string
+		from, to Wallet
+		amount   int64
+		house    map[string]string
+	}{
+		{"same currency", aliceBTC, bobBTC, 10, map[string]string{
+			"1/issuance": "-200", "1/revenue": "0.00000309", "2/issuance": "-200",
+		}},
+		// the exchange takes the bitcoins and pays the ethers
+		{"another currency", aliceBTC, aliceETH, 10, map[string]string{
+			"1/issuance": "-200", "1/revenue": "0.00000618", "1/exchange": "0.00030437", "2/issuance": "-200",
+			"2/exchange": "-0.004944009096976738",
+		}},
+		// the failed transfer moves nothing
+		{"insufficient funds", aliceBTC, bobBTC, 99999999, map[string]string{
+			"1/issuance": "-200", "1/revenue": "0.00000618", "1/exchange": "0.00030437", "2/issuance": "-200",
+			"2/exchange": "-0.004944009096976738",
+		}},
+	} {
+		toRate := btcRate
+		if c.to.CurrencyID == 2 {
+			toRate = ethRate
+		}
+		_, err := s.MakeTransaction(ctx, uuid.Must(uuid.NewV4()).String(), c.from.ID, c.to.ID,
+			decimal.NewFromInt(c.amount), decimal.RequireFromString("0.01"), btcRate, toRate)
+		require.NoError(t, err, c.name)
+
+		house := requireBalanced(c.name)
+		require.Len(t, house, len(c.house), "%s: %v", c.name, house)
+		for account, balance := range c.house {
+			require.True(t, decimal.RequireFromString(balance).Equal(decimal.RequireFromString(house[account])),
+				"%s: %s is %s", c.name, account, house[account])
+		}
+	}
+
+	// the journal that does not sum to zero is refused as a whole
+	before := balanceOf(t, s, aliceBTC)
+	err := s.(*memoryStorage).post("unbalanced", []memoryEntry{
+		{kind: EntryGrant, walletID: aliceBTC.ID, currencyID: 1, amount: decimal.NewFromInt(1)},
+	})
+	require.Error(t, err)
+	require.True(t, before.Equal(balanceOf(t, s, aliceBTC)))
+	requireBalanced("unbalanced journal")
+}
+
+func TestMemoryReconcileQueries(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage()
+	data := s.(*memoryStorage).data
+	btcRate := decimal.RequireFromString("32853.856")
+	aliceBTC, _ := newTestWallets(t, s, "alice@example.com")
+	bobBTC, _ := newTestWallets(t, s, "bob@example.com")
+	const transactionID = "00000000-0000-0000-0000-000000000001"
+	_, err := s.MakeTransaction(ctx, transactionID, aliceBTC.ID, bobBTC.ID, decimal.NewFromInt(10),
+		decimal.RequireFromString("0.01"), btcRate, btcRate)
+	require.NoError(t, err)
+
+	totals, err := s.GetLedgerTotals(ctx)
+	require.NoError(t, err)
+	require.Len(t, totals, 2)
+	require.Equal(t, int32(1), totals[0].CurrencyID)
+	require.True(t, totals[0].Minted.Equal(decimal.NewFromInt(200)))
+	require.True(t, totals[0].Burned.IsZero())
+	require.True(t, totals[0].Wallets.Add(totals[0].House).Equal(totals[0].Minted))
+
+	for _, c := range []struct {
+		name   string
+		tamper func()
+		check  func() (int, error)
+	}{
+		{"balance of the wallet", func() {
+			wallet := data.wallets[aliceBTC.ID]
+			wallet.Balance = wallet.Balance.Add(decimal.NewFromInt(1))
+			data.wallets[aliceBTC.ID] = wallet
+		}, func() (found int, err error) {
+			mismatches, err := s.GetBalanceMismatches(ctx)
+			for _, m := range mismatches {
+				if m.WalletID == aliceBTC.ID && m.Entries.Add(decimal.NewFromInt(1)).Equal(m.Balance) {
+					found++
+				}
+			}
+			return
+		}},
+		{"balance of the house account", func() {
+			id := houseAccountID{currencyID: 1, kind: HouseRevenue}
+			data.houseAccounts[id] = data.houseAccounts[id].Add(decimal.NewFromInt(1))
+		}, func() (found int, err error) {
+			mismatches, err := s.GetBalanceMismatches(ctx)
+			for _, m := range mismatches {
+				if m.HouseAccount == HouseRevenue && m.CurrencyID == 1 {
+					found++
+				}
+			}
+			return
+		}},
+		{"unbalanced journal", func() {
+			data.entries = append(data.entries, memoryEntry{journalID: "unbalanced", kind: EntryGrant,
+				walletID: bobBTC.ID, currencyID: 1, amount: decimal.NewFromInt(1)})
+		}, func() (int, error) {
+			journals, err := s.GetUnbalancedJournals(ctx)
+			if len(journals) == 1 && journals[0].JournalID != "unbalanced" {
+				return 0, fmt.Errorf("journal %s", journals[0].JournalID)
+			}
+			return len(journals), err
+		}},
+		{"amount of the transfer", func() {
+			for i := range data.transactions {
+				data.transactions[i].debited = data.transactions[i].debited.Add(decimal.NewFromInt(1))
+			}
+		}, func() (int, error) {
+			mismatches, err := s.GetTransferMismatches(ctx)
+			if len(mismatches) == 1 && mismatches[0].JournalID != transactionID {
+				return 0, fmt.Errorf("journal %s", mismatches[0].JournalID)
+			}
+			return len(mismatches), err
+		}},
+	} {
+		// nothing is found before the data is broken, the breakages of the cases before are kept
+		found, err := c.check()
+		require.NoError(t, err, c.name)
+		require.Zero(t, found, c.name)
+
+		c.tamper()
+		found, err = c.check()
+		require.NoError(t, err, c.name)
+		require.Equal(t, 1, found, c.name)
+	}
+}
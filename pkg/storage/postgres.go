@@ -0,0 +1,907 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/crypto_app/pkg/models"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
+	"github.com/lib/pq"
+	"github.com/shopspring/decimal"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the queries run on every request are prepared on each connection of the pool, see CachedStatements
+const (
+	queryToGetWallets = `select a.id, address, name, balance, label, a.created_at, archived_at is not null
+		from addresses as a
+    	left join salary s on a.salary_id = s.id
+	where user_id = $1 order by a.id;`
+	queryToMakeTransaction = `select make_transfer($1,$2,$3,$4,$5,$6,$7)`
+	// queryToGetLatestQuote the active override wins over the quotes of the feed, the overrides saved
+	// to the history are skipped, so the deleted override is not used anymore
+	queryToGetLatestQuote = `
+		select currency_id, price, source, quoted_at from (
+			select currency_id, price, $2::varchar as source, created_at as quoted_at, 0 as priority from rate_overrides
+				where currency_id = $1 and (expires_at is null or expires_at > current_timestamp)
+			union all
+			(select currency_id, price, source, quoted_at, 1 as priority from rate_history
+				where currency_id = $1 and source <> $2 order by quoted_at desc limit 1)
+		) as q order by priority limit 1;`
+)
+
+// CachedStatements the statements to prepare on every new connection
+var CachedStatements = []string{queryToGetWallets, queryToMakeTransaction, queryToGetLatestQuote}
+
+// queryExecutor is satisfied both by *pgx.ConnPool and *pgx.Tx
+type queryExecutor interface {
+	QueryEx(ctx context.Context, sql string, options *pgx.QueryExOptions, args ...interface{}) (*pgx.Rows, error)
+	QueryRowEx(ctx context.Context, sql string, options *pgx.QueryExOptions, args ...interface{}) *pgx.Row
+	ExecEx(ctx context.Context, sql string, options *pgx.QueryExOptions, arguments ...interface{}) (pgx.CommandTag, error)
+}
+
+type postgresStorage struct {
+	pool *pgx.ConnPool
+	db   queryExecutor
+	// inTx the storage is bound to the transaction
+	inTx bool
+}
+
+func (s *postgresStorage) InTx(ctx context.Context, fn func(tx Storage) error) (err error) {
+	if s.inTx {
+		return fn(s)
+	}
+
+	tx, err := s.pool.BeginEx(ctx, nil)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			if er := tx.Rollback(); er != nil {
+				log.Printf("error while rolling up the transaction: %v", er)
+			}
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	err = fn(&postgresStorage{
+		pool: s.pool,
+		db:   tx,
+		inTx: true,
+	})
+	return
+}
+
+func (s *postgresStorage) Stats() (stats models.PoolStatsResponse) {
+	stat := s.pool.Stat()
+	stats.MaxConnections = stat.MaxConnections
+	stats.CurrentConnections = stat.CurrentConnections
+	stats.AvailableConnections = stat.AvailableConnections
+	return
+}
+
+func (s *postgresStorage) EmailExists(ctx context.Context, email string) (exists bool, err error) {
+	const query = `select exists(select * from user_data where email = $1);`
+
+	err = s.db.QueryRowEx(ctx, query, nil, email).Scan(&exists)
+	return
+}
+
+func (s *postgresStorage) CreateUser(ctx context.Context, user User) (userID int32, err error) {
+	const query = `insert  into user_data (name, last_name, email, pass_hash) values
+			($1, $2, $3, $4) returning id`
+
+	err = s.db.QueryRowEx(ctx, query, nil, user.Name, user.LastName, user.Email, user.PassHash).Scan(&userID)
+	return
+}
+
+func (s *postgresStorage) GetUserByEmail(ctx context.Context, email string) (user User, err error) {
+	const query = `select id, name, last_name, email, pass_hash, is_admin, email_verified_at is not null
+			from user_data where email = $1;`
+
+	err = s.db.QueryRowEx(ctx, query, nil, email).Scan(&user.ID, &user.Name, &user.LastName, &user.Email,
+		&user.PassHash, &user.IsAdmin, &user.EmailVerified)
+	err = notFound(err)
+	return
+}
+
+func (s *postgresStorage) GetUser(ctx context.Context, userID int32) (user User, err error) {
+	const query = `select id, name, last_name, email, pass_hash, is_admin, email_verified_at is not null
+			from user_data where id = $1;`
+
+	err = s.db.QueryRowEx(ctx, query, nil, userID).Scan(&user.ID, &user.Name, &user.LastName, &user.Email,
+		&user.PassHash, &user.IsAdmin, &user.EmailVerified)
+	err = notFound(err)
+	return
+}
+
+func (s *postgresStorage) UpdatePassHash(ctx context.Context, userID int32, passHash string) (err error) {
+	const query = `update user_data set pass_hash = $2 where id = $1;`
+
+	_, err = s.db.ExecEx(ctx, query, nil, userID, passHash)
+	return
+}
+
+func (s *postgresStorage) MarkEmailVerified(ctx context.Context, userID int32) (err error) {
+	const query = `update user_data set email_verified_at = current_timestamp
+			where id = $1 and email_verified_at is null;`
+
+	_, err = s.db.ExecEx(ctx, query, nil, userID)
+	return
+}
+
+func (s *postgresStorage) GetProfile(ctx context.Context, userID int32) (
+	profile models.SingleUserDataDbResponse, err error) {
+	const query = `select id, name, last_name, email, email_verified_at is not null, dob, address, description,
+			created_at, updated_at
+		from user_data where id = $1;`
+
+	var dob, createdAt, updatedAt *time.Time
+	err = s.db.QueryRowEx(ctx, query, nil, userID).Scan(&profile.ID, &profile.Name, &profile.LastName,
+		&profile.Email, &profile.EmailVerified, &dob, &profile.Address, &profile.Description, &createdAt, &updatedAt)
+	if err = notFound(err); err != nil {
+		return
+	}
+	profile.DOB = nullTime(dob)
+	profile.CreateAt = nullTime(createdAt)
+	profile.UpdatedAt = nullTime(updatedAt)
+	return
+}
+
+func (s *postgresStorage) UpdateProfile(ctx context.Context, input models.UpdateUserData) (err error) {
+	// updated_at is set by the trigger when anything changes
+	const query = `update user_data set
+			name = coalesce($2, name),
+			last_name = coalesce($3, last_name),
+			dob = case when $4::varchar is null then dob else cast(nullif($4::varchar, '') as date) end,
+			address = coalesce($5, address),
+			description = coalesce($6, description)
+		where id = $1;`
+
+	_, err = s.db.ExecEx(ctx, query, nil, input.ID, input.Name, input.LastName, input.DOB, input.Address,
+		input.Description)
+	return
+}
+
+func (s *postgresStorage) SaveRefreshToken(ctx context.Context, tokenHash string, userID int32, familyID string,
+	ttl time.Duration) (err error) {
+	const query = `insert into refresh_tokens (user_id, family_id, token_hash, expires_at) values
+			($1, $2, $3, current_timestamp + make_interval(secs => $4));`
+
+	_, err = s.db.ExecEx(ctx, query, nil, userID, familyID, tokenHash, ttl.Seconds())
+	return
+}
+
+func (s *postgresStorage) GetRefreshToken(ctx context.Context, tokenHash string) (token RefreshToken, err error) {
+	const query = `select user_id, family_id, used_at is not null or revoked, expires_at < current_timestamp
+			from refresh_tokens where token_hash = $1 for update;`
+
+	err = s.db.QueryRowEx(ctx, query, nil, tokenHash).Scan(&token.UserID, &token.FamilyID, &token.Spent,
+		&token.Expired)
+	err = notFound(err)
+	return
+}
+
+func (s *postgresStorage) MarkRefreshTokenUsed(ctx context.Context, tokenHash string) (err error) {
+	const query = `update refresh_tokens set used_at = current_timestamp where token_hash = $1;`
+
+	_, err = s.db.ExecEx(ctx, query, nil, tokenHash)
+	return
+}
+
+func (s *postgresStorage) RevokeRefreshTokenFamily(ctx context.Context, familyID string) (err error) {
+	const query = `update refresh_tokens set revoked = true where family_id = $1;`
+
+	_, err = s.db.ExecEx(ctx, query, nil, familyID)
+	return
+}
+
+func (s *postgresStorage) RevokeUserRefreshTokens(ctx context.Context, userID int32) (err error) {
+	const query = `update refresh_tokens set revoked = true where user_id = $1;`
+
+	_, err = s.db.ExecEx(ctx, query, nil, userID)
+	return
+}
+
+func (s *postgresStorage) SavePasswordResetToken(ctx context.Context, tokenHash string, userID int32,
+	ttl time.Duration) (err error) {
+	const query = `insert into password_resets (user_id, token_hash, expires_at) values
+			($1, $2, current_timestamp + make_interval(secs => $3));`
+
+	_, err = s.db.ExecEx(ctx, query, nil, userID, tokenHash, ttl.Seconds())
+	return
+}
+
+func (s *postgresStorage) GetPasswordResetToken(ctx context.Context, tokenHash string) (
+	token PasswordResetToken, err error) {
+	const query = `select user_id, used_at is not null, expires_at < current_timestamp
+			from password_resets where token_hash = $1 for update;`
+
+	err = s.db.QueryRowEx(ctx, query, nil, tokenHash).Scan(&token.UserID, &token.Spent, &token.Expired)
+	err = notFound(err)
+	return
+}
+
+func (s *postgresStorage) SpendPasswordResetTokens(ctx context.Context, userID int32) (err error) {
+	const query = `update password_resets set used_at = current_timestamp where user_id = $1 and used_at is null;`
+
+	_, err = s.db.ExecEx(ctx, query, nil, userID)
+	return
+}
+
+func (s *postgresStorage) SaveEmailVerificationToken(ctx context.Context, tokenHash string, userID int32,
+	ttl time.Duration) (err error) {
+	const query = `insert into email_verifications (user_id, token_hash, expires_at) values
+			($1, $2, current_timestamp + make_interval(secs => $3));`
+
+	_, err = s.db.ExecEx(ctx, query, nil, userID, tokenHash, ttl.Seconds())
+	return
+}
+
+func (s *postgresStorage) GetEmailVerificationToken(ctx context.Context, tokenHash string) (
+	token EmailVerificationToken, err error) {
+	const query = `select user_id, used_at is not null, expires_at < current_timestamp
+			from email_verifications where token_hash = $1 for update;`
+
+	err = s.db.QueryRowEx(ctx, query, nil, tokenHash).Scan(&token.UserID, &token.Spent, &token.Expired)
+	err = notFound(err)
+	return
+}
+
+func (s *postgresStorage) SpendEmailVerificationTokens(ctx context.Context, userID int32) (err error) {
+	const query = `update email_verifications set used_at = current_timestamp
+			where user_id = $1 and used_at is null;`
+
+	_, err = s.db.ExecEx(ctx, query, nil, userID)
+	return
+}
+
+func (s *postgresStorage) SaveMFASecret(ctx context.Context, userID int32, secret string) (err error) {
+	const query = `insert into user_mfa (user_id, secret) values ($1, $2)
+		on conflict (user_id) do update set secret = excluded.secret, enabled_at = null, last_counter = 0,
+			create_at = current_timestamp;`
+
+	_, err = s.db.ExecEx(ctx, query, nil, userID, secret)
+	return
+}
+
+func (s *postgresStorage) GetMFASecret(ctx context.Context, userID int32) (secret MFASecret, err error) {
+	const query = `select user_id, secret, enabled_at is not null, last_counter from user_mfa
+			where user_id = $1 for update;`
+
+	err = s.db.QueryRowEx(ctx, query, nil, userID).Scan(&secret.UserID, &secret.Secret, &secret.Enabled,
+		&secret.LastCounter)
+	err = notFound(err)
+	return
+}
+
+func (s *postgresStorage) EnableMFA(ctx context.Context, userID int32, counter int64,
+	recoveryCodeHashes []string) (err error) {
+	const (
+		queryEnable = `update user_mfa set enabled_at = current_timestamp, last_counter = $2 where user_id = $1;`
+		queryDelete = `delete from mfa_recovery_codes where user_id = $1;`
+		queryInsert = `insert into mfa_recovery_codes (user_id, code_hash) select $1, unnest($2::varchar[]);`
+	)
+
+	if _, err = s.db.ExecEx(ctx, queryEnable, nil, userID, counter); err != nil {
+		return
+	}
+	if _, err = s.db.ExecEx(ctx, queryDelete, nil, userID); err != nil {
+		return
+	}
+	_, err = s.db.ExecEx(ctx, queryInsert, nil, userID, recoveryCodeHashes)
+	return
+}
+
+func (s *postgresStorage) SetMFACounter(ctx context.Context, userID int32, counter int64) (err error) {
+	const query = `update user_mfa set last_counter = $2 where user_id = $1;`
+
+	_, err = s.db.ExecEx(ctx, query, nil, userID, counter)
+	return
+}
+
+func (s *postgresStorage) DisableMFA(ctx context.Context, userID int32) (err error) {
+	const (
+		queryCodes  = `delete from mfa_recovery_codes where user_id = $1;`
+		querySecret = `delete from user_mfa where user_id = $1;`
+	)
+
+	if _, err = s.db.ExecEx(ctx, queryCodes, nil, userID); err != nil {
+		return
+	}
+	_, err = s.db.ExecEx(ctx, querySecret, nil, userID)
+	return
+}
+
+func (s *postgresStorage) UseRecoveryCode(ctx context.Context, userID int32, codeHash string) (used bool, err error) {
+	const query = `update mfa_recovery_codes set used_at = current_timestamp
+			where user_id = $1 and code_hash = $2 and used_at is null;`
+
+	tag, err := s.db.ExecEx(ctx, query, nil, userID, codeHash)
+	used = err == nil && tag.RowsAffected() > 0
+	return
+}
+
+func (s *postgresStorage) SaveMFAChallenge(ctx context.Context, tokenHash string, userID int32,
+	ttl time.Duration) (err error) {
+	const query = `insert into mfa_challenges (user_id, token_hash, expires_at) values
+			($1, $2, current_timestamp + make_interval(secs => $3));`
+
+	_, err = s.db.ExecEx(ctx, query, nil, userID, tokenHash, ttl.Seconds())
+	return
+}
+
+func (s *postgresStorage) GetMFAChallenge(ctx context.Context, tokenHash string) (challenge MFAChallenge, err error) {
+	const query = `select user_id, used_at is not null, expires_at < current_timestamp, attempts
+			from mfa_challenges where token_hash = $1 for update;`
+
+	err = s.db.QueryRowEx(ctx, query, nil, tokenHash).Scan(&challenge.UserID, &challenge.Spent, &challenge.Expired,
+		&challenge.Attempts)
+	err = notFound(err)
+	return
+}
+
+func (s *postgresStorage) FailMFAChallenge(ctx context.Context, tokenHash string) (err error) {
+	const query = `update mfa_challenges set attempts = attempts + 1 where token_hash = $1;`
+
+	_, err = s.db.ExecEx(ctx, query, nil, tokenHash)
+	return
+}
+
+func (s *postgresStorage) SpendMFAChallenge(ctx context.Context, tokenHash string) (err error) {
+	const query = `update mfa_challenges set used_at = current_timestamp where token_hash = $1;`
+
+	_, err = s.db.ExecEx(ctx, query, nil, tokenHash)
+	return
+}
+
+func (s *postgresStorage) CreateWallet(ctx context.Context, wallet Wallet) (walletID int32, err error) {
+	// the conflict does not abort the transaction unlike the violation of the index
+	const query = `insert into addresses (address, user_id, salary_id, balance, label) values ($1,$2,$3,0,$4)
+		on conflict (address) do nothing returning id;`
+
+	err = s.db.QueryRowEx(ctx, query, nil, wallet.Address, wallet.UserID, wallet.CurrencyID,
+		wallet.Label).Scan(&walletID)
+	if err == pgx.ErrNoRows {
+		err = ErrAddressTaken
+	}
+	return
+}
+
+func (s *postgresStorage) GetWallets(ctx context.Context, userID int32) (wallets []*models.WalletsResponse, err error) {
+	rows, err := s.db.QueryEx(ctx, queryToGetWallets, nil, userID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		local := new(models.WalletsResponse)
+		if err = rows.Scan(&local.ID, &local.Address, &local.Salary, &local.Balance, &local.Label, &local.CreatedAt,
+			&local.Archived); err != nil {
+			return
+		}
+		wallets = append(wallets, local)
+	}
+	err = rows.Err()
+	return
+}
+
+func (s *postgresStorage) GetWalletByAddress(ctx context.Context, address string) (wallet Wallet, err error) {
+	const query = `select id, user_id, salary_id, address, balance, label, created_at, archived_at
+		from addresses where address = $1;`
+
+	err = s.db.QueryRowEx(ctx, query, nil, address).Scan(&wallet.ID, &wallet.UserID, &wallet.CurrencyID,
+		&wallet.Address, &wallet.Balance, &wallet.Label, &wallet.CreatedAt, &wallet.ArchivedAt)
+	err = notFound(err)
+	return
+}
+
+func (s *postgresStorage) GetWalletsByIDs(ctx context.Context, walletIDs []int32) (wallets []Wallet, err error) {
+	// the wallets are locked in the order of the ids, as every transfer does, so two transfers never deadlock
+	const query = `select id, user_id, salary_id, address, balance, label, created_at, archived_at
+		from addresses where id = any($1) order by id for update;`
+
+	rows, err := s.db.QueryEx(ctx, query, nil, pq.Array(walletIDs))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var wallet Wallet
+		if err = rows.Scan(&wallet.ID, &wallet.UserID, &wallet.CurrencyID, &wallet.Address, &wallet.Balance,
+			&wallet.Label, &wallet.CreatedAt, &wallet.ArchivedAt); err != nil {
+			return
+		}
+		wallets = append(wallets, wallet)
+	}
+	err = rows.Err()
+	return
+}
+
+func (s *postgresStorage) ArchiveWallet(ctx context.Context, walletID int32) (archived bool, err error) {
+	const query = `update addresses set archived_at = current_timestamp
+		where id = $1 and balance = 0 and archived_at is null;`
+
+	tag, err := s.db.ExecEx(ctx, query, nil, walletID)
+	if err != nil {
+		return
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (s *postgresStorage) GetCurrencies(ctx context.Context) (currencies []Currency, err error) {
+	const query = `select id, name, display_name, scale, address_format, enabled from salary order by id;`
+
+	rows, err := s.db.QueryEx(ctx, query, nil)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var currency Currency
+		if err = rows.Scan(&currency.ID, &currency.Name, &currency.DisplayName, &currency.Scale,
+			&currency.AddressFormat, &currency.Enabled); err != nil {
+			return
+		}
+		currencies = append(currencies, currency)
+	}
+	err = rows.Err()
+	return
+}
+
+func (s *postgresStorage) GetCurrencyByName(ctx context.Context, name string) (currency Currency, err error) {
+	const query = `select id, name, display_name, scale, address_format, enabled from salary where name = $1;`
+
+	err = s.db.QueryRowEx(ctx, query, nil, name).Scan(&currency.ID, &currency.Name, &currency.DisplayName,
+		&currency.Scale, &currency.AddressFormat, &currency.Enabled)
+	err = notFound(err)
+	return
+}
+
+func (s *postgresStorage) CreateCurrency(ctx context.Context, currency Currency) (currencyID int32, err error) {
+	const query = `insert into salary (name, display_name, scale, address_format, enabled)
+		values ($1, $2, $3, $4, $5) returning id;`
+
+	err = s.db.QueryRowEx(ctx, query, nil, currency.Name, currency.DisplayName, currency.Scale,
+		currency.AddressFormat, currency.Enabled).Scan(&currencyID)
+	return
+}
+
+func (s *postgresStorage) UpdateCurrency(ctx context.Context, currency Currency) (err error) {
+	const query = `update salary set display_name = $2, address_format = $3, enabled = $4 where id = $1;`
+
+	tag, err := s.db.ExecEx(ctx, query, nil, currency.ID, currency.DisplayName, currency.AddressFormat,
+		currency.Enabled)
+	if err == nil && tag.RowsAffected() == 0 {
+		err = ErrNotFound
+	}
+	return
+}
+
+// SaveQuotes saves all the quotes or none of them, the quote saved already is skipped
+func (s *postgresStorage) SaveQuotes(ctx context.Context, quotes []Quote) (err error) {
+	const query = `insert into rate_history (currency_id, price, source, quoted_at) values ($1, $2, $3, $4)
+		on conflict (currency_id, quoted_at, source) do nothing;`
+
+	return s.InTx(ctx, func(tx Storage) error {
+		db := tx.(*postgresStorage).db
+		for _, quote := range quotes {
+			if _, err := db.ExecEx(ctx, query, nil, quote.CurrencyID, quote.Price, quote.Source, quote.QuotedAt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *postgresStorage) GetLatestQuote(ctx context.Context, currencyID int32) (quote Quote, err error) {
+	err = s.db.QueryRowEx(ctx, queryToGetLatestQuote, nil, currencyID, SourceManual).Scan(&quote.CurrencyID,
+		&quote.Price, &quote.Source, &quote.QuotedAt)
+	err = notFound(err)
+	return
+}
+
+func (s *postgresStorage) SetOverride(ctx context.Context, override Override) (err error) {
+	const query = `
+		with o as (
+			insert into rate_overrides (currency_id, price, expires_at, created_by) values ($1, $2, $3, $4)
+			on conflict (currency_id) do update set price = excluded.price, expires_at = excluded.expires_at,
+				created_by = excluded.created_by, created_at = current_timestamp
+			returning currency_id, price
+		)
+		insert into rate_history (currency_id, price, source) select currency_id, price, $5 from o;`
+
+	_, err = s.db.ExecEx(ctx, query, nil, override.CurrencyID, override.Price, override.ExpiresAt,
+		override.CreatedBy, SourceManual)
+	return
+}
+
+func (s *postgresStorage) DeleteOverride(ctx context.Context, currencyID int32) (err error) {
+	const query = `delete from rate_overrides where currency_id = $1;`
+
+	tag, err := s.db.ExecEx(ctx, query, nil, currencyID)
+	if err == nil && tag.RowsAffected() == 0 {
+		err = ErrNotFound
+	}
+	return
+}
+
+func (s *postgresStorage) GetCandles(ctx context.Context, filter CandleFilter) (candles []Candle, err error) {
+	const query = `
+		select to_timestamp(extract(epoch from quoted_at)::bigint / $2::bigint * $2::bigint) as bucket,
+			(array_agg(price order by quoted_at, id))[1], max(price), min(price),
+			(array_agg(price order by quoted_at desc, id desc))[1], count(*)
+		from rate_history
+		where currency_id = $1 and quoted_at >= $3 and quoted_at < $4
+		group by bucket order by bucket;`
+
+	rows, err := s.db.QueryEx(ctx, query, nil, filter.CurrencyID, int64(filter.Interval/time.Second),
+		filter.From, filter.To)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var candle Candle
+		if err = rows.Scan(&candle.Time, &candle.Open, &candle.High, &candle.Low, &candle.Close,
+			&candle.Quotes); err != nil {
+			return
+		}
+		candles = append(candles, candle)
+	}
+	err = rows.Err()
+	return
+}
+
+func (s *postgresStorage) MakeTransaction(ctx context.Context, transactionID string, fromWalletID int32,
+	toWalletID int32, amount decimal.Decimal, commission decimal.Decimal, fromRate decimal.Decimal,
+	toRate decimal.Decimal) (success bool, err error) {
+	err = s.db.QueryRowEx(ctx, queryToMakeTransaction, nil, transactionID, fromWalletID, toWalletID, amount,
+		commission, fromRate, toRate).Scan(&success)
+	return
+}
+
+func (s *postgresStorage) GetTransaction(ctx context.Context, userID int32, transactionID string) (
+	transaction models.TransactionDetail, err error) {
+	const query = `
+		select t.public_id, a_from.address, a_to.address, s_from.name, s_to.name, t.amount_dollars,
+				t.debited, t.credited, t.fee, t.from_rate, t.to_rate, t.commission, cast(t.create_at as text),
+				t.successful, coalesce(t.failure_reason, ''),
+				case when t.sender_id = t.recipient_id then 'internal'
+					when t.sender_id = $1 then 'outgoing'
+					else 'incoming' end
+			from transactions as t
+		    left join addresses a_from on a_from.id = t.from_address
+		    left join addresses a_to on a_to.id = t.to_address
+		    left join salary s_from on s_from.id = a_from.salary_id
+		    left join salary s_to on s_to.id = a_to.salary_id
+		where t.public_id = $2 and (t.sender_id = $1 or t.recipient_id = $1);`
+
+	err = s.db.QueryRowEx(ctx, query, nil, userID, transactionID).Scan(
+		&transaction.ID,
+		&transaction.FromAddress,
+		&transaction.ToAddress,
+		&transaction.FromCurrency,
+		&transaction.ToCurrency,
+		&transaction.Amount,
+		&transaction.Debited,
+		&transaction.Credited,
+		&transaction.Fee,
+		&transaction.FromRate,
+		&transaction.ToRate,
+		&transaction.Commission,
+		&transaction.Date,
+		&transaction.Success,
+		&transaction.FailureReason,
+		&transaction.Direction)
+	err = notFound(err)
+	return
+}
+
+func (s *postgresStorage) GetTransactions(ctx context.Context, filter TransactionFilter) (
+	transactions []*models.SingleTransaction, err error) {
+	const query = `
+		select t.public_id, t.id, t.create_at, a_from.address as from_address, a_to.address as to_address,
+				amount_dollars as sum, commission, cast(t.create_at as text) as date, successful as success,
+				case when t.sender_id = t.recipient_id then 'internal'
+					when t.sender_id = $1 then 'outgoing'
+					else 'incoming' end as direction
+			from transactions as t
+		    left join addresses a_from on a_from.id = t.from_address
+		    left join addresses a_to on a_to.id = t.to_address
+		where (t.sender_id = $1 or t.recipient_id = $1)`
+
+	sql, args := buildTransactionFilter(query, filter)
+	rows, err := s.db.QueryEx(ctx, sql, nil, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		local := new(models.SingleTransaction)
+		err = rows.Scan(
+			&local.ID,
+			&local.Seq,
+			&local.CreateAt,
+			&local.FromAddress,
+			&local.ToAddress,
+			&local.Sum,
+			&local.Commission,
+			&local.Date,
+			&local.Success,
+			&local.Direction)
+		if err != nil {
+			return
+		}
+		transactions = append(transactions, local)
+	}
+	err = rows.Err()
+	return
+}
+
+// buildTransactionFilter appends the conditions of the filter to the query, $1 is the user id.
+// Only the set fields add conditions, so the planner sees the plain query without "or $n is null" branches.
+func buildTransactionFilter(query string, filter TransactionFilter) (string, []interface{}) {
+	var (
+		b    strings.Builder
+		args = []interface{}{filter.UserID}
+	)
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	b.WriteString(query)
+	if filter.After != nil {
+		// timestamp is stored without the time zone, the wall clock is compared as is
+		fmt.Fprintf(&b, " and (t.create_at, t.id) < (%s, %s)", arg(filter.After.CreateAt.UTC()), arg(filter.After.ID))
+	}
+	if filter.DateFrom != nil {
+		fmt.Fprintf(&b, " and t.create_at >= %s", arg(filter.DateFrom.UTC()))
+	}
+	if filter.DateTo != nil {
+		fmt.Fprintf(&b, " and t.create_at < %s", arg(filter.DateTo.UTC()))
+	}
+	if filter.Currency != "" {
+		fmt.Fprintf(&b, " and exists(select 1 from salary as s where s.name = %s and s.id in (a_from.salary_id, a_to.salary_id))",
+			arg(filter.Currency))
+	}
+	if filter.Address != "" {
+		p := arg(filter.Address)
+		fmt.Fprintf(&b, " and (a_from.address = %s or a_to.address = %s)", p, p)
+	}
+	switch filter.Direction {
+	case models.DirectionInternal:
+		b.WriteString(" and t.sender_id = t.recipient_id")
+	case models.DirectionOutgoing:
+		b.WriteString(" and t.sender_id = $1 and t.recipient_id <> $1")
+	case models.DirectionIncoming:
+		b.WriteString(" and t.recipient_id = $1 and t.sender_id <> $1")
+	}
+	if filter.Success != nil {
+		fmt.Fprintf(&b, " and t.successful = %s", arg(*filter.Success))
+	}
+	if filter.MinAmount != nil {
+		fmt.Fprintf(&b, " and t.amount_dollars >= %s", arg(*filter.MinAmount))
+	}
+	if filter.MaxAmount != nil {
+		fmt.Fprintf(&b, " and t.amount_dollars <= %s", arg(*filter.MaxAmount))
+	}
+	fmt.Fprintf(&b, " order by t.create_at desc, t.id desc limit %s", arg(int64(filter.Limit)))
+
+	return b.String(), args
+}
+
+func (s *postgresStorage) GrantBalance(ctx context.Context, walletID int32, amount decimal.Decimal) (err error) {
+	// both entries are saved by the single statement, the journal is checked to be balanced on commit
+	const query = `insert into ledger_entries (journal_id, kind, address_id, house_account_id, currency_id, amount)
+		select $1::uuid, $2::varchar, id, null, salary_id, $4::numeric from addresses where id = $3
+		union all
+		select $1::uuid, $2::varchar, null, house_account(salary_id, $5), salary_id, -$4::numeric
+			from addresses where id = $3;`
+
+	journalID, err := uuid.NewV4()
+	if err != nil {
+		return
+	}
+	_, err = s.db.ExecEx(ctx, query, nil, journalID.String(), EntryGrant, walletID, amount, HouseIssuance)
+	return
+}
+
+func (s *postgresStorage) GetHouseAccounts(ctx context.Context) (accounts []HouseAccount, err error) {
+	const query = `select currency_id, kind, balance from house_accounts order by currency_id, kind;`
+
+	rows, err := s.db.QueryEx(ctx, query, nil)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var account HouseAccount
+		if err = rows.Scan(&account.CurrencyID, &account.Kind, &account.Balance); err != nil {
+			return
+		}
+		accounts = append(accounts, account)
+	}
+	err = rows.Err()
+	return
+}
+
+func (s *postgresStorage) GetLedgerTotals(ctx context.Context) (totals []LedgerTotals, err error) {
+	const query = `select s.id,
+			coalesce((select sum(balance) from addresses where salary_id = s.id), 0),
+			coalesce((select sum(balance) from house_accounts where currency_id = s.id and kind <> $1), 0),
+			coalesce((select -sum(e.amount) from ledger_entries e join house_accounts h on h.id = e.house_account_id
+				where h.currency_id = s.id and h.kind = $1 and e.amount < 0), 0),
+			coalesce((select sum(e.amount) from ledger_entries e join house_accounts h on h.id = e.house_account_id
+				where h.currency_id = s.id and h.kind = $1 and e.amount > 0), 0)
+		from salary s order by s.id;`
+
+	rows, err := s.db.QueryEx(ctx, query, nil, HouseIssuance)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t LedgerTotals
+		if err = rows.Scan(&t.CurrencyID, &t.Wallets, &t.House, &t.Minted, &t.Burned); err != nil {
+			return
+		}
+		totals = append(totals, t)
+	}
+	err = rows.Err()
+	return
+}
+
+func (s *postgresStorage) GetBalanceMismatches(ctx context.Context) (mismatches []BalanceMismatch, err error) {
+	const query = `
+		select a.id, a.address, '', a.salary_id, a.balance, coalesce(sum(e.amount), 0) from addresses a
+			left join ledger_entries e on e.address_id = a.id
+		group by a.id having a.balance <> coalesce(sum(e.amount), 0)
+		union all
+		select 0, '', h.kind, h.currency_id, h.balance, coalesce(sum(e.amount), 0) from house_accounts h
+			left join ledger_entries e on e.house_account_id = h.id
+		group by h.id having h.balance <> coalesce(sum(e.amount), 0);`
+
+	rows, err := s.db.QueryEx(ctx, query, nil)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m BalanceMismatch
+		if err = rows.Scan(&m.WalletID, &m.Address, &m.HouseAccount, &m.CurrencyID, &m.Balance,
+			&m.Entries); err != nil {
+			return
+		}
+		mismatches = append(mismatches, m)
+	}
+	err = rows.Err()
+	return
+}
+
+func (s *postgresStorage) GetUnbalancedJournals(ctx context.Context) (journals []UnbalancedJournal, err error) {
+	const query = `select journal_id::text, currency_id, sum(amount) from ledger_entries
+		group by journal_id, currency_id having sum(amount) <> 0 order by journal_id, currency_id;`
+
+	rows, err := s.db.QueryEx(ctx, query, nil)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var j UnbalancedJournal
+		if err = rows.Scan(&j.JournalID, &j.CurrencyID, &j.Sum); err != nil {
+			return
+		}
+		journals = append(journals, j)
+	}
+	err = rows.Err()
+	return
+}
+
+func (s *postgresStorage) GetTransferMismatches(ctx context.Context) (mismatches []TransferMismatch, err error) {
+	const query = `
+		select journal_id, debited, credited, ledger_debited, ledger_credited from (
+			select e.journal_id::text as journal_id,
+				case when t.successful then coalesce(t.debited, 0) else 0 end as debited,
+				case when t.successful then coalesce(t.credited, 0) else 0 end as credited,
+				coalesce(-sum(e.amount) filter (where e.amount < 0), 0) as ledger_debited,
+				coalesce(sum(e.amount) filter (where e.amount > 0), 0) as ledger_credited,
+				count(*) filter (where e.address_id is distinct from t.from_address
+					and e.address_id is distinct from t.to_address) as strangers
+			from ledger_entries e
+				left join transactions t on t.public_id = e.journal_id
+			where e.kind = $1
+			group by e.journal_id, t.id
+		) as j
+		where debited <> ledger_debited or credited <> ledger_credited or strangers > 0
+		order by journal_id;`
+
+	rows, err := s.db.QueryEx(ctx, query, nil, EntryTransfer)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m TransferMismatch
+		if err = rows.Scan(&m.JournalID, &m.Debited, &m.Credited, &m.LedgerDebited, &m.LedgerCredited); err != nil {
+			return
+		}
+		mismatches = append(mismatches, m)
+	}
+	err = rows.Err()
+	return
+}
+
+func (s *postgresStorage) ReserveIdempotencyKey(ctx context.Context, userID int32, key string, fingerprint string) (
+	reserved bool, err error) {
+	const query = `insert into idempotency_keys (user_id, key, fingerprint) values ($1, $2, $3)
+			on conflict (user_id, key) do nothing;`
+
+	tag, err := s.db.ExecEx(ctx, query, nil, userID, key, fingerprint)
+	if err != nil {
+		return
+	}
+	reserved = tag.RowsAffected() == 1
+	return
+}
+
+func (s *postgresStorage) GetIdempotencyKey(ctx context.Context, userID int32, key string) (
+	fingerprint string, transactionID string, success bool, err error) {
+	const query = `select fingerprint, coalesce(transaction_id::text, ''), success from idempotency_keys
+		where user_id = $1 and key = $2;`
+
+	err = s.db.QueryRowEx(ctx, query, nil, userID, key).Scan(&fingerprint, &transactionID, &success)
+	err = notFound(err)
+	return
+}
+
+func (s *postgresStorage) SaveIdempotentResult(ctx context.Context, userID int32, key string, transactionID string,
+	success bool) (err error) {
+	const query = `update idempotency_keys set transaction_id = $3, success = $4 where user_id = $1 and key = $2;`
+
+	_, err = s.db.ExecEx(ctx, query, nil, userID, key, transactionID, success)
+	return
+}
+
+// notFound replaces the driver specific error of the missing row
+func notFound(err error) error {
+	if err == pgx.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+// nullTime the nullable column is scanned into the pointer, the models keep it as sql.NullTime
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: *t, Valid: true}
+}
+
+// NewPostgresStorage creates the storage keeping the data in postgres, the schema is created by the migrations
+func NewPostgresStorage(db *pgx.ConnPool) Storage {
+	return &postgresStorage{
+		pool: db,
+		db:   db,
+	}
+}
@@ -0,0 +1,383 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"github.com/crypto_app/pkg/models"
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+// ErrNotFound is returned when the requested entity does not exist
+var ErrNotFound = errors.New(models.SqlNoRows)
+
+// ErrAddressTaken is returned when the wallet with the same address already exists
+var ErrAddressTaken = errors.New("address is taken")
+
+// FailureInsufficientFunds the reason the transaction fails when the sender lacks money
+const FailureInsufficientFunds = "insufficient_funds"
+
+// SourceManual the source of the quotes set by the admin
+const SourceManual = "manual"
+
+// the house accounts, every currency has one of each
+const (
+	// HouseIssuance the source of the granted money, its balance is minus the money issued
+	HouseIssuance = "issuance"
+	// HouseRevenue receives the fees of the transfers
+	HouseRevenue = "revenue"
+	// HouseExchange takes the currency of the sender and pays the currency of the recipient
+	HouseExchange = "exchange"
+)
+
+// the kinds of the ledger entries
+const (
+	// EntryOpening the balance the wallet had before the ledger was introduced
+	EntryOpening  = "opening"
+	EntryGrant    = "grant"
+	EntryTransfer = "transfer"
+	EntryFee      = "fee"
+	EntryExchange = "exchange"
+)
+
+// Storage keeps the data of the app. The business rules live in crypto_app, the implementations
+// only store and fetch the data, except MakeTransaction which moves the money atomically.
+type Storage interface {
+	Users
+	Tokens
+	PasswordResets
+	EmailVerifications
+	MFA
+	Wallets
+	Currencies
+	Rates
+	Transactions
+	Ledger
+	Idempotency
+
+	// InTx runs fn in a transaction, the changes made through the Storage passed to fn are kept
+	// only if fn returns nil. Calling InTx on that Storage runs fn in the same transaction.
+	InTx(ctx context.Context, fn func(tx Storage) error) (err error)
+	// Stats returns the state of the underlying connection pool
+	Stats() (stats models.PoolStatsResponse)
+}
+
+// User the registered user
+type User struct {
+	ID       int32
+	Name     string
+	LastName string
+	Email    string
+	PassHash string
+	IsAdmin  bool
+	// EmailVerified the user confirmed the email by the mailed token, new users start unverified
+	EmailVerified bool
+}
+
+type Users interface {
+	EmailExists(ctx context.Context, email string) (exists bool, err error)
+	// CreateUser saves the user and returns its id, the id of the input is ignored
+	CreateUser(ctx context.Context, user User) (userID int32, err error)
+	GetUserByEmail(ctx context.Context, email string) (user User, err error)
+	GetUser(ctx context.Context, userID int32) (user User, err error)
+	UpdatePassHash(ctx context.Context, userID int32, passHash string) (err error)
+	MarkEmailVerified(ctx context.Context, userID int32) (err error)
+	GetProfile(ctx context.Context, userID int32) (profile models.SingleUserDataDbResponse, err error)
+	// UpdateProfile changes the non nil fields of the input, the empty DOB clears it
+	UpdateProfile(ctx context.Context, input models.UpdateUserData) (err error)
+}
+
+// RefreshToken the state of the refresh token
+type RefreshToken struct {
+	UserID   int32
+	FamilyID string
+	// Spent the token was already used or revoked
+	Spent   bool
+	Expired bool
+}
+
+type Tokens interface {
+	SaveRefreshToken(ctx context.Context, tokenHash string, userID int32, familyID string, ttl time.Duration) (err error)
+	// GetRefreshToken returns the token locking it until the end of the transaction
+	GetRefreshToken(ctx context.Context, tokenHash string) (token RefreshToken, err error)
+	MarkRefreshTokenUsed(ctx context.Context, tokenHash string) (err error)
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string) (err error)
+	RevokeUserRefreshTokens(ctx context.Context, userID int32) (err error)
+}
+
+// PasswordResetToken the state of the token the password is reset with
+type PasswordResetToken struct {
+	UserID int32
+	// Spent the token or another token of the user was already used
+	Spent   bool
+	Expired bool
+}
+
+type PasswordResets interface {
+	SavePasswordResetToken(ctx context.Context, tokenHash string, userID int32, ttl time.Duration) (err error)
+	// GetPasswordResetToken returns the token locking it until the end of the transaction
+	GetPasswordResetToken(ctx context.Context, tokenHash string) (token PasswordResetToken, err error)
+	// SpendPasswordResetTokens marks every token of the user as used, so the password is reset only once
+	SpendPasswordResetTokens(ctx context.Context, userID int32) (err error)
+}
+
+// EmailVerificationToken the state of the token the email is confirmed with
+type EmailVerificationToken struct {
+	UserID int32
+	// Spent the token or another token of the user was already used
+	Spent   bool
+	Expired bool
+}
+
+type EmailVerifications interface {
+	SaveEmailVerificationToken(ctx context.Context, tokenHash string, userID int32, ttl time.Duration) (err error)
+	// GetEmailVerificationToken returns the token locking it until the end of the transaction
+	GetEmailVerificationToken(ctx context.Context, tokenHash string) (token EmailVerificationToken, err error)
+	// SpendEmailVerificationTokens marks every token of the user as used
+	SpendEmailVerificationTokens(ctx context.Context, userID int32) (err error)
+}
+
+// MFASecret the TOTP second factor of the user
+type MFASecret struct {
+	UserID int32
+	Secret string
+	// Enabled the secret was confirmed by the first code, the unconfirmed one is not asked for
+	Enabled bool
+	// LastCounter the time step of the last accepted code
+	LastCounter int64
+}
+
+// MFAChallenge the state of the token the correct password is swapped for
+type MFAChallenge struct {
+	UserID int32
+	// Spent the challenge was already passed
+	Spent    bool
+	Expired  bool
+	Attempts int32
+}
+
+type MFA interface {
+	// SaveMFASecret replaces the secret of the user, the replaced secret is disabled until confirmed
+	SaveMFASecret(ctx context.Context, userID int32, secret string) (err error)
+	// GetMFASecret returns the secret locking it until the end of the transaction, ErrNotFound without one
+	GetMFASecret(ctx context.Context, userID int32) (secret MFASecret, err error)
+	// EnableMFA turns the secret on and replaces the recovery codes of the user
+	EnableMFA(ctx context.Context, userID int32, counter int64, recoveryCodeHashes []string) (err error)
+	SetMFACounter(ctx context.Context, userID int32, counter int64) (err error)
+	// DisableMFA deletes the secret and the recovery codes of the user
+	DisableMFA(ctx context.Context, userID int32) (err error)
+	// UseRecoveryCode marks the code as used, used is false for the unknown or already used code
+	UseRecoveryCode(ctx context.Context, userID int32, codeHash string) (used bool, err error)
+
+	SaveMFAChallenge(ctx context.Context, tokenHash string, userID int32, ttl time.Duration) (err error)
+	// GetMFAChallenge returns the challenge locking it until the end of the transaction
+	GetMFAChallenge(ctx context.Context, tokenHash string) (challenge MFAChallenge, err error)
+	FailMFAChallenge(ctx context.Context, tokenHash string) (err error)
+	SpendMFAChallenge(ctx context.Context, tokenHash string) (err error)
+}
+
+// Wallet the address of the user in one of the currencies, the archived wallet takes no transfers.
+// Balance is the sum of the ledger entries of the wallet, it is kept by the storage.
+type Wallet struct {
+	ID         int32
+	UserID     int32
+	CurrencyID int32
+	Address    string
+	Balance    decimal.Decimal
+	Label      string
+	CreatedAt  time.Time
+	ArchivedAt *time.Time
+}
+
+type Wallets interface {
+	// CreateWallet saves the empty wallet and returns its id, the id, the balance and the times of the input
+	// are ignored, the money is given with GrantBalance.
+	// ErrAddressTaken is returned without breaking the transaction, so another address can be tried.
+	CreateWallet(ctx context.Context, wallet Wallet) (walletID int32, err error)
+	// GetWallets returns every wallet of the user including the archived ones
+	GetWallets(ctx context.Context, userID int32) (wallets []*models.WalletsResponse, err error)
+	GetWalletByAddress(ctx context.Context, address string) (wallet Wallet, err error)
+	// GetWalletsByIDs returns the wallets found locking them until the end of the transaction,
+	// the missing ones are skipped
+	GetWalletsByIDs(ctx context.Context, walletIDs []int32) (wallets []Wallet, err error)
+	// ArchiveWallet archives the wallet unless it keeps any money or is archived already, archived is false then
+	ArchiveWallet(ctx context.Context, walletID int32) (archived bool, err error)
+}
+
+// Currency the entry of the registry, Name is the code of the currency and Scale is the number of decimals
+// the amounts of the currency are kept with. The disabled currency keeps its wallets but takes no transfers.
+type Currency struct {
+	ID            int32
+	Name          string
+	DisplayName   string
+	Scale         int32
+	AddressFormat string
+	Enabled       bool
+}
+
+type Currencies interface {
+	GetCurrencies(ctx context.Context) (currencies []Currency, err error)
+	GetCurrencyByName(ctx context.Context, name string) (currency Currency, err error)
+	// CreateCurrency saves the currency and returns its id, the id of the input is ignored
+	CreateCurrency(ctx context.Context, currency Currency) (currencyID int32, err error)
+	// UpdateCurrency saves everything but the name and the scale, the amounts already kept depend on them
+	UpdateCurrency(ctx context.Context, currency Currency) (err error)
+}
+
+// Quote the price of the currency in dollars at the moment
+type Quote struct {
+	CurrencyID int32
+	Price      decimal.Decimal
+	Source     string
+	QuotedAt   time.Time
+}
+
+// Override the price set by the admin, it is used instead of the quotes until it expires or is deleted
+type Override struct {
+	CurrencyID int32
+	Price      decimal.Decimal
+	// ExpiresAt nil means the override stays until it is deleted
+	ExpiresAt *time.Time
+	CreatedBy int32
+}
+
+// CandleFilter selects the quotes of the currency in [From, To) grouped by Interval
+type CandleFilter struct {
+	CurrencyID int32
+	Interval   time.Duration
+	From       time.Time
+	To         time.Time
+}
+
+// Candle the prices of the currency during the interval starting at Time
+type Candle struct {
+	Time   time.Time
+	Open   decimal.Decimal
+	High   decimal.Decimal
+	Low    decimal.Decimal
+	Close  decimal.Decimal
+	Quotes int64
+}
+
+type Rates interface {
+	SaveQuotes(ctx context.Context, quotes []Quote) (err error)
+	// GetLatestQuote returns the active override of the currency as the quote of SourceManual,
+	// otherwise the latest quote of the feed
+	GetLatestQuote(ctx context.Context, currencyID int32) (quote Quote, err error)
+	// SetOverride replaces the override of the currency and saves it to the history as a quote
+	SetOverride(ctx context.Context, override Override) (err error)
+	DeleteOverride(ctx context.Context, currencyID int32) (err error)
+	// GetCandles aggregates every saved quote including the overrides, the intervals are aligned to the unix epoch
+	// and those without quotes are skipped
+	GetCandles(ctx context.Context, filter CandleFilter) (candles []Candle, err error)
+}
+
+// TransactionKey the position of the transaction in the list, the transactions are ordered by it descending
+type TransactionKey struct {
+	CreateAt time.Time
+	ID       int64
+}
+
+// TransactionFilter selects the transactions of the user, the empty fields do not filter anything
+type TransactionFilter struct {
+	UserID int32
+	// After returns the transactions following the given one
+	After     *TransactionKey
+	Limit     int
+	DateFrom  *time.Time
+	DateTo    *time.Time
+	Currency  string
+	Address   string
+	Direction string
+	Success   *bool
+	MinAmount *decimal.Decimal
+	MaxAmount *decimal.Decimal
+}
+
+type Transactions interface {
+	// MakeTransaction moves amount dollars worth of currency between the wallets charging the commission
+	// from the sender, the amounts of crypto are computed with the given prices of the currencies.
+	// The fee goes to the revenue account and the currencies are swapped through the exchange accounts.
+	// The attempt is recorded under the given id even when the sender lacks money, success is false then.
+	MakeTransaction(ctx context.Context, transactionID string, fromWalletID int32, toWalletID int32,
+		amount decimal.Decimal, commission decimal.Decimal, fromRate decimal.Decimal, toRate decimal.Decimal) (
+		success bool, err error)
+	// GetTransaction returns the transaction the user sent or received, ErrNotFound for the others
+	GetTransaction(ctx context.Context, userID int32, transactionID string) (transaction models.TransactionDetail, err error)
+	// GetTransactions returns the transactions the user sent or received, the latest first
+	GetTransactions(ctx context.Context, filter TransactionFilter) (transactions []*models.SingleTransaction, err error)
+}
+
+// HouseAccount the account of the app in the currency, see HouseIssuance, HouseRevenue and HouseExchange
+type HouseAccount struct {
+	CurrencyID int32
+	Kind       string
+	Balance    decimal.Decimal
+}
+
+// LedgerTotals the money of the currency: the balances held by the wallets and the house accounts
+// must sum to the money issued by the issuance account less the money returned to it
+type LedgerTotals struct {
+	CurrencyID int32
+	// Wallets the sum of the cached balances of the wallets
+	Wallets decimal.Decimal
+	// House the sum of the cached balances of the house accounts but the issuance
+	House  decimal.Decimal
+	Minted decimal.Decimal
+	Burned decimal.Decimal
+}
+
+// BalanceMismatch the account whose cached balance differs from the sum of its entries,
+// either WalletID or HouseAccount is set
+type BalanceMismatch struct {
+	WalletID     int32
+	Address      string
+	HouseAccount string
+	CurrencyID   int32
+	Balance      decimal.Decimal
+	Entries      decimal.Decimal
+}
+
+// UnbalancedJournal the journal whose entries do not sum to zero in the currency
+type UnbalancedJournal struct {
+	JournalID  string
+	CurrencyID int32
+	Sum        decimal.Decimal
+}
+
+// TransferMismatch the transfer journal which moved other amounts or other wallets than the transaction says,
+// the amounts of the transaction are zero when it is missing or failed
+type TransferMismatch struct {
+	JournalID      string
+	Debited        decimal.Decimal
+	Credited       decimal.Decimal
+	LedgerDebited  decimal.Decimal
+	LedgerCredited decimal.Decimal
+}
+
+// Ledger the journal of the balances, every change of the balance of the wallet is the entry of the journal,
+// the entries of the journal sum to zero in every currency. The transfers are recorded by MakeTransaction
+// under the id of the transaction.
+type Ledger interface {
+	// GrantBalance moves the amount from the issuance account of the currency of the wallet to the wallet
+	GrantBalance(ctx context.Context, walletID int32, amount decimal.Decimal) (err error)
+	// GetHouseAccounts returns the house accounts ordered by the currency, the account appears with its first entry
+	GetHouseAccounts(ctx context.Context) (accounts []HouseAccount, err error)
+	// GetLedgerTotals returns the totals of every currency of the registry
+	GetLedgerTotals(ctx context.Context) (totals []LedgerTotals, err error)
+	GetBalanceMismatches(ctx context.Context) (mismatches []BalanceMismatch, err error)
+	GetUnbalancedJournals(ctx context.Context) (journals []UnbalancedJournal, err error)
+	// GetTransferMismatches compares the transfer journals to their transactions, the transactions
+	// made before the ledger have no journals and are not compared
+	GetTransferMismatches(ctx context.Context) (mismatches []TransferMismatch, err error)
+}
+
+type Idempotency interface {
+	// ReserveIdempotencyKey saves the key unless it is already known, reserved is false then.
+	// The concurrent reservation of the same key waits until the first one is committed.
+	ReserveIdempotencyKey(ctx context.Context, userID int32, key string, fingerprint string) (reserved bool, err error)
+	// GetIdempotencyKey transactionID is empty for the keys saved before the transactions had the id
+	GetIdempotencyKey(ctx context.Context, userID int32, key string) (fingerprint string, transactionID string,
+		success bool, err error)
+	SaveIdempotentResult(ctx context.Context, userID int32, key string, transactionID string, success bool) (err error)
+}
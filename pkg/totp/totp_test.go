@@ -0,0 +1,90 @@
+package totp
+
+import (
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// rfcSecret the SHA1 secret of the test vectors of RFC 6238, "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeRFC6238(t *testing.T) {
+	// the 8 digit codes of the RFC cut to the last 6 digits
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, v := range vectors {
+		code, err := Code(rfcSecret, Counter(time.Unix(v.unix, 0)))
+		require.NoError(t, err)
+		require.Equal(t, v.code, code, "time %d", v.unix)
+	}
+}
+
+func TestCodeBadSecret(t *testing.T) {
+	_, err := Code("not base32!", 1)
+	require.Error(t, err)
+}
+
+func TestValidateSkew(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := Counter(now)
+
+	for _, step := range []int64{-1, 0, 1} {
+		code, err := Code(rfcSecret, current+step)
+		require.NoError(t, err)
+
+		counter, ok := Validate(rfcSecret, code, now, 1)
+		require.True(t, ok, "step %d", step)
+		// the matched step is returned, the caller refuses it the next time
+		require.Equal(t, current+step, counter)
+	}
+
+	for _, step := range []int64{-2, 2} {
+		code, err := Code(rfcSecret, current+step)
+		require.NoError(t, err)
+
+		_, ok := Validate(rfcSecret, code, now, 1)
+		require.False(t, ok, "step %d", step)
+	}
+}
+
+func TestValidateRefusesBadCodes(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	for _, code := range []string{"", "00592", "0059240", "abcdef", "005925"} {
+		_, ok := Validate(rfcSecret, code, now, 1)
+		require.False(t, ok, "code %q", code)
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+	key, err := encoding.DecodeString(secret)
+	require.NoError(t, err)
+	require.Len(t, key, secretSize)
+
+	other, err := GenerateSecret()
+	require.NoError(t, err)
+	require.NotEqual(t, secret, other)
+}
+
+func TestURI(t *testing.T) {
+	u, err := url.Parse(URI("Crypto", "alice@example.com", rfcSecret))
+	require.NoError(t, err)
+	require.Equal(t, "otpauth", u.Scheme)
+	require.Equal(t, "totp", u.Host)
+	require.Equal(t, "/Crypto:alice@example.com", u.Path)
+	require.Equal(t, rfcSecret, u.Query().Get("secret"))
+	require.Equal(t, "Crypto", u.Query().Get("issuer"))
+}
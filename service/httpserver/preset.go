@@ -2,10 +2,44 @@ package httpserver
 
 // const for httpserver
 const (
-	URIPathGetAlive        = "/crypto/alive"
-	URIPathSignIn          = "/crypto/register"
-	URIPathLogIn           = "/crypto/log_in"
-	URIPathGetWallets      = "/crypto/wallet"
-	URIPathTransaction     = "/crypto/transaction"
-	URIPathGetTransactions = "/crypto/transaction/list"
+	URIPathGetAlive                = "/crypto/alive"
+	URIPathSignIn                  = "/crypto/register"
+	URIPathLogIn                   = "/crypto/log_in"
+	URIPathLogInMFA                = "/crypto/log_in/mfa"
+	URIPathRefreshToken            = "/crypto/token/refresh"
+	URIPathLogOut                  = "/crypto/log_out"
+	URIPathRevokeAllSessions       = "/crypto/sessions/revoke_all"
+	URIPathGetMe                   = "/crypto/me"
+	URIPathUpdateMe                = "/crypto/me"
+	URIPathForgotPassword          = "/crypto/password/forgot"
+	URIPathResetPassword           = "/crypto/password/reset"
+	URIPathVerifyEmail             = "/crypto/email/verify"
+	URIPathResendVerificationEmail = "/crypto/email/verify/resend"
+	URIPathEnrollMFA               = "/crypto/mfa/enroll"
+	URIPathConfirmMFA              = "/crypto/mfa/confirm"
+	URIPathDisableMFA              = "/crypto/mfa/disable"
+	URIPathGetJWKS                 = "/crypto/.well-known/jwks.json"
+	URIPathGetWallets              = "/crypto/wallet"
+	URIPathOpenWallet              = "/crypto/wallet"
+	URIPathArchiveWallet           = "/crypto/wallet/{address}"
+	URIPathTransaction             = "/crypto/transaction"
+	URIPathGetTransactions         = "/crypto/transaction/list"
+	// URIPathGetTransactionDetail the id is the uuid, so the path never matches the list
+	URIPathGetTransactionDetail = "/crypto/transaction/{id:[0-9a-fA-F-]{36}}"
+	URIPathGetRates             = "/crypto/rates"
+	URIPathGetCandles           = "/crypto/rates/{currency}/candles"
+	// the routes under /crypto/admin/ are allowed only to the admin tokens, see middlewhare.AuthMiddleware
+	URIPathRateOverride       = "/crypto/admin/rates/override"
+	URIPathDeleteRateOverride = "/crypto/admin/rates/override/{currency}"
+	URIPathCurrencies         = "/crypto/admin/currencies"
+	URIPathUpdateCurrency     = "/crypto/admin/currencies/{code}"
+	URIPathGetHouseAccounts   = "/crypto/admin/ledger/accounts"
+	URIPathUnlockLogIn        = "/crypto/admin/login/unlock"
+	URIPathGetPoolStats       = "/crypto/admin/db/stats"
+)
+
+const (
+	idempotencyKey       = "Idempotency-Key"
+	maxIdempotencyKeyLen = 255
+	queryDateLayout      = "2006-01-02"
 )
@@ -12,9 +12,36 @@ type service interface {
 	Alive(ctx context.Context) (output models.AliveResponse, err error)
 	Sign(ctx context.Context, input *models.RegisterRequest) (output models.RegisterResponse, err error)
 	LogIn(ctx context.Context, input *models.LogInRequest) (output models.RegisterResponse, err error)
+	LogInMFA(ctx context.Context, input models.LogInMFARequest) (output models.RegisterResponse, err error)
+	RefreshToken(ctx context.Context, input *models.RefreshTokenRequest) (output models.RegisterResponse, err error)
+	LogOut(ctx context.Context) (err error)
+	RevokeAllSessions(ctx context.Context) (err error)
+	GetMe(ctx context.Context) (output models.SingleUserData, err error)
+	UpdateMe(ctx context.Context, input models.UpdateUserData) (output models.SingleUserData, err error)
+	ForgotPassword(ctx context.Context, input models.ForgotPasswordRequest) (err error)
+	ResetPassword(ctx context.Context, input models.ResetPasswordRequest) (err error)
+	VerifyEmail(ctx context.Context, input models.VerifyEmailRequest) (err error)
+	ResendVerificationEmail(ctx context.Context) (err error)
+	EnrollMFA(ctx context.Context) (output models.MFAEnrollResponse, err error)
+	ConfirmMFA(ctx context.Context, input models.MFACodeRequest) (output models.MFAConfirmResponse, err error)
+	DisableMFA(ctx context.Context, input models.MFACodeRequest) (err error)
+	GetJWKS(ctx context.Context) (output models.JWKSResponse, err error)
+	GetPoolStats(ctx context.Context) (output models.PoolStatsResponse, err error)
 	GetWallets(ctx context.Context) (output []*models.WalletsResponse, err error)
-	Transaction(ctx context.Context, input models.TransactionRequest) (err error)
-	GetTransactions(ctx context.Context, perPage int, pageNum int) (response models.GetTransactionResponse, err error)
+	OpenWallet(ctx context.Context, input models.OpenWalletRequest) (output models.WalletsResponse, err error)
+	ArchiveWallet(ctx context.Context, address string) (err error)
+	Transaction(ctx context.Context, input models.TransactionRequest) (output models.TransactionDetail, err error)
+	GetTransaction(ctx context.Context, transactionID string) (output models.TransactionDetail, err error)
+	GetTransactions(ctx context.Context, input models.GetTransactionsRequest) (response models.GetTransactionResponse, err error)
+	GetRates(ctx context.Context) (output []*models.RateResponse, err error)
+	GetCandles(ctx context.Context, input models.GetCandlesRequest) (output models.GetCandlesResponse, err error)
+	SetRateOverride(ctx context.Context, input models.RateOverrideRequest) (err error)
+	DeleteRateOverride(ctx context.Context, currency string) (err error)
+	GetCurrencies(ctx context.Context) (output []*models.CurrencyResponse, err error)
+	CreateCurrency(ctx context.Context, input models.CreateCurrencyRequest) (output models.CurrencyResponse, err error)
+	UpdateCurrency(ctx context.Context, input models.UpdateCurrencyRequest) (output models.CurrencyResponse, err error)
+	GetHouseAccounts(ctx context.Context) (output []*models.HouseAccountResponse, err error)
+	UnlockLogIn(ctx context.Context, input models.UnlockLogInRequest) (err error)
 }
 
 //================================================
@@ -128,23 +155,837 @@ func NewLogInServer(transport LogInTransport, service service) http.HandlerFunc
 	return ls.ServeHTTP
 }
 
+//================================================
+// LogInMFAServer
+//================================================
+type logInMFAServer struct {
+	transport LogInMFATransport
+	service   service
+}
+
+// ServeHTTP implements http.Handler.
+func (s *logInMFAServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	input, err := s.transport.DecodeRequest(r.Context(), r)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	response, err := s.service.LogInMFA(r.Context(), input)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	if err := s.transport.EncodeResponse(r.Context(), w, response); err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+}
+
+// NewLogInMFAServer the server creator
+func NewLogInMFAServer(transport LogInMFATransport, service service) http.HandlerFunc {
+	ls := logInMFAServer{
+		transport: transport,
+		service:   service,
+	}
+	return ls.ServeHTTP
+}
+
+//================================================
+// RefreshTokenServer
+//================================================
+type refreshTokenServer struct {
+	transport RefreshTokenTransport
+	service   service
+}
+
+// ServeHTTP implements http.Handler.
+func (s *refreshTokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req, err := s.transport.DecodeRequest(r.Context(), r)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	response, err := s.service.RefreshToken(r.Context(), &req)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	if err := s.transport.EncodeResponse(r.Context(), w, &response); err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+}
+
+// NewRefreshTokenServer the server creator
+func NewRefreshTokenServer(transport RefreshTokenTransport, service service) http.HandlerFunc {
+	ls := refreshTokenServer{
+		transport: transport,
+		service:   service,
+	}
+	return ls.ServeHTTP
+}
+
+//================================================
+// LogOutServer
+//================================================
+type logOutServer struct {
+	transport LogOutTransport
+	service   service
+}
+
+// ServeHTTP implements http.Handler.
+func (s *logOutServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := s.transport.DecodeRequest(r.Context(), r)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	err = s.service.LogOut(r.Context())
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	if err := s.transport.EncodeResponse(r.Context(), w); err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+}
+
+// NewLogOutServer the server creator
+func NewLogOutServer(transport LogOutTransport, service service) http.HandlerFunc {
+	ls := logOutServer{
+		transport: transport,
+		service:   service,
+	}
+	return ls.ServeHTTP
+}
+
+//================================================
+// RevokeAllSessionsServer
+//================================================
+type revokeAllSessionsServer struct {
+	transport RevokeAllSessionsTransport
+	service   service
+}
+
+// ServeHTTP implements http.Handler.
+func (s *revokeAllSessionsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := s.transport.DecodeRequest(r.Context(), r)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	err = s.service.RevokeAllSessions(r.Context())
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	if err := s.transport.EncodeResponse(r.Context(), w); err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+}
+
+// NewRevokeAllSessionsServer the server creator
+func NewRevokeAllSessionsServer(transport RevokeAllSessionsTransport, service service) http.HandlerFunc {
+	ls := revokeAllSessionsServer{
+		transport: transport,
+		service:   service,
+	}
+	return ls.ServeHTTP
+}
+
+//================================================
+// GetMeServer
+//================================================
+type getMeServer struct {
+	transport GetMeTransport
+	service   service
+}
+
+// ServeHTTP implements http.Handler.
+func (s *getMeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := s.transport.DecodeRequest(r.Context(), r)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	response, err := s.service.GetMe(r.Context())
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	if err := s.transport.EncodeResponse(r.Context(), w, response); err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+}
+
+// NewGetMeServer the server creator
+func NewGetMeServer(transport GetMeTransport, service service) http.HandlerFunc {
+	ls := getMeServer{
+		transport: transport,
+		service:   service,
+	}
+	return ls.ServeHTTP
+}
+
+//================================================
+// UpdateMeServer
+//================================================
+type updateMeServer struct {
+	transport UpdateMeTransport
+	service   service
+}
+
+// ServeHTTP implements http.Handler.
+func (s *updateMeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	input, err := s.transport.DecodeRequest(r.Context(), r)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	response, err := s.service.UpdateMe(r.Context(), input)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	if err := s.transport.EncodeResponse(r.Context(), w, response); err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+}
+
+// NewUpdateMeServer the server creator
+func NewUpdateMeServer(transport UpdateMeTransport, service service) http.HandlerFunc {
+	ls := updateMeServer{
+		transport: transport,
+		service:   service,
+	}
+	return ls.ServeHTTP
+}
+
+//================================================
+// ForgotPasswordServer
+//================================================
+type forgotPasswordServer struct {
+	transport ForgotPasswordTransport
+	service   service
+}
+
+// ServeHTTP implements http.Handler.
+func (s *forgotPasswordServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	input, err := s.transport.DecodeRequest(r.Context(), r)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	err = s.service.ForgotPassword(r.Context(), input)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	if err := s.transport.EncodeResponse(r.Context(), w); err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+}
+
+// NewForgotPasswordServer the server creator
+func NewForgotPasswordServer(transport ForgotPasswordTransport, service service) http.HandlerFunc {
+	ls := forgotPasswordServer{
+		transport: transport,
+		service:   service,
+	}
+	return ls.ServeHTTP
+}
+
+//================================================
+// ResetPasswordServer
+//================================================
+type resetPasswordServer struct {
+	transport ResetPasswordTransport
+	service   service
+}
+
+// ServeHTTP implements http.Handler.
+func (s *resetPasswordServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	input, err := s.transport.DecodeRequest(r.Context(), r)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	err = s.service.ResetPassword(r.Context(), input)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	if err := s.transport.EncodeResponse(r.Context(), w); err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+}
+
+// NewResetPasswordServer the server creator
+func NewResetPasswordServer(transport ResetPasswordTransport, service service) http.HandlerFunc {
+	ls := resetPasswordServer{
+		transport: transport,
+		service:   service,
+	}
+	return ls.ServeHTTP
+}
+
+//================================================
+// VerifyEmailServer
+//================================================
+type verifyEmailServer struct {
+	transport VerifyEmailTransport
+	service   service
+}
+
+// ServeHTTP implements http.Handler.
+func (s *verifyEmailServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	input, err := s.transport.DecodeRequest(r.Context(), r)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	err = s.service.VerifyEmail(r.Context(), input)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	if err := s.transport.EncodeResponse(r.Context(), w); err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+}
+
+// NewVerifyEmailServer the server creator
+func NewVerifyEmailServer(transport VerifyEmailTransport, service service) http.HandlerFunc {
+	ls := verifyEmailServer{
+		transport: transport,
+		service:   service,
+	}
+	return ls.ServeHTTP
+}
+
+//================================================
+// ResendVerificationEmailServer
+//================================================
+type resendVerificationEmailServer struct {
+	transport ResendVerificationEmailTransport
+	service   service
+}
+
+// ServeHTTP implements http.Handler.
+func (s *resendVerificationEmailServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := s.transport.DecodeRequest(r.Context(), r)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	err = s.service.ResendVerificationEmail(r.Context())
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	if err := s.transport.EncodeResponse(r.Context(), w); err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+}
+
+// NewResendVerificationEmailServer the server creator
+func NewResendVerificationEmailServer(transport ResendVerificationEmailTransport, service service) http.HandlerFunc {
+	ls := resendVerificationEmailServer{
+		transport: transport,
+		service:   service,
+	}
+	return ls.ServeHTTP
+}
+
+//================================================
+// EnrollMFAServer
+//================================================
+type enrollMFAServer struct {
+	transport EnrollMFATransport
+	service   service
+}
+
+// ServeHTTP implements http.Handler.
+func (s *enrollMFAServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := s.transport.DecodeRequest(r.Context(), r)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	response, err := s.service.EnrollMFA(r.Context())
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	if err := s.transport.EncodeResponse(r.Context(), w, response); err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+}
+
+// NewEnrollMFAServer the server creator
+func NewEnrollMFAServer(transport EnrollMFATransport, service service) http.HandlerFunc {
+	ls := enrollMFAServer{
+		transport: transport,
+		service:   service,
+	}
+	return ls.ServeHTTP
+}
+
+//================================================
+// ConfirmMFAServer
+//================================================
+type confirmMFAServer struct {
+	transport ConfirmMFATransport
+	service   service
+}
+
+// ServeHTTP implements http.Handler.
+func (s *confirmMFAServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	input, err := s.transport.DecodeRequest(r.Context(), r)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	response, err := s.service.ConfirmMFA(r.Context(), input)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	if err := s.transport.EncodeResponse(r.Context(), w, response); err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+}
+
+// NewConfirmMFAServer the server creator
+func NewConfirmMFAServer(transport ConfirmMFATransport, service service) http.HandlerFunc {
+	ls := confirmMFAServer{
+		transport: transport,
+		service:   service,
+	}
+	return ls.ServeHTTP
+}
+
+//================================================
+// DisableMFAServer
+//================================================
+type disableMFAServer struct {
+	transport DisableMFATransport
+	service   service
+}
+
+// ServeHTTP implements http.Handler.
+func (s *disableMFAServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	input, err := s.transport.DecodeRequest(r.Context(), r)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	err = s.service.DisableMFA(r.Context(), input)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	if err := s.transport.EncodeResponse(r.Context(), w); err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+}
+
+// NewDisableMFAServer the server creator
+func NewDisableMFAServer(transport DisableMFATransport, service service) http.HandlerFunc {
+	ls := disableMFAServer{
+		transport: transport,
+		service:   service,
+	}
+	return ls.ServeHTTP
+}
+
+//================================================
+// GetJWKSServer
+//================================================
+type getJWKSServer struct {
+	transport GetJWKSTransport
+	service   service
+}
+
+// ServeHTTP implements http.Handler.
+func (s *getJWKSServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := s.transport.DecodeRequest(r.Context(), r)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	response, err := s.service.GetJWKS(r.Context())
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	if err := s.transport.EncodeResponse(r.Context(), w, &response); err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+}
+
+// NewGetJWKSServer the server creator
+func NewGetJWKSServer(transport GetJWKSTransport, service service) http.HandlerFunc {
+	ls := getJWKSServer{
+		transport: transport,
+		service:   service,
+	}
+	return ls.ServeHTTP
+}
+
+//================================================
+// GetPoolStatsServer
+//================================================
+type getPoolStatsServer struct {
+	transport GetPoolStatsTransport
+	service   service
+}
+
+// ServeHTTP implements http.Handler.
+func (s *getPoolStatsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := s.transport.DecodeRequest(r.Context(), r)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	response, err := s.service.GetPoolStats(r.Context())
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	if err := s.transport.EncodeResponse(r.Context(), w, &response); err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+}
+
+// NewGetPoolStatsServer the server creator
+func NewGetPoolStatsServer(transport GetPoolStatsTransport, service service) http.HandlerFunc {
+	ls := getPoolStatsServer{
+		transport: transport,
+		service:   service,
+	}
+	return ls.ServeHTTP
+}
+
 //================================================
 // GetWalletsServer
 //================================================
-type getWalletsServer struct {
-	transport GetWalletsTransport
+type getWalletsServer struct {
+	transport GetWalletsTransport
+	service   service
+}
+
+// ServeHTTP implements http.Handler.
+func (s *getWalletsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := s.transport.DecodeRequest(r.Context(), r)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	response, err := s.service.GetWallets(r.Context())
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	if err := s.transport.EncodeResponse(r.Context(), w, response); err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+}
+
+// NewGetWalletsServer the server creator
+func NewGetWalletsServer(transport GetWalletsTransport, service service) http.HandlerFunc {
+	ls := getWalletsServer{
+		transport: transport,
+		service:   service,
+	}
+	return ls.ServeHTTP
+}
+
+//================================================
+// OpenWalletServer
+//================================================
+type openWalletServer struct {
+	transport OpenWalletTransport
+	service   service
+}
+
+// ServeHTTP implements http.Handler.
+func (s *openWalletServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	input, err := s.transport.DecodeRequest(r.Context(), r)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	response, err := s.service.OpenWallet(r.Context(), input)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	if err := s.transport.EncodeResponse(r.Context(), w, response); err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+}
+
+// NewOpenWalletServer the server creator
+func NewOpenWalletServer(transport OpenWalletTransport, service service) http.HandlerFunc {
+	ls := openWalletServer{
+		transport: transport,
+		service:   service,
+	}
+	return ls.ServeHTTP
+}
+
+//================================================
+// ArchiveWalletServer
+//================================================
+type archiveWalletServer struct {
+	transport ArchiveWalletTransport
+	service   service
+}
+
+// ServeHTTP implements http.Handler.
+func (s *archiveWalletServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	address, err := s.transport.DecodeRequest(r.Context(), r)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	err = s.service.ArchiveWallet(r.Context(), address)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	if err := s.transport.EncodeResponse(r.Context(), w); err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+}
+
+// NewArchiveWalletServer the server creator
+func NewArchiveWalletServer(transport ArchiveWalletTransport, service service) http.HandlerFunc {
+	ls := archiveWalletServer{
+		transport: transport,
+		service:   service,
+	}
+	return ls.ServeHTTP
+}
+
+//================================================
+// TransactionServer
+//================================================
+type transactionServer struct {
+	transport TransactionTransport
+	service   service
+}
+
+// ServeHTTP implements http.Handler.
+func (s *transactionServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	resp, err := s.transport.DecodeRequest(r.Context(), r)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	output, err := s.service.Transaction(r.Context(), resp)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	if err := s.transport.EncodeResponse(r.Context(), w, output); err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+}
+
+// NewTransactionServer the server creator
+func NewTransactionServer(transport TransactionTransport, service service) http.HandlerFunc {
+	ls := transactionServer{
+		transport: transport,
+		service:   service,
+	}
+	return ls.ServeHTTP
+}
+
+//================================================
+// GetTransactionServer
+//================================================
+type getTransactionServer struct {
+	transport GetTransactionsTransport
+	service   service
+}
+
+// ServeHTTP implements http.Handler.
+func (s *getTransactionServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	input, err := s.transport.DecodeRequest(r.Context(), r)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	resp, err := s.service.GetTransactions(r.Context(), input)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	if err := s.transport.EncodeResponse(r.Context(), w, resp); err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+}
+
+// NewGetTransactionsServer the server creator
+func NewGetTransactionsServer(transport GetTransactionsTransport, service service) http.HandlerFunc {
+	ls := getTransactionServer{
+		transport: transport,
+		service:   service,
+	}
+	return ls.ServeHTTP
+}
+
+//================================================
+// TransactionDetailServer
+//================================================
+type transactionDetailServer struct {
+	transport TransactionDetailTransport
+	service   service
+}
+
+// ServeHTTP implements http.Handler.
+func (s *transactionDetailServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	transactionID, err := s.transport.DecodeRequest(r.Context(), r)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	resp, err := s.service.GetTransaction(r.Context(), transactionID)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	if err := s.transport.EncodeResponse(r.Context(), w, resp); err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+}
+
+// NewTransactionDetailServer the server creator
+func NewTransactionDetailServer(transport TransactionDetailTransport, service service) http.HandlerFunc {
+	ls := transactionDetailServer{
+		transport: transport,
+		service:   service,
+	}
+	return ls.ServeHTTP
+}
+
+//================================================
+// GetRatesServer
+//================================================
+type getRatesServer struct {
+	transport GetRatesTransport
+	service   service
+}
+
+// ServeHTTP implements http.Handler.
+func (s *getRatesServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := s.transport.DecodeRequest(r.Context(), r)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	response, err := s.service.GetRates(r.Context())
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	if err := s.transport.EncodeResponse(r.Context(), w, response); err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+}
+
+// NewGetRatesServer the server creator
+func NewGetRatesServer(transport GetRatesTransport, service service) http.HandlerFunc {
+	ls := getRatesServer{
+		transport: transport,
+		service:   service,
+	}
+	return ls.ServeHTTP
+}
+
+//================================================
+// GetCandlesServer
+//================================================
+type getCandlesServer struct {
+	transport GetCandlesTransport
 	service   service
 }
 
 // ServeHTTP implements http.Handler.
-func (s *getWalletsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	err := s.transport.DecodeRequest(r.Context(), r)
+func (s *getCandlesServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	input, err := s.transport.DecodeRequest(r.Context(), r)
 	if err != nil {
 		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
 		return
 	}
 
-	response, err := s.service.GetWallets(r.Context())
+	response, err := s.service.GetCandles(r.Context(), input)
 	if err != nil {
 		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
 		return
@@ -156,9 +997,9 @@ func (s *getWalletsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// NewGetWalletsServer the server creator
-func NewGetWalletsServer(transport GetWalletsTransport, service service) http.HandlerFunc {
-	ls := getWalletsServer{
+// NewGetCandlesServer the server creator
+func NewGetCandlesServer(transport GetCandlesTransport, service service) http.HandlerFunc {
+	ls := getCandlesServer{
 		transport: transport,
 		service:   service,
 	}
@@ -166,22 +1007,22 @@ func NewGetWalletsServer(transport GetWalletsTransport, service service) http.Ha
 }
 
 //================================================
-// TransactionServer
+// SetRateOverrideServer
 //================================================
-type transactionServer struct {
-	transport TransactionTransport
+type setRateOverrideServer struct {
+	transport SetRateOverrideTransport
 	service   service
 }
 
 // ServeHTTP implements http.Handler.
-func (s *transactionServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	resp, err := s.transport.DecodeRequest(r.Context(), r)
+func (s *setRateOverrideServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	input, err := s.transport.DecodeRequest(r.Context(), r)
 	if err != nil {
 		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
 		return
 	}
 
-	err = s.service.Transaction(r.Context(), resp)
+	err = s.service.SetRateOverride(r.Context(), input)
 	if err != nil {
 		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
 		return
@@ -193,9 +1034,9 @@ func (s *transactionServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// NewTransactionServer the server creator
-func NewTransactionServer(transport TransactionTransport, service service) http.HandlerFunc {
-	ls := transactionServer{
+// NewSetRateOverrideServer the server creator
+func NewSetRateOverrideServer(transport SetRateOverrideTransport, service service) http.HandlerFunc {
+	ls := setRateOverrideServer{
 		transport: transport,
 		service:   service,
 	}
@@ -203,36 +1044,221 @@ func NewTransactionServer(transport TransactionTransport, service service) http.
 }
 
 //================================================
-// GetTransactionServer
+// DeleteRateOverrideServer
 //================================================
-type getTransactionServer struct {
-	transport GetTransactionsTransport
+type deleteRateOverrideServer struct {
+	transport DeleteRateOverrideTransport
 	service   service
 }
 
 // ServeHTTP implements http.Handler.
-func (s *getTransactionServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	perPage, pageNum, err := s.transport.DecodeRequest(r.Context(), r)
+func (s *deleteRateOverrideServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	currency, err := s.transport.DecodeRequest(r.Context(), r)
 	if err != nil {
 		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
 		return
 	}
 
-	resp, err := s.service.GetTransactions(r.Context(), perPage, pageNum)
+	err = s.service.DeleteRateOverride(r.Context(), currency)
 	if err != nil {
 		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
 		return
 	}
 
-	if err := s.transport.EncodeResponse(r.Context(), w, resp); err != nil {
+	if err := s.transport.EncodeResponse(r.Context(), w); err != nil {
 		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
 		return
 	}
 }
 
-// NewGetTransactionsServer the server creator
-func NewGetTransactionsServer(transport GetTransactionsTransport, service service) http.HandlerFunc {
-	ls := getTransactionServer{
+// NewDeleteRateOverrideServer the server creator
+func NewDeleteRateOverrideServer(transport DeleteRateOverrideTransport, service service) http.HandlerFunc {
+	ls := deleteRateOverrideServer{
+		transport: transport,
+		service:   service,
+	}
+	return ls.ServeHTTP
+}
+
+//================================================
+// GetCurrenciesServer
+//================================================
+type getCurrenciesServer struct {
+	transport GetCurrenciesTransport
+	service   service
+}
+
+// ServeHTTP implements http.Handler.
+func (s *getCurrenciesServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := s.transport.DecodeRequest(r.Context(), r)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	response, err := s.service.GetCurrencies(r.Context())
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	if err := s.transport.EncodeResponse(r.Context(), w, response); err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+}
+
+// NewGetCurrenciesServer the server creator
+func NewGetCurrenciesServer(transport GetCurrenciesTransport, service service) http.HandlerFunc {
+	ls := getCurrenciesServer{
+		transport: transport,
+		service:   service,
+	}
+	return ls.ServeHTTP
+}
+
+//================================================
+// CreateCurrencyServer
+//================================================
+type createCurrencyServer struct {
+	transport CreateCurrencyTransport
+	service   service
+}
+
+// ServeHTTP implements http.Handler.
+func (s *createCurrencyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	input, err := s.transport.DecodeRequest(r.Context(), r)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	response, err := s.service.CreateCurrency(r.Context(), input)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	if err := s.transport.EncodeResponse(r.Context(), w, response); err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+}
+
+// NewCreateCurrencyServer the server creator
+func NewCreateCurrencyServer(transport CreateCurrencyTransport, service service) http.HandlerFunc {
+	ls := createCurrencyServer{
+		transport: transport,
+		service:   service,
+	}
+	return ls.ServeHTTP
+}
+
+//================================================
+// UpdateCurrencyServer
+//================================================
+type updateCurrencyServer struct {
+	transport UpdateCurrencyTransport
+	service   service
+}
+
+// ServeHTTP implements http.Handler.
+func (s *updateCurrencyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	input, err := s.transport.DecodeRequest(r.Context(), r)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	response, err := s.service.UpdateCurrency(r.Context(), input)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	if err := s.transport.EncodeResponse(r.Context(), w, response); err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+}
+
+// NewUpdateCurrencyServer the server creator
+func NewUpdateCurrencyServer(transport UpdateCurrencyTransport, service service) http.HandlerFunc {
+	ls := updateCurrencyServer{
+		transport: transport,
+		service:   service,
+	}
+	return ls.ServeHTTP
+}
+
+//================================================
+// GetHouseAccountsServer
+//================================================
+type getHouseAccountsServer struct {
+	transport GetHouseAccountsTransport
+	service   service
+}
+
+// ServeHTTP implements http.Handler.
+func (s *getHouseAccountsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := s.transport.DecodeRequest(r.Context(), r)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	response, err := s.service.GetHouseAccounts(r.Context())
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	if err := s.transport.EncodeResponse(r.Context(), w, response); err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+}
+
+// NewGetHouseAccountsServer the server creator
+func NewGetHouseAccountsServer(transport GetHouseAccountsTransport, service service) http.HandlerFunc {
+	ls := getHouseAccountsServer{
+		transport: transport,
+		service:   service,
+	}
+	return ls.ServeHTTP
+}
+
+//================================================
+// UnlockLogInServer
+//================================================
+type unlockLogInServer struct {
+	transport UnlockLogInTransport
+	service   service
+}
+
+// ServeHTTP implements http.Handler.
+func (s *unlockLogInServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	input, err := s.transport.DecodeRequest(r.Context(), r)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	err = s.service.UnlockLogIn(r.Context(), input)
+	if err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+
+	if err := s.transport.EncodeResponse(r.Context(), w); err != nil {
+		tools.EncodeIntoResponseWriter(w, err.(tools.ErrorMessage))
+		return
+	}
+}
+
+// NewUnlockLogInServer the server creator
+func NewUnlockLogInServer(transport UnlockLogInTransport, service service) http.HandlerFunc {
+	ls := unlockLogInServer{
 		transport: transport,
 		service:   service,
 	}
@@ -244,9 +1270,36 @@ func NewPreparedServer(svc service) *mux.Router {
 	aliveTransport := NewAliveTransport()
 	signInTransport := NewSignInTransport()
 	logInTransport := NewLogInTransport()
+	logInMFATransport := NewLogInMFATransport()
+	refreshTokenTransport := NewRefreshTokenTransport()
+	logOutTransport := NewLogOutTransport()
+	revokeAllSessionsTransport := NewRevokeAllSessionsTransport()
+	getMeTransport := NewGetMeTransport()
+	updateMeTransport := NewUpdateMeTransport()
+	forgotPasswordTransport := NewForgotPasswordTransport()
+	resetPasswordTransport := NewResetPasswordTransport()
+	verifyEmailTransport := NewVerifyEmailTransport()
+	resendVerificationEmailTransport := NewResendVerificationEmailTransport()
+	enrollMFATransport := NewEnrollMFATransport()
+	confirmMFATransport := NewConfirmMFATransport()
+	disableMFATransport := NewDisableMFATransport()
+	getJWKSTransport := NewGetJWKSTransport()
+	getPoolStatsTransport := NewGetPoolStatsTransport()
 	getWalletsTransport := NewGetWalletsTransport()
+	openWalletTransport := NewOpenWalletTransport()
+	archiveWalletTransport := NewArchiveWalletTransport()
 	transactionTransport := NewTransactionTransport()
 	getTransactionsTransport := NewGetTransactionsTransport()
+	transactionDetailTransport := NewTransactionDetailTransport()
+	getRatesTransport := NewGetRatesTransport()
+	getCandlesTransport := NewGetCandlesTransport()
+	setRateOverrideTransport := NewSetRateOverrideTransport()
+	deleteRateOverrideTransport := NewDeleteRateOverrideTransport()
+	getCurrenciesTransport := NewGetCurrenciesTransport()
+	createCurrencyTransport := NewCreateCurrencyTransport()
+	updateCurrencyTransport := NewUpdateCurrencyTransport()
+	getHouseAccountsTransport := NewGetHouseAccountsTransport()
+	unlockLogInTransport := NewUnlockLogInTransport()
 	return MakeRouter(
 		[]*HandlerSettings{
 			{
@@ -264,11 +1317,96 @@ func NewPreparedServer(svc service) *mux.Router {
 				Method:  http.MethodPost,
 				Handler: NewLogInServer(logInTransport, svc),
 			},
+			{
+				Path:    URIPathLogInMFA,
+				Method:  http.MethodPost,
+				Handler: NewLogInMFAServer(logInMFATransport, svc),
+			},
+			{
+				Path:    URIPathRefreshToken,
+				Method:  http.MethodPost,
+				Handler: NewRefreshTokenServer(refreshTokenTransport, svc),
+			},
+			{
+				Path:    URIPathLogOut,
+				Method:  http.MethodPost,
+				Handler: NewLogOutServer(logOutTransport, svc),
+			},
+			{
+				Path:    URIPathRevokeAllSessions,
+				Method:  http.MethodPost,
+				Handler: NewRevokeAllSessionsServer(revokeAllSessionsTransport, svc),
+			},
+			{
+				Path:    URIPathGetMe,
+				Method:  http.MethodGet,
+				Handler: NewGetMeServer(getMeTransport, svc),
+			},
+			{
+				Path:    URIPathUpdateMe,
+				Method:  http.MethodPatch,
+				Handler: NewUpdateMeServer(updateMeTransport, svc),
+			},
+			{
+				Path:    URIPathForgotPassword,
+				Method:  http.MethodPost,
+				Handler: NewForgotPasswordServer(forgotPasswordTransport, svc),
+			},
+			{
+				Path:    URIPathResetPassword,
+				Method:  http.MethodPost,
+				Handler: NewResetPasswordServer(resetPasswordTransport, svc),
+			},
+			{
+				Path:    URIPathVerifyEmail,
+				Method:  http.MethodPost,
+				Handler: NewVerifyEmailServer(verifyEmailTransport, svc),
+			},
+			{
+				Path:    URIPathResendVerificationEmail,
+				Method:  http.MethodPost,
+				Handler: NewResendVerificationEmailServer(resendVerificationEmailTransport, svc),
+			},
+			{
+				Path:    URIPathEnrollMFA,
+				Method:  http.MethodPost,
+				Handler: NewEnrollMFAServer(enrollMFATransport, svc),
+			},
+			{
+				Path:    URIPathConfirmMFA,
+				Method:  http.MethodPost,
+				Handler: NewConfirmMFAServer(confirmMFATransport, svc),
+			},
+			{
+				Path:    URIPathDisableMFA,
+				Method:  http.MethodPost,
+				Handler: NewDisableMFAServer(disableMFATransport, svc),
+			},
+			{
+				Path:    URIPathGetJWKS,
+				Method:  http.MethodGet,
+				Handler: NewGetJWKSServer(getJWKSTransport, svc),
+			},
+			{
+				Path:    URIPathGetPoolStats,
+				Method:  http.MethodGet,
+				Handler: NewGetPoolStatsServer(getPoolStatsTransport, svc),
+			},
 			{
 				Path:    URIPathGetWallets,
 				Method:  http.MethodGet,
 				Handler: NewGetWalletsServer(getWalletsTransport, svc),
 			},
+			{
+				Path:    URIPathOpenWallet,
+				Method:  http.MethodPost,
+				Handler: NewOpenWalletServer(openWalletTransport, svc),
+			},
+			{
+				Path:    URIPathArchiveWallet,
+				Method:  http.MethodDelete,
+				Handler: NewArchiveWalletServer(archiveWalletTransport, svc),
+			},
 			{
 				Path:    URIPathTransaction,
 				Method:  http.MethodPost,
@@ -279,6 +1417,56 @@ func NewPreparedServer(svc service) *mux.Router {
 				Method:  http.MethodGet,
 				Handler: NewGetTransactionsServer(getTransactionsTransport, svc),
 			},
+			{
+				Path:    URIPathGetTransactionDetail,
+				Method:  http.MethodGet,
+				Handler: NewTransactionDetailServer(transactionDetailTransport, svc),
+			},
+			{
+				Path:    URIPathGetRates,
+				Method:  http.MethodGet,
+				Handler: NewGetRatesServer(getRatesTransport, svc),
+			},
+			{
+				Path:    URIPathGetCandles,
+				Method:  http.MethodGet,
+				Handler: NewGetCandlesServer(getCandlesTransport, svc),
+			},
+			{
+				Path:    URIPathRateOverride,
+				Method:  http.MethodPost,
+				Handler: NewSetRateOverrideServer(setRateOverrideTransport, svc),
+			},
+			{
+				Path:    URIPathDeleteRateOverride,
+				Method:  http.MethodDelete,
+				Handler: NewDeleteRateOverrideServer(deleteRateOverrideTransport, svc),
+			},
+			{
+				Path:    URIPathCurrencies,
+				Method:  http.MethodGet,
+				Handler: NewGetCurrenciesServer(getCurrenciesTransport, svc),
+			},
+			{
+				Path:    URIPathCurrencies,
+				Method:  http.MethodPost,
+				Handler: NewCreateCurrencyServer(createCurrencyTransport, svc),
+			},
+			{
+				Path:    URIPathUpdateCurrency,
+				Method:  http.MethodPatch,
+				Handler: NewUpdateCurrencyServer(updateCurrencyTransport, svc),
+			},
+			{
+				Path:    URIPathGetHouseAccounts,
+				Method:  http.MethodGet,
+				Handler: NewGetHouseAccountsServer(getHouseAccountsTransport, svc),
+			},
+			{
+				Path:    URIPathUnlockLogIn,
+				Method:  http.MethodPost,
+				Handler: NewUnlockLogInServer(unlockLogInTransport, svc),
+			},
 		},
 	)
 }
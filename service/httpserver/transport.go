@@ -3,10 +3,15 @@ package httpserver
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"github.com/crypto_app/pkg/models"
 	"github.com/crypto_app/tools"
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
+	"github.com/shopspring/decimal"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 // AliveTransport ...
@@ -132,6 +137,531 @@ func NewLogInTransport() LogInTransport {
 	return &logInTransport{}
 }
 
+// LogInMFATransport ...
+//================================================
+// LogInMFATransport
+//================================================
+type LogInMFATransport interface {
+	DecodeRequest(ctx context.Context, r *http.Request) (input models.LogInMFARequest, err error)
+	EncodeResponse(ctx context.Context, w http.ResponseWriter, response models.RegisterResponse) (err error)
+}
+
+type logInMFATransport struct {
+}
+
+// DecodeRequest method for decoding requests on server side
+func (t *logInMFATransport) DecodeRequest(ctx context.Context, r *http.Request) (input models.LogInMFARequest, err error) {
+	if er := json.NewDecoder(r.Body).Decode(&input); er != nil {
+		err = tools.NewErrorMessage(er, "Error while unmarshal LogInMFA request", http.StatusBadRequest)
+	}
+	return
+}
+
+// EncodeResponse method for encoding response on server side
+func (t *logInMFATransport) EncodeResponse(ctx context.Context, w http.ResponseWriter, response models.RegisterResponse) (err error) {
+	byteResp, err := json.Marshal(response)
+	if err != nil {
+		err = tools.NewErrorMessage(err, "Error while marshal LogInMFA response",
+			http.StatusInternalServerError)
+		return
+	}
+
+	if _, err = w.Write(byteResp); err != nil {
+		err = tools.NewErrorMessage(err,
+			"Error while writing response to response writer in LogInMFA method",
+			http.StatusInternalServerError)
+	}
+	return
+}
+
+// NewLogInMFATransport the transport creator for http requests
+func NewLogInMFATransport() LogInMFATransport {
+	return &logInMFATransport{}
+}
+
+// RefreshTokenTransport ...
+//================================================
+// RefreshTokenTransport
+//================================================
+type RefreshTokenTransport interface {
+	DecodeRequest(ctx context.Context, r *http.Request) (response models.RefreshTokenRequest, err error)
+	EncodeResponse(ctx context.Context, w http.ResponseWriter, response *models.RegisterResponse) (err error)
+}
+
+type refreshTokenTransport struct {
+}
+
+// DecodeRequest method for decoding requests on server side
+func (t *refreshTokenTransport) DecodeRequest(ctx context.Context, r *http.Request) (response models.RefreshTokenRequest, err error) {
+	er := json.NewDecoder(r.Body).Decode(&response)
+	if er != nil {
+		err = tools.NewErrorMessage(er, "Error while unmarshal RefreshToken request", http.StatusBadRequest)
+	}
+	return
+}
+
+// EncodeResponse method for encoding response on server side
+func (t *refreshTokenTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter, response *models.RegisterResponse) (err error) {
+	byteResp, err := json.Marshal(response)
+	if err != nil {
+		err = tools.NewErrorMessage(err, "Error while marshal RefreshToken response", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(byteResp)
+	if err != nil {
+		err = tools.NewErrorMessage(err, "Error while writing response to response writer in RefreshToken method",
+			http.StatusInternalServerError)
+	}
+	return
+}
+
+// NewRefreshTokenTransport the transport creator for http requests
+func NewRefreshTokenTransport() RefreshTokenTransport {
+	return &refreshTokenTransport{}
+}
+
+// LogOutTransport ...
+//================================================
+// LogOutTransport
+//================================================
+type LogOutTransport interface {
+	DecodeRequest(ctx context.Context, r *http.Request) (err error)
+	EncodeResponse(ctx context.Context, w http.ResponseWriter) (err error)
+}
+
+type logOutTransport struct {
+}
+
+// DecodeRequest method for decoding requests on server side
+func (t *logOutTransport) DecodeRequest(ctx context.Context, r *http.Request) (err error) {
+	return
+}
+
+// EncodeResponse method for encoding response on server side
+func (t *logOutTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter) (err error) {
+	return
+}
+
+// NewLogOutTransport the transport creator for http requests
+func NewLogOutTransport() LogOutTransport {
+	return &logOutTransport{}
+}
+
+// RevokeAllSessionsTransport ...
+//================================================
+// RevokeAllSessionsTransport
+//================================================
+type RevokeAllSessionsTransport interface {
+	DecodeRequest(ctx context.Context, r *http.Request) (err error)
+	EncodeResponse(ctx context.Context, w http.ResponseWriter) (err error)
+}
+
+type revokeAllSessionsTransport struct {
+}
+
+// DecodeRequest method for decoding requests on server side
+func (t *revokeAllSessionsTransport) DecodeRequest(ctx context.Context, r *http.Request) (err error) {
+	return
+}
+
+// EncodeResponse method for encoding response on server side
+func (t *revokeAllSessionsTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter) (err error) {
+	return
+}
+
+// NewRevokeAllSessionsTransport the transport creator for http requests
+func NewRevokeAllSessionsTransport() RevokeAllSessionsTransport {
+	return &revokeAllSessionsTransport{}
+}
+
+// GetMeTransport ...
+//================================================
+// GetMeTransport
+//================================================
+type GetMeTransport interface {
+	DecodeRequest(ctx context.Context, r *http.Request) (err error)
+	EncodeResponse(ctx context.Context, w http.ResponseWriter, response models.SingleUserData) (err error)
+}
+
+type getMeTransport struct {
+}
+
+// DecodeRequest method for decoding requests on server side
+func (t *getMeTransport) DecodeRequest(ctx context.Context, r *http.Request) (err error) {
+	return
+}
+
+// EncodeResponse method for encoding response on server side
+func (t *getMeTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter, response models.SingleUserData) (err error) {
+	byteResp, err := json.Marshal(response)
+	if err != nil {
+		err = tools.NewErrorMessage(err, "Error while marshal GetMe response",
+			http.StatusInternalServerError)
+		return
+	}
+
+	if _, err = w.Write(byteResp); err != nil {
+		err = tools.NewErrorMessage(err,
+			"Error while writing response to response writer in GetMe method",
+			http.StatusInternalServerError)
+	}
+	return
+}
+
+// NewGetMeTransport the transport creator for http requests
+func NewGetMeTransport() GetMeTransport {
+	return &getMeTransport{}
+}
+
+// UpdateMeTransport ...
+//================================================
+// UpdateMeTransport
+//================================================
+type UpdateMeTransport interface {
+	DecodeRequest(ctx context.Context, r *http.Request) (input models.UpdateUserData, err error)
+	EncodeResponse(ctx context.Context, w http.ResponseWriter, response models.SingleUserData) (err error)
+}
+
+type updateMeTransport struct {
+}
+
+// DecodeRequest method for decoding requests on server side
+func (t *updateMeTransport) DecodeRequest(ctx context.Context, r *http.Request) (input models.UpdateUserData, err error) {
+	if er := json.NewDecoder(r.Body).Decode(&input); er != nil {
+		err = tools.NewErrorMessage(er, "Error while unmarshal UpdateMe request", http.StatusBadRequest)
+	}
+	return
+}
+
+// EncodeResponse method for encoding response on server side
+func (t *updateMeTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter, response models.SingleUserData) (err error) {
+	byteResp, err := json.Marshal(response)
+	if err != nil {
+		err = tools.NewErrorMessage(err, "Error while marshal UpdateMe response",
+			http.StatusInternalServerError)
+		return
+	}
+
+	if _, err = w.Write(byteResp); err != nil {
+		err = tools.NewErrorMessage(err,
+			"Error while writing response to response writer in UpdateMe method",
+			http.StatusInternalServerError)
+	}
+	return
+}
+
+// NewUpdateMeTransport the transport creator for http requests
+func NewUpdateMeTransport() UpdateMeTransport {
+	return &updateMeTransport{}
+}
+
+// ForgotPasswordTransport ...
+//================================================
+// ForgotPasswordTransport
+//================================================
+type ForgotPasswordTransport interface {
+	DecodeRequest(ctx context.Context, r *http.Request) (input models.ForgotPasswordRequest, err error)
+	EncodeResponse(ctx context.Context, w http.ResponseWriter) (err error)
+}
+
+type forgotPasswordTransport struct {
+}
+
+// DecodeRequest method for decoding requests on server side
+func (t *forgotPasswordTransport) DecodeRequest(ctx context.Context, r *http.Request) (input models.ForgotPasswordRequest, err error) {
+	if er := json.NewDecoder(r.Body).Decode(&input); er != nil {
+		err = tools.NewErrorMessage(er, "Error while unmarshal ForgotPassword request", http.StatusBadRequest)
+	}
+	return
+}
+
+// EncodeResponse method for encoding response on server side
+func (t *forgotPasswordTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter) (err error) {
+	return
+}
+
+// NewForgotPasswordTransport the transport creator for http requests
+func NewForgotPasswordTransport() ForgotPasswordTransport {
+	return &forgotPasswordTransport{}
+}
+
+// ResetPasswordTransport ...
+//================================================
+// ResetPasswordTransport
+//================================================
+type ResetPasswordTransport interface {
+	DecodeRequest(ctx context.Context, r *http.Request) (input models.ResetPasswordRequest, err error)
+	EncodeResponse(ctx context.Context, w http.ResponseWriter) (err error)
+}
+
+type resetPasswordTransport struct {
+}
+
+// DecodeRequest method for decoding requests on server side
+func (t *resetPasswordTransport) DecodeRequest(ctx context.Context, r *http.Request) (input models.ResetPasswordRequest, err error) {
+	if er := json.NewDecoder(r.Body).Decode(&input); er != nil {
+		err = tools.NewErrorMessage(er, "Error while unmarshal ResetPassword request", http.StatusBadRequest)
+	}
+	return
+}
+
+// EncodeResponse method for encoding response on server side
+func (t *resetPasswordTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter) (err error) {
+	return
+}
+
+// NewResetPasswordTransport the transport creator for http requests
+func NewResetPasswordTransport() ResetPasswordTransport {
+	return &resetPasswordTransport{}
+}
+
+// VerifyEmailTransport ...
+//================================================
+// VerifyEmailTransport
+//================================================
+type VerifyEmailTransport interface {
+	DecodeRequest(ctx context.Context, r *http.Request) (input models.VerifyEmailRequest, err error)
+	EncodeResponse(ctx context.Context, w http.ResponseWriter) (err error)
+}
+
+type verifyEmailTransport struct {
+}
+
+// DecodeRequest method for decoding requests on server side
+func (t *verifyEmailTransport) DecodeRequest(ctx context.Context, r *http.Request) (input models.VerifyEmailRequest, err error) {
+	if er := json.NewDecoder(r.Body).Decode(&input); er != nil {
+		err = tools.NewErrorMessage(er, "Error while unmarshal VerifyEmail request", http.StatusBadRequest)
+	}
+	return
+}
+
+// EncodeResponse method for encoding response on server side
+func (t *verifyEmailTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter) (err error) {
+	return
+}
+
+// NewVerifyEmailTransport the transport creator for http requests
+func NewVerifyEmailTransport() VerifyEmailTransport {
+	return &verifyEmailTransport{}
+}
+
+// ResendVerificationEmailTransport ...
+//================================================
+// ResendVerificationEmailTransport
+//================================================
+type ResendVerificationEmailTransport interface {
+	DecodeRequest(ctx context.Context, r *http.Request) (err error)
+	EncodeResponse(ctx context.Context, w http.ResponseWriter) (err error)
+}
+
+type resendVerificationEmailTransport struct {
+}
+
+// DecodeRequest method for decoding requests on server side
+func (t *resendVerificationEmailTransport) DecodeRequest(ctx context.Context, r *http.Request) (err error) {
+	return
+}
+
+// EncodeResponse method for encoding response on server side
+func (t *resendVerificationEmailTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter) (err error) {
+	return
+}
+
+// NewResendVerificationEmailTransport the transport creator for http requests
+func NewResendVerificationEmailTransport() ResendVerificationEmailTransport {
+	return &resendVerificationEmailTransport{}
+}
+
+// EnrollMFATransport ...
+//================================================
+// EnrollMFATransport
+//================================================
+type EnrollMFATransport interface {
+	DecodeRequest(ctx context.Context, r *http.Request) (err error)
+	EncodeResponse(ctx context.Context, w http.ResponseWriter, response models.MFAEnrollResponse) (err error)
+}
+
+type enrollMFATransport struct {
+}
+
+// DecodeRequest method for decoding requests on server side
+func (t *enrollMFATransport) DecodeRequest(ctx context.Context, r *http.Request) (err error) {
+	return
+}
+
+// EncodeResponse method for encoding response on server side
+func (t *enrollMFATransport) EncodeResponse(ctx context.Context, w http.ResponseWriter, response models.MFAEnrollResponse) (err error) {
+	byteResp, err := json.Marshal(response)
+	if err != nil {
+		err = tools.NewErrorMessage(err, "Error while marshal EnrollMFA response",
+			http.StatusInternalServerError)
+		return
+	}
+
+	if _, err = w.Write(byteResp); err != nil {
+		err = tools.NewErrorMessage(err,
+			"Error while writing response to response writer in EnrollMFA method",
+			http.StatusInternalServerError)
+	}
+	return
+}
+
+// NewEnrollMFATransport the transport creator for http requests
+func NewEnrollMFATransport() EnrollMFATransport {
+	return &enrollMFATransport{}
+}
+
+// ConfirmMFATransport ...
+//================================================
+// ConfirmMFATransport
+//================================================
+type ConfirmMFATransport interface {
+	DecodeRequest(ctx context.Context, r *http.Request) (input models.MFACodeRequest, err error)
+	EncodeResponse(ctx context.Context, w http.ResponseWriter, response models.MFAConfirmResponse) (err error)
+}
+
+type confirmMFATransport struct {
+}
+
+// DecodeRequest method for decoding requests on server side
+func (t *confirmMFATransport) DecodeRequest(ctx context.Context, r *http.Request) (input models.MFACodeRequest, err error) {
+	if er := json.NewDecoder(r.Body).Decode(&input); er != nil {
+		err = tools.NewErrorMessage(er, "Error while unmarshal ConfirmMFA request", http.StatusBadRequest)
+	}
+	return
+}
+
+// EncodeResponse method for encoding response on server side
+func (t *confirmMFATransport) EncodeResponse(ctx context.Context, w http.ResponseWriter, response models.MFAConfirmResponse) (err error) {
+	byteResp, err := json.Marshal(response)
+	if err != nil {
+		err = tools.NewErrorMessage(err, "Error while marshal ConfirmMFA response",
+			http.StatusInternalServerError)
+		return
+	}
+
+	if _, err = w.Write(byteResp); err != nil {
+		err = tools.NewErrorMessage(err,
+			"Error while writing response to response writer in ConfirmMFA method",
+			http.StatusInternalServerError)
+	}
+	return
+}
+
+// NewConfirmMFATransport the transport creator for http requests
+func NewConfirmMFATransport() ConfirmMFATransport {
+	return &confirmMFATransport{}
+}
+
+// DisableMFATransport ...
+//================================================
+// DisableMFATransport
+//================================================
+type DisableMFATransport interface {
+	DecodeRequest(ctx context.Context, r *http.Request) (input models.MFACodeRequest, err error)
+	EncodeResponse(ctx context.Context, w http.ResponseWriter) (err error)
+}
+
+type disableMFATransport struct {
+}
+
+// DecodeRequest method for decoding requests on server side
+func (t *disableMFATransport) DecodeRequest(ctx context.Context, r *http.Request) (input models.MFACodeRequest, err error) {
+	if er := json.NewDecoder(r.Body).Decode(&input); er != nil {
+		err = tools.NewErrorMessage(er, "Error while unmarshal DisableMFA request", http.StatusBadRequest)
+	}
+	return
+}
+
+// EncodeResponse method for encoding response on server side
+func (t *disableMFATransport) EncodeResponse(ctx context.Context, w http.ResponseWriter) (err error) {
+	return
+}
+
+// NewDisableMFATransport the transport creator for http requests
+func NewDisableMFATransport() DisableMFATransport {
+	return &disableMFATransport{}
+}
+
+// GetJWKSTransport ...
+//================================================
+// GetJWKSTransport
+//================================================
+type GetJWKSTransport interface {
+	DecodeRequest(ctx context.Context, r *http.Request) (err error)
+	EncodeResponse(ctx context.Context, w http.ResponseWriter, response *models.JWKSResponse) (err error)
+}
+
+type getJWKSTransport struct {
+}
+
+// DecodeRequest method for decoding requests on server side
+func (t *getJWKSTransport) DecodeRequest(ctx context.Context, r *http.Request) (err error) {
+	return
+}
+
+// EncodeResponse method for encoding response on server side
+func (t *getJWKSTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter, response *models.JWKSResponse) (err error) {
+	w.Header().Set("Content-Type", "application/json")
+	byteResp, err := json.Marshal(response)
+	if err != nil {
+		err = tools.NewErrorMessage(err, "Error while marshal GetJWKS response", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(byteResp)
+	if err != nil {
+		err = tools.NewErrorMessage(err, "Error while writing response to response writer in GetJWKS method",
+			http.StatusInternalServerError)
+	}
+	return
+}
+
+// NewGetJWKSTransport the transport creator for http requests
+func NewGetJWKSTransport() GetJWKSTransport {
+	return &getJWKSTransport{}
+}
+
+// GetPoolStatsTransport ...
+//================================================
+// GetPoolStatsTransport
+//================================================
+type GetPoolStatsTransport interface {
+	DecodeRequest(ctx context.Context, r *http.Request) (err error)
+	EncodeResponse(ctx context.Context, w http.ResponseWriter, response *models.PoolStatsResponse) (err error)
+}
+
+type getPoolStatsTransport struct {
+}
+
+// DecodeRequest method for decoding requests on server side
+func (t *getPoolStatsTransport) DecodeRequest(ctx context.Context, r *http.Request) (err error) {
+	return
+}
+
+// EncodeResponse method for encoding response on server side
+func (t *getPoolStatsTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter, response *models.PoolStatsResponse) (err error) {
+	w.Header().Set("Content-Type", "application/json")
+	byteResp, err := json.Marshal(response)
+	if err != nil {
+		err = tools.NewErrorMessage(err, "Error while marshal GetPoolStats response", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(byteResp)
+	if err != nil {
+		err = tools.NewErrorMessage(err, "Error while writing response to response writer in GetPoolStats method",
+			http.StatusInternalServerError)
+	}
+	return
+}
+
+// NewGetPoolStatsTransport the transport creator for http requests
+func NewGetPoolStatsTransport() GetPoolStatsTransport {
+	return &getPoolStatsTransport{}
+}
+
 // GetWallets ...
 //================================================
 // GetWallets
@@ -141,16 +671,218 @@ type GetWalletsTransport interface {
 	EncodeResponse(ctx context.Context, w http.ResponseWriter, response []*models.WalletsResponse) (err error)
 }
 
-type getWalletsTransport struct {
+type getWalletsTransport struct {
+}
+
+// DecodeRequest method for decoding requests on server side
+func (t *getWalletsTransport) DecodeRequest(ctx context.Context, r *http.Request) (err error) {
+	return
+}
+
+// EncodeResponse method for encoding response on server side
+func (t *getWalletsTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter, response []*models.WalletsResponse) (err error) {
+	byteResp, err := json.Marshal(response)
+	if err != nil {
+		err = tools.NewErrorMessage(err, "Error while marshal GetWallets response",
+			http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(byteResp)
+	if err != nil {
+		err = tools.NewErrorMessage(err,
+			"Error while writing response to response writer in GetWallets method",
+			http.StatusInternalServerError)
+	}
+	return
+}
+
+// NewGetWalletsTransport the transport creator for http requests
+func NewGetWalletsTransport() GetWalletsTransport {
+	return &getWalletsTransport{}
+}
+
+// OpenWalletTransport ...
+//================================================
+// OpenWalletTransport
+//================================================
+type OpenWalletTransport interface {
+	DecodeRequest(ctx context.Context, r *http.Request) (input models.OpenWalletRequest, err error)
+	EncodeResponse(ctx context.Context, w http.ResponseWriter, response models.WalletsResponse) (err error)
+}
+
+type openWalletTransport struct {
+}
+
+// DecodeRequest method for decoding requests on server side
+func (t *openWalletTransport) DecodeRequest(ctx context.Context, r *http.Request) (input models.OpenWalletRequest, err error) {
+	if er := json.NewDecoder(r.Body).Decode(&input); er != nil {
+		err = tools.NewErrorMessage(er, "Error while unmarshal OpenWallet request", http.StatusBadRequest)
+	}
+	return
+}
+
+// EncodeResponse method for encoding response on server side
+func (t *openWalletTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter, response models.WalletsResponse) (err error) {
+	byteResp, err := json.Marshal(response)
+	if err != nil {
+		err = tools.NewErrorMessage(err, "Error while marshal OpenWallet response",
+			http.StatusInternalServerError)
+		return
+	}
+
+	if _, err = w.Write(byteResp); err != nil {
+		err = tools.NewErrorMessage(err,
+			"Error while writing response to response writer in OpenWallet method",
+			http.StatusInternalServerError)
+	}
+	return
+}
+
+// NewOpenWalletTransport the transport creator for http requests
+func NewOpenWalletTransport() OpenWalletTransport {
+	return &openWalletTransport{}
+}
+
+// ArchiveWalletTransport ...
+//================================================
+// ArchiveWalletTransport
+//================================================
+type ArchiveWalletTransport interface {
+	DecodeRequest(ctx context.Context, r *http.Request) (address string, err error)
+	EncodeResponse(ctx context.Context, w http.ResponseWriter) (err error)
+}
+
+type archiveWalletTransport struct {
+}
+
+// DecodeRequest method for decoding requests on server side
+func (t *archiveWalletTransport) DecodeRequest(ctx context.Context, r *http.Request) (address string, err error) {
+	return mux.Vars(r)["address"], nil
+}
+
+// EncodeResponse method for encoding response on server side
+func (t *archiveWalletTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter) (err error) {
+	return
+}
+
+// NewArchiveWalletTransport the transport creator for http requests
+func NewArchiveWalletTransport() ArchiveWalletTransport {
+	return &archiveWalletTransport{}
+}
+
+// TransactionTransport ...
+//================================================
+// TransactionTransport
+//================================================
+type TransactionTransport interface {
+	DecodeRequest(ctx context.Context, r *http.Request) (response models.TransactionRequest, err error)
+	EncodeResponse(ctx context.Context, w http.ResponseWriter, response models.TransactionDetail) (err error)
+}
+
+type transactionTransport struct {
+}
+
+// DecodeRequest method for decoding requests on server side
+func (t *transactionTransport) DecodeRequest(ctx context.Context, r *http.Request) (response models.TransactionRequest, err error) {
+	er := json.NewDecoder(r.Body).Decode(&response)
+	if er != nil {
+		err = tools.NewErrorMessage(er, "Error while unmarshal LogIn request", http.StatusInternalServerError)
+		return
+	}
+
+	response.IdempotencyKey = r.Header.Get(idempotencyKey)
+	if len(response.IdempotencyKey) > maxIdempotencyKeyLen {
+		err = tools.NewErrorMessage(errors.New("idempotency key is too long"),
+			"Слишком длинный Idempotency-Key", http.StatusBadRequest)
+	}
+	return
+}
+
+// EncodeResponse method for encoding response on server side
+func (t *transactionTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter, response models.TransactionDetail) (err error) {
+	// the failed transfer is recorded as well, the client gets its id and the reason
+	if !response.Success {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	return encodeTransactionDetail(w, response)
+}
+
+// NewTransactionTransport the transport creator for http requests
+func NewTransactionTransport() TransactionTransport {
+	return &transactionTransport{}
+}
+
+// GetTransactionsTransport ...
+//================================================
+// GetTransactionsTransport
+//================================================
+type GetTransactionsTransport interface {
+	DecodeRequest(ctx context.Context, r *http.Request) (input models.GetTransactionsRequest, err error)
+	EncodeResponse(ctx context.Context, w http.ResponseWriter, response models.GetTransactionResponse) (err error)
+}
+
+type getTransactionsTransport struct {
 }
 
 // DecodeRequest method for decoding requests on server side
-func (t *getWalletsTransport) DecodeRequest(ctx context.Context, r *http.Request) (err error) {
+func (t *getTransactionsTransport) DecodeRequest(ctx context.Context, r *http.Request) (input models.GetTransactionsRequest, err error) {
+	query := r.URL.Query()
+
+	// the pages are gone, the old client would get the first page over and over
+	if _, ok := query["page_num"]; ok {
+		err = tools.NewErrorMessage(errors.New("page_num is not supported"),
+			"page_num больше не поддерживается, передайте cursor из ответа", http.StatusBadRequest)
+		return
+	}
+
+	input.Cursor = query.Get("cursor")
+	input.Currency = query.Get("currency")
+	input.Address = query.Get("address")
+	input.Direction = query.Get("direction")
+
+	// per_page is the name of the limit before the cursor pagination
+	limit := query.Get("limit")
+	if limit == "" {
+		limit = query.Get("per_page")
+	}
+	if limit != "" {
+		if input.Limit, err = strconv.Atoi(limit); err != nil {
+			err = tools.NewErrorMessage(err, "Неправильно передан limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if input.DateFrom, err = parseQueryTime(query.Get("date_from")); err != nil {
+		err = tools.NewErrorMessage(err, "Неправильно передан date_from", http.StatusBadRequest)
+		return
+	}
+	if input.DateTo, err = parseQueryTime(query.Get("date_to")); err != nil {
+		err = tools.NewErrorMessage(err, "Неправильно передан date_to", http.StatusBadRequest)
+		return
+	}
+
+	if success := query.Get("success"); success != "" {
+		var value bool
+		if value, err = strconv.ParseBool(success); err != nil {
+			err = tools.NewErrorMessage(err, "Неправильно передан success", http.StatusBadRequest)
+			return
+		}
+		input.Success = &value
+	}
+
+	if input.MinAmount, err = parseQueryDecimal(query.Get("min_amount")); err != nil {
+		err = tools.NewErrorMessage(err, "Неправильно передан min_amount", http.StatusBadRequest)
+		return
+	}
+	if input.MaxAmount, err = parseQueryDecimal(query.Get("max_amount")); err != nil {
+		err = tools.NewErrorMessage(err, "Неправильно передан max_amount", http.StatusBadRequest)
+	}
 	return
 }
 
 // EncodeResponse method for encoding response on server side
-func (t *getWalletsTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter, response []*models.WalletsResponse) (err error) {
+func (t *getTransactionsTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter, response models.GetTransactionResponse) (err error) {
 	byteResp, err := json.Marshal(response)
 	if err != nil {
 		err = tools.NewErrorMessage(err, "Error while marshal GetWallets response",
@@ -167,87 +899,422 @@ func (t *getWalletsTransport) EncodeResponse(ctx context.Context, w http.Respons
 	return
 }
 
-// NewGetWalletsTransport the transport creator for http requests
-func NewGetWalletsTransport() GetWalletsTransport {
-	return &getWalletsTransport{}
+// NewGetTransactionsTransport the transport creator for http requests
+func NewGetTransactionsTransport() GetTransactionsTransport {
+	return &getTransactionsTransport{}
 }
 
-// TransactionTransport ...
+// TransactionDetailTransport ...
 //================================================
-// TransactionTransport
+// TransactionDetailTransport
 //================================================
-type TransactionTransport interface {
-	DecodeRequest(ctx context.Context, r *http.Request) (response models.TransactionRequest, err error)
+type TransactionDetailTransport interface {
+	DecodeRequest(ctx context.Context, r *http.Request) (transactionID string, err error)
+	EncodeResponse(ctx context.Context, w http.ResponseWriter, response models.TransactionDetail) (err error)
+}
+
+type transactionDetailTransport struct {
+}
+
+// DecodeRequest method for decoding requests on server side
+func (t *transactionDetailTransport) DecodeRequest(ctx context.Context, r *http.Request) (transactionID string, err error) {
+	id, err := uuid.FromString(mux.Vars(r)["id"])
+	if err != nil {
+		err = tools.NewErrorMessage(err, "Невалидный id транзакции", http.StatusBadRequest)
+		return
+	}
+	return id.String(), nil
+}
+
+// EncodeResponse method for encoding response on server side
+func (t *transactionDetailTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter, response models.TransactionDetail) (err error) {
+	return encodeTransactionDetail(w, response)
+}
+
+// NewTransactionDetailTransport the transport creator for http requests
+func NewTransactionDetailTransport() TransactionDetailTransport {
+	return &transactionDetailTransport{}
+}
+
+// GetRatesTransport ...
+//================================================
+// GetRatesTransport
+//================================================
+type GetRatesTransport interface {
+	DecodeRequest(ctx context.Context, r *http.Request) (err error)
+	EncodeResponse(ctx context.Context, w http.ResponseWriter, response []*models.RateResponse) (err error)
+}
+
+type getRatesTransport struct {
+}
+
+// DecodeRequest method for decoding requests on server side
+func (t *getRatesTransport) DecodeRequest(ctx context.Context, r *http.Request) (err error) {
+	return
+}
+
+// EncodeResponse method for encoding response on server side
+func (t *getRatesTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter, response []*models.RateResponse) (err error) {
+	byteResp, err := json.Marshal(response)
+	if err != nil {
+		err = tools.NewErrorMessage(err, "Error while marshal GetRates response",
+			http.StatusInternalServerError)
+		return
+	}
+
+	if _, err = w.Write(byteResp); err != nil {
+		err = tools.NewErrorMessage(err,
+			"Error while writing response to response writer in GetRates method",
+			http.StatusInternalServerError)
+	}
+	return
+}
+
+// NewGetRatesTransport the transport creator for http requests
+func NewGetRatesTransport() GetRatesTransport {
+	return &getRatesTransport{}
+}
+
+// GetCandlesTransport ...
+//================================================
+// GetCandlesTransport
+//================================================
+type GetCandlesTransport interface {
+	DecodeRequest(ctx context.Context, r *http.Request) (input models.GetCandlesRequest, err error)
+	EncodeResponse(ctx context.Context, w http.ResponseWriter, response models.GetCandlesResponse) (err error)
+}
+
+type getCandlesTransport struct {
+}
+
+// DecodeRequest method for decoding requests on server side
+func (t *getCandlesTransport) DecodeRequest(ctx context.Context, r *http.Request) (input models.GetCandlesRequest, err error) {
+	query := r.URL.Query()
+
+	input.Currency = mux.Vars(r)["currency"]
+	input.Interval = query.Get("interval")
+
+	if input.From, err = parseQueryTime(query.Get("from")); err != nil {
+		err = tools.NewErrorMessage(err, "Неправильно передан from", http.StatusBadRequest)
+		return
+	}
+	if input.To, err = parseQueryTime(query.Get("to")); err != nil {
+		err = tools.NewErrorMessage(err, "Неправильно передан to", http.StatusBadRequest)
+	}
+	return
+}
+
+// EncodeResponse method for encoding response on server side
+func (t *getCandlesTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter, response models.GetCandlesResponse) (err error) {
+	byteResp, err := json.Marshal(response)
+	if err != nil {
+		err = tools.NewErrorMessage(err, "Error while marshal GetCandles response",
+			http.StatusInternalServerError)
+		return
+	}
+
+	if _, err = w.Write(byteResp); err != nil {
+		err = tools.NewErrorMessage(err,
+			"Error while writing response to response writer in GetCandles method",
+			http.StatusInternalServerError)
+	}
+	return
+}
+
+// NewGetCandlesTransport the transport creator for http requests
+func NewGetCandlesTransport() GetCandlesTransport {
+	return &getCandlesTransport{}
+}
+
+// SetRateOverrideTransport ...
+//================================================
+// SetRateOverrideTransport
+//================================================
+type SetRateOverrideTransport interface {
+	DecodeRequest(ctx context.Context, r *http.Request) (input models.RateOverrideRequest, err error)
 	EncodeResponse(ctx context.Context, w http.ResponseWriter) (err error)
 }
 
-type transactionTransport struct {
+type setRateOverrideTransport struct {
 }
 
 // DecodeRequest method for decoding requests on server side
-func (t *transactionTransport) DecodeRequest(ctx context.Context, r *http.Request) (response models.TransactionRequest, err error) {
-	er := json.NewDecoder(r.Body).Decode(&response)
-	if er != nil {
-		err = tools.NewErrorMessage(er, "Error while unmarshal LogIn request", http.StatusInternalServerError)
+func (t *setRateOverrideTransport) DecodeRequest(ctx context.Context, r *http.Request) (input models.RateOverrideRequest, err error) {
+	if er := json.NewDecoder(r.Body).Decode(&input); er != nil {
+		err = tools.NewErrorMessage(er, "Error while unmarshal SetRateOverride request", http.StatusBadRequest)
 	}
 	return
 }
 
 // EncodeResponse method for encoding response on server side
-func (t *transactionTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter) (err error) {
+func (t *setRateOverrideTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter) (err error) {
 	return
 }
 
-// NewTransactionTransport the transport creator for http requests
-func NewTransactionTransport() TransactionTransport {
-	return &transactionTransport{}
+// NewSetRateOverrideTransport the transport creator for http requests
+func NewSetRateOverrideTransport() SetRateOverrideTransport {
+	return &setRateOverrideTransport{}
 }
 
-// GetTransactionsTransport ...
+// DeleteRateOverrideTransport ...
 //================================================
-// GetTransactionsTransport
+// DeleteRateOverrideTransport
 //================================================
-type GetTransactionsTransport interface {
-	DecodeRequest(ctx context.Context, r *http.Request) (perPage, pageNum int, err error)
-	EncodeResponse(ctx context.Context, w http.ResponseWriter, response models.GetTransactionResponse) (err error)
+type DeleteRateOverrideTransport interface {
+	DecodeRequest(ctx context.Context, r *http.Request) (currency string, err error)
+	EncodeResponse(ctx context.Context, w http.ResponseWriter) (err error)
 }
 
-type getTransactionsTransport struct {
+type deleteRateOverrideTransport struct {
+}
+
+// DecodeRequest method for decoding requests on server side
+func (t *deleteRateOverrideTransport) DecodeRequest(ctx context.Context, r *http.Request) (currency string, err error) {
+	return mux.Vars(r)["currency"], nil
+}
+
+// EncodeResponse method for encoding response on server side
+func (t *deleteRateOverrideTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter) (err error) {
+	return
+}
+
+// NewDeleteRateOverrideTransport the transport creator for http requests
+func NewDeleteRateOverrideTransport() DeleteRateOverrideTransport {
+	return &deleteRateOverrideTransport{}
+}
+
+// GetCurrenciesTransport ...
+//================================================
+// GetCurrenciesTransport
+//================================================
+type GetCurrenciesTransport interface {
+	DecodeRequest(ctx context.Context, r *http.Request) (err error)
+	EncodeResponse(ctx context.Context, w http.ResponseWriter, response []*models.CurrencyResponse) (err error)
+}
+
+type getCurrenciesTransport struct {
 }
 
 // DecodeRequest method for decoding requests on server side
-func (t *getTransactionsTransport) DecodeRequest(ctx context.Context, r *http.Request) (perPage, pageNum int, err error) {
-	perPage, err = strconv.Atoi(r.URL.Query().Get("per_page"))
+func (t *getCurrenciesTransport) DecodeRequest(ctx context.Context, r *http.Request) (err error) {
+	return
+}
+
+// EncodeResponse method for encoding response on server side
+func (t *getCurrenciesTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter, response []*models.CurrencyResponse) (err error) {
+	byteResp, err := json.Marshal(response)
 	if err != nil {
-		err = tools.NewErrorMessage(err, "Неправильно переданы query параметры", http.StatusBadRequest)
+		err = tools.NewErrorMessage(err, "Error while marshal GetCurrencies response",
+			http.StatusInternalServerError)
 		return
 	}
-	pageNum, err = strconv.Atoi(r.URL.Query().Get("page_num"))
+
+	if _, err = w.Write(byteResp); err != nil {
+		err = tools.NewErrorMessage(err,
+			"Error while writing response to response writer in GetCurrencies method",
+			http.StatusInternalServerError)
+	}
+	return
+}
+
+// NewGetCurrenciesTransport the transport creator for http requests
+func NewGetCurrenciesTransport() GetCurrenciesTransport {
+	return &getCurrenciesTransport{}
+}
+
+// CreateCurrencyTransport ...
+//================================================
+// CreateCurrencyTransport
+//================================================
+type CreateCurrencyTransport interface {
+	DecodeRequest(ctx context.Context, r *http.Request) (input models.CreateCurrencyRequest, err error)
+	EncodeResponse(ctx context.Context, w http.ResponseWriter, response models.CurrencyResponse) (err error)
+}
+
+type createCurrencyTransport struct {
+}
+
+// DecodeRequest method for decoding requests on server side
+func (t *createCurrencyTransport) DecodeRequest(ctx context.Context, r *http.Request) (input models.CreateCurrencyRequest, err error) {
+	if er := json.NewDecoder(r.Body).Decode(&input); er != nil {
+		err = tools.NewErrorMessage(er, "Error while unmarshal CreateCurrency request", http.StatusBadRequest)
+	}
+	return
+}
+
+// EncodeResponse method for encoding response on server side
+func (t *createCurrencyTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter, response models.CurrencyResponse) (err error) {
+	byteResp, err := json.Marshal(response)
 	if err != nil {
-		err = tools.NewErrorMessage(err, "Неправильно переданы query параметры", http.StatusBadRequest)
+		err = tools.NewErrorMessage(err, "Error while marshal CreateCurrency response",
+			http.StatusInternalServerError)
+		return
+	}
+
+	if _, err = w.Write(byteResp); err != nil {
+		err = tools.NewErrorMessage(err,
+			"Error while writing response to response writer in CreateCurrency method",
+			http.StatusInternalServerError)
+	}
+	return
+}
+
+// NewCreateCurrencyTransport the transport creator for http requests
+func NewCreateCurrencyTransport() CreateCurrencyTransport {
+	return &createCurrencyTransport{}
+}
+
+// UpdateCurrencyTransport ...
+//================================================
+// UpdateCurrencyTransport
+//================================================
+type UpdateCurrencyTransport interface {
+	DecodeRequest(ctx context.Context, r *http.Request) (input models.UpdateCurrencyRequest, err error)
+	EncodeResponse(ctx context.Context, w http.ResponseWriter, response models.CurrencyResponse) (err error)
+}
+
+type updateCurrencyTransport struct {
+}
+
+// DecodeRequest method for decoding requests on server side
+func (t *updateCurrencyTransport) DecodeRequest(ctx context.Context, r *http.Request) (input models.UpdateCurrencyRequest, err error) {
+	if er := json.NewDecoder(r.Body).Decode(&input); er != nil {
+		err = tools.NewErrorMessage(er, "Error while unmarshal UpdateCurrency request", http.StatusBadRequest)
+		return
 	}
+	input.Code = mux.Vars(r)["code"]
 	return
 }
 
 // EncodeResponse method for encoding response on server side
-func (t *getTransactionsTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter, response models.GetTransactionResponse) (err error) {
+func (t *updateCurrencyTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter, response models.CurrencyResponse) (err error) {
 	byteResp, err := json.Marshal(response)
 	if err != nil {
-		err = tools.NewErrorMessage(err, "Error while marshal GetWallets response",
+		err = tools.NewErrorMessage(err, "Error while marshal UpdateCurrency response",
 			http.StatusInternalServerError)
 		return
 	}
 
-	_, err = w.Write(byteResp)
+	if _, err = w.Write(byteResp); err != nil {
+		err = tools.NewErrorMessage(err,
+			"Error while writing response to response writer in UpdateCurrency method",
+			http.StatusInternalServerError)
+	}
+	return
+}
+
+// NewUpdateCurrencyTransport the transport creator for http requests
+func NewUpdateCurrencyTransport() UpdateCurrencyTransport {
+	return &updateCurrencyTransport{}
+}
+
+// GetHouseAccountsTransport ...
+//================================================
+// GetHouseAccountsTransport
+//================================================
+type GetHouseAccountsTransport interface {
+	DecodeRequest(ctx context.Context, r *http.Request) (err error)
+	EncodeResponse(ctx context.Context, w http.ResponseWriter, response []*models.HouseAccountResponse) (err error)
+}
+
+type getHouseAccountsTransport struct {
+}
+
+// DecodeRequest method for decoding requests on server side
+func (t *getHouseAccountsTransport) DecodeRequest(ctx context.Context, r *http.Request) (err error) {
+	return
+}
+
+// EncodeResponse method for encoding response on server side
+func (t *getHouseAccountsTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter, response []*models.HouseAccountResponse) (err error) {
+	byteResp, err := json.Marshal(response)
 	if err != nil {
+		err = tools.NewErrorMessage(err, "Error while marshal GetHouseAccounts response",
+			http.StatusInternalServerError)
+		return
+	}
+
+	if _, err = w.Write(byteResp); err != nil {
 		err = tools.NewErrorMessage(err,
-			"Error while writing response to response writer in GetWallets method",
+			"Error while writing response to response writer in GetHouseAccounts method",
 			http.StatusInternalServerError)
 	}
 	return
 }
 
-// NewGetTransactionsTransport the transport creator for http requests
-func NewGetTransactionsTransport() GetTransactionsTransport {
-	return &getTransactionsTransport{}
+// NewGetHouseAccountsTransport the transport creator for http requests
+func NewGetHouseAccountsTransport() GetHouseAccountsTransport {
+	return &getHouseAccountsTransport{}
+}
+
+// UnlockLogInTransport ...
+//================================================
+// UnlockLogInTransport
+//================================================
+type UnlockLogInTransport interface {
+	DecodeRequest(ctx context.Context, r *http.Request) (input models.UnlockLogInRequest, err error)
+	EncodeResponse(ctx context.Context, w http.ResponseWriter) (err error)
+}
+
+type unlockLogInTransport struct {
+}
+
+// DecodeRequest method for decoding requests on server side
+func (t *unlockLogInTransport) DecodeRequest(ctx context.Context, r *http.Request) (input models.UnlockLogInRequest, err error) {
+	if er := json.NewDecoder(r.Body).Decode(&input); er != nil {
+		err = tools.NewErrorMessage(er, "Error while unmarshal UnlockLogIn request", http.StatusBadRequest)
+	}
+	return
+}
+
+// EncodeResponse method for encoding response on server side
+func (t *unlockLogInTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter) (err error) {
+	return
+}
+
+// NewUnlockLogInTransport the transport creator for http requests
+func NewUnlockLogInTransport() UnlockLogInTransport {
+	return &unlockLogInTransport{}
+}
+
+func encodeTransactionDetail(w http.ResponseWriter, response models.TransactionDetail) (err error) {
+	byteResp, err := json.Marshal(response)
+	if err != nil {
+		err = tools.NewErrorMessage(err, "Error while marshal Transaction response",
+			http.StatusInternalServerError)
+		return
+	}
+
+	if _, err = w.Write(byteResp); err != nil {
+		err = tools.NewErrorMessage(err,
+			"Error while writing response to response writer in Transaction method",
+			http.StatusInternalServerError)
+	}
+	return
+}
+
+// parseQueryTime accepts RFC 3339 time or a date, the empty value means no time
+func parseQueryTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		if t, err = time.Parse(queryDateLayout, value); err != nil {
+			return nil, err
+		}
+	}
+	return &t, nil
+}
+
+// parseQueryDecimal the empty value means no value
+func parseQueryDecimal(value string) (*decimal.Decimal, error) {
+	if value == "" {
+		return nil, nil
+	}
+	d, err := decimal.NewFromString(value)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
 }
@@ -0,0 +1,192 @@
+package httpserver
+
+import (
+	"context"
+	"github.com/crypto_app/pkg/models"
+	"github.com/crypto_app/tools"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetTransactionsDecodeRequest(t *testing.T) {
+	transport := NewGetTransactionsTransport()
+
+	r := httptest.NewRequest(http.MethodGet, "/crypto/transaction/list?limit=20&cursor=abc&currency=BTC"+
+		"&address=123&direction=incoming&success=false&date_from=2021-09-01&date_to=2021-09-02T10:00:00Z"+
+		"&min_amount=1.5&max_amount=10", nil)
+	input, err := transport.DecodeRequest(context.Background(), r)
+	require.NoError(t, err)
+	require.Equal(t, 20, input.Limit)
+	require.Equal(t, "abc", input.Cursor)
+	require.Equal(t, "BTC", input.Currency)
+	require.Equal(t, "123", input.Address)
+	require.Equal(t, "incoming", input.Direction)
+	require.False(t, *input.Success)
+	require.Equal(t, "2021-09-01T00:00:00Z", input.DateFrom.Format("2006-01-02T15:04:05Z07:00"))
+	require.Equal(t, "2021-09-02T10:00:00Z", input.DateTo.Format("2006-01-02T15:04:05Z07:00"))
+	require.Equal(t, "1.5", input.MinAmount.String())
+	require.Equal(t, "10", input.MaxAmount.String())
+
+	// per_page is still the limit
+	r = httptest.NewRequest(http.MethodGet, "/crypto/transaction/list?per_page=5", nil)
+	input, err = transport.DecodeRequest(context.Background(), r)
+	require.NoError(t, err)
+	require.Equal(t, 5, input.Limit)
+	require.Nil(t, input.Success)
+	require.Nil(t, input.DateFrom)
+	require.Nil(t, input.MinAmount)
+}
+
+func TestGetTransactionsDecodeRequestErrors(t *testing.T) {
+	transport := NewGetTransactionsTransport()
+
+	for _, query := range []string{
+		"limit=ten",
+		"per_page=ten",
+		"date_from=yesterday",
+		"date_to=2021-13-01",
+		"success=maybe",
+		"min_amount=one",
+		"max_amount=1,5",
+		// the old clients paging by the number would get the first page over and over
+		"page_num=2&per_page=5",
+		"page_num=",
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/crypto/transaction/list?"+query, nil)
+		_, err := transport.DecodeRequest(context.Background(), r)
+		require.Error(t, err, query)
+		require.Equal(t, http.StatusBadRequest, err.(tools.ErrorMessage).GetCode(), query)
+	}
+}
+
+func TestTransactionDetailDecodeRequest(t *testing.T) {
+	transport := NewTransactionDetailTransport()
+
+	for _, c := range []struct {
+		id       string
+		expected string
+		isErr    bool
+	}{
+		{"6ba7b810-9dad-11d1-80b4-00c04fd430c8", "6ba7b810-9dad-11d1-80b4-00c04fd430c8", false},
+		// the id is normalized, so the lookup does not depend on the case
+		{"6BA7B810-9DAD-11D1-80B4-00C04FD430C8", "6ba7b810-9dad-11d1-80b4-00c04fd430c8", false},
+		{"42", "", true},
+		{"", "", true},
+	} {
+		r := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/crypto/transaction/"+c.id, nil),
+			map[string]string{"id": c.id})
+		id, err := transport.DecodeRequest(context.Background(), r)
+		if c.isErr {
+			require.Error(t, err, c.id)
+			require.Equal(t, http.StatusBadRequest, err.(tools.ErrorMessage).GetCode(), c.id)
+			continue
+		}
+		require.NoError(t, err, c.id)
+		require.Equal(t, c.expected, id)
+	}
+}
+
+func TestGetCandlesDecodeRequest(t *testing.T) {
+	transport := NewGetCandlesTransport()
+	from := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, c := range []struct {
+		query string
+		from  *time.Time
+		isErr bool
+	}{
+		{"interval=1h", nil, false},
+		{"interval=1h&from=2021-06-01T12:00:00Z", &from, false},
+		{"interval=1h&from=yesterday", nil, true},
+		{"interval=1h&to=noon", nil, true},
+	} {
+		r := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/crypto/rates/btc/candles?"+c.query, nil),
+			map[string]string{"currency": "btc"})
+		input, err := transport.DecodeRequest(context.Background(), r)
+		if c.isErr {
+			require.Error(t, err, c.query)
+			require.Equal(t, http.StatusBadRequest, err.(tools.ErrorMessage).GetCode(), c.query)
+			continue
+		}
+		require.NoError(t, err, c.query)
+		require.Equal(t, "btc", input.Currency, c.query)
+		require.Equal(t, "1h", input.Interval, c.query)
+		require.Equal(t, c.from, input.From, c.query)
+	}
+}
+
+func TestTransactionDecodeRequest(t *testing.T) {
+	transport := NewTransactionTransport()
+
+	for _, c := range []struct {
+		body string
+		from models.WalletRef
+		to   models.WalletRef
+	}{
+		// the internal ids of the old clients
+		{`{"from_address": 1, "to_address": 2, "amount": "10"}`, models.WalletRef{ID: 1}, models.WalletRef{ID: 2}},
+		{`{"from_address": "12345", "to_address": "54321", "amount": "10"}`, models.WalletRef{Address: "12345"},
+			models.WalletRef{Address: "54321"}},
+		{`{"from_address": 1, "to_address": null, "recipient": "54321", "amount": "10"}`, models.WalletRef{ID: 1},
+			models.WalletRef{}},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/crypto/transaction", strings.NewReader(c.body))
+		r.Header.Set("Idempotency-Key", "key")
+		input, err := transport.DecodeRequest(context.Background(), r)
+		require.NoError(t, err, c.body)
+		require.Equal(t, c.from, input.FromAddress, c.body)
+		require.Equal(t, c.to, input.ToAddress, c.body)
+		require.Equal(t, "key", input.IdempotencyKey, c.body)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/crypto/transaction", strings.NewReader(`{"from_address": true}`))
+	_, err := transport.DecodeRequest(context.Background(), r)
+	require.Error(t, err)
+}
+
+func TestTransactionEncodeResponse(t *testing.T) {
+	transport := NewTransactionTransport()
+
+	for _, c := range []struct {
+		name     string
+		response models.TransactionDetail
+		status   int
+		contains string
+	}{
+		{"success", models.TransactionDetail{ID: "tx", Success: true}, http.StatusOK, `"success":true`},
+		// the recorded failure keeps the body of the transfer
+		{"failure", models.TransactionDetail{ID: "tx", FailureReason: "insufficient funds"},
+			http.StatusUnprocessableEntity, `"failure_reason":"insufficient funds"`},
+	} {
+		w := httptest.NewRecorder()
+		require.NoError(t, transport.EncodeResponse(context.Background(), w, c.response), c.name)
+		require.Equal(t, c.status, w.Code, c.name)
+		require.Contains(t, w.Body.String(), `"id":"tx"`, c.name)
+		require.Contains(t, w.Body.String(), c.contains, c.name)
+	}
+}
+
+func TestUpdateMeDecodeRequest(t *testing.T) {
+	transport := NewUpdateMeTransport()
+
+	// the absent fields are kept, the id comes from the token only
+	r := httptest.NewRequest(http.MethodPatch, "/crypto/me",
+		strings.NewReader(`{"id": 7, "name": "Ivan", "dob": "", "address": null}`))
+	input, err := transport.DecodeRequest(context.Background(), r)
+	require.NoError(t, err)
+	require.Zero(t, input.ID)
+	require.Equal(t, "Ivan", *input.Name)
+	require.Equal(t, "", *input.DOB)
+	require.Nil(t, input.LastName)
+	require.Nil(t, input.Address)
+	require.Nil(t, input.Description)
+
+	r = httptest.NewRequest(http.MethodPatch, "/crypto/me", strings.NewReader(`{"name": 1}`))
+	_, err = transport.DecodeRequest(context.Background(), r)
+	require.Error(t, err)
+}
@@ -2,28 +2,79 @@ package service
 
 import (
 	"context"
-	"errors"
 	"github.com/crypto_app/pkg/models"
-	"github.com/crypto_app/tools"
-	"net/http"
 )
 
 type crypto interface {
 	Alive(ctx context.Context) (output models.AliveResponse, err error)
 	Sign(ctx context.Context, input *models.RegisterRequest) (output models.RegisterResponse, err error)
 	LogIn(ctx context.Context, input *models.LogInRequest) (output models.RegisterResponse, err error)
+	LogInMFA(ctx context.Context, input models.LogInMFARequest) (output models.RegisterResponse, err error)
+	RefreshToken(ctx context.Context, input *models.RefreshTokenRequest) (output models.RegisterResponse, err error)
+	LogOut(ctx context.Context) (err error)
+	RevokeAllSessions(ctx context.Context) (err error)
+	GetMe(ctx context.Context) (output models.SingleUserData, err error)
+	UpdateMe(ctx context.Context, input models.UpdateUserData) (output models.SingleUserData, err error)
+	ForgotPassword(ctx context.Context, input models.ForgotPasswordRequest) (err error)
+	ResetPassword(ctx context.Context, input models.ResetPasswordRequest) (err error)
+	VerifyEmail(ctx context.Context, input models.VerifyEmailRequest) (err error)
+	ResendVerificationEmail(ctx context.Context) (err error)
+	EnrollMFA(ctx context.Context) (output models.MFAEnrollResponse, err error)
+	ConfirmMFA(ctx context.Context, input models.MFACodeRequest) (output models.MFAConfirmResponse, err error)
+	DisableMFA(ctx context.Context, input models.MFACodeRequest) (err error)
+	GetJWKS(ctx context.Context) (output models.JWKSResponse, err error)
+	GetPoolStats(ctx context.Context) (output models.PoolStatsResponse, err error)
 	GetWallets(ctx context.Context) (output []*models.WalletsResponse, err error)
-	Transaction(ctx context.Context, input models.TransactionRequest) (success bool, err error)
-	GetTransactions(ctx context.Context, perPage int, pageNum int) (response models.GetTransactionResponse, err error)
+	OpenWallet(ctx context.Context, input models.OpenWalletRequest) (output models.WalletsResponse, err error)
+	ArchiveWallet(ctx context.Context, address string) (err error)
+	Transaction(ctx context.Context, input models.TransactionRequest) (output models.TransactionDetail, err error)
+	GetTransaction(ctx context.Context, transactionID string) (output models.TransactionDetail, err error)
+	GetTransactions(ctx context.Context, input models.GetTransactionsRequest) (response models.GetTransactionResponse, err error)
+	GetRates(ctx context.Context) (output []*models.RateResponse, err error)
+	GetCandles(ctx context.Context, input models.GetCandlesRequest) (output models.GetCandlesResponse, err error)
+	SetRateOverride(ctx context.Context, input models.RateOverrideRequest) (err error)
+	DeleteRateOverride(ctx context.Context, currency string) (err error)
+	GetCurrencies(ctx context.Context) (output []*models.CurrencyResponse, err error)
+	CreateCurrency(ctx context.Context, input models.CreateCurrencyRequest) (output models.CurrencyResponse, err error)
+	UpdateCurrency(ctx context.Context, input models.UpdateCurrencyRequest) (output models.CurrencyResponse, err error)
+	GetHouseAccounts(ctx context.Context) (output []*models.HouseAccountResponse, err error)
+	UnlockLogIn(ctx context.Context, input models.UnlockLogInRequest) (err error)
 }
 
 type Service interface {
 	Alive(ctx context.Context) (output models.AliveResponse, err error)
 	Sign(ctx context.Context, input *models.RegisterRequest) (output models.RegisterResponse, err error)
 	LogIn(ctx context.Context, input *models.LogInRequest) (output models.RegisterResponse, err error)
+	LogInMFA(ctx context.Context, input models.LogInMFARequest) (output models.RegisterResponse, err error)
+	RefreshToken(ctx context.Context, input *models.RefreshTokenRequest) (output models.RegisterResponse, err error)
+	LogOut(ctx context.Context) (err error)
+	RevokeAllSessions(ctx context.Context) (err error)
+	GetMe(ctx context.Context) (output models.SingleUserData, err error)
+	UpdateMe(ctx context.Context, input models.UpdateUserData) (output models.SingleUserData, err error)
+	ForgotPassword(ctx context.Context, input models.ForgotPasswordRequest) (err error)
+	ResetPassword(ctx context.Context, input models.ResetPasswordRequest) (err error)
+	VerifyEmail(ctx context.Context, input models.VerifyEmailRequest) (err error)
+	ResendVerificationEmail(ctx context.Context) (err error)
+	EnrollMFA(ctx context.Context) (output models.MFAEnrollResponse, err error)
+	ConfirmMFA(ctx context.Context, input models.MFACodeRequest) (output models.MFAConfirmResponse, err error)
+	DisableMFA(ctx context.Context, input models.MFACodeRequest) (err error)
+	GetJWKS(ctx context.Context) (output models.JWKSResponse, err error)
+	GetPoolStats(ctx context.Context) (output models.PoolStatsResponse, err error)
 	GetWallets(ctx context.Context) (output []*models.WalletsResponse, err error)
-	Transaction(ctx context.Context, input models.TransactionRequest) (err error)
-	GetTransactions(ctx context.Context, perPage int, pageNum int) (response models.GetTransactionResponse, err error)
+	OpenWallet(ctx context.Context, input models.OpenWalletRequest) (output models.WalletsResponse, err error)
+	ArchiveWallet(ctx context.Context, address string) (err error)
+	Transaction(ctx context.Context, input models.TransactionRequest) (output models.TransactionDetail, err error)
+	GetTransaction(ctx context.Context, transactionID string) (output models.TransactionDetail, err error)
+	GetTransactions(ctx context.Context, input models.GetTransactionsRequest) (response models.GetTransactionResponse, err error)
+	GetRates(ctx context.Context) (output []*models.RateResponse, err error)
+	GetCandles(ctx context.Context, input models.GetCandlesRequest) (output models.GetCandlesResponse, err error)
+	SetRateOverride(ctx context.Context, input models.RateOverrideRequest) (err error)
+	DeleteRateOverride(ctx context.Context, currency string) (err error)
+	GetCurrencies(ctx context.Context) (output []*models.CurrencyResponse, err error)
+	CreateCurrency(ctx context.Context, input models.CreateCurrencyRequest) (output models.CurrencyResponse, err error)
+	UpdateCurrency(ctx context.Context, input models.UpdateCurrencyRequest) (output models.CurrencyResponse, err error)
+	GetHouseAccounts(ctx context.Context) (output []*models.HouseAccountResponse, err error)
+	UnlockLogIn(ctx context.Context, input models.UnlockLogInRequest) (err error)
 }
 
 type service struct {
@@ -45,22 +96,153 @@ func (s *service) LogIn(ctx context.Context, input *models.LogInRequest) (output
 	return
 }
 
+func (s *service) LogInMFA(ctx context.Context, input models.LogInMFARequest) (output models.RegisterResponse, err error) {
+	output, err = s.crypto.LogInMFA(ctx, input)
+	return
+}
+
+func (s *service) RefreshToken(ctx context.Context, input *models.RefreshTokenRequest) (output models.RegisterResponse, err error) {
+	output, err = s.crypto.RefreshToken(ctx, input)
+	return
+}
+
+func (s *service) LogOut(ctx context.Context) (err error) {
+	err = s.crypto.LogOut(ctx)
+	return
+}
+
+func (s *service) RevokeAllSessions(ctx context.Context) (err error) {
+	err = s.crypto.RevokeAllSessions(ctx)
+	return
+}
+
+func (s *service) GetMe(ctx context.Context) (output models.SingleUserData, err error) {
+	output, err = s.crypto.GetMe(ctx)
+	return
+}
+
+func (s *service) UpdateMe(ctx context.Context, input models.UpdateUserData) (output models.SingleUserData, err error) {
+	output, err = s.crypto.UpdateMe(ctx, input)
+	return
+}
+
+func (s *service) ForgotPassword(ctx context.Context, input models.ForgotPasswordRequest) (err error) {
+	err = s.crypto.ForgotPassword(ctx, input)
+	return
+}
+
+func (s *service) ResetPassword(ctx context.Context, input models.ResetPasswordRequest) (err error) {
+	err = s.crypto.ResetPassword(ctx, input)
+	return
+}
+
+func (s *service) VerifyEmail(ctx context.Context, input models.VerifyEmailRequest) (err error) {
+	err = s.crypto.VerifyEmail(ctx, input)
+	return
+}
+
+func (s *service) ResendVerificationEmail(ctx context.Context) (err error) {
+	err = s.crypto.ResendVerificationEmail(ctx)
+	return
+}
+
+func (s *service) EnrollMFA(ctx context.Context) (output models.MFAEnrollResponse, err error) {
+	output, err = s.crypto.EnrollMFA(ctx)
+	return
+}
+
+func (s *service) ConfirmMFA(ctx context.Context, input models.MFACodeRequest) (output models.MFAConfirmResponse, err error) {
+	output, err = s.crypto.ConfirmMFA(ctx, input)
+	return
+}
+
+func (s *service) DisableMFA(ctx context.Context, input models.MFACodeRequest) (err error) {
+	err = s.crypto.DisableMFA(ctx, input)
+	return
+}
+
+func (s *service) GetJWKS(ctx context.Context) (output models.JWKSResponse, err error) {
+	output, err = s.crypto.GetJWKS(ctx)
+	return
+}
+
+func (s *service) GetPoolStats(ctx context.Context) (output models.PoolStatsResponse, err error) {
+	output, err = s.crypto.GetPoolStats(ctx)
+	return
+}
+
 func (s *service) GetWallets(ctx context.Context) (output []*models.WalletsResponse, err error) {
 	output, err = s.crypto.GetWallets(ctx)
 	return
 }
 
-func (s *service) Transaction(ctx context.Context, input models.TransactionRequest) (err error) {
-	success, err := s.crypto.Transaction(ctx, input)
-	if !success {
-		err = tools.NewErrorMessage(errors.New("this transaction was aborted"),
-			"Данная транзакция не завершилась успешно", http.StatusInternalServerError)
-	}
+func (s *service) OpenWallet(ctx context.Context, input models.OpenWalletRequest) (output models.WalletsResponse, err error) {
+	output, err = s.crypto.OpenWallet(ctx, input)
+	return
+}
+
+func (s *service) ArchiveWallet(ctx context.Context, address string) (err error) {
+	err = s.crypto.ArchiveWallet(ctx, address)
+	return
+}
+
+func (s *service) Transaction(ctx context.Context, input models.TransactionRequest) (output models.TransactionDetail, err error) {
+	output, err = s.crypto.Transaction(ctx, input)
+	return
+}
+
+func (s *service) GetTransaction(ctx context.Context, transactionID string) (output models.TransactionDetail, err error) {
+	output, err = s.crypto.GetTransaction(ctx, transactionID)
+	return
+}
+
+func (s *service) GetTransactions(ctx context.Context, input models.GetTransactionsRequest) (response models.GetTransactionResponse, err error) {
+	response, err = s.crypto.GetTransactions(ctx, input)
+	return
+}
+
+func (s *service) GetRates(ctx context.Context) (output []*models.RateResponse, err error) {
+	output, err = s.crypto.GetRates(ctx)
+	return
+}
+
+func (s *service) GetCandles(ctx context.Context, input models.GetCandlesRequest) (output models.GetCandlesResponse, err error) {
+	output, err = s.crypto.GetCandles(ctx, input)
+	return
+}
+
+func (s *service) SetRateOverride(ctx context.Context, input models.RateOverrideRequest) (err error) {
+	err = s.crypto.SetRateOverride(ctx, input)
+	return
+}
+
+func (s *service) DeleteRateOverride(ctx context.Context, currency string) (err error) {
+	err = s.crypto.DeleteRateOverride(ctx, currency)
+	return
+}
+
+func (s *service) GetCurrencies(ctx context.Context) (output []*models.CurrencyResponse, err error) {
+	output, err = s.crypto.GetCurrencies(ctx)
+	return
+}
+
+func (s *service) CreateCurrency(ctx context.Context, input models.CreateCurrencyRequest) (output models.CurrencyResponse, err error) {
+	output, err = s.crypto.CreateCurrency(ctx, input)
+	return
+}
+
+func (s *service) UpdateCurrency(ctx context.Context, input models.UpdateCurrencyRequest) (output models.CurrencyResponse, err error) {
+	output, err = s.crypto.UpdateCurrency(ctx, input)
+	return
+}
+
+func (s *service) GetHouseAccounts(ctx context.Context) (output []*models.HouseAccountResponse, err error) {
+	output, err = s.crypto.GetHouseAccounts(ctx)
 	return
 }
 
-func (s *service) GetTransactions(ctx context.Context, perPage int, pageNum int) (response models.GetTransactionResponse, err error) {
-	response, err = s.crypto.GetTransactions(ctx, perPage, pageNum)
+func (s *service) UnlockLogIn(ctx context.Context, input models.UnlockLogInRequest) (err error) {
+	err = s.crypto.UnlockLogIn(ctx, input)
 	return
 }
 
@@ -3,19 +3,97 @@ package db
 import (
 	"context"
 	"github.com/jackc/pgx"
+	"log"
+	"time"
 )
 
-func NewDbConnector(ctx context.Context, login, pass, host, name string, port uint16) (*pgx.Conn, error) {
-	conn, err := pgx.Connect(pgx.ConnConfig{
-		Host:     host,
-		Port:     port,
-		Database: name,
-		Password: pass,
-		User:     login,
+// Config settings of the connection pool
+type Config struct {
+	Login, Pass, Host, Name string
+	Port                    uint16
+	// MaxConnections max simultaneous connections, pgx requires at least 2
+	MaxConnections int
+	// AcquireTimeout max wait for a free connection when all of them are busy, 0 means no timeout
+	AcquireTimeout time.Duration
+	// HealthCheckPeriod how often idle connections are pinged, broken ones are dropped from the pool
+	HealthCheckPeriod time.Duration
+	// CachedStatements are prepared on every new connection under the name equal to the sql itself,
+	// so pgx uses the prepared statement whenever the same sql is queried
+	CachedStatements []string
+}
+
+// NewDbConnector creates the connection pool, the health checks run until ctx is done
+func NewDbConnector(ctx context.Context, config Config) (*pgx.ConnPool, error) {
+	pool, err := pgx.NewConnPool(pgx.ConnPoolConfig{
+		ConnConfig: pgx.ConnConfig{
+			Host:     config.Host,
+			Port:     config.Port,
+			Database: config.Name,
+			Password: config.Pass,
+			User:     config.Login,
+		},
+		MaxConnections: config.MaxConnections,
+		AcquireTimeout: config.AcquireTimeout,
+		AfterConnect: func(conn *pgx.Conn) error {
+			for _, sql := range config.CachedStatements {
+				if _, err := conn.Prepare(sql, sql); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	return conn, nil
+	if config.HealthCheckPeriod > 0 {
+		go runHealthChecks(ctx, pool, config.HealthCheckPeriod)
+	}
+
+	return pool, nil
+}
+
+func runHealthChecks(ctx context.Context, pool *pgx.ConnPool, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			checkIdleConnections(ctx, pool, period)
+		}
+	}
+}
+
+// checkIdleConnections pings every idle connection, the pool drops the closed ones on release.
+// The connections are held until all of them are checked, otherwise the same one would be acquired again.
+func checkIdleConnections(ctx context.Context, pool *pgx.ConnPool, timeout time.Duration) {
+	var conns []*pgx.Conn
+	defer func() {
+		for _, conn := range conns {
+			pool.Release(conn)
+		}
+	}()
+
+	idle := pool.Stat().AvailableConnections
+	for i := 0; i < idle; i++ {
+		acquireCtx, cancel := context.WithTimeout(ctx, time.Millisecond)
+		conn, err := pool.AcquireEx(acquireCtx)
+		cancel()
+		if err != nil {
+			// the rest of connections were taken by requests, so they are obviously in use
+			return
+		}
+		conns = append(conns, conn)
+
+		pingCtx, cancel := context.WithTimeout(ctx, timeout)
+		if err = conn.Ping(pingCtx); err != nil {
+			log.Printf("db health check failed, dropping the connection: %v", err)
+			_ = conn.Close()
+		}
+		cancel()
+	}
 }
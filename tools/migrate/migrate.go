@@ -0,0 +1,356 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// lockID key of the advisory lock, so two replicas never migrate the same database at once
+const lockID = int64(0x63727970746f)
+
+var fileRegex = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration a single version of the schema
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status of the migration in the database
+type Status struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+// Migrator applies the migrations, every migration runs in its own transaction together
+// with the update of schema_migrations, so a failed migration leaves no trace
+type Migrator struct {
+	db         *pgx.ConnPool
+	migrations []Migration
+}
+
+// Up applies the pending migrations, steps limits their number, 0 applies all of them
+func (m *Migrator) Up(ctx context.Context, steps int) (applied []Migration, err error) {
+	const (
+		queryToSaveVersion = `insert into schema_migrations (version, name) values ($1, $2);`
+	)
+
+	err = m.withLock(ctx, func(conn *pgx.Conn, versions map[int64]time.Time) error {
+		for _, migration := range m.migrations {
+			if _, ok := versions[migration.Version]; ok {
+				continue
+			}
+			if steps > 0 && len(applied) == steps {
+				break
+			}
+
+			log.Printf("applying migration %d_%s", migration.Version, migration.Name)
+			if err := runInTx(ctx, conn, migration.Up, queryToSaveVersion, migration.Version, migration.Name); err != nil {
+				return fmt.Errorf("migration %d_%s: %v", migration.Version, migration.Name, err)
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return
+}
+
+// Down rolls back the given number of the latest applied migrations
+func (m *Migrator) Down(ctx context.Context, steps int) (rolledBack []Migration, err error) {
+	const (
+		queryToDeleteVersion = `delete from schema_migrations where version = $1;`
+	)
+
+	err = m.withLock(ctx, func(conn *pgx.Conn, versions map[int64]time.Time) error {
+		for i := len(m.migrations) - 1; i >= 0 && len(rolledBack) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := versions[migration.Version]; !ok {
+				continue
+			}
+
+			log.Printf("rolling back migration %d_%s", migration.Version, migration.Name)
+			if err := runInTx(ctx, conn, migration.Down, queryToDeleteVersion, migration.Version); err != nil {
+				return fmt.Errorf("migration %d_%s: %v", migration.Version, migration.Name, err)
+			}
+			rolledBack = append(rolledBack, migration)
+		}
+		return nil
+	})
+	return
+}
+
+// Status lists every known migration and whether it is applied
+func (m *Migrator) Status(ctx context.Context) (statuses []Status, err error) {
+	err = m.withLock(ctx, func(conn *pgx.Conn, versions map[int64]time.Time) error {
+		for _, migration := range m.migrations {
+			status := Status{
+				Version: migration.Version,
+				Name:    migration.Name,
+			}
+			if appliedAt, ok := versions[migration.Version]; ok {
+				status.Applied = true
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return
+}
+
+// Force marks the migrations up to the version as applied and the later ones as not applied without
+// running any sql. It is meant for the databases created before the migrations were tracked
+// and for the recovery after a migration was fixed by hand.
+func (m *Migrator) Force(ctx context.Context, version int64) (err error) {
+	const (
+		queryToDeleteLater = `delete from schema_migrations where version > $1;`
+		queryToSaveVersion = `insert into schema_migrations (version, name) values ($1, $2) on conflict do nothing;`
+	)
+
+	if version != 0 && m.find(version) == nil {
+		return fmt.Errorf("unknown version %d", version)
+	}
+
+	return m.withLock(ctx, func(conn *pgx.Conn, versions map[int64]time.Time) error {
+		tx, err := conn.Begin()
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = tx.Rollback()
+		}()
+
+		if _, err = tx.ExecEx(ctx, queryToDeleteLater, nil, version); err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if migration.Version > version {
+				break
+			}
+			if _, err = tx.ExecEx(ctx, queryToSaveVersion, nil, migration.Version, migration.Name); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+}
+
+// Check returns the error when some of the migrations are not applied yet, the server is not meant to run
+// on the older schema. The table of the versions is not created here and no lock is taken, so the check
+// does not wait for the migration run by another replica.
+func (m *Migrator) Check(ctx context.Context) (err error) {
+	const (
+		queryToTableExists = `select to_regclass('schema_migrations') is not null;`
+		queryToVersions    = `select version, applied_at from schema_migrations;`
+	)
+
+	var exists bool
+	if err = m.db.QueryRowEx(ctx, queryToTableExists, nil).Scan(&exists); err != nil {
+		return
+	}
+
+	versions := make(map[int64]time.Time)
+	if exists {
+		rows, err := m.db.QueryEx(ctx, queryToVersions, nil)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var (
+				version   int64
+				appliedAt time.Time
+			)
+			if err = rows.Scan(&version, &appliedAt); err != nil {
+				rows.Close()
+				return err
+			}
+			versions[version] = appliedAt
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	if pending := pendingMigrations(m.migrations, versions); len(pending) > 0 {
+		last := pending[len(pending)-1]
+		return fmt.Errorf("the database schema is out of date, %d migrations are pending up to %d_%s, run `migrate up`",
+			len(pending), last.Version, last.Name)
+	}
+	return nil
+}
+
+// pendingMigrations the migrations which are not in the applied versions
+func pendingMigrations(migrations []Migration, versions map[int64]time.Time) (pending []Migration) {
+	for _, migration := range migrations {
+		if _, ok := versions[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+	return
+}
+
+func (m *Migrator) find(version int64) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
+	}
+	return nil
+}
+
+// withLock runs fn on a single connection holding the advisory lock, the applied versions are read
+// after the lock is taken, so they are not changed by another replica meanwhile
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *pgx.Conn, versions map[int64]time.Time) error) (err error) {
+	const (
+		queryToCreateTable = `create table if not exists schema_migrations
+		(
+			version bigint not null
+				constraint schema_migrations_pk
+					primary key,
+			name varchar(256) not null,
+			applied_at timestamptz default current_timestamp not null
+		);`
+		queryToLock     = `select pg_advisory_lock($1);`
+		queryToUnlock   = `select pg_advisory_unlock($1);`
+		queryToVersions = `select version, applied_at from schema_migrations;`
+	)
+
+	conn, err := m.db.Acquire()
+	if err != nil {
+		return
+	}
+	defer m.db.Release(conn)
+
+	if _, err = conn.ExecEx(ctx, queryToLock, nil, lockID); err != nil {
+		return
+	}
+	defer func() {
+		if _, er := conn.ExecEx(context.Background(), queryToUnlock, nil, lockID); er != nil {
+			log.Printf("error while releasing the migration lock: %v", er)
+		}
+	}()
+
+	if _, err = conn.ExecEx(ctx, queryToCreateTable, nil); err != nil {
+		return
+	}
+
+	rows, err := conn.QueryEx(ctx, queryToVersions, nil)
+	if err != nil {
+		return
+	}
+	versions := make(map[int64]time.Time)
+	for rows.Next() {
+		var (
+			version   int64
+			appliedAt time.Time
+		)
+		if err = rows.Scan(&version, &appliedAt); err != nil {
+			rows.Close()
+			return
+		}
+		versions[version] = appliedAt
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	return fn(conn, versions)
+}
+
+func runInTx(ctx context.Context, conn *pgx.Conn, migrationSQL string, versionSQL string, args ...interface{}) (err error) {
+	tx, err := conn.Begin()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	if _, err = tx.ExecEx(ctx, migrationSQL, nil); err != nil {
+		return
+	}
+	_, err = tx.ExecEx(ctx, versionSQL, nil, args...)
+	return
+}
+
+// load reads the migrations from the source, every version must have both up and down files
+func load(source fs.FS) (migrations []Migration, err error) {
+	files, err := fs.Glob(source, "*.sql")
+	if err != nil {
+		return
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, file := range files {
+		match := fileRegex.FindStringSubmatch(file)
+		if match == nil {
+			return nil, fmt.Errorf("bad migration file name %s", file)
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		data, err := fs.ReadFile(source, file)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has different names %s and %s", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both up and down files", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return
+}
+
+// NewMigrator creates the migrator for the migrations found in the source
+func NewMigrator(db *pgx.ConnPool, source fs.FS) (*Migrator, error) {
+	migrations, err := load(source)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+	}, nil
+}
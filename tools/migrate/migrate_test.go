@@ -0,0 +1,105 @@
+package migrate
+
+import (
+	"context"
+	"github.com/crypto_app/migrations"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	file := func(content string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(content)}
+	}
+
+	for _, c := range []struct {
+		name     string
+		source   fstest.MapFS
+		versions []int64
+		isErr    bool
+	}{
+		{"sorted by version", fstest.MapFS{
+			"0010_later.up.sql":   file("create table later ();"),
+			"0010_later.down.sql": file("drop table later;"),
+			"0002_first.up.sql":   file("create table first ();"),
+			"0002_first.down.sql": file("drop table first;"),
+			"README.md":           file("not a migration"),
+		}, []int64{2, 10}, false},
+		{"empty", fstest.MapFS{}, nil, false},
+		{"bad file name", fstest.MapFS{
+			"first.up.sql": file("create table first ();"),
+		}, nil, true},
+		{"no down file", fstest.MapFS{
+			"0001_first.up.sql": file("create table first ();"),
+		}, nil, true},
+		{"empty down file", fstest.MapFS{
+			"0001_first.up.sql":   file("create table first ();"),
+			"0001_first.down.sql": file(""),
+		}, nil, true},
+		{"different names", fstest.MapFS{
+			"0001_first.up.sql":   file("create table first ();"),
+			"0001_other.down.sql": file("drop table first;"),
+		}, nil, true},
+	} {
+		loaded, err := load(c.source)
+		if c.isErr {
+			require.Error(t, err, c.name)
+			continue
+		}
+		require.NoError(t, err, c.name)
+
+		var versions []int64
+		for _, migration := range loaded {
+			versions = append(versions, migration.Version)
+		}
+		require.Equal(t, c.versions, versions, c.name)
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	loaded, err := load(migrations.FS)
+	require.NoError(t, err)
+	require.NotEmpty(t, loaded)
+
+	// the versions go one after another, a gap means a lost file
+	for i, migration := range loaded {
+		require.Equal(t, int64(i+1), migration.Version, migration.Name)
+		require.NotEmpty(t, migration.Up, migration.Name)
+		require.NotEmpty(t, migration.Down, migration.Name)
+	}
+}
+
+func TestForceUnknownVersion(t *testing.T) {
+	m, err := NewMigrator(nil, migrations.FS)
+	require.NoError(t, err)
+
+	// the version is checked before the database is touched
+	require.Error(t, m.Force(context.Background(), 9999))
+	require.NotNil(t, m.find(1))
+	require.Nil(t, m.find(9999))
+}
+
+func TestPendingMigrations(t *testing.T) {
+	known := []Migration{{Version: 1, Name: "init"}, {Version: 2, Name: "users"}, {Version: 3, Name: "wallets"}}
+	applied := time.Now()
+
+	for _, c := range []struct {
+		name     string
+		versions map[int64]time.Time
+		pending  []int64
+	}{
+		{"fresh database", map[int64]time.Time{}, []int64{1, 2, 3}},
+		{"partly migrated", map[int64]time.Time{1: applied, 2: applied}, []int64{3}},
+		{"gap in the middle", map[int64]time.Time{1: applied, 3: applied}, []int64{2}},
+		{"up to date", map[int64]time.Time{1: applied, 2: applied, 3: applied}, nil},
+		{"newer database", map[int64]time.Time{1: applied, 2: applied, 3: applied, 4: applied}, nil},
+	} {
+		var pending []int64
+		for _, migration := range pendingMigrations(known, c.versions) {
+			pending = append(pending, migration.Version)
+		}
+		require.Equal(t, c.pending, pending, c.name)
+	}
+}